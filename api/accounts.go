@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/YaleSpinup/efs-api/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// accountDefaults returns the configured defaults for an account number.  The per-account configuration
+// can be keyed by the account number or by any name that maps to it in the accountsMap.
+func (s *server) accountDefaults(account string) (common.Account, bool) {
+	conf := s.conf()
+
+	if a, ok := conf.accounts[account]; ok {
+		return a, true
+	}
+
+	for name, number := range conf.accountsMap {
+		if number != account {
+			continue
+		}
+
+		if a, ok := conf.accounts[name]; ok {
+			log.Debugf("using account configuration %s for account %s", name, account)
+			return a, true
+		}
+	}
+
+	return common.Account{}, false
+}
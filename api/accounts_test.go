@@ -0,0 +1,52 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/efs-api/common"
+)
+
+func TestAccountDefaults(t *testing.T) {
+	spinup := common.Account{
+		DefaultSubnets: []string{"subnet-1111", "subnet-2222"},
+		DefaultSgs:     []string{"sg-1111"},
+	}
+
+	spinupsec := common.Account{
+		DefaultKmsKeyId: "arn:aws:kms:us-east-1:0987654321:key/abcd",
+	}
+
+	s := server{}
+	s.config.Store(&dynamicConfig{
+		accounts: map[string]common.Account{
+			"spinup":     spinup,
+			"0987654321": spinupsec,
+		},
+		accountsMap: map[string]string{
+			"spinup":    "1234567890",
+			"spinupsec": "0987654321",
+		},
+	})
+
+	tests := []struct {
+		account string
+		expect  common.Account
+		ok      bool
+	}{
+		{account: "1234567890", expect: spinup, ok: true},
+		{account: "0987654321", expect: spinupsec, ok: true},
+		{account: "5555555555", expect: common.Account{}, ok: false},
+	}
+
+	for _, test := range tests {
+		out, ok := s.accountDefaults(test.account)
+		if ok != test.ok {
+			t.Errorf("expected ok to be %t for %s, got %t", test.ok, test.account, ok)
+		}
+
+		if !reflect.DeepEqual(test.expect, out) {
+			t.Errorf("expected defaults for %s to be %+v, got %+v", test.account, test.expect, out)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/audit"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const auditEventContextKey contextKey = "auditEvent"
+
+// maxAuditResponse is the maximum size of a response body kept to find the created resource id or error
+const maxAuditResponse = 64 * 1024
+
+// maxAuditRequest is the largest request body accepted by an audited request
+const maxAuditRequest = 1 << 20
+
+// auditResourceFields are the fields in a response body that identify a created resource
+var auditResourceFields = []string{"FileSystemId", "AccessPointId", "UserName"}
+
+// newAuditor creates an auditor with the configured sinks, or nil if no sinks are configured
+func newAuditor(config common.Audit) (*audit.Auditor, error) {
+	sinks := []audit.Sink{}
+
+	if config.File != "" {
+		sink, err := audit.NewFileSink(config.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if config.RedisAddress != "" {
+		opts := &redis.Options{
+			Addr:     config.RedisAddress,
+			Password: config.RedisPassword,
+		}
+
+		if config.RedisDatabase != "" {
+			db, err := strconv.Atoi(config.RedisDatabase)
+			if err != nil {
+				return nil, err
+			}
+			opts.DB = db
+		}
+
+		stream := config.RedisStream
+		if stream == "" {
+			stream = "efsapi:audit"
+		}
+
+		sinks = append(sinks, audit.NewRedisSink(redis.NewClient(opts), stream, config.RedisMaxLen))
+	}
+
+	if config.WebhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(config.WebhookURL, config.WebhookHeaders))
+	}
+
+	if len(sinks) == 0 {
+		log.Warn("no audit sinks are configured, mutating operations won't be audited")
+		return nil, nil
+	}
+
+	return audit.New(sinks), nil
+}
+
+// withAuditEvent returns a copy of the context carrying the audit event for the request
+func withAuditEvent(ctx context.Context, event *audit.Event) context.Context {
+	return context.WithValue(ctx, auditEventContextKey, event)
+}
+
+// auditEventFromContext returns the audit event carried in the context, or nil
+func auditEventFromContext(ctx context.Context) *audit.Event {
+	if event, ok := ctx.Value(auditEventContextKey).(*audit.Event); ok {
+		return event
+	}
+	return nil
+}
+
+// auditResponseWriter records the status and the beginning of the response body
+type auditResponseWriter struct {
+	http.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(p []byte) (int, error) {
+	if remaining := maxAuditResponse - w.body.Len(); remaining > 0 {
+		if len(p) > remaining {
+			w.body.Write(p[:remaining])
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// AuditMiddleware records an audit event for every mutating request with the caller, the account, group
+// and resource, the redacted request body, the flywheel task and the outcome
+func (s *server) AuditMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auditor == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxAuditRequest)); err != nil {
+				handleError(w, apierror.New(apierror.ErrBadRequest, "failed to read request body", err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		vars := mux.Vars(r)
+		event := &audit.Event{
+			Caller:     tokenName(r.Context()),
+			RequestID:  requestIDFromContext(r.Context()),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Account:    vars["account"],
+			Group:      vars["group"],
+			ResourceID: auditResourceID(vars),
+			Request:    audit.Redact(body),
+		}
+
+		if route := mux.CurrentRoute(r); route != nil {
+			event.Route, _ = route.GetPathTemplate()
+		}
+
+		aw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(aw, r.WithContext(withAuditEvent(r.Context(), event)))
+
+		// the event in the context is shared with any task started by the request, so record a copy
+		e := *event
+		e.Status = aw.status
+		e.TaskID = aw.Header().Get("X-Flywheel-Task")
+
+		switch {
+		case aw.status >= http.StatusBadRequest:
+			e.Outcome = audit.OutcomeFailure
+			e.Error = aw.body.String()
+		case e.TaskID != "":
+			e.Outcome = audit.OutcomeAccepted
+		default:
+			e.Outcome = audit.OutcomeSuccess
+		}
+
+		if e.ResourceID == "" {
+			e.ResourceID = auditResponseResourceID(aw.body.Bytes())
+		}
+
+		s.auditor.Record(&e)
+	})
+}
+
+// setAuditRequest replaces the request body recorded for the request, once the ValidationMiddleware has converted
+// it to JSON
+func setAuditRequest(ctx context.Context, body []byte) {
+	if event := auditEventFromContext(ctx); event != nil {
+		event.Request = audit.Redact(body)
+	}
+}
+
+// auditTaskOutcome records the final outcome of a task started by an audited request
+func (s *server) auditTaskOutcome(ctx context.Context, taskID, outcome string, err error) {
+	event := auditEventFromContext(ctx)
+	if s.auditor == nil || event == nil {
+		return
+	}
+
+	e := *event
+	e.TaskID = taskID
+	e.Outcome = outcome
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	s.auditor.Record(&e)
+}
+
+// auditResourceID returns the most specific resource id in the route variables
+func auditResourceID(vars map[string]string) string {
+	for _, v := range []string{"user", "apid", "id", "name"} {
+		if id, ok := vars[v]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// auditResponseResourceID returns the id of a created resource from the response body
+func auditResponseResourceID(body []byte) string {
+	resp := map[string]interface{}{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ""
+	}
+
+	for _, f := range auditResourceFields {
+		if id, ok := resp[f].(string); ok && id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
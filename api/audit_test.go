@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/YaleSpinup/efs-api/audit"
+	"github.com/gorilla/mux"
+)
+
+type testAuditSink struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (t *testAuditSink) Write(ctx context.Context, event *audit.Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+	return nil
+}
+
+func (t *testAuditSink) Close() error {
+	return nil
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	sink := &testAuditSink{}
+	s := server{auditor: audit.New([]audit.Sink{sink})}
+
+	var taskCtx context.Context
+	router := mux.NewRouter()
+	router.Use(s.AuditMiddleware)
+	router.HandleFunc("/v1/efs/{account}/filesystems/{group}", func(w http.ResponseWriter, r *http.Request) {
+		// the handler can still read the body
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "myfs") {
+			t.Errorf("expected handler to read the request body, got %s", string(body))
+		}
+
+		taskCtx = r.Context()
+		w.Header().Set("X-Flywheel-Task", "task-123")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"FileSystemId":"fs-123"}`))
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/v1/efs/{account}/filesystems/{group}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("filesystem not found"))
+	}).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/efs/{account}/filesystems/{group}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet)
+
+	token := &apiToken{name: "provisioner", scope: scopeWrite}
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/v1/efs/spinup/filesystems/space1", strings.NewReader(`{"Name":"myfs","Password":"hunter2"}`)),
+		httptest.NewRequest(http.MethodDelete, "/v1/efs/spinup/filesystems/space1/fs-456", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/efs/spinup/filesystems/space1/fs-456", nil),
+	}
+
+	for _, req := range requests {
+		router.ServeHTTP(httptest.NewRecorder(), req.WithContext(withToken(req.Context(), token)))
+	}
+
+	s.auditTaskOutcome(taskCtx, "task-123", audit.OutcomeFailed, errors.New("boom"))
+
+	if err := s.auditor.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected 3 audit events, got %d", len(sink.events))
+	}
+
+	create := sink.events[0]
+	if create.Caller != "provisioner" || create.Account != "spinup" || create.Group != "space1" {
+		t.Errorf("unexpected caller, account or group in create event %+v", create)
+	}
+
+	if create.Route != "/v1/efs/{account}/filesystems/{group}" || create.ResourceID != "fs-123" || create.TaskID != "task-123" {
+		t.Errorf("unexpected route, resource or task in create event %+v", create)
+	}
+
+	if create.Status != http.StatusAccepted || create.Outcome != audit.OutcomeAccepted {
+		t.Errorf("expected accepted outcome for create event, got %+v", create)
+	}
+
+	req := map[string]string{}
+	if err := json.Unmarshal(create.Request, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if req["Name"] != "myfs" || req["Password"] != audit.Redacted {
+		t.Errorf("expected redacted request body, got %+v", req)
+	}
+
+	del := sink.events[1]
+	if del.ResourceID != "fs-456" || del.Status != http.StatusNotFound || del.Outcome != audit.OutcomeFailure || del.Error != "filesystem not found" {
+		t.Errorf("unexpected delete event %+v", del)
+	}
+
+	final := sink.events[2]
+	if final.TaskID != "task-123" || final.Outcome != audit.OutcomeFailed || final.Error != "boom" || final.Caller != "provisioner" {
+		t.Errorf("unexpected task outcome event %+v", final)
+	}
+}
+
+func TestAuditMiddlewareRequestBody(t *testing.T) {
+	sink := &testAuditSink{}
+	s := server{auditor: audit.New([]audit.Sink{sink}), openAPI: newOpenAPIDocument("", apiOperations)}
+
+	handled := 0
+	router := mux.NewRouter()
+	api := router.PathPrefix("/v1/efs").Subrouter()
+	api.Use(s.AuditMiddleware)
+	api.Use(s.ValidationMiddleware)
+	api.HandleFunc("/{account}/filesystems/{group}/{name}/spec", func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodPut)
+
+	token := &apiToken{name: "provisioner", scope: scopeWrite}
+	request := func(contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/v1/efs/spinup/filesystems/space1/myfs/spec", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req.WithContext(withToken(req.Context(), token)))
+		return rr.Code
+	}
+
+	// yaml bodies are recorded once they're converted to json
+	if code := request("application/yaml", "BackupPolicy: ENABLED\nUsers:\n  - alice\n"); code != http.StatusOK {
+		t.Fatalf("expected status 200 for yaml spec, got %d", code)
+	}
+
+	// bodies larger than the limit are rejected before they're read into memory
+	if code := request("application/json", `{"Users":["`+strings.Repeat("a", maxAuditRequest)+`"]}`); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for oversized body, got %d", code)
+	}
+
+	if handled != 1 {
+		t.Errorf("expected only the yaml spec to be handled, got %d requests", handled)
+	}
+
+	if err := s.auditor.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(sink.events))
+	}
+
+	req := map[string]interface{}{}
+	if err := json.Unmarshal(sink.events[0].Request, &req); err != nil {
+		t.Fatalf("expected json request body in audit event, got %q: %s", string(sink.events[0].Request), err)
+	}
+
+	if req["BackupPolicy"] != "ENABLED" {
+		t.Errorf("expected the converted yaml body in the audit event, got %+v", req)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+)
+
+const (
+	// bytesPerGB is the number of bytes in a billed GB-month
+	bytesPerGB = 1 << 30
+
+	// baselineThroughputPerGB is the throughput (MB/s) included with each GB of standard storage, provisioned
+	// throughput is only billed above this baseline
+	baselineThroughputPerGB = 50.0 / 1024
+
+	// defaultElasticReadRatio and defaultElasticWriteRatio are the expected GB read and written in a month for
+	// each GB stored if they're not overridden in the pricing configuration
+	defaultElasticReadRatio  = 1.0
+	defaultElasticWriteRatio = 0.1
+)
+
+// lifecycleConfigurations is the list of valid transition to IA lifecycle configurations
+var lifecycleConfigurations = []string{
+	"NONE",
+	"AFTER_7_DAYS",
+	"AFTER_14_DAYS",
+	"AFTER_30_DAYS",
+	"AFTER_60_DAYS",
+	"AFTER_90_DAYS",
+}
+
+// defaultLifecycleIARatio is the expected fraction of data in IA for each lifecycle configuration if
+// it's not overridden in the pricing configuration
+var defaultLifecycleIARatio = map[string]float64{
+	"NONE":          0,
+	"AFTER_7_DAYS":  0.8,
+	"AFTER_14_DAYS": 0.75,
+	"AFTER_30_DAYS": 0.7,
+	"AFTER_60_DAYS": 0.65,
+	"AFTER_90_DAYS": 0.6,
+}
+
+// fileSystemCostFromEFS estimates the monthly cost of a filesystem from its current size breakdown, storage class and
+// throughput mode and calculates what the cost would be under each alternative lifecycle configuration
+func fileSystemCostFromEFS(fs *efs.FileSystemDescription, lifecycle, region string, pricing common.Pricing) *FileSystemCostResponse {
+	oneZone := fs.AvailabilityZoneName != nil
+
+	var standardBytes, iaBytes int64
+	if fs.SizeInBytes != nil {
+		standardBytes = aws.Int64Value(fs.SizeInBytes.ValueInStandard)
+		iaBytes = aws.Int64Value(fs.SizeInBytes.ValueInIA)
+	}
+
+	if lifecycle == "" {
+		lifecycle = "NONE"
+	}
+
+	storageClass := "Standard"
+	if oneZone {
+		storageClass = "OneZone"
+	}
+
+	throughputMode := aws.StringValue(fs.ThroughputMode)
+	provisioned := aws.Float64Value(fs.ProvisionedThroughputInMibps)
+
+	currency := pricing.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+
+	totalBytes := standardBytes + iaBytes
+
+	// elastic throughput is billed by the data read and written, which doesn't depend on the storage class
+	var elasticItems []*CostLineItem
+	if throughputMode == efs.ThroughputModeElastic {
+		elasticItems = elasticThroughputLineItems(pricing, totalBytes)
+	}
+
+	lineItems := storageLineItems(pricing, oneZone, standardBytes, iaBytes)
+	if throughputMode == efs.ThroughputModeProvisioned {
+		lineItems = append(lineItems, throughputLineItem(pricing, provisioned, standardBytes))
+	}
+	lineItems = append(lineItems, elasticItems...)
+	monthlyCost := sumLineItems(lineItems)
+
+	// estimate the cost for each alternative lifecycle configuration by redistributing the total
+	// size between standard and IA using the expected IA ratio for that configuration
+	alternatives := make([]*CostAlternative, 0, len(lifecycleConfigurations)+1)
+	current := false
+	for _, l := range lifecycleConfigurations {
+		if l == lifecycle {
+			current = true
+			alternatives = append(alternatives, &CostAlternative{
+				LifeCycleConfiguration: l,
+				Current:                true,
+				MonthlyCost:            monthlyCost,
+			})
+			continue
+		}
+
+		ratio := lifecycleIARatio(pricing, l)
+		altIA := int64(math.Round(float64(totalBytes) * ratio))
+		altStandard := totalBytes - altIA
+
+		altItems := storageLineItems(pricing, oneZone, altStandard, altIA)
+		if throughputMode == efs.ThroughputModeProvisioned {
+			altItems = append(altItems, throughputLineItem(pricing, provisioned, altStandard))
+		}
+		altItems = append(altItems, elasticItems...)
+		altCost := sumLineItems(altItems)
+
+		alternatives = append(alternatives, &CostAlternative{
+			LifeCycleConfiguration: l,
+			MonthlyCost:            altCost,
+			Savings:                roundCents(monthlyCost - altCost),
+		})
+	}
+
+	// lifecycle configurations without an expected IA ratio are only listed as the current configuration
+	if !current {
+		alternatives = append(alternatives, &CostAlternative{
+			LifeCycleConfiguration: lifecycle,
+			Current:                true,
+			MonthlyCost:            monthlyCost,
+		})
+	}
+
+	return &FileSystemCostResponse{
+		Alternatives:           alternatives,
+		Currency:               currency,
+		FileSystemId:           aws.StringValue(fs.FileSystemId),
+		LifeCycleConfiguration: lifecycle,
+		LineItems:              lineItems,
+		MonthlyCost:            monthlyCost,
+		Name:                   aws.StringValue(fs.Name),
+		Region:                 region,
+		StorageClass:           storageClass,
+		ThroughputMode:         throughputMode,
+	}
+}
+
+// storageLineItems returns the primary and infrequent access storage line items for the given storage class
+func storageLineItems(pricing common.Pricing, oneZone bool, standardBytes, iaBytes int64) []*CostLineItem {
+	primaryName, primaryRate := "Standard storage", pricing.Standard
+	iaName, iaRate := "Standard-Infrequent Access storage", pricing.StandardIA
+	if oneZone {
+		primaryName, primaryRate = "One Zone storage", pricing.OneZone
+		iaName, iaRate = "One Zone-Infrequent Access storage", pricing.OneZoneIA
+	}
+
+	return []*CostLineItem{
+		newCostLineItem(primaryName, "GB-Mo", float64(standardBytes)/bytesPerGB, primaryRate),
+		newCostLineItem(iaName, "GB-Mo", float64(iaBytes)/bytesPerGB, iaRate),
+	}
+}
+
+// throughputLineItem returns the line item for provisioned throughput above the baseline included with standard storage
+func throughputLineItem(pricing common.Pricing, provisioned float64, standardBytes int64) *CostLineItem {
+	billable := provisioned - (float64(standardBytes)/bytesPerGB)*baselineThroughputPerGB
+	if billable < 0 {
+		billable = 0
+	}
+
+	desc := fmt.Sprintf("Provisioned throughput (%.1f MB/s)", provisioned)
+	return newCostLineItem(desc, "MBps-Mo", billable, pricing.ProvisionedThroughput)
+}
+
+// elasticThroughputLineItems returns the line items for the data read and written with elastic throughput, estimated
+// from the total size with the expected read and write ratios
+func elasticThroughputLineItems(pricing common.Pricing, totalBytes int64) []*CostLineItem {
+	readRatio, writeRatio := defaultElasticReadRatio, defaultElasticWriteRatio
+	if pricing.ElasticReadRatio != nil {
+		readRatio = *pricing.ElasticReadRatio
+	}
+
+	if pricing.ElasticWriteRatio != nil {
+		writeRatio = *pricing.ElasticWriteRatio
+	}
+
+	totalGB := float64(totalBytes) / bytesPerGB
+	return []*CostLineItem{
+		newCostLineItem("Elastic throughput reads", "GB", totalGB*readRatio, pricing.ElasticRead),
+		newCostLineItem("Elastic throughput writes", "GB", totalGB*writeRatio, pricing.ElasticWrite),
+	}
+}
+
+func newCostLineItem(desc, unit string, quantity, rate float64) *CostLineItem {
+	return &CostLineItem{
+		Cost:        roundCents(quantity * rate),
+		Description: desc,
+		Quantity:    math.Round(quantity*1000) / 1000,
+		Rate:        rate,
+		Unit:        unit,
+	}
+}
+
+// lifecycleIARatio returns the expected IA ratio for a lifecycle configuration from the pricing configuration,
+// falling back to the default
+func lifecycleIARatio(pricing common.Pricing, lifecycle string) float64 {
+	if r, ok := pricing.LifecycleIARatio[lifecycle]; ok {
+		return r
+	}
+	return defaultLifecycleIARatio[lifecycle]
+}
+
+func sumLineItems(items []*CostLineItem) float64 {
+	var total float64
+	for _, i := range items {
+		total += i.Cost
+	}
+	return roundCents(total)
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
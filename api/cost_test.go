@@ -0,0 +1,176 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/efs"
+)
+
+var testPricing = common.Pricing{
+	Currency:              "USD",
+	Standard:              0.30,
+	StandardIA:            0.025,
+	OneZone:               0.16,
+	OneZoneIA:             0.0133,
+	ProvisionedThroughput: 6.00,
+}
+
+func TestFileSystemCostFromEFS(t *testing.T) {
+	fs := &efs.FileSystemDescription{
+		FileSystemId: aws.String("fs-01234567"),
+		Name:         aws.String("superfs"),
+		SizeInBytes: &efs.FileSystemSize{
+			Value:           aws.Int64(20 * bytesPerGB),
+			ValueInIA:       aws.Int64(10 * bytesPerGB),
+			ValueInStandard: aws.Int64(10 * bytesPerGB),
+		},
+		ThroughputMode: aws.String("bursting"),
+	}
+
+	expected := &FileSystemCostResponse{
+		Alternatives: []*CostAlternative{
+			{LifeCycleConfiguration: "NONE", MonthlyCost: 6.00, Savings: -2.75},
+			{LifeCycleConfiguration: "AFTER_7_DAYS", MonthlyCost: 1.60, Savings: 1.65},
+			{LifeCycleConfiguration: "AFTER_14_DAYS", MonthlyCost: 1.88, Savings: 1.37},
+			{LifeCycleConfiguration: "AFTER_30_DAYS", Current: true, MonthlyCost: 3.25},
+			{LifeCycleConfiguration: "AFTER_60_DAYS", MonthlyCost: 2.43, Savings: 0.82},
+			{LifeCycleConfiguration: "AFTER_90_DAYS", MonthlyCost: 2.70, Savings: 0.55},
+		},
+		Currency:               "USD",
+		FileSystemId:           "fs-01234567",
+		LifeCycleConfiguration: "AFTER_30_DAYS",
+		LineItems: []*CostLineItem{
+			{Cost: 3.00, Description: "Standard storage", Quantity: 10, Rate: 0.30, Unit: "GB-Mo"},
+			{Cost: 0.25, Description: "Standard-Infrequent Access storage", Quantity: 10, Rate: 0.025, Unit: "GB-Mo"},
+		},
+		MonthlyCost:    3.25,
+		Name:           "superfs",
+		Region:         "us-east-1",
+		StorageClass:   "Standard",
+		ThroughputMode: "bursting",
+	}
+
+	out := fileSystemCostFromEFS(fs, "AFTER_30_DAYS", "us-east-1", testPricing)
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("expected %s, got %s", awsutil.Prettify(expected), awsutil.Prettify(out))
+	}
+}
+
+func TestFileSystemCostFromEFSOneZoneProvisioned(t *testing.T) {
+	fs := &efs.FileSystemDescription{
+		AvailabilityZoneName: aws.String("us-east-1a"),
+		FileSystemId:         aws.String("fs-76543210"),
+		Name:                 aws.String("boringfs"),
+		SizeInBytes: &efs.FileSystemSize{
+			Value:           aws.Int64(100 * bytesPerGB),
+			ValueInStandard: aws.Int64(100 * bytesPerGB),
+		},
+		ThroughputMode:               aws.String("provisioned"),
+		ProvisionedThroughputInMibps: aws.Float64(10),
+	}
+
+	pricing := testPricing
+	pricing.LifecycleIARatio = map[string]float64{"AFTER_7_DAYS": 0.5}
+
+	out := fileSystemCostFromEFS(fs, "", "us-east-1", pricing)
+
+	if out.StorageClass != "OneZone" {
+		t.Errorf("expected storage class OneZone, got %s", out.StorageClass)
+	}
+
+	if out.LifeCycleConfiguration != "NONE" {
+		t.Errorf("expected lifecycle configuration NONE, got %s", out.LifeCycleConfiguration)
+	}
+
+	expectedItems := []*CostLineItem{
+		{Cost: 16.00, Description: "One Zone storage", Quantity: 100, Rate: 0.16, Unit: "GB-Mo"},
+		{Cost: 0, Description: "One Zone-Infrequent Access storage", Quantity: 0, Rate: 0.0133, Unit: "GB-Mo"},
+		{Cost: 30.70, Description: "Provisioned throughput (10.0 MB/s)", Quantity: 5.117, Rate: 6.00, Unit: "MBps-Mo"},
+	}
+
+	if !reflect.DeepEqual(expectedItems, out.LineItems) {
+		t.Errorf("expected %s, got %s", awsutil.Prettify(expectedItems), awsutil.Prettify(out.LineItems))
+	}
+
+	if out.MonthlyCost != 46.70 {
+		t.Errorf("expected monthly cost 46.70, got %f", out.MonthlyCost)
+	}
+
+	// 50GB in one zone, 50GB in one zone IA and 7.559 MB/s of billable throughput
+	for _, a := range out.Alternatives {
+		if a.LifeCycleConfiguration != "AFTER_7_DAYS" {
+			continue
+		}
+
+		if a.MonthlyCost != 54.01 {
+			t.Errorf("expected AFTER_7_DAYS monthly cost 54.01, got %f", a.MonthlyCost)
+		}
+	}
+}
+
+func TestFileSystemCostFromEFSElastic(t *testing.T) {
+	fs := &efs.FileSystemDescription{
+		FileSystemId: aws.String("fs-01234567"),
+		SizeInBytes: &efs.FileSystemSize{
+			Value:           aws.Int64(100 * bytesPerGB),
+			ValueInStandard: aws.Int64(100 * bytesPerGB),
+		},
+		ThroughputMode: aws.String("elastic"),
+	}
+
+	pricing := testPricing
+	pricing.ElasticRead = 0.03
+	pricing.ElasticWrite = 0.06
+	pricing.ElasticWriteRatio = aws.Float64(0.5)
+
+	out := fileSystemCostFromEFS(fs, "NONE", "us-east-1", pricing)
+
+	expectedItems := []*CostLineItem{
+		{Cost: 30.00, Description: "Standard storage", Quantity: 100, Rate: 0.30, Unit: "GB-Mo"},
+		{Cost: 0, Description: "Standard-Infrequent Access storage", Quantity: 0, Rate: 0.025, Unit: "GB-Mo"},
+		{Cost: 3.00, Description: "Elastic throughput reads", Quantity: 100, Rate: 0.03, Unit: "GB"},
+		{Cost: 3.00, Description: "Elastic throughput writes", Quantity: 50, Rate: 0.06, Unit: "GB"},
+	}
+
+	if !reflect.DeepEqual(expectedItems, out.LineItems) {
+		t.Errorf("expected %s, got %s", awsutil.Prettify(expectedItems), awsutil.Prettify(out.LineItems))
+	}
+
+	if out.MonthlyCost != 36.00 {
+		t.Errorf("expected monthly cost 36.00, got %f", out.MonthlyCost)
+	}
+
+	// the elastic throughput is the same for every lifecycle configuration, 20GB standard and 80GB IA
+	for _, a := range out.Alternatives {
+		if a.LifeCycleConfiguration == "AFTER_7_DAYS" && a.MonthlyCost != 14.00 {
+			t.Errorf("expected AFTER_7_DAYS monthly cost 14.00, got %f", a.MonthlyCost)
+		}
+	}
+}
+
+func TestFileSystemCostFromEFSOtherLifecycle(t *testing.T) {
+	fs := &efs.FileSystemDescription{
+		FileSystemId: aws.String("fs-01234567"),
+		SizeInBytes: &efs.FileSystemSize{
+			ValueInIA:       aws.Int64(10 * bytesPerGB),
+			ValueInStandard: aws.Int64(10 * bytesPerGB),
+		},
+		ThroughputMode: aws.String("bursting"),
+	}
+
+	out := fileSystemCostFromEFS(fs, "AFTER_180_DAYS", "us-east-1", testPricing)
+
+	if len(out.Alternatives) != len(lifecycleConfigurations)+1 {
+		t.Fatalf("expected %d alternatives, got %d", len(lifecycleConfigurations)+1, len(out.Alternatives))
+	}
+
+	current := out.Alternatives[len(out.Alternatives)-1]
+	expected := &CostAlternative{LifeCycleConfiguration: "AFTER_180_DAYS", Current: true, MonthlyCost: 3.25}
+	if !reflect.DeepEqual(expected, current) {
+		t.Errorf("expected current alternative %+v, got %+v", expected, current)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader is the header with the id of the request, echoed in error responses
+const requestIDHeader = "X-Request-Id"
+
+// errTokenNotAllowed is the error of requests whose token isn't allowed access to the account or group
+var errTokenNotAllowed = apierror.New(apierror.ErrForbidden, "token is not allowed access to the account or group", nil)
+
+// errFileSystemNotInSpace is the error of requests for a filesystem that isn't in the space (group)
+func errFileSystemNotInSpace(fs, group string) error {
+	return apierror.New(apierror.ErrNotFound, fmt.Sprintf("filesystem %s not found in space %s", fs, group), nil)
+}
+
+// errAccessPointNotInFileSystem is the error of requests for an access point that isn't in the filesystem
+func errAccessPointNotInFileSystem(apid, fs string) error {
+	return apierror.New(apierror.ErrNotFound, fmt.Sprintf("access point %s not found in filesystem %s", apid, fs), nil)
+}
+
+// fieldErrors are the validation errors of the fields of a request
+type fieldErrors []*FieldError
+
+func (f fieldErrors) Error() string {
+	msgs := make([]string, len(f))
+	for i, e := range f {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// newValidationError returns a bad request error with the validation errors of the fields of the request
+func newValidationError(fields ...*FieldError) error {
+	fe := fieldErrors(fields)
+	return apierror.New(apierror.ErrBadRequest, fe.Error(), fe)
+}
+
+// errorStatus returns the http status for the apierror code
+func errorStatus(code string) int {
+	switch code {
+	case apierror.ErrForbidden:
+		return http.StatusForbidden
+	case apierror.ErrNotFound:
+		return http.StatusNotFound
+	case apierror.ErrConflict:
+		return http.StatusConflict
+	case apierror.ErrBadRequest:
+		return http.StatusBadRequest
+	case apierror.ErrLimitExceeded:
+		return http.StatusTooManyRequests
+	case apierror.ErrServiceUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorResponse returns the http status and the response for the error.  Errors that aren't an apierror are
+// internal errors.
+func errorResponse(err error) (int, *ErrorResponse) {
+	aerr, ok := errors.Cause(err).(apierror.Error)
+	if !ok {
+		return http.StatusInternalServerError, &ErrorResponse{
+			Code:    apierror.ErrInternalError,
+			Message: err.Error(),
+		}
+	}
+
+	resp := &ErrorResponse{
+		Code:    aerr.Code,
+		Message: aerr.Message,
+	}
+
+	if fe, ok := errors.Cause(aerr.OrigErr).(fieldErrors); ok {
+		resp.FieldErrors = fe
+	}
+
+	resp.AWSErrorCode, resp.AWSRequestID = awsErrorDetails(aerr.OrigErr)
+
+	return errorStatus(aerr.Code), resp
+}
+
+// awsErrorDetails returns the code and the request id of the AWS error wrapped by the error, if there is one
+func awsErrorDetails(err error) (string, string) {
+	for err != nil {
+		switch e := errors.Cause(err).(type) {
+		case awserr.RequestFailure:
+			return e.Code(), e.RequestID()
+		case awserr.Error:
+			return e.Code(), ""
+		case apierror.Error:
+			err = e.OrigErr
+		default:
+			err = errors.Unwrap(e)
+		}
+	}
+	return "", ""
+}
+
+// writeError writes the JSON error response with the status
+func writeError(w http.ResponseWriter, status int, resp *ErrorResponse) {
+	resp.RequestID = w.Header().Get(requestIDHeader)
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf("cannot marshal error response (%v) into JSON: %s", resp, err)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(j)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestHandleError(t *testing.T) {
+	awsErr := awserr.NewRequestFailure(awserr.New("FileSystemNotFound", "not found", nil), http.StatusNotFound, "aws-request-1")
+
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		expected ErrorResponse
+	}{
+		{
+			name:     "plain error",
+			err:      errors.New("boom"),
+			status:   http.StatusInternalServerError,
+			expected: ErrorResponse{Code: apierror.ErrInternalError, Message: "boom", RequestID: "req-1"},
+		},
+		{
+			name:     "filesystem not in space",
+			err:      errFileSystemNotInSpace("fs-123", "space1"),
+			status:   http.StatusNotFound,
+			expected: ErrorResponse{Code: apierror.ErrNotFound, Message: "filesystem fs-123 not found in space space1", RequestID: "req-1"},
+		},
+		{
+			name:   "wrapped aws error",
+			err:    pkgerrors.Wrap(apierror.New(apierror.ErrNotFound, "failed to get filesystem", awsErr), "describe"),
+			status: http.StatusNotFound,
+			expected: ErrorResponse{
+				Code:         apierror.ErrNotFound,
+				Message:      "failed to get filesystem",
+				RequestID:    "req-1",
+				AWSErrorCode: "FileSystemNotFound",
+				AWSRequestID: "aws-request-1",
+			},
+		},
+		{
+			name:   "validation error",
+			err:    newValidationError(&FieldError{Field: "Name", Message: "Name is a required field"}, &FieldError{Field: "BackupPolicy", Message: "invalid backup policy"}),
+			status: http.StatusBadRequest,
+			expected: ErrorResponse{
+				Code:      apierror.ErrBadRequest,
+				Message:   "Name is a required field, invalid backup policy",
+				RequestID: "req-1",
+				FieldErrors: []*FieldError{
+					{Field: "Name", Message: "Name is a required field"},
+					{Field: "BackupPolicy", Message: "invalid backup policy"},
+				},
+			},
+		},
+		{
+			name:     "service unavailable",
+			err:      apierror.New(apierror.ErrServiceUnavailable, "try again", nil),
+			status:   http.StatusServiceUnavailable,
+			expected: ErrorResponse{Code: apierror.ErrServiceUnavailable, Message: "try again", RequestID: "req-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rr.Header().Set(requestIDHeader, "req-1")
+
+			handleError(rr, tt.err)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected json content type, got %s", ct)
+			}
+
+			got := ErrorResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal error response %s: %s", rr.Body.String(), err)
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
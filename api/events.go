@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// taskEventLog is the type of the events carrying an orchestration log message
+	taskEventLog = "log"
+
+	// taskEventStatus is the type of the events carrying the status of the task
+	taskEventStatus = "status"
+)
+
+// taskEvent is a log message or the final status of an asynchronous task, published while the task runs
+type taskEvent struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Failure string    `json:"failure,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// taskEvents publishes the events of tasks to the subscribers on every replica
+type taskEvents interface {
+	publish(ctx context.Context, id string, event *taskEvent) error
+	subscribe(ctx context.Context, id string) (<-chan *taskEvent, func() error, error)
+}
+
+// redisTaskEvents publishes the events of each task to the redis pub/sub channel <prefix>:<task id>
+type redisTaskEvents struct {
+	client *redis.Client
+	prefix string
+}
+
+// newTaskEvents creates a redis pub/sub task event bus under the flywheel namespace
+func newTaskEvents(client *redis.Client, namespace string) *redisTaskEvents {
+	return &redisTaskEvents{
+		client: client,
+		prefix: namespace + ":taskevents",
+	}
+}
+
+func (r *redisTaskEvents) channel(id string) string { return r.prefix + ":" + id }
+
+func (r *redisTaskEvents) publish(ctx context.Context, id string, event *taskEvent) error {
+	out, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, r.channel(id), out).Err()
+}
+
+// subscribe returns the events published for the task after the subscription is confirmed, and a function
+// to close the subscription
+func (r *redisTaskEvents) subscribe(ctx context.Context, id string) (<-chan *taskEvent, func() error, error) {
+	pubsub := r.client.Subscribe(ctx, r.channel(id))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, nil, err
+	}
+
+	events := make(chan *taskEvent)
+	go func() {
+		defer close(events)
+
+		for msg := range pubsub.Channel() {
+			event := &taskEvent{}
+			if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+				logger(ctx).Warnf("failed to unmarshal event for task %s: %s", id, err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, pubsub.Close, nil
+}
+
+// publishTaskEvent publishes the event for the task's subscribers.  Failing to publish the event doesn't fail
+// the task, it's still logged in flywheel.
+func (s *server) publishTaskEvent(ctx context.Context, id string, event *taskEvent) {
+	if s.taskEvents == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	if err := s.taskEvents.publish(ctx, id, event); err != nil {
+		logger(ctx).Errorf("failed to publish event for task %s: %s", id, err)
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/flywheel"
+	"github.com/gorilla/mux"
+)
+
+func TestRedisTaskEvents(t *testing.T) {
+	client := newTestRedis(t)
+	bus := newTaskEvents(client, "efsapi")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, unsubscribe, err := bus.subscribe(ctx, "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bus.publish(ctx, "task-2", &taskEvent{Type: taskEventLog, Message: "other task"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bus.publish(ctx, "task-1", &taskEvent{Type: taskEventLog, Message: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != taskEventLog || event.Message != "hello" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	if err := unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are closed when the subscription is closed
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected events to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events to close")
+	}
+}
+
+func TestTaskEventsHandler(t *testing.T) {
+	client := newTestRedis(t)
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server{flywheel: manager, taskIndex: newTaskIndex(client, "efsapi"), taskEvents: newTaskEvents(client, "efsapi"), shuttingDown: make(chan struct{})}
+	s.config.Store(&dynamicConfig{accountsMap: map[string]string{"spinup": "1234567890"}})
+
+	ctx := context.TODO()
+	running, completed := flywheel.NewTask(), flywheel.NewTask()
+	for _, task := range []*flywheel.Task{running, completed} {
+		if err := manager.Start(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+		s.indexTask(ctx, &taskInfo{TaskID: task.ID, Operation: kindFilesystemDelete, Account: "1234567890", Group: "space1", StartedAt: time.Now()})
+	}
+
+	if err := manager.Complete(ctx, completed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	token := &apiToken{name: "dashboard", scope: scopeRead}
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/efs/tasks/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		s.TaskEventsHandler(w, r.WithContext(withToken(r.Context(), token)))
+	}).Methods(http.MethodGet)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	get := func(id string) *http.Response {
+		res, err := http.Get(ts.URL + "/v1/efs/tasks/" + id + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// readEvents reads the events of the stream until it ends
+	readEvents := func(res *http.Response, lines chan<- string) {
+		defer close(lines)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") || strings.HasPrefix(line, "data: ") {
+				lines <- line
+			}
+		}
+	}
+
+	if res := get("missing"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found, got %d", res.StatusCode)
+	}
+
+	// the stream of a finished task ends after its status
+	res := get(completed.ID)
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected event stream, got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string, 10)
+	readEvents(res, lines)
+
+	out := []string{}
+	for l := range lines {
+		out = append(out, l)
+	}
+
+	if len(out) != 2 || out[0] != "event: status" || !strings.Contains(out[1], `"status":"completed"`) {
+		t.Errorf("unexpected events for completed task %v", out)
+	}
+
+	// the stream of a running task ends after the final status is published
+	res = get(running.ID)
+	defer res.Body.Close()
+
+	lines = make(chan string, 10)
+	go readEvents(res, lines)
+
+	next := func() string {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				t.Fatal("stream ended early")
+			}
+			return l
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return ""
+	}
+
+	if l := next(); l != "event: status" {
+		t.Fatalf("expected the current status first, got %s", l)
+	}
+
+	if l := next(); !strings.Contains(l, `"status":"running"`) {
+		t.Fatalf("expected running status, got %s", l)
+	}
+
+	s.publishTaskEvent(ctx, running.ID, &taskEvent{Type: taskEventLog, Message: "deleting mount targets"})
+	s.publishTaskEvent(ctx, running.ID, &taskEvent{Type: taskEventStatus, Status: flywheel.STATUS_FAILED, Failure: "boom"})
+
+	expected := []string{"event: log", `"message":"deleting mount targets"`, "event: status", `"failure":"boom"`}
+	for _, e := range expected {
+		if l := next(); !strings.Contains(l, e) {
+			t.Errorf("expected event line containing %s, got %s", e, l)
+		}
+	}
+
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("expected the stream to end after the final status")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream to end")
+	}
+
+	// the streams of running tasks end when the server shuts down
+	interrupted := flywheel.NewTask()
+	if err := manager.Start(ctx, interrupted); err != nil {
+		t.Fatal(err)
+	}
+	s.indexTask(ctx, &taskInfo{TaskID: interrupted.ID, Operation: kindFilesystemDelete, Account: "1234567890", Group: "space1", StartedAt: time.Now()})
+
+	res = get(interrupted.ID)
+	defer res.Body.Close()
+
+	lines = make(chan string, 10)
+	go readEvents(res, lines)
+
+	if l := next(); l != "event: status" {
+		t.Fatalf("expected the current status first, got %s", l)
+	}
+	next()
+
+	close(s.shuttingDown)
+
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("expected the stream to end when the server shuts down")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream to end")
+	}
+
+	// tokens restricted to other groups can't stream the task's events
+	token = &apiToken{name: "space", scope: scopeRead, groups: []string{"space2"}}
+	if res := get(running.ID); res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden, got %d", res.StatusCode)
+	}
+}
@@ -20,9 +20,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/YaleSpinup/apierror"
-	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -48,8 +48,7 @@ func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte{})
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal version", err))
 		return
 	}
 
@@ -57,27 +56,44 @@ func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// handleError handles standard apierror return codes
+// OpenAPIHandler responds with the OpenAPI document of the API
+func (s *server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	data, err := json.Marshal(s.openAPI)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal openapi document", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleError writes the JSON error response for standard apierror return codes
 func handleError(w http.ResponseWriter, err error) {
-	log.Error(err.Error())
-	if aerr, ok := errors.Cause(err).(apierror.Error); ok {
-		switch aerr.Code {
-		case apierror.ErrForbidden:
-			w.WriteHeader(http.StatusForbidden)
-		case apierror.ErrNotFound:
-			w.WriteHeader(http.StatusNotFound)
-		case apierror.ErrConflict:
-			w.WriteHeader(http.StatusConflict)
-		case apierror.ErrBadRequest:
-			w.WriteHeader(http.StatusBadRequest)
-		case apierror.ErrLimitExceeded:
-			w.WriteHeader(http.StatusTooManyRequests)
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		w.Write([]byte(aerr.Message))
-	} else {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+	entry := log.NewEntry(log.StandardLogger())
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		entry = entry.WithField(requestIDField, id)
+	}
+	entry.Error(err.Error())
+	status, resp := errorResponse(err)
+	writeError(w, status, resp)
+}
+
+// boolQueryParam parses the boolean query string parameter, false if it's not in the query
+func boolQueryParam(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		msg := fmt.Sprintf("invalid %s %s, must be true or false", name, v)
+		return false, newValidationError(&FieldError{Field: name, Message: msg})
 	}
+	return b, nil
 }
@@ -7,7 +7,6 @@ import (
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/gorilla/mux"
-	log "github.com/sirupsen/logrus"
 )
 
 // FileSystemAPCreateHandler Route handler for creating the filesystems access points
@@ -15,16 +14,25 @@ func (s *server) FileSystemAPCreateHandler(w http.ResponseWriter, r *http.Reques
 	w = LogWriter{w}
 	vars := mux.Vars(r)
 	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
 	fsid := vars["id"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	req := AccessPointCreateRequest{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := newRequestDecoder(r.Body).Decode(&req); err != nil {
 		msg := fmt.Sprintf("cannot decode body into create access point request input: %s", err)
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	output, task, err := s.accessPointCreate(r.Context(), account, fsid, &req)
+	output, task, err := s.accessPointCreate(r.Context(), account, group, fsid, &req)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -32,8 +40,7 @@ func (s *server) FileSystemAPCreateHandler(w http.ResponseWriter, r *http.Reques
 
 	j, err := json.Marshal(output)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", output, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -52,8 +59,17 @@ func (s *server) FileSystemAPListHandler(w http.ResponseWriter, r *http.Request)
 	w = LogWriter{w}
 	vars := mux.Vars(r)
 	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
 	fsid := vars["id"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	out, err := s.listFilesystemAccessPoints(r.Context(), account, fsid)
 	if err != nil {
 		handleError(w, err)
@@ -62,8 +78,7 @@ func (s *server) FileSystemAPListHandler(w http.ResponseWriter, r *http.Request)
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", out, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -76,14 +91,24 @@ func (s *server) FileSystemAPListHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// FileSystemAPShowHandler Request handler for
+// FileSystemAPShowHandler Request handler for showing a file system access point
 func (s *server) FileSystemAPShowHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
 	vars := mux.Vars(r)
 	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+	fsid := vars["id"]
 	apid := vars["apid"]
 
-	out, err := s.getFilesystemAccessPoint(r.Context(), account, apid)
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
+	out, err := s.getFilesystemAccessPoint(r.Context(), account, fsid, apid)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -91,8 +116,7 @@ func (s *server) FileSystemAPShowHandler(w http.ResponseWriter, r *http.Request)
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", out, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -110,9 +134,19 @@ func (s *server) FileSystemAPDeleteHandler(w http.ResponseWriter, r *http.Reques
 	w = LogWriter{w}
 	vars := mux.Vars(r)
 	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+	fsid := vars["id"]
 	apid := vars["apid"]
 
-	if err := s.deleteFilesystemAccessPoint(r.Context(), account, apid); err != nil {
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
+	if err := s.deleteFilesystemAccessPoint(r.Context(), account, fsid, apid); err != nil {
 		handleError(w, err)
 		return
 	}
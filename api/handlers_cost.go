@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+)
+
+// FileSystemCostHandler estimates the monthly cost of a filesystem
+func (s *server) FileSystemCostHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+	fs := vars["id"]
+
+	out, err := s.filesystemCost(r.Context(), account, group, fs)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(out)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
+
+// GroupCostHandler estimates the monthly cost of all of the filesystems in a group
+func (s *server) GroupCostHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+
+	out, err := s.filesystemGroupCost(r.Context(), account, group)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(out)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 )
 
 // FileSystemCreateHandler creates a filesystem service
@@ -21,7 +20,7 @@ func (s *server) FileSystemCreateHandler(w http.ResponseWriter, r *http.Request)
 	group := vars["group"]
 
 	req := FileSystemCreateRequest{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := newRequestDecoder(r.Body).Decode(&req)
 	if err != nil {
 		msg := fmt.Sprintf("cannot decode body into create filesystem input: %s", err)
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
@@ -36,8 +35,7 @@ func (s *server) FileSystemCreateHandler(w http.ResponseWriter, r *http.Request)
 
 	j, err := json.Marshal(output)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", output, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -61,13 +59,14 @@ func (s *server) FileSystemUpdateHandler(w http.ResponseWriter, r *http.Request)
 
 	if exists, err := s.fileSystemExists(r.Context(), account, group, fs); err != nil {
 		handleError(w, err)
+		return
 	} else if !exists {
-		w.WriteHeader(http.StatusNotFound)
+		handleError(w, errFileSystemNotInSpace(fs, group))
 		return
 	}
 
 	req := FileSystemUpdateRequest{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := newRequestDecoder(r.Body).Decode(&req)
 	if err != nil {
 		msg := fmt.Sprintf("cannot decode body into update filesystem input: %s", err)
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
@@ -90,6 +89,57 @@ func (s *server) FileSystemUpdateHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// FileSystemSpecHandler applies the spec of a filesystem by name, creating, updating and deleting the filesystem
+// settings, mount targets, access points and users that don't match the spec.  With ?dryRun=true, the plan is
+// returned without applying it.
+func (s *server) FileSystemSpecHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+	name := vars["name"]
+
+	dryRun, err := boolQueryParam(r, "dryRun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// YAML specs are converted to JSON by the ValidationMiddleware
+	req := FileSystemSpec{}
+	if err := newRequestDecoder(r.Body).Decode(&req); err != nil {
+		msg := fmt.Sprintf("cannot decode body into filesystem spec: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	plan, task, err := s.fileSystemSpecApply(r.Context(), account, group, name, &req, dryRun)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(plan)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	status := http.StatusOK
+	if task != nil {
+		w.Header().Set("X-Flywheel-Task", task.ID)
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
+
 // FileSystemDeleteHandler deletes a filesystem by id
 func (s *server) FileSystemDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
@@ -98,7 +148,7 @@ func (s *server) FileSystemDeleteHandler(w http.ResponseWriter, r *http.Request)
 	group := vars["group"]
 	fs := vars["id"]
 
-	task, err := s.filesystemDelete(r.Context(), account, group, fs)
+	task, err := s.filesystemDelete(r.Context(), account, group, fs, r.URL.Query().Get("callbackUrl"))
 	if err != nil {
 		handleError(w, err)
 		return
@@ -127,14 +177,17 @@ func (s *server) FileSystemListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output := listFileSystemsResponse(out)
-	j, err := json.Marshal(output)
+	if out == nil {
+		out = []string{}
+	}
+
+	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", output, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
+	w.Header().Set("X-Region", s.sessionRegion(r.Context()))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -155,8 +208,7 @@ func (s *server) FileSystemShowHandler(w http.ResponseWriter, r *http.Request) {
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
-		log.Errorf("cannot generate policy for role: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "cannot generate policy for role", err))
 		return
 	}
 
@@ -167,8 +219,7 @@ func (s *server) FileSystemShowHandler(w http.ResponseWriter, r *http.Request) {
 		policy,
 	)
 	if err != nil {
-		log.Errorf("cannot assume role: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to assume role in account", err))
 		return
 	}
 
@@ -176,8 +227,9 @@ func (s *server) FileSystemShowHandler(w http.ResponseWriter, r *http.Request) {
 
 	if exists, err := s.fileSystemExists(r.Context(), account, group, fs); err != nil {
 		handleError(w, err)
+		return
 	} else if !exists {
-		w.WriteHeader(http.StatusNotFound)
+		handleError(w, errFileSystemNotInSpace(fs, group))
 		return
 	}
 
@@ -215,7 +267,7 @@ func (s *server) FileSystemShowHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if aerr, ok := errors.Cause(err).(apierror.Error); ok {
 			if aerr.Code != apierror.ErrNotFound {
-				log.Errorf("error: %s", aerr)
+				logger(r.Context()).Errorf("error: %s", aerr)
 				handleError(w, err)
 				return
 			}
@@ -231,8 +283,7 @@ func (s *server) FileSystemShowHandler(w http.ResponseWriter, r *http.Request) {
 	output := fileSystemResponseFromEFS(filesystem, mounttargets, accessPoints, fsPolicy, backup, transitionToIA, transitionToPrimary)
 	j, err := json.Marshal(output)
 	if err != nil {
-		log.Errorf("cannot marshal response (%v) into JSON: %s", output, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+)
+
+// OrphanListHandler lists the resources left behind in an account by partially failed filesystem creates and
+// deletes, with the reason each one is an orphan
+func (s *server) OrphanListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+
+	orphans, err := s.orphanScan(r.Context(), account)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(orphans)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
+
+// OrphanCleanupHandler deletes the selected orphans of an account with a task
+func (s *server) OrphanCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+
+	req := OrphanCleanupRequest{}
+	if err := newRequestDecoder(r.Body).Decode(&req); err != nil {
+		msg := fmt.Sprintf("cannot decode body into orphan cleanup input: %s", err)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if err := validateRequest(&req); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	out, task, err := s.orphanCleanup(r.Context(), account, &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(out)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("X-Flywheel-Task", task.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+)
+
+// DriftListHandler lists the latest drift found by the reconciler for the filesystems in an account, optionally
+// filtered by group.  Tokens restricted to groups must pass one of their groups.
+func (s *server) DriftListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+	group := r.URL.Query().Get("group")
+
+	if !s.tokenAllowed(tokenFromContext(r.Context()), scopeRead, vars["account"], group, r.URL.String()) {
+		handleError(w, errTokenNotAllowed)
+		return
+	}
+
+	drifts, err := s.listDrift(r.Context(), account, group)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to list drift", err))
+		return
+	}
+
+	j, err := json.Marshal(drifts)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+)
+
+// SpaceTeardownHandler deletes all of the filesystems in a space (group).  With ?dryRun=true, the filesystems that
+// would be deleted are listed without deleting them.
+func (s *server) SpaceTeardownHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+	group := vars["group"]
+
+	dryRun, err := boolQueryParam(r, "dryRun")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	out, task, err := s.spaceTeardown(r.Context(), account, group, dryRun)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(out)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	status := http.StatusOK
+	if task != nil {
+		w.Header().Set("X-Flywheel-Task", task.ID)
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
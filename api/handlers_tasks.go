@@ -0,0 +1,302 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/gorilla/mux"
+)
+
+// defaultTaskListLimit is the number of tasks listed if a limit isn't passed
+const defaultTaskListLimit = 50
+
+// maxTaskListLimit is the maximum number of tasks that can be listed
+const maxTaskListLimit = 500
+
+// TaskListHandler lists the recent tasks in an account, optionally filtered by group, filesystem, operation
+// and status.  Tokens restricted to groups must pass one of their groups.
+func (s *server) TaskListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	account := s.mapAccountNumber(vars["account"])
+
+	q := r.URL.Query()
+	filter := taskFilter{
+		Group:        q.Get("group"),
+		FileSystemID: q.Get("fs"),
+		Operation:    q.Get("operation"),
+		Status:       q.Get("status"),
+	}
+
+	if !s.tokenAllowed(tokenFromContext(r.Context()), scopeRead, vars["account"], filter.Group, r.URL.String()) {
+		handleError(w, errTokenNotAllowed)
+		return
+	}
+
+	limit := defaultTaskListLimit
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxTaskListLimit {
+			msg := fmt.Sprintf("invalid limit %s, must be between 1 and %d", l, maxTaskListLimit)
+			handleError(w, newValidationError(&FieldError{Field: "limit", Message: msg}))
+			return
+		}
+	}
+
+	tasks, err := s.listTasks(r.Context(), account, filter, limit)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to list tasks", err))
+		return
+	}
+
+	j, err := json.Marshal(tasks)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
+
+// FlywheelTasksHandler returns the flywheel tasks passed as `task` query parameters.  Each task is checked against
+// the account and group it was started for in the task index, like the other task routes.  Cancelled tasks are
+// returned with the cancelled status instead of failed.
+func (s *server) FlywheelTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	ids := r.URL.Query()["task"]
+	if len(ids) == 0 {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "at least one task is required", nil))
+		return
+	}
+
+	tasks := map[string]*flywheel.Task{}
+	for _, id := range ids {
+		// the token is checked against the account and group of the task before anything about it is returned
+		var account, group string
+		if s.taskIndex != nil {
+			info, err := s.taskIndex.get(r.Context(), id)
+			if err != nil {
+				handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+				return
+			}
+
+			if info != nil {
+				account, group = info.Account, info.Group
+			}
+		}
+
+		if !s.tokenAllowed(tokenFromContext(r.Context()), scopeRead, account, group, r.URL.String()) {
+			handleError(w, errTokenNotAllowed)
+			return
+		}
+
+		task, err := s.flywheel.GetTask(r.Context(), id)
+		if err != nil {
+			handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+			return
+		}
+
+		if task != nil {
+			task.Status = flywheelTaskStatus(task)
+			tasks[id] = task
+		}
+	}
+
+	j, err := json.Marshal(tasks)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(j)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "error writing response", err))
+	}
+}
+
+// TaskCancelHandler cancels a running filesystem create or delete task.  The completed steps of a filesystem
+// create are rolled back and the flywheel task is marked cancelled when the orchestration stops.
+func (s *server) TaskCancelHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if s.orchestrationStore == nil {
+		handleError(w, apierror.New(apierror.ErrConflict, "task cancellation is not supported", nil))
+		return
+	}
+
+	state, err := s.orchestrationStore.load(r.Context(), id)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to load task orchestration", err))
+		return
+	}
+
+	// the token is checked against the account and group of the task before anything about it is returned
+	var account, group string
+	if state != nil {
+		account, group = state.Account, state.Group
+	} else if s.taskIndex != nil {
+		info, err := s.taskIndex.get(r.Context(), id)
+		if err != nil {
+			handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+			return
+		}
+
+		if info != nil {
+			account, group = info.Account, info.Group
+		}
+	}
+
+	if !s.tokenAllowed(tokenFromContext(r.Context()), scopeWrite, account, group, r.URL.String()) {
+		handleError(w, errTokenNotAllowed)
+		return
+	}
+
+	if state == nil {
+		task, err := s.flywheel.GetTask(r.Context(), id)
+		if err != nil {
+			handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+			return
+		}
+
+		if task == nil {
+			handleError(w, apierror.New(apierror.ErrNotFound, "task not found", nil))
+			return
+		}
+
+		msg := fmt.Sprintf("task %s (%s) is not a running filesystem create or delete", id, task.Status)
+		handleError(w, apierror.New(apierror.ErrConflict, msg, nil))
+		return
+	}
+
+	if state.RollingBack {
+		msg := fmt.Sprintf("task %s is already rolling back", id)
+		handleError(w, apierror.New(apierror.ErrConflict, msg, nil))
+		return
+	}
+
+	if err := s.cancelTask(r.Context(), id); err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to cancel task", err))
+		return
+	}
+
+	w.Header().Set("X-Flywheel-Task", id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// taskEventsKeepAlive is how often a comment is sent to keep idle task event streams open
+const taskEventsKeepAlive = 15 * time.Second
+
+// TaskEventsHandler streams the log messages and the final status of a running task as server-sent events.
+// The stream starts with the current status of the task and ends after its final status, or when the server
+// shuts down.
+func (s *server) TaskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if s.taskIndex == nil || s.taskEvents == nil {
+		handleError(w, apierror.New(apierror.ErrConflict, "task event streams are not supported", nil))
+		return
+	}
+
+	info, err := s.taskIndex.get(r.Context(), id)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+		return
+	}
+
+	if info == nil {
+		handleError(w, apierror.New(apierror.ErrNotFound, "task not found", nil))
+		return
+	}
+
+	if !s.tokenAllowed(tokenFromContext(r.Context()), scopeRead, info.Account, info.Group, r.URL.String()) {
+		handleError(w, errTokenNotAllowed)
+		return
+	}
+
+	// subscribe before getting the status so events published in between aren't missed
+	events, unsubscribe, err := s.taskEvents.subscribe(r.Context(), id)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to subscribe to task events", err))
+		return
+	}
+	defer unsubscribe()
+
+	task, err := s.flywheel.GetTask(r.Context(), id)
+	if err != nil {
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to get task", err))
+		return
+	}
+
+	if task == nil {
+		handleError(w, apierror.New(apierror.ErrNotFound, "task not found", nil))
+		return
+	}
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger(r.Context()).Warnf("failed to clear write deadline for task %s event stream: %s", id, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event *taskEvent) bool {
+		j, err := json.Marshal(event)
+		if err != nil {
+			logger(r.Context()).Errorf("cannot marshal task event (%v) into JSON: %s", event, err)
+			return false
+		}
+
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, j); err != nil {
+			return false
+		}
+
+		return rc.Flush() == nil
+	}
+
+	current := &taskEvent{Type: taskEventStatus, Status: flywheelTaskStatus(task), Failure: task.Failure, Time: time.Now().UTC()}
+	if !send(current) || taskFinished(task.Status) {
+		return
+	}
+
+	keepAlive := time.NewTicker(taskEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shuttingDown:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok || !send(event) || event.Type == taskEventStatus {
+				return
+			}
+		}
+	}
+}
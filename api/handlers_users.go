@@ -9,7 +9,6 @@ import (
 	"github.com/YaleSpinup/aws-go/services/iam"
 	"github.com/YaleSpinup/efs-api/efs"
 	"github.com/gorilla/mux"
-	log "github.com/sirupsen/logrus"
 )
 
 // UsersCreateHandler handles user creation requests
@@ -20,19 +19,27 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 	group := vars["group"]
 	fsid := vars["id"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	req := FileSystemUserCreateRequest{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := newRequestDecoder(r.Body).Decode(&req); err != nil {
 		msg := fmt.Sprintf("cannot decode body into create user input: %s", err)
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	if req.UserName == "" {
-		handleError(w, apierror.New(apierror.ErrBadRequest, "Username is a required field", nil))
+	if err := validateRequest(&req); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	log.Infof("creating filesystem %s user %s", fsid, req.UserName)
+	logger(r.Context()).Infof("creating filesystem %s user %s", fsid, req.UserName)
 
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
@@ -66,7 +73,7 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, err := orch.createFilesystemUser(r.Context(), group, fsid, &req)
+	out, err := orch.createFilesystemUser(r.Context(), group, fsid, s.quotaForGroup(group), &req)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -74,8 +81,7 @@ func (s *server) UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -97,6 +103,14 @@ func (s *server) UsersDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	fsid := vars["id"]
 	user := vars["user"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	policy, err := s.filesystemUserDeletePolicy()
@@ -146,6 +160,14 @@ func (s *server) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 	group := vars["group"]
 	fsid := vars["id"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
@@ -176,8 +198,7 @@ func (s *server) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -199,6 +220,14 @@ func (s *server) UsersShowHandler(w http.ResponseWriter, r *http.Request) {
 	fsid := vars["id"]
 	user := vars["user"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
 	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
@@ -229,8 +258,7 @@ func (s *server) UsersShowHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, apierror.New(apierror.ErrInternalError, "failed to marshal response", err))
 		return
 	}
 
@@ -252,8 +280,16 @@ func (s *server) UsersUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	fsid := vars["id"]
 	userName := vars["user"]
 
+	if exists, err := s.fileSystemExists(r.Context(), account, group, fsid); err != nil {
+		handleError(w, err)
+		return
+	} else if !exists {
+		handleError(w, errFileSystemNotInSpace(fsid, group))
+		return
+	}
+
 	req := FileSystemUserUpdateRequest{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := newRequestDecoder(r.Body).Decode(&req); err != nil {
 		msg := fmt.Sprintf("cannot decode body into update filesystem user input: %s", err)
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
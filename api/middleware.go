@@ -20,12 +20,25 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/YaleSpinup/apierror"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // TokenMiddleware checks the tokens for non-public URLs
 func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.Handler {
+	tokens := []*apiToken{{name: defaultTokenName, secret: psk, scope: scopeAdmin}}
+	return tokenMiddleware(func(r *http.Request) *apiToken {
+		return authenticateToken(tokens, r.Header.Get("X-Auth-Token"))
+	}, public, h)
+}
+
+// corsAllowHeaders are the request headers allowed by CORS preflight checks, browsers authenticate with an OIDC
+// bearer token in the Authorization header
+const corsAllowHeaders = "Authorization, Content-Type, X-Auth-Token, " + requestIDHeader
+
+// tokenMiddleware authenticates non-public URLs with the authenticate function and attaches the
+// authenticated token to the request context
+func tokenMiddleware(authenticate func(r *http.Request) *apiToken, public map[string]string, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Debug("Processing token middleware for protected URLs")
 
@@ -33,7 +46,7 @@ func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.
 		if r.Method == "OPTIONS" {
 			log.Info("Setting CORS preflight options and returning")
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "X-Auth-Token")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
 			return
@@ -41,8 +54,7 @@ func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.
 
 		uri, err := url.ParseRequestURI(r.RequestURI)
 		if err != nil {
-			log.Error("Unable to parse request URI ", err)
-			w.WriteHeader(http.StatusForbidden)
+			handleError(w, apierror.New(apierror.ErrForbidden, "unable to parse request uri", err))
 			return
 		}
 
@@ -51,14 +63,15 @@ func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.
 		} else {
 			log.Debugf("Authenticating token for protected URL '%s'", r.URL)
 
-			htoken := r.Header.Get("X-Auth-Token")
-			if err := bcrypt.CompareHashAndPassword([]byte(htoken), psk); err != nil {
-				log.Warnf("Unable to authenticate session for '%s' with '%s'", r.URL, htoken)
-				w.WriteHeader(http.StatusForbidden)
+			token := authenticate(r)
+			if token == nil {
+				log.Warnf("Unable to authenticate session for '%s'", r.URL)
+				handleError(w, apierror.New(apierror.ErrForbidden, "unable to authenticate token", nil))
 				return
 			}
 
-			log.Infof("Successfully authenticated token for URL '%s'", r.URL)
+			log.Infof("Successfully authenticated token %s for URL '%s'", token.name, r.URL)
+			r = r.WithContext(withToken(r.Context(), token))
 		}
 		h.ServeHTTP(w, r)
 	})
@@ -17,11 +17,13 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/YaleSpinup/apierror"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -73,6 +75,11 @@ func TestTokenMiddleware(t *testing.T) {
 		t.Errorf("Received status: %d for '%s/private', expected %d", resp.StatusCode, server.URL, http.StatusForbidden)
 	}
 
+	errResp := ErrorResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Code != apierror.ErrForbidden {
+		t.Errorf("expected forbidden error response, got %+v (%v)", errResp, err)
+	}
+
 	// Test a private URL _with_ an auth-token
 	client := &http.Client{}
 	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/private", server.URL), nil)
@@ -98,7 +105,7 @@ func TestTokenMiddleware(t *testing.T) {
 
 	testHeaders := map[string]string{
 		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Headers": "X-Auth-Token",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type, X-Auth-Token, X-Request-Id",
 	}
 
 	for k, v := range testHeaders {
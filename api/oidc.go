@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultJWKSCacheTTL is how long the JWKS is cached when jwksCacheTTL isn't configured
+	defaultJWKSCacheTTL = 1 * time.Hour
+	// jwksRefreshInterval limits how often the JWKS is refreshed when a token is signed with an unknown key
+	jwksRefreshInterval = 1 * time.Minute
+	// jwtLeeway is the allowed clock skew when checking the expiry and not before times of a token
+	jwtLeeway = 1 * time.Minute
+)
+
+// oidcAuthenticator validates OIDC bearer tokens against a JWKS
+type oidcAuthenticator struct {
+	audience    string
+	groupsClaim string
+	issuer      string
+	jwks        *jwks
+	now         func() time.Time
+	scope       scope
+}
+
+// jwtAlgorithms are the signing algorithms accepted for OIDC tokens
+var jwtAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512}
+
+// jwks is a cached JSON web key set loaded from a file or URL
+type jwks struct {
+	client     *http.Client
+	file       string
+	fetched    time.Time
+	keys       map[string]jose.JSONWebKey
+	mu         sync.Mutex
+	refreshing *jwksRefresh
+	ttl        time.Duration
+	url        string
+}
+
+// jwksRefresh is a refresh of the key set in flight, done is closed when it finishes
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// newOIDCAuthenticator returns an authenticator for the configuration, or nil if OIDC isn't configured
+func newOIDCAuthenticator(config common.OIDC) (*oidcAuthenticator, error) {
+	if config.Issuer == "" {
+		return nil, nil
+	}
+
+	ttl := defaultJWKSCacheTTL
+	if config.JWKSCacheTTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(config.JWKSCacheTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	groupsClaim := config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	sc := scopeWrite
+	if config.Scope != "" {
+		sc = scopeNames[config.Scope]
+	}
+
+	log.Infof("authenticating OIDC bearer tokens from issuer %s for audience %s", config.Issuer, config.Audience)
+
+	return &oidcAuthenticator{
+		audience:    config.Audience,
+		groupsClaim: groupsClaim,
+		issuer:      config.Issuer,
+		jwks: &jwks{
+			client: &http.Client{Timeout: 10 * time.Second},
+			file:   config.JWKSFile,
+			ttl:    ttl,
+			url:    config.JWKSURL,
+		},
+		now:   time.Now,
+		scope: sc,
+	}, nil
+}
+
+// authenticate validates the bearer token and returns an API token restricted to the groups in the
+// configured claim
+func (o *oidcAuthenticator) authenticate(ctx context.Context, bearer string) (*apiToken, error) {
+	claims, err := o.verify(ctx, bearer)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := claimStrings(claims[o.groupsClaim])
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("token has no %s claim", o.groupsClaim)
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	return &apiToken{
+		name:   "oidc:" + sub,
+		scope:  o.scope,
+		groups: groups,
+	}, nil
+}
+
+// verify checks the signature, issuer, audience, expiry and not before time of a JWT and returns its claims
+func (o *oidcAuthenticator) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	tok, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+
+	if len(tok.Headers) != 1 {
+		return nil, errors.New("invalid token header")
+	}
+
+	key, err := o.jwks.key(ctx, tok.Headers[0].KeyID, o.now())
+	if err != nil {
+		return nil, err
+	}
+
+	std := jwt.Claims{}
+	claims := map[string]interface{}{}
+	if err := tok.Claims(key.Key, &std, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+
+	if std.Expiry == nil {
+		return nil, errors.New("token has no expiry")
+	}
+
+	if err := std.ValidateWithLeeway(jwt.Expected{
+		Issuer:      o.issuer,
+		AnyAudience: jwt.Audience{o.audience},
+		Time:        o.now(),
+	}, jwtLeeway); err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+
+	return claims, nil
+}
+
+// key returns the public key with the kid, refreshing the key set when the cache is expired or the key
+// is unknown.  The cached keys are served while an expired key set is refreshed.
+func (j *jwks) key(ctx context.Context, kid string, now time.Time) (jose.JSONWebKey, error) {
+	keys, fetched := j.cached()
+
+	if keys == nil {
+		if err := j.refresh(ctx, now); err != nil {
+			return jose.JSONWebKey{}, err
+		}
+		keys, fetched = j.cached()
+	} else if now.Sub(fetched) > j.ttl {
+		j.startRefresh(now)
+	}
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	// the key may have been rotated, refresh at most once per interval
+	if now.Sub(fetched) > jwksRefreshInterval {
+		if err := j.refresh(ctx, now); err != nil {
+			return jose.JSONWebKey{}, err
+		}
+
+		keys, _ = j.cached()
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	return jose.JSONWebKey{}, fmt.Errorf("unknown signing key %s", kid)
+}
+
+// cached returns the cached keys and when they were fetched
+func (j *jwks) cached() (map[string]jose.JSONWebKey, time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys, j.fetched
+}
+
+// refresh waits for a refresh of the key set, joining the one in flight if there is one
+func (j *jwks) refresh(ctx context.Context, now time.Time) error {
+	r := j.startRefresh(now)
+
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startRefresh starts loading the key set in the background unless a refresh is already in flight.  The
+// lock isn't held while loading so the cached keys can be served in the meantime.
+func (j *jwks) startRefresh(now time.Time) *jwksRefresh {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.refreshing != nil {
+		return j.refreshing
+	}
+
+	r := &jwksRefresh{done: make(chan struct{})}
+	j.refreshing = r
+
+	go func() {
+		keys, err := j.load(context.Background())
+
+		j.mu.Lock()
+		if err == nil {
+			j.keys = keys
+			j.fetched = now
+		}
+		r.err = err
+		j.refreshing = nil
+		j.mu.Unlock()
+
+		close(r.done)
+	}()
+
+	return r
+}
+
+// load loads and parses the key set from the file or URL
+func (j *jwks) load(ctx context.Context) (map[string]jose.JSONWebKey, error) {
+	var data []byte
+	var err error
+
+	if j.file != "" {
+		log.Debugf("loading jwks from file %s", j.file)
+		data, err = os.ReadFile(j.file)
+	} else {
+		log.Debugf("loading jwks from url %s", j.url)
+		data, err = j.fetch(ctx)
+	}
+
+	if err != nil {
+		log.Errorf("failed to load jwks: %s", err)
+		return nil, fmt.Errorf("failed to load jwks: %s", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		log.Errorf("failed to parse jwks: %s", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (j *jwks) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// parseJWKS parses the public signing keys from a JSON web key set, other keys and keys that can't be parsed
+// are skipped
+func parseJWKS(data []byte) (map[string]jose.JSONWebKey, error) {
+	set := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %s", err)
+	}
+
+	keys := map[string]jose.JSONWebKey{}
+	for _, raw := range set.Keys {
+		key := jose.JSONWebKey{}
+		if err := key.UnmarshalJSON(raw); err != nil {
+			log.Warnf("skipping jwks key: %s", err)
+			continue
+		}
+
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if !key.IsPublic() || !key.Valid() {
+			log.Warnf("skipping jwks key %s: not a valid public key", key.KeyID)
+			continue
+		}
+
+		keys[key.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+// claimStrings returns the value of a claim that may be a string or a list of strings
+func claimStrings(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		out := []string{}
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + b64(signature)
+}
+
+func testJWKS(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": "rsa1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   b64(rsaKey.N.Bytes()),
+				"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kid": "ec1",
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   b64(ecKey.X.FillBytes(make([]byte, 32))),
+				"y":   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+	return jwks
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetches := 0
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(testJWKS(rsaKey, ecKey))
+	}))
+	defer jwksServer.Close()
+
+	o, err := newOIDCAuthenticator(common.OIDC{
+		Issuer:   "https://idp.example.com",
+		Audience: "efs-api",
+		JWKSURL:  jwksServer.URL,
+		Scope:    "read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	o.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://idp.example.com",
+			"aud":    []string{"efs-api", "other"},
+			"sub":    "jdoe",
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []string{"space1", "space2"},
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	token, err := o.authenticate(context.TODO(), signJWT(t, "RS256", "rsa1", rsaKey, claims(nil)))
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	expected := &apiToken{name: "oidc:jdoe", scope: scopeRead, groups: []string{"space1", "space2"}}
+	if !reflect.DeepEqual(expected, token) {
+		t.Errorf("expected token %+v, got %+v", expected, token)
+	}
+
+	if _, err := o.authenticate(context.TODO(), signJWT(t, "ES256", "ec1", ecKey, claims(map[string]interface{}{"aud": "efs-api"}))); err != nil {
+		t.Errorf("expected nil error for ES256 token, got %s", err)
+	}
+
+	invalid := map[string]string{
+		"malformed":      "not.a.jwt.token",
+		"expired":        signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+		"no expiry":      signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"exp": nil})),
+		"not yet valid":  signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})),
+		"wrong issuer":   signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience": signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"aud": "something-else"})),
+		"no groups":      signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"groups": nil})),
+		"bad signature":  signJWT(t, "RS256", "rsa1", otherKey, claims(nil)),
+		"wrong alg":      signJWT(t, "ES256", "rsa1", ecKey, claims(nil)),
+		"hmac alg":       signJWT(t, "HS256", "rsa1", rsaKey, claims(nil)),
+		"none alg":       signJWT(t, "none", "rsa1", rsaKey, claims(nil)),
+		"unknown key":    signJWT(t, "RS256", "rsa2", rsaKey, claims(nil)),
+	}
+
+	for name, jwt := range invalid {
+		if _, err := o.authenticate(context.TODO(), jwt); err == nil {
+			t.Errorf("expected error for %s token, got nil", name)
+		}
+	}
+
+	// the jwks is cached, an unknown key refreshes it at most once per interval
+	if fetches != 1 {
+		t.Errorf("expected jwks to be fetched once, got %d", fetches)
+	}
+
+	now = now.Add(2 * jwksRefreshInterval)
+	if _, err := o.authenticate(context.TODO(), signJWT(t, "RS256", "rsa2", rsaKey, claims(nil))); err == nil {
+		t.Error("expected error for unknown key, got nil")
+	}
+
+	if fetches != 2 {
+		t.Errorf("expected jwks to be refreshed for an unknown key, got %d fetches", fetches)
+	}
+}
+
+func TestOIDCJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, testJWKS(rsaKey, ecKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := newOIDCAuthenticator(common.OIDC{
+		Issuer:      "https://idp.example.com",
+		Audience:    "efs-api",
+		JWKSFile:    path,
+		GroupsClaim: "spaces",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := signJWT(t, "RS256", "rsa1", rsaKey, map[string]interface{}{
+		"iss":    "https://idp.example.com",
+		"aud":    "efs-api",
+		"sub":    "jdoe",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"spaces": "space1",
+	})
+
+	s := server{oidc: o}
+	req := httptest.NewRequest(http.MethodGet, "/v1/efs/spinup/filesystems/space1", nil)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	token := s.authenticate(req)
+	if token == nil {
+		t.Fatal("expected authenticated token, got nil")
+	}
+
+	if token.scope != scopeWrite || !reflect.DeepEqual(token.groups, []string{"space1"}) {
+		t.Errorf("expected write token for space1, got %+v", token)
+	}
+
+	req.Header.Set("Authorization", "Bearer garbage")
+	if token := s.authenticate(req); token != nil {
+		t.Errorf("expected nil token for invalid bearer token, got %+v", token)
+	}
+}
+
+func TestJWKSRefreshServesCachedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	release := make(chan struct{})
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		w.Write(testJWKS(rsaKey, ecKey))
+	}))
+	defer jwksServer.Close()
+
+	j := &jwks{client: jwksServer.Client(), ttl: time.Hour, url: jwksServer.URL}
+
+	now := time.Now()
+	if _, err := j.key(context.TODO(), "rsa1", now); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	// the expired key set is refreshed in the background, the cached keys are served in the meantime
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := j.key(context.TODO(), "rsa1", now); err != nil {
+			t.Fatalf("expected cached key while refreshing, got %s", err)
+		}
+	}
+
+	// requests for unknown keys wait for the refresh in flight instead of starting another one
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := j.key(ctx, "rsa2", now); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded waiting for the refresh, got %v", err)
+	}
+
+	j.mu.Lock()
+	r := j.refreshing
+	j.mu.Unlock()
+
+	close(release)
+	<-r.done
+
+	if _, err := j.key(context.TODO(), "rsa2", now); err == nil {
+		t.Error("expected error for unknown key, got nil")
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("expected jwks to be fetched twice, got %d", n)
+	}
+
+	if _, fetched := j.cached(); !fetched.Equal(now) {
+		t.Errorf("expected jwks to be refreshed at %s, got %s", now, fetched)
+	}
+}
@@ -0,0 +1,525 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIBasePath is the path prefix of all of the API routes, the paths of the OpenAPI document are relative to it
+const openAPIBasePath = "/v1/efs"
+
+// openAPIDocument is the OpenAPI 3 document describing the routes and types of the API
+type openAPIDocument struct {
+	OpenAPI    string                       `json:"openapi"`
+	Info       openAPIInfo                  `json:"info"`
+	Servers    []openAPIServer              `json:"servers"`
+	Paths      map[string]openAPIPathItem   `json:"paths"`
+	Components openAPIComponents            `json:"components"`
+	operations map[string]*openAPIOperation `json:"-"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+// openAPIPathItem are the operations of a path, keyed by lower case http method
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+// openAPISchema is the subset of the OpenAPI schema object used to describe the API types
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	MinLength            *int64                    `json:"minLength,omitempty"`
+	MaxLength            *int64                    `json:"maxLength,omitempty"`
+	Minimum              *int64                    `json:"minimum,omitempty"`
+	Maximum              *int64                    `json:"maximum,omitempty"`
+}
+
+// valid values of the filesystem settings
+var (
+	backupPolicies                    = []string{"ENABLED", "DISABLED"}
+	lifeCycleConfigurations           = []string{"NONE", "AFTER_7_DAYS", "AFTER_14_DAYS", "AFTER_30_DAYS", "AFTER_60_DAYS", "AFTER_90_DAYS"}
+	transitionToPrimaryStorageClasses = []string{"NONE", "AFTER_1_ACCESS"}
+)
+
+// patterns and limits of the request fields
+const (
+	// namePattern matches the characters allowed in both tag values and IAM user names, since the names of
+	// filesystems and access points are tagged and filesystem names prefix the names of their IAM users
+	namePattern = `^[a-zA-Z0-9_.+=@-]+$`
+	// tagKeyPattern and tagValuePattern match the characters allowed in AWS tags
+	tagKeyPattern   = `^[\p{L}\p{Z}\p{N}_.:/=+@-]+$`
+	tagValuePattern = `^[\p{L}\p{Z}\p{N}_.:/=+@-]*$`
+	// userNamePattern matches the characters allowed in IAM user names
+	userNamePattern = `^[\w+=,.@-]+$`
+	// rootDirectoryPattern matches absolute paths of at most four directories that don't start with a dot
+	rootDirectoryPattern = `^/$|^(/[a-zA-Z0-9_+=@-][a-zA-Z0-9_.+=@-]*){1,4}$`
+	// permissionsPattern matches octal POSIX permissions
+	permissionsPattern = `^[0-7]{3,4}$`
+
+	maxFileSystemNameLength = 48
+	maxUserNameLength       = 64
+	maxTagKeyLength         = 128
+	maxTagValueLength       = 256
+	maxPosixID              = 4294967295
+)
+
+// fieldRule constrains a field of an API type beyond its go type.  The pattern and the length limits of
+// string list fields apply to their items.
+type fieldRule struct {
+	required  bool
+	enum      []string
+	pattern   string
+	minLength *int64
+	maxLength *int64
+	minimum   *int64
+	maximum   *int64
+}
+
+// posixIDRule constrains POSIX user and group ids
+var posixIDRule = fieldRule{minimum: int64Ptr(0), maximum: int64Ptr(maxPosixID)}
+
+// fieldRules are the constraints of the fields of the API types, keyed by type and field name.  The fields of
+// the AWS types are also constrained by their required, min and max struct tags.
+var fieldRules = map[string]fieldRule{
+	"FileSystemCreateRequest.Name":                            {required: true, pattern: namePattern, maxLength: int64Ptr(maxFileSystemNameLength)},
+	"FileSystemCreateRequest.BackupPolicy":                    {enum: backupPolicies},
+	"FileSystemCreateRequest.LifeCycleConfiguration":          {enum: lifeCycleConfigurations},
+	"FileSystemCreateRequest.TransitionToPrimaryStorageClass": {enum: transitionToPrimaryStorageClasses},
+	"FileSystemCreateRequest.Sgs":                             {pattern: `^sg-[0-9a-f]+$`},
+	"FileSystemCreateRequest.Subnets":                         {pattern: `^subnet-[0-9a-f]+$`},
+	"FileSystemUpdateRequest.BackupPolicy":                    {enum: backupPolicies},
+	"FileSystemUpdateRequest.LifeCycleConfiguration":          {enum: lifeCycleConfigurations},
+	"FileSystemUpdateRequest.TransitionToPrimaryStorageClass": {enum: transitionToPrimaryStorageClasses},
+	"AccessPointCreateRequest.Name":                           {pattern: namePattern, maxLength: int64Ptr(maxTagValueLength)},
+	"FileSystemSpec.BackupPolicy":                             {enum: backupPolicies},
+	"FileSystemSpec.LifeCycleConfiguration":                   {enum: lifeCycleConfigurations},
+	"FileSystemSpec.TransitionToPrimaryStorageClass":          {enum: transitionToPrimaryStorageClasses},
+	"FileSystemSpec.Sgs":                                      {pattern: `^sg-[0-9a-f]+$`},
+	"FileSystemSpec.Subnets":                                  {pattern: `^subnet-[0-9a-f]+$`},
+	"FileSystemSpec.Users":                                    {pattern: userNamePattern, maxLength: int64Ptr(maxUserNameLength)},
+	"AccessPointSpec.Name":                                    {required: true, pattern: namePattern, maxLength: int64Ptr(maxTagValueLength)},
+	"FileSystemUserCreateRequest.UserName":                    {required: true, pattern: userNamePattern, maxLength: int64Ptr(maxUserNameLength)},
+	"OrphanCleanupRequest.Orphans":                            {required: true, pattern: `^(user|group|filesystem|accessPoint):.+$`},
+	"Tag.Key":                                                 {required: true, pattern: tagKeyPattern, maxLength: int64Ptr(maxTagKeyLength)},
+	"Tag.Value":                                               {pattern: tagValuePattern, maxLength: int64Ptr(maxTagValueLength)},
+	"PosixUser.Uid":                                           posixIDRule,
+	"PosixUser.Gid":                                           posixIDRule,
+	"PosixUser.SecondaryGids":                                 posixIDRule,
+	"CreationInfo.OwnerUid":                                   posixIDRule,
+	"CreationInfo.OwnerGid":                                   posixIDRule,
+	"CreationInfo.Permissions":                                {pattern: permissionsPattern},
+	"RootDirectory.Path":                                      {pattern: rootDirectoryPattern},
+}
+
+// pathParameters are the path parameters of the routes
+var pathParameters = map[string]*openAPIParameter{
+	"account": {Description: "account name or number", Schema: &openAPISchema{Type: "string", Pattern: `^[\w.-]+$`}},
+	"group":   {Description: "spinup space (group) id", Schema: &openAPISchema{Type: "string", Pattern: `^[\w.-]+$`}},
+	"id":      {Description: "filesystem id", Schema: &openAPISchema{Type: "string", Pattern: `^fs-[0-9a-f]{8,40}$`}},
+	"name":    {Description: "filesystem name", Schema: &openAPISchema{Type: "string", Pattern: `^[a-zA-Z0-9_.+=@-]{1,48}$`}},
+	"apid":    {Description: "access point id", Schema: &openAPISchema{Type: "string", Pattern: `^fsap-[0-9a-f]{8,40}$`}},
+	"user":    {Description: "filesystem user name", Schema: &openAPISchema{Type: "string", Pattern: `^[\w+=,.@-]{1,64}$`}},
+	"task":    {Description: "flywheel task id", Schema: &openAPISchema{Type: "string", Pattern: `^[\w-]+$`}},
+}
+
+// apiOperation describes a route of the API for the OpenAPI document
+type apiOperation struct {
+	method  string
+	path    string
+	id      string
+	summary string
+	tag     string
+	// query are the query string parameters of the operation
+	query []*openAPIParameter
+	// request is a value of the type of the JSON request body, nil if the operation has no body
+	request interface{}
+	// requestYAML is true if the request body can also be YAML
+	requestYAML bool
+	// status is the http status of a successful response
+	status int
+	// response is a value of the type of the JSON response body, nil if the response isn't JSON
+	response interface{}
+	// contentType of the response if it isn't JSON
+	contentType string
+}
+
+// apiOperations are all of the routes of the API
+var apiOperations = []*apiOperation{
+	{method: http.MethodGet, path: "/ping", id: "Ping", summary: "Ping the API", tag: "status", status: http.StatusOK, contentType: "text/plain"},
+	{method: http.MethodGet, path: "/version", id: "Version", summary: "Get the version of the API", tag: "status", status: http.StatusOK, response: apiVersion{}},
+	{method: http.MethodGet, path: "/metrics", id: "Metrics", summary: "Get the prometheus metrics", tag: "status", status: http.StatusOK, contentType: "text/plain"},
+	{method: http.MethodGet, path: "/openapi.json", id: "OpenAPI", summary: "Get the OpenAPI document of the API", tag: "status", status: http.StatusOK, response: map[string]interface{}{}},
+
+	{
+		method: http.MethodGet, path: "/flywheel", id: "FlywheelTaskStatus", summary: "Get the status of flywheel tasks", tag: "tasks", status: http.StatusOK, response: map[string]interface{}{},
+		query: []*openAPIParameter{
+			{Name: "task", In: "query", Required: true, Description: "task id, can be repeated", Schema: &openAPISchema{Type: "array", Items: &openAPISchema{Type: "string"}}},
+		},
+	},
+	{method: http.MethodDelete, path: "/tasks/{id}", id: "TaskCancel", summary: "Cancel a filesystem create or delete task", tag: "tasks", status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/tasks/{id}/events", id: "TaskEvents", summary: "Stream the log messages and final status of a task as server-sent events", tag: "tasks", status: http.StatusOK, contentType: "text/event-stream"},
+	{
+		method: http.MethodGet, path: "/{account}/tasks", id: "TaskList", summary: "List the recent tasks in an account", tag: "tasks", status: http.StatusOK, response: []*TaskResponse{},
+		query: []*openAPIParameter{
+			{Name: "group", In: "query", Schema: &openAPISchema{Type: "string"}},
+			{Name: "fs", In: "query", Description: "filesystem id", Schema: &openAPISchema{Type: "string"}},
+			{Name: "operation", In: "query", Schema: &openAPISchema{Type: "string"}},
+			{Name: "status", In: "query", Schema: &openAPISchema{Type: "string"}},
+			{Name: "limit", In: "query", Schema: &openAPISchema{Type: "integer", Minimum: int64Ptr(1), Maximum: int64Ptr(maxTaskListLimit)}},
+		},
+	},
+	{
+		method: http.MethodGet, path: "/{account}/drift", id: "DriftList", summary: "List the drift of the filesystems from their last applied configuration", tag: "filesystems", status: http.StatusOK, response: []*FileSystemDrift{},
+		query: []*openAPIParameter{
+			{Name: "group", In: "query", Schema: &openAPISchema{Type: "string"}},
+		},
+	},
+	{method: http.MethodGet, path: "/{account}/orphans", id: "OrphanList", summary: "List the resources left behind by partially failed filesystem creates and deletes", tag: "orphans", status: http.StatusOK, response: []*Orphan{}},
+	{method: http.MethodPost, path: "/{account}/orphans/cleanup", id: "OrphanCleanup", summary: "Delete the selected orphaned resources", tag: "orphans", request: OrphanCleanupRequest{}, status: http.StatusAccepted, response: OrphanCleanupResponse{}},
+
+	{method: http.MethodGet, path: "/{account}/filesystems", id: "FileSystemList", summary: "List the filesystems in an account", tag: "filesystems", status: http.StatusOK, response: []string{}},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}", id: "FileSystemListGroup", summary: "List the filesystems in a space", tag: "filesystems", status: http.StatusOK, response: []string{}},
+	{method: http.MethodPost, path: "/{account}/filesystems/{group}", id: "FileSystemCreate", summary: "Create a filesystem", tag: "filesystems", request: FileSystemCreateRequest{}, status: http.StatusAccepted, response: FileSystemResponse{}},
+	{
+		method: http.MethodDelete, path: "/{account}/filesystems/{group}", id: "SpaceTeardown", summary: "Delete all of the filesystems in a space", tag: "filesystems", status: http.StatusAccepted, response: SpaceTeardownResponse{},
+		query: []*openAPIParameter{
+			{Name: "dryRun", In: "query", Description: "list the filesystems that would be deleted without deleting them", Schema: &openAPISchema{Type: "boolean"}},
+		},
+	},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}", id: "FileSystemShow", summary: "Get a filesystem", tag: "filesystems", status: http.StatusOK, response: FileSystemResponse{}},
+	{method: http.MethodPut, path: "/{account}/filesystems/{group}/{id}", id: "FileSystemUpdate", summary: "Update a filesystem", tag: "filesystems", request: FileSystemUpdateRequest{}, status: http.StatusAccepted},
+	{
+		method: http.MethodDelete, path: "/{account}/filesystems/{group}/{id}", id: "FileSystemDelete", summary: "Delete a filesystem", tag: "filesystems", status: http.StatusAccepted,
+		query: []*openAPIParameter{
+			{Name: "callbackUrl", In: "query", Description: "URL notified when the task finishes", Schema: &openAPISchema{Type: "string"}},
+		},
+	},
+	{
+		method: http.MethodPut, path: "/{account}/filesystems/{group}/{name}/spec", id: "FileSystemSpecApply", summary: "Apply the spec of a filesystem, returning the plan of the changes", tag: "filesystems",
+		request: FileSystemSpec{}, requestYAML: true, status: http.StatusAccepted, response: FileSystemSpecPlan{},
+		query: []*openAPIParameter{
+			{Name: "dryRun", In: "query", Description: "return the plan without applying it", Schema: &openAPISchema{Type: "boolean"}},
+		},
+	},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}/cost", id: "FileSystemCost", summary: "Estimate the monthly cost of a filesystem", tag: "costs", status: http.StatusOK, response: FileSystemCostResponse{}},
+
+	{method: http.MethodPost, path: "/{account}/filesystems/{group}/{id}/users", id: "UsersCreate", summary: "Create a filesystem user", tag: "users", request: FileSystemUserCreateRequest{}, status: http.StatusOK, response: FileSystemUserResponse{}},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}/users", id: "UsersList", summary: "List the filesystem users", tag: "users", status: http.StatusOK, response: []string{}},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}/users/{user}", id: "UsersShow", summary: "Get a filesystem user", tag: "users", status: http.StatusOK, response: FileSystemUserResponse{}},
+	{method: http.MethodPut, path: "/{account}/filesystems/{group}/{id}/users/{user}", id: "UsersUpdate", summary: "Update a filesystem user, optionally resetting its access key", tag: "users", request: FileSystemUserUpdateRequest{}, status: http.StatusOK, response: FileSystemUserResponse{}},
+	{method: http.MethodDelete, path: "/{account}/filesystems/{group}/{id}/users/{user}", id: "UsersDelete", summary: "Delete a filesystem user", tag: "users", status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}/aps", id: "FileSystemAPList", summary: "List the access points of a filesystem", tag: "access points", status: http.StatusOK, response: []string{}},
+	{method: http.MethodPost, path: "/{account}/filesystems/{group}/{id}/aps", id: "FileSystemAPCreate", summary: "Create an access point", tag: "access points", request: AccessPointCreateRequest{}, status: http.StatusAccepted, response: AccessPoint{}},
+	{method: http.MethodGet, path: "/{account}/filesystems/{group}/{id}/aps/{apid}", id: "FileSystemAPShow", summary: "Get an access point", tag: "access points", status: http.StatusOK, response: AccessPoint{}},
+	{method: http.MethodDelete, path: "/{account}/filesystems/{group}/{id}/aps/{apid}", id: "FileSystemAPDelete", summary: "Delete an access point", tag: "access points", status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/{account}/costs/{group}", id: "GroupCost", summary: "Estimate the monthly cost of the filesystems in a space", tag: "costs", status: http.StatusOK, response: GroupCostResponse{}},
+	{method: http.MethodGet, path: "/{account}/quotas/{group}", id: "QuotaShow", summary: "Get the quotas and usage of a space", tag: "quotas", status: http.StatusOK, response: QuotaResponse{}},
+}
+
+// newOpenAPIDocument generates the OpenAPI document from the operations, reflecting the schemas of their
+// request and response types
+func newOpenAPIDocument(version string, operations []*apiOperation) *openAPIDocument {
+	g := &schemaGenerator{schemas: map[string]*openAPISchema{}}
+
+	doc := &openAPIDocument{
+		OpenAPI:    "3.0.3",
+		Info:       openAPIInfo{Title: "efs-api", Version: version},
+		Servers:    []openAPIServer{{URL: openAPIBasePath}},
+		Paths:      map[string]openAPIPathItem{},
+		Components: openAPIComponents{Schemas: g.schemas},
+		operations: map[string]*openAPIOperation{},
+	}
+
+	errorSchema := g.schema(reflect.TypeOf(ErrorResponse{}))
+
+	for _, o := range operations {
+		op := &openAPIOperation{
+			OperationID: o.id,
+			Summary:     o.summary,
+			Parameters:  append(pathParametersOf(o.path), o.query...),
+			Responses: map[string]*openAPIResponse{
+				"default": {
+					Description: "error",
+					Content:     map[string]*openAPIMediaType{"application/json": {Schema: errorSchema}},
+				},
+			},
+		}
+
+		if o.tag != "" {
+			op.Tags = []string{o.tag}
+		}
+
+		if o.request != nil {
+			schema := g.schema(reflect.TypeOf(o.request))
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]*openAPIMediaType{"application/json": {Schema: schema}},
+			}
+
+			if o.requestYAML {
+				op.RequestBody.Content["application/yaml"] = &openAPIMediaType{Schema: schema}
+			}
+		}
+
+		resp := &openAPIResponse{Description: http.StatusText(o.status)}
+		switch {
+		case o.response != nil:
+			resp.Content = map[string]*openAPIMediaType{"application/json": {Schema: g.schema(reflect.TypeOf(o.response))}}
+		case o.contentType != "":
+			resp.Content = map[string]*openAPIMediaType{o.contentType: {Schema: &openAPISchema{Type: "string"}}}
+		}
+		op.Responses[strconv.Itoa(o.status)] = resp
+
+		if doc.Paths[o.path] == nil {
+			doc.Paths[o.path] = openAPIPathItem{}
+		}
+		doc.Paths[o.path][strings.ToLower(o.method)] = op
+		doc.operations[routeKey(o.method, o.path)] = op
+	}
+
+	return doc
+}
+
+// operation returns the operation for the method and the route path template, or nil if it's not in the document
+func (d *openAPIDocument) operation(method, path string) *openAPIOperation {
+	return d.operations[routeKey(method, path)]
+}
+
+// resolve returns the schema referenced by the schema, or the schema if it isn't a reference
+func (d *openAPIDocument) resolve(schema *openAPISchema) *openAPISchema {
+	if schema == nil || schema.Ref == "" {
+		return schema
+	}
+	return d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+}
+
+// pathParametersOf returns the parameters of the variables in the path template
+func pathParametersOf(path string) []*openAPIParameter {
+	params := []*openAPIParameter{}
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		name := strings.Trim(segment, "{}")
+
+		p := &openAPIParameter{Name: name, In: "path", Required: true, Schema: &openAPISchema{Type: "string"}}
+		if known, ok := pathParameters[name]; ok {
+			p.Description = known.Description
+			p.Schema = known.Schema
+		}
+
+		// the task routes use the id variable for the task id
+		if name == "id" && strings.HasPrefix(path, "/tasks/") {
+			p.Description = pathParameters["task"].Description
+			p.Schema = pathParameters["task"].Schema
+		}
+
+		params = append(params, p)
+	}
+	return params
+}
+
+// schemaGenerator reflects the OpenAPI schemas of go types.  Structs are added to the components of the
+// document and referenced by their type name.
+type schemaGenerator struct {
+	schemas map[string]*openAPISchema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) *openAPISchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Uint, reflect.Uint32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &openAPISchema{Type: "string", Format: "date-time"}
+		}
+
+		name := t.Name()
+		if _, ok := g.schemas[name]; !ok {
+			// add the component before generating its schema, in case the struct references itself
+			s := &openAPISchema{}
+			g.schemas[name] = s
+			*s = *g.structSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	default:
+		return &openAPISchema{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *openAPISchema {
+	// unknown fields are rejected instead of being silently ignored
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}, AdditionalProperties: false}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		fs := g.schema(f.Type)
+
+		// the AWS types tag their required fields and length and value limits
+		if f.Tag.Get("required") == "true" {
+			s.Required = append(s.Required, name)
+		}
+
+		if min, err := strconv.ParseInt(f.Tag.Get("min"), 10, 64); err == nil {
+			switch fs.Type {
+			case "string":
+				fs.MinLength = int64Ptr(min)
+			case "integer":
+				fs.Minimum = int64Ptr(min)
+			}
+		}
+
+		if max, err := strconv.ParseInt(f.Tag.Get("max"), 10, 64); err == nil {
+			switch fs.Type {
+			case "string":
+				fs.MaxLength = int64Ptr(max)
+			case "integer":
+				fs.Maximum = int64Ptr(max)
+			}
+		}
+
+		if rule, ok := fieldRules[t.Name()+"."+f.Name]; ok {
+			if rule.required {
+				s.Required = append(s.Required, name)
+			}
+			rule.apply(fs)
+		}
+
+		s.Properties[name] = fs
+	}
+
+	sort.Strings(s.Required)
+
+	return s
+}
+
+// apply adds the constraints of the rule to the schema of the field, or its items if it's a list
+func (r fieldRule) apply(s *openAPISchema) {
+	if s.Type == "array" && s.Items != nil {
+		s = s.Items
+	}
+
+	if r.enum != nil {
+		s.Enum = r.enum
+	}
+
+	if r.pattern != "" {
+		s.Pattern = r.pattern
+	}
+
+	if r.minLength != nil {
+		s.MinLength = r.minLength
+	}
+
+	if r.maxLength != nil {
+		s.MaxLength = r.maxLength
+	}
+
+	if r.minimum != nil {
+		s.Minimum = r.minimum
+	}
+
+	if r.maximum != nil {
+		s.Maximum = r.maximum
+	}
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+// routeKey returns the key of the method and path template, relative to the API base path
+func routeKey(method, path string) string {
+	return fmt.Sprintf("%s %s", method, strings.TrimPrefix(path, openAPIBasePath))
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/flywheel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+func newOpenAPITestServer(t *testing.T) *server {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{router: mux.NewRouter(), flywheel: manager}
+	s.routes()
+	return s
+}
+
+func TestOpenAPIDocumentRoutes(t *testing.T) {
+	s := newOpenAPITestServer(t)
+
+	routes := map[string]bool{}
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || path == openAPIBasePath {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			// routes without methods, like the flywheel handler, are documented as GET
+			methods = []string{http.MethodGet}
+		}
+
+		for _, m := range methods {
+			routes[routeKey(m, path)] = true
+			if s.openAPI.operation(m, path) == nil {
+				t.Errorf("expected route %s %s in the openapi document", m, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range s.openAPI.operations {
+		if !routes[key] {
+			t.Errorf("expected openapi operation %s to be a route", key)
+		}
+	}
+}
+
+func TestNewOpenAPIDocument(t *testing.T) {
+	doc := newOpenAPIDocument("1.2.3", apiOperations)
+
+	if doc.Info.Version != "1.2.3" {
+		t.Errorf("expected version 1.2.3, got %s", doc.Info.Version)
+	}
+
+	for _, name := range []string{"FileSystemCreateRequest", "FileSystemResponse", "AccessPoint", "AccessPointCreateRequest", "FileSystemUserResponse", "PosixUser", "RootDirectory", "ErrorResponse", "Tag"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("expected %s component schema", name)
+		}
+	}
+
+	create := doc.Components.Schemas["FileSystemCreateRequest"]
+	if !reflect.DeepEqual(create.Required, []string{"Name"}) {
+		t.Errorf("expected Name to be required, got %v", create.Required)
+	}
+
+	if !reflect.DeepEqual(create.Properties["BackupPolicy"].Enum, backupPolicies) {
+		t.Errorf("expected backup policy enum, got %v", create.Properties["BackupPolicy"].Enum)
+	}
+
+	if ref := create.Properties["AccessPoints"].Items.Ref; ref != "#/components/schemas/AccessPointCreateRequest" {
+		t.Errorf("expected access points to reference AccessPointCreateRequest, got %s", ref)
+	}
+
+	// the required fields of the AWS types come from their struct tags
+	if posix := doc.Components.Schemas["PosixUser"]; !reflect.DeepEqual(posix.Required, []string{"Gid", "Uid"}) {
+		t.Errorf("expected Gid and Uid to be required, got %v", posix.Required)
+	}
+
+	op := doc.operation(http.MethodDelete, "/v1/efs/{account}/filesystems/{group}/{id}/aps/{apid}")
+	if op == nil {
+		t.Fatal("expected delete access point operation")
+	}
+
+	names := []string{}
+	for _, p := range op.Parameters {
+		names = append(names, p.Name)
+	}
+
+	if expected := []string{"account", "group", "id", "apid"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected parameters %v, got %v", expected, names)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("expected document to marshal, got %s", err)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	s := newOpenAPITestServer(t)
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/efs/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out["openapi"] != "3.0.3" {
+		t.Errorf("expected openapi 3.0.3, got %v", out["openapi"])
+	}
+
+	if _, ok := out["paths"].(map[string]interface{})["/{account}/filesystems/{group}/{id}/users/{user}"]; !ok {
+		t.Error("expected users path in the document")
+	}
+}
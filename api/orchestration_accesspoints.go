@@ -3,18 +3,26 @@ package api
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/YaleSpinup/apierror"
 	yefs "github.com/YaleSpinup/efs-api/efs"
 	ykms "github.com/YaleSpinup/efs-api/kms"
+	"github.com/YaleSpinup/efs-api/saga"
 	"github.com/YaleSpinup/flywheel"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/efs"
 	"github.com/google/uuid"
 )
 
-func (s *server) accessPointCreate(ctx context.Context, account, fsid string, req *AccessPointCreateRequest) (*AccessPoint, *flywheel.Task, error) {
+func (s *server) accessPointCreate(ctx context.Context, account, group, fsid string, req *AccessPointCreateRequest) (*AccessPoint, *flywheel.Task, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.validateCallbackURL(ctx, req.CallbackURL); err != nil {
+		return nil, nil, err
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -32,7 +40,7 @@ func (s *server) accessPointCreate(ctx context.Context, account, fsid string, re
 	}
 
 	kmsService := ykms.New(ykms.WithSession(session.Session))
-	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.kmsKeyTags, s.org)
+	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.conf().kmsKeyTags, s.org)
 	if err != nil {
 		return nil, nil, apierror.New(apierror.ErrInternalError, "failed to find kms key by tags", nil)
 	}
@@ -43,6 +51,15 @@ func (s *server) accessPointCreate(ctx context.Context, account, fsid string, re
 		return nil, nil, err
 	}
 
+	accessPoints, err := service.ListAccessPoints(ctx, fsid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkAccessPointQuota(s.quotaForGroup(group), len(accessPoints)); err != nil {
+		return nil, nil, err
+	}
+
 	// if the Name is empty, just make one up
 	if req.Name == "" {
 		req.Name = uuid.NewString()
@@ -78,40 +95,56 @@ func (s *server) accessPointCreate(ctx context.Context, account, fsid string, re
 	}
 
 	// start the async orchestration to wait for access point to become available
+	fsCtx, cancel := s.orchestrationContext(ctx, task)
 	go func() {
+		defer cancel()
+
 		fsid := aws.StringValue(filesystem.FileSystemId)
 		apid := aws.StringValue(out.AccessPointId)
 
-		fsCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		msgChan, errChan := s.startTask(fsCtx, task)
+		msgChan, errChan := s.startTask(fsCtx, task, taskInfo{
+			Operation:    kindAccessPointCreate,
+			Account:      account,
+			Group:        group,
+			FileSystemID: fsid,
+			CallbackURL:  req.CallbackURL,
+		})
 
 		msgChan <- fmt.Sprintf("requested creation of accesspoint for filesystem %s", fsid)
 
-		// wait for the accesspoint to become available
-		if err = retry(10, 2*time.Second, func() error {
-			msg := fmt.Sprintf("checking if accesspoint %s is available before continuing", apid)
-			msgChan <- msg
-
-			out, err := service.GetAccessPoint(fsCtx, apid)
-			if err != nil {
-				msgChan <- fmt.Sprintf("got error checking if accesspoint %s is available: %s", apid, err)
-				return err
-			}
-
-			if status := aws.StringValue(out.LifeCycleState); status != "available" {
-				msgChan <- fmt.Sprintf("accesspoint %s is not yet available (%s)", apid, status)
-				return fmt.Errorf("accesspoint %s not yet available", apid)
-			}
-
-			msgChan <- fmt.Sprintf("accesspoint %s is available", apid)
-			return nil
-		}); err != nil {
-			errChan <- fmt.Errorf("failed to create access point %s for filesystem %s, timeout waiting to become available: %s", apid, fsid, err.Error())
-			return
+		// the access point was created before the task started, it's deleted if it never becomes available
+		steps := []saga.Step{
+			{
+				Name: "create-access-point",
+				Undo: func(ctx context.Context) error {
+					logger(ctx).Errorf("rollback: deleting accesspoint %s", apid)
+					return service.DeleteAccessPoint(ctx, apid)
+				},
+			},
+			{
+				Name: "wait-access-point-available",
+				Do: func(ctx context.Context) error {
+					msgChan <- fmt.Sprintf("checking if accesspoint %s is available before continuing", apid)
+
+					// wait for the accesspoint to become available
+					w := s.waiters.get(waitAccessPoint).WithProgress(taskProgress(ctx, msgChan))
+					if err := service.WaitForAccessPointState(ctx, w, apid, "available"); err != nil {
+						return fmt.Errorf("failed to create access point %s for filesystem %s, error waiting to become available: %s", apid, fsid, err.Error())
+					}
+
+					msgChan <- fmt.Sprintf("accesspoint %s is available", apid)
+					return nil
+				},
+			},
 		}
 
+		err := saga.New(task.ID, steps,
+			saga.WithCompleted("create-access-point"),
+			saga.WithProgress(taskProgress(fsCtx, msgChan)),
+		).Run(fsCtx)
+		if err != nil {
+			errChan <- err
+		}
 	}()
 
 	ap := &AccessPoint{
@@ -144,7 +177,7 @@ func (s *server) listFilesystemAccessPoints(ctx context.Context, account, fsid s
 	}
 
 	kmsService := ykms.New(ykms.WithSession(session.Session))
-	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.kmsKeyTags, s.org)
+	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.conf().kmsKeyTags, s.org)
 	if err != nil {
 		return nil, apierror.New(apierror.ErrInternalError, "failed to find kms key by tags", nil)
 	}
@@ -163,7 +196,7 @@ func (s *server) listFilesystemAccessPoints(ctx context.Context, account, fsid s
 	return output, nil
 }
 
-func (s *server) getFilesystemAccessPoint(ctx context.Context, account, apid string) (*AccessPoint, error) {
+func (s *server) getFilesystemAccessPoint(ctx context.Context, account, fsid, apid string) (*AccessPoint, error) {
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -181,7 +214,7 @@ func (s *server) getFilesystemAccessPoint(ctx context.Context, account, apid str
 	}
 
 	kmsService := ykms.New(ykms.WithSession(session.Session))
-	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.kmsKeyTags, s.org)
+	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.conf().kmsKeyTags, s.org)
 	if err != nil {
 		return nil, apierror.New(apierror.ErrInternalError, "failed to find kms key by tags", nil)
 	}
@@ -193,11 +226,15 @@ func (s *server) getFilesystemAccessPoint(ctx context.Context, account, apid str
 		return nil, err
 	}
 
+	if aws.StringValue(out.FileSystemId) != fsid {
+		return nil, errAccessPointNotInFileSystem(apid, fsid)
+	}
+
 	return accessPointResponseFromEFS(out), nil
 }
 
-// deleteFilesystemAccessPoint
-func (s *server) deleteFilesystemAccessPoint(ctx context.Context, account, apid string) error {
+// deleteFilesystemAccessPoint deletes the access point if it belongs to the filesystem
+func (s *server) deleteFilesystemAccessPoint(ctx context.Context, account, fsid, apid string) error {
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -215,13 +252,22 @@ func (s *server) deleteFilesystemAccessPoint(ctx context.Context, account, apid
 	}
 
 	kmsService := ykms.New(ykms.WithSession(session.Session))
-	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.kmsKeyTags, s.org)
+	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.conf().kmsKeyTags, s.org)
 	if err != nil {
 		return apierror.New(apierror.ErrInternalError, "failed to find kms key by tags", nil)
 	}
 
 	service := yefs.New(yefs.WithSession(session.Session), yefs.WithDefaultKMSKeyId(account, kmsKeyId))
 
+	ap, err := service.GetAccessPoint(ctx, apid)
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(ap.FileSystemId) != fsid {
+		return errAccessPointNotInFileSystem(apid, fsid)
+	}
+
 	if err := service.DeleteAccessPoint(ctx, apid); err != nil {
 		return err
 	}
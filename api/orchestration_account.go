@@ -9,7 +9,6 @@ import (
 	"github.com/YaleSpinup/apierror"
 	"github.com/YaleSpinup/aws-go/services/iam"
 	"github.com/aws/aws-sdk-go/aws"
-	log "github.com/sirupsen/logrus"
 )
 
 var efsAdminPolicyDoc string
@@ -50,7 +49,7 @@ func cachePolicyDoc() error {
 
 // prepareAccount sets up the account for user management by creating the admin policy and group
 func (o *userOrchestrator) prepareAccount(ctx context.Context) error {
-	log.Info("preparing account for user management")
+	logger(ctx).Info("preparing account for user management")
 
 	path := fmt.Sprintf("/spinup/%s/", o.org)
 
@@ -78,7 +77,7 @@ func (o *userOrchestrator) prepareAccount(ctx context.Context) error {
 // returns.  if the policy is found, it gets the policy document and compares to the expected policy document, updating
 // if they differ.
 func (o *userOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name, path string) (string, error) {
-	log.Infof("creating policy %s in %s if missing", name, path)
+	logger(ctx).Infof("creating policy %s in %s if missing", name, path)
 
 	policy, err := o.iamClient.GetPolicyByName(ctx, name, path)
 	if err != nil {
@@ -86,7 +85,7 @@ func (o *userOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name,
 			return "", err
 		}
 
-		log.Infof("policy %s not found, creating", name)
+		logger(ctx).Infof("policy %s not found, creating", name)
 	}
 
 	// if the policy isn't found, create it and return
@@ -120,10 +119,10 @@ func (o *userOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name,
 	var updatePolicy bool
 	doc := iam.PolicyDocument{}
 	if err := json.Unmarshal([]byte(d), &doc); err != nil {
-		log.Warnf("error getting policy document: %s, updating", err)
+		logger(ctx).Warnf("error getting policy document: %s, updating", err)
 		updatePolicy = true
 	} else if !iam.PolicyDeepEqual(doc, EfsAdminPolicy) {
-		log.Warn("policy document is not the same, updating")
+		logger(ctx).Warn("policy document is not the same, updating")
 		updatePolicy = true
 	}
 
@@ -141,14 +140,14 @@ func (o *userOrchestrator) userCreatePolicyIfMissing(ctx context.Context, name,
 // userCreateGroupIfMissing gets the group and creates it if it's missing.  it also checks if the correct
 // policyArn is attached to the group, and attaches it if it's not.
 func (o *userOrchestrator) userCreateGroupIfMissing(ctx context.Context, name, path, policyArn string) error {
-	log.Infof("creating group %s in %s and assigning policy %s if missing", name, path, policyArn)
+	logger(ctx).Infof("creating group %s in %s and assigning policy %s if missing", name, path, policyArn)
 
 	if _, err := o.iamClient.GetGroupWithPath(ctx, name, path); err != nil {
 		if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
 			return err
 		}
 
-		log.Infof("group %s not found, creating", name)
+		logger(ctx).Infof("group %s not found, creating", name)
 
 		if _, err := o.iamClient.CreateGroup(ctx, name, path); err != nil {
 			return err
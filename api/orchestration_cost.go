@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+
+	yefs "github.com/YaleSpinup/efs-api/efs"
+)
+
+// filesystemCost estimates the monthly cost of a filesystem in a group
+func (s *server) filesystemCost(ctx context.Context, account, group, fs string) (*FileSystemCostResponse, error) {
+	if exists, err := s.fileSystemExists(ctx, account, group, fs); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, apierror.New(apierror.ErrNotFound, "filesystem doesnt exist", nil)
+	}
+
+	service, region, err := s.filesystemCostService(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	pricing, err := s.pricingForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return filesystemCostFromService(ctx, service, region, pricing, fs)
+}
+
+// filesystemGroupCost estimates the monthly cost of all of the filesystems in a group and rolls them up
+func (s *server) filesystemGroupCost(ctx context.Context, account, group string) (*GroupCostResponse, error) {
+	fsList, err := s.filesystemList(ctx, account, group)
+	if err != nil {
+		return nil, err
+	}
+
+	service, region, err := s.filesystemCostService(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	pricing, err := s.pricingForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GroupCostResponse{
+		Currency:    pricing.Currency,
+		FileSystems: make([]*FileSystemCostResponse, 0, len(fsList)),
+		Group:       group,
+	}
+
+	if response.Currency == "" {
+		response.Currency = "USD"
+	}
+
+	var total float64
+	for _, fs := range fsList {
+		cost, err := filesystemCostFromService(ctx, service, region, pricing, fs)
+		if err != nil {
+			return nil, err
+		}
+
+		total += cost.MonthlyCost
+		response.FileSystems = append(response.FileSystems, cost)
+	}
+	response.MonthlyCost = roundCents(total)
+
+	return response, nil
+}
+
+// filesystemCostService assumes a role in the account and returns the EFS service and the region of the session
+func (s *server) filesystemCostService(ctx context.Context, account string) (*yefs.EFS, string, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := generatePolicy("elasticfilesystem:*")
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, "", apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	service := yefs.New(yefs.WithSession(session.Session))
+
+	return &service, aws.StringValue(session.Session.Config.Region), nil
+}
+
+// pricingForRegion returns the configured pricing table for a region
+func (s *server) pricingForRegion(region string) (common.Pricing, error) {
+	pricing, ok := s.conf().pricing[region]
+	if !ok {
+		msg := fmt.Sprintf("pricing is not configured for region %s", region)
+		return common.Pricing{}, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	return pricing, nil
+}
+
+// filesystemCostFromService gets the filesystem and its lifecycle configuration and estimates the cost
+func filesystemCostFromService(ctx context.Context, service *yefs.EFS, region string, pricing common.Pricing, fs string) (*FileSystemCostResponse, error) {
+	filesystem, err := service.GetFileSystem(ctx, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	transitionToIA, _, err := service.GetFilesystemLifecycle(ctx, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	logger(ctx).Debugf("estimating cost of filesystem %s in %s with lifecycle %s", fs, region, transitionToIA)
+
+	return fileSystemCostFromEFS(filesystem, transitionToIA, region, pricing), nil
+}
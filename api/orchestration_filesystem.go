@@ -3,13 +3,17 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws/arn"
 	"strings"
 	"time"
 
 	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/audit"
 	"github.com/YaleSpinup/efs-api/resourcegroupstaggingapi"
+	"github.com/YaleSpinup/efs-api/saga"
+	"github.com/YaleSpinup/efs-api/waiter"
 	"github.com/YaleSpinup/flywheel"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/efs"
@@ -24,6 +28,20 @@ import (
 
 // filesystemCreate orchestrates the creation of an EFS filesystem and all related mount targets, policies, etc.
 func (s *server) filesystemCreate(ctx context.Context, account, group string, req *FileSystemCreateRequest) (*FileSystemResponse, *flywheel.Task, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.validateCallbackURL(ctx, req.CallbackURL); err != nil {
+		return nil, nil, err
+	}
+
+	for _, ap := range req.AccessPoints {
+		if err := s.validateCallbackURL(ctx, ap.CallbackURL); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -40,19 +58,21 @@ func (s *server) filesystemCreate(ctx context.Context, account, group string, re
 		return nil, nil, apierror.New(apierror.ErrNotFound, "failed to assume role in account", nil)
 	}
 
-	kmsService := ykms.New(ykms.WithSession(session.Session))
-	kmsKeyId, err := kmsService.GetKmsKeyIdByTags(ctx, s.kmsKeyTags, s.org)
+	// the subnets, security groups and kms key configured for the account are used when they're not in the request
+	defaults, _ := s.accountDefaults(account)
+
+	kmsKeyId := defaults.DefaultKmsKeyId
+	if kmsKeyId == "" {
+		kmsService := ykms.New(ykms.WithSession(session.Session))
+		kmsKeyId, err = kmsService.GetKmsKeyIdByTags(ctx, s.conf().kmsKeyTags, s.org)
+	}
 
 	log.Printf("KMS Key: %s", kmsKeyId)
 
 	service := yefs.New(yefs.WithSession(session.Session),
 		yefs.WithDefaultKMSKeyId(account, kmsKeyId),
-		yefs.WithDefaultSgs(req.Sgs),
-		yefs.WithDefaultSubnets(req.Subnets))
-
-	if req.Name == "" {
-		return nil, nil, apierror.New(apierror.ErrBadRequest, "Name is a required field", nil)
-	}
+		yefs.WithDefaultSgs(defaults.DefaultSgs),
+		yefs.WithDefaultSubnets(defaults.DefaultSubnets))
 
 	// normalize the tags passed in the request
 	req.Tags = normalizeTags(s.org, req.Name, group, req.Tags)
@@ -62,38 +82,25 @@ func (s *server) filesystemCreate(ctx context.Context, account, group string, re
 		req.KmsKeyId = kmsKeyId
 	}
 
-	// validate lifecycle configuration setting
-	switch req.LifeCycleConfiguration {
-	case "", "NONE":
+	// default the settings that aren't in the request, the request was validated above
+	if req.LifeCycleConfiguration == "" {
 		req.LifeCycleConfiguration = "NONE"
-	case "AFTER_7_DAYS",
-		"AFTER_14_DAYS",
-		"AFTER_30_DAYS",
-		"AFTER_60_DAYS",
-		"AFTER_90_DAYS":
-		log.Debugf("setting Tansition to Infrequent access to %s", req.LifeCycleConfiguration)
-	default:
-		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid lifecycle configuration, valid values are NONE | AFTER_7_DAYS | AFTER_14_DAYS | AFTER_30_DAYS | AFTER_60_DAYS | AFTER_90_DAYS", nil)
-	}
-
-	// validate intelligent tiering configuration setting
-	switch req.TransitionToPrimaryStorageClass {
-	case "", "NONE":
+	}
+
+	if req.TransitionToPrimaryStorageClass == "" {
 		req.TransitionToPrimaryStorageClass = "NONE"
-	case "AFTER_1_ACCESS":
-		log.Debugf("setting Tansition to primary access to %s", req.TransitionToPrimaryStorageClass)
-	default:
-		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid transition to primary storage class rule, valid values are NONE | AFTER_1_ACCESS", nil)
 	}
 
-	// validate backup policy setting
-	switch req.BackupPolicy {
-	case "":
+	if req.BackupPolicy == "" {
 		req.BackupPolicy = "DISABLED"
-	case "DISABLED", "ENABLED":
-		log.Debugf("setting backup policy to %s", req.BackupPolicy)
-	default:
-		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid backup policy, valid values are ENABLED | DISABLED", nil)
+	}
+
+	logger(ctx).Debugf("creating filesystem with lifecycle configuration %s, transition to primary storage class %s and backup policy %s",
+		req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass, req.BackupPolicy)
+
+	// check the filesystem and access point quotas for the space
+	if err := s.checkFileSystemQuota(ctx, account, group, len(req.AccessPoints)); err != nil {
+		return nil, nil, err
 	}
 
 	// generate a new task to track and start it
@@ -124,7 +131,7 @@ func (s *server) filesystemCreate(ctx context.Context, account, group string, re
 			break
 		}
 
-		log.Debugf("setting availability zone to %s", az)
+		logger(ctx).Debugf("setting availability zone to %s", az)
 
 		input.AvailabilityZoneName = aws.String(az)
 		req.Subnets = []string{subnet}
@@ -136,210 +143,295 @@ func (s *server) filesystemCreate(ctx context.Context, account, group string, re
 		return nil, nil, err
 	}
 
-	// start the async orchestration to wait for filesystem to become available, set policies and create mount targets
-	go func() {
-		fsid := aws.StringValue(filesystem.FileSystemId)
-
-		fsCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		msgChan, errChan := s.startTask(fsCtx, task)
-
-		msgChan <- fmt.Sprintf("requested creation of filesystem %s", fsid)
-
-		// setup err var, rollback function list and defer execution
-		var err error
-		var rollBackTasks []rollbackFunc
-		defer func() {
-			if err != nil {
-				log.Errorf("recovering from error: %s, executing %d rollback tasks", err, len(rollBackTasks))
-				rollBack(&rollBackTasks)
-			}
-		}()
-
-		// wait for the filesystem to become available
-		if err = retry(10, 2*time.Second, func() error {
-			msg := fmt.Sprintf("checking if filesystem %s is available before continuing", fsid)
-			msgChan <- msg
+	// resolve the security groups before the orchestration is persisted so that it can be resumed
+	if req.Sgs == nil {
+		logger(ctx).Debugf("setting default security groups on mount target")
+		req.Sgs = service.DefaultSgs
+	}
 
-			out, err := service.GetFileSystem(fsCtx, fsid)
-			if err != nil {
-				msgChan <- fmt.Sprintf("got error checking if filesystem %s is available: %s", fsid, err)
-				return err
-			}
+	// start the async orchestration to wait for filesystem to become available, set policies and create mount targets
+	s.runOrchestration(ctx, task, &orchestrationState{
+		TaskID:        task.ID,
+		Kind:          kindFilesystemCreate,
+		Account:       account,
+		Group:         group,
+		Region:        regionFromContext(ctx),
+		FileSystemID:  aws.StringValue(filesystem.FileSystemId),
+		FileSystemArn: aws.StringValue(filesystem.FileSystemArn),
+		Request:       req,
+		CallbackURL:   req.CallbackURL,
+		RequestID:     requestIDFromContext(ctx),
+		Completed:     []string{"create-filesystem"},
+	})
 
-			if status := aws.StringValue(out.LifeCycleState); status != "available" {
-				msgChan <- fmt.Sprintf("filesystem %s is not yet available (%s)", fsid, status)
-				return fmt.Errorf("filsystem %s not yet available", fsid)
-			}
+	return fileSystemResponseFromEFS(filesystem, nil, nil, req.AccessPolicy, req.BackupPolicy, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass), task, nil
+}
 
-			msgChan <- fmt.Sprintf("filesystem %s is available", fsid)
-			return nil
-		}); err != nil {
-			errChan <- fmt.Errorf("failed to create filesystem %s, timeout waiting to become available: %s", fsid, err.Error())
-			return
-		}
+// filesystemCreateSteps returns the steps of the filesystem create orchestration: wait for the filesystem
+// to become available, set the backup policy, lifecycle configuration and access policy, create the mount
+// targets and wait for them to become available, then create the access points
+func (s *server) filesystemCreateSteps(ctx context.Context, state *orchestrationState, msgChan chan<- string) ([]saga.Step, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", state.Account, s.session.RoleName)
+	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
+	if err != nil {
+		return nil, err
+	}
 
-		rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
-			log.Errorf("rollback: deleting filesystem: %s", fsid)
-			return service.DeleteFileSystem(fsCtx, fsid)
-		})
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		msgChan <- fmt.Sprintf("setting filesystem %s backup policy to %s", fsid, req.BackupPolicy)
+	service := yefs.New(yefs.WithSession(session.Session))
 
-		err = service.SetFileSystemBackup(fsCtx, fsid, req.BackupPolicy)
-		if err != nil {
-			errChan <- fmt.Errorf("failed to set backup policy for filesystem %s: %s", fsid, err.Error())
-			return
-		}
-		msgChan <- fmt.Sprintf("setting filesystem %s lifecycle configuration to %s", fsid, req.LifeCycleConfiguration)
+	account, group, fsid, req := state.Account, state.Group, state.FileSystemID, state.Request
+	if req == nil {
+		return nil, fmt.Errorf("missing request for filesystem %s create orchestration", fsid)
+	}
 
-		err = service.SetFileSystemLifecycle(fsCtx, fsid, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass)
+	// deleteMountTargets deletes the mount targets of the filesystem and waits for them to be gone, they're
+	// listed since the ones in the state may be missing after a resume
+	deleteMountTargets := func(ctx context.Context) error {
+		mts, err := service.ListMountTargetsForFileSystem(ctx, fsid)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to set lifecycle for filesystem %s: %s", fsid, err.Error())
-			return
+			return err
 		}
 
-		if req.AccessPolicy != nil {
-			msgChan <- fmt.Sprintf("setting filesystem %s access policy to %+v", fsid, req.AccessPolicy)
-
-			var policy []byte
-			policy, err = json.Marshal(efsPolicyFromFileSystemAccessPolicy(account, group, aws.StringValue(filesystem.FileSystemArn), req.AccessPolicy))
-			if err != nil {
-				errChan <- fmt.Errorf("failed to marshall access policy for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+		for _, mt := range mts {
+			mtid := aws.StringValue(mt.MountTargetId)
+			logger(ctx).Errorf("rollback: deleting mount target %s of filesystem %s", mtid, fsid)
 
-			err = service.SetFileSystemPolicy(fsCtx, fsid, string(policy))
-			if err != nil {
-				errChan <- fmt.Errorf("failed to set access policy for filesystem %s: %s", fsid, err.Error())
-				return
+			if err := service.DeleteMountTarget(ctx, mtid); err != nil {
+				return err
 			}
 		}
 
-		mounttargets := []*efs.MountTargetDescription{}
-		for _, subnet := range req.Subnets {
-			if req.Sgs == nil {
-				log.Debugf("setting default security groups on mount target")
-				req.Sgs = service.DefaultSgs
-			}
-
-			var mt *efs.MountTargetDescription
-			mt, err = service.CreateMountTarget(fsCtx, &efs.CreateMountTargetInput{
-				FileSystemId:   aws.String(fsid),
-				SecurityGroups: aws.StringSlice(req.Sgs),
-				SubnetId:       aws.String(subnet),
-			})
+		logger(ctx).Warnf("rollback: waiting for number of mount targets for filesystem %s to be 0", fsid)
+		return service.WaitForNoMountTargets(ctx, s.waiters.get(waitMountTarget), fsid)
+	}
 
-			if err != nil {
-				errChan <- fmt.Errorf("failed to create mount target for filesystem %s: %s", fsid, err)
-				return
-			}
+	// the filesystem was created before the orchestration started, it's deleted if a later step fails
+	steps := []saga.Step{
+		{
+			Name: "create-filesystem",
+			Undo: func(ctx context.Context) error {
+				// the access points created before a later step failed are deleted with the filesystem
+				aps, err := service.ListAccessPoints(ctx, fsid)
+				if err != nil {
+					return err
+				}
 
-			mounttargets = append(mounttargets, mt)
+				for _, ap := range aps {
+					apid := aws.StringValue(ap.AccessPointId)
+					logger(ctx).Errorf("rollback: deleting access point %s of filesystem %s", apid, fsid)
 
-			// TODO tag mount target eni?
-		}
+					if err := service.DeleteAccessPoint(ctx, apid); err != nil {
+						return err
+					}
+				}
 
-		// wait for mount targets to become available
-		if err = retry(10, 2*time.Second, func() error {
-			msgChan <- fmt.Sprintf("waiting for mount targets for filesystem %s to be available", fsid)
+				logger(ctx).Errorf("rollback: deleting filesystem: %s", fsid)
+				return service.DeleteFileSystem(ctx, fsid)
+			},
+		},
+		{
+			Name: "wait-filesystem-available",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("requested creation of filesystem %s", fsid)
+				msgChan <- fmt.Sprintf("checking if filesystem %s is available before continuing", fsid)
+
+				// wait for the filesystem to become available
+				w := s.waiters.get(waitFileSystem).WithProgress(taskProgress(ctx, msgChan))
+				if err := service.WaitForFileSystemState(ctx, w, fsid, "available"); err != nil {
+					return fmt.Errorf("failed to create filesystem %s, error waiting to become available: %s", fsid, err.Error())
+				}
 
-			mounttargets, err := service.ListMountTargetsForFileSystem(fsCtx, fsid)
-			if err != nil {
-				return fmt.Errorf("failed to list mount targets for filesystem %s: %s", fsid, err)
-			}
+				msgChan <- fmt.Sprintf("filesystem %s is available", fsid)
+				return nil
+			},
+		},
+		{
+			Name: "set-backup-policy",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("setting filesystem %s backup policy to %s", fsid, req.BackupPolicy)
 
-			for _, mt := range mounttargets {
-				if status := aws.StringValue(mt.LifeCycleState); status != "available" {
-					msg := fmt.Sprintf("filesystem %s mount target %s has status %s, not available", fsid, aws.StringValue(mt.MountTargetId), status)
-					return apierror.New(apierror.ErrNotFound, msg, nil)
+				if err := service.SetFileSystemBackup(ctx, fsid, req.BackupPolicy); err != nil {
+					return fmt.Errorf("failed to set backup policy for filesystem %s: %s", fsid, err.Error())
 				}
-			}
-
-			return nil
-		}); err != nil {
-			errChan <- err
-			return
-		}
+				return nil
+			},
+		},
+		{
+			Name: "set-lifecycle",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("setting filesystem %s lifecycle configuration to %s", fsid, req.LifeCycleConfiguration)
 
-		msgChan <- fmt.Sprintf("created %d mount targets for fs %s", len(mounttargets), fsid)
+				if err := service.SetFileSystemLifecycle(ctx, fsid, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass); err != nil {
+					return fmt.Errorf("failed to set lifecycle for filesystem %s: %s", fsid, err.Error())
+				}
+				return nil
+			},
+		},
+	}
 
-		rollBackTasks = append(rollBackTasks, func(ctx context.Context) error {
-			log.Errorf("rollback: deleting mount target for filesystem %s", fsid)
+	if req.AccessPolicy != nil {
+		steps = append(steps, saga.Step{
+			Name: "set-access-policy",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("setting filesystem %s access policy to %+v", fsid, req.AccessPolicy)
 
-			for _, mt := range mounttargets {
-				if err := service.DeleteMountTarget(fsCtx, aws.StringValue(mt.MountTargetId)); err != nil {
-					return err
+				policy, err := json.Marshal(efsPolicyFromFileSystemAccessPolicy(account, group, state.FileSystemArn, req.AccessPolicy))
+				if err != nil {
+					return fmt.Errorf("failed to marshall access policy for filesystem %s: %s", fsid, err.Error())
 				}
-			}
 
-			if err = retry(10, 2*time.Second, func() error {
-				log.Warnf("rollback: waiting for number of mount targets for filesystem %s to be 0", fsid)
+				if err := service.SetFileSystemPolicy(ctx, fsid, string(policy)); err != nil {
+					return fmt.Errorf("failed to set access policy for filesystem %s: %s", fsid, err.Error())
+				}
+				return nil
+			},
+		})
+	}
 
-				out, err := service.GetFileSystem(fsCtx, fsid)
+	steps = append(steps,
+		saga.Step{
+			Name: "create-mount-targets",
+			Do: func(ctx context.Context) error {
+				// skip subnets that already have a mount target when the step is resumed
+				existing, err := service.ListMountTargetsForFileSystem(ctx, fsid)
 				if err != nil {
-					log.Warnf("rollback: error getting filesystem %s during delete: %s", fsid, err)
-					return err
+					return fmt.Errorf("failed to list mount targets for filesystem %s: %s", fsid, err)
 				}
 
-				if num := aws.Int64Value(out.NumberOfMountTargets); num > 0 {
-					log.Warnf("number of mount targets for filesystem %s > 0 (current: %d)", fsid, num)
-					return fmt.Errorf("waiting for number of mount targets for filesystem %s to be 0 (current: %d)", fsid, num)
+				state.MountTargets = []string{}
+				subnets := map[string]bool{}
+				for _, mt := range existing {
+					subnets[aws.StringValue(mt.SubnetId)] = true
+					state.MountTargets = append(state.MountTargets, aws.StringValue(mt.MountTargetId))
 				}
 
-				return nil
-			}); err != nil {
-				return err
-			}
+				for _, subnet := range req.Subnets {
+					if subnets[subnet] {
+						continue
+					}
+
+					mt, err := service.CreateMountTarget(ctx, &efs.CreateMountTargetInput{
+						FileSystemId:   aws.String(fsid),
+						SecurityGroups: aws.StringSlice(req.Sgs),
+						SubnetId:       aws.String(subnet),
+					})
+					if err != nil {
+						err = fmt.Errorf("failed to create mount target for filesystem %s: %s", fsid, err)
+
+						// a failed step isn't compensated, so the mount targets created so far are deleted here
+						// or the filesystem can't be deleted.  They're kept if the orchestration is interrupted
+						// since the step is resumed.
+						if s.orchestrationsInterrupted() || s.orchestrationLeaseLost(state.TaskID) {
+							return err
+						}
+
+						cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 120*time.Second)
+						defer cancel()
+
+						if cerr := deleteMountTargets(cctx); cerr != nil {
+							logger(ctx).Errorf("failed to delete the mount targets of filesystem %s: %s", fsid, cerr)
+						}
+						return err
+					}
+
+					state.MountTargets = append(state.MountTargets, aws.StringValue(mt.MountTargetId))
+
+					// TODO tag mount target eni?
+				}
 
-			return nil
-		})
+				return nil
+			},
+			Undo: deleteMountTargets,
+		},
+		saga.Step{
+			Name: "wait-mount-targets-available",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("waiting for mount targets for filesystem %s to be available", fsid)
+
+				// wait for mount targets to become available
+				w := s.waiters.get(waitMountTarget).WithProgress(taskProgress(ctx, msgChan))
+				if err := service.WaitForMountTargetsState(ctx, w, fsid, "available"); err != nil {
+					return fmt.Errorf("failed waiting for mount targets for filesystem %s to be available: %s", fsid, err)
+				}
 
-		for _, apReq := range req.AccessPoints {
-			msgChan <- fmt.Sprintf("creating access point '%s' for fs %s", apReq.Name, fsid)
+				msgChan <- fmt.Sprintf("created %d mount targets for fs %s", len(state.MountTargets), fsid)
+				return nil
+			},
+		},
+	)
 
-			var ap *AccessPoint
-			var apTask *flywheel.Task
-			ap, apTask, err = s.accessPointCreate(fsCtx, account, fsid, apReq)
-			if err != nil {
-				errChan <- err
-				return
-			}
+	for i, apReq := range req.AccessPoints {
+		apReq := apReq
+		steps = append(steps, saga.Step{
+			Name: fmt.Sprintf("create-access-point-%d", i),
+			Do: func(ctx context.Context) error {
+				// the access point may have been created before the orchestration was resumed, it's named
+				// after the filesystem and the access point
+				if apReq.Name != "" {
+					name := fmt.Sprintf("%s-%s", req.Name, apReq.Name)
+
+					aps, err := service.ListAccessPoints(ctx, fsid)
+					if err != nil {
+						return fmt.Errorf("failed to list access points for filesystem %s: %s", fsid, err)
+					}
+
+					for _, ap := range aps {
+						if aws.StringValue(ap.Name) != name {
+							continue
+						}
+
+						apid := aws.StringValue(ap.AccessPointId)
+						msgChan <- fmt.Sprintf("access point %s '%s' for fs %s already exists, waiting for it to be available", apid, apReq.Name, fsid)
+
+						w := s.waiters.get(waitAccessPoint).WithProgress(taskProgress(ctx, msgChan))
+						if err := service.WaitForAccessPointState(ctx, w, apid, "available"); err != nil {
+							return fmt.Errorf("failed waiting for access point %s for filesystem %s to be available: %s", apid, fsid, err)
+						}
+						return nil
+					}
+				}
 
-			if err = retry(10, 2*time.Second, func() error {
-				msgChan <- fmt.Sprintf("waiting for access point %s for filesystem %s to be available", ap.AccessPointId, fsid)
+				msgChan <- fmt.Sprintf("creating access point '%s' for fs %s", apReq.Name, fsid)
 
-				apt, err := s.flywheel.GetTask(fsCtx, apTask.ID)
+				ap, apTask, err := s.accessPointCreate(ctx, account, group, fsid, apReq)
 				if err != nil {
 					return err
 				}
 
-				if apt == nil {
-					return fmt.Errorf("filsystem %s not found", fsid)
-				}
+				msgChan <- fmt.Sprintf("waiting for access point %s for filesystem %s to be available", ap.AccessPointId, fsid)
 
-				switch apt.Status {
-				case flywheel.STATUS_COMPLETED:
-					return nil
-				case flywheel.STATUS_FAILED:
-					return fmt.Errorf("failed to create access point %s for fs %s: %s", ap.AccessPointId, fsid, apTask.Failure)
+				// wait for the access point's own task to finish
+				w := s.waiters.get(waitTask).WithProgress(taskProgress(ctx, msgChan))
+				if err := s.waitForTask(ctx, w, apTask.ID); err != nil {
+					return fmt.Errorf("failed waiting for access point %s for filesystem %s to be available: %s", ap.AccessPointId, fsid, err)
 				}
+				return nil
+			},
+		})
+	}
 
-				msgChan <- fmt.Sprintf("access point %s for filesystem %s is not yet available (%s)", ap.AccessPointId, fsid, apTask.Status)
-				return fmt.Errorf("filsystem %s not yet available", fsid)
-			}); err != nil {
-				errChan <- err
-				return
-			}
-		}
-
-	}()
-
-	return fileSystemResponseFromEFS(filesystem, nil, nil, req.AccessPolicy, req.BackupPolicy, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass), task, nil
+	return steps, nil
 }
 
 func (s *server) filesystemUpdate(ctx context.Context, account, group, fs string, req *FileSystemUpdateRequest) (*flywheel.Task, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateCallbackURL(ctx, req.CallbackURL); err != nil {
+		return nil, err
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -363,51 +455,43 @@ func (s *server) filesystemUpdate(ctx context.Context, account, group, fs string
 		return nil, err
 	}
 
+	// the current settings are kept to undo the update if a later step fails
+	var transitionToIA, transitionToPrimary, backupPolicy, accessPolicy string
+
 	// if the lifecycle configuraiton or transition to primary storage rule is updated
 	if req.LifeCycleConfiguration != "" || req.TransitionToPrimaryStorageClass != "" {
-		transitionToIA, transitionToPrimary, err := service.GetFilesystemLifecycle(ctx, fs)
+		transitionToIA, transitionToPrimary, err = service.GetFilesystemLifecycle(ctx, fs)
 		if err != nil {
 			return nil, err
 		}
 
-		switch req.LifeCycleConfiguration {
-		case "":
-			log.Debugf("not updating lifecycle configuration")
+		// the setting that isn't in the request keeps its current value
+		if req.LifeCycleConfiguration == "" {
+			logger(ctx).Debugf("not updating lifecycle configuration")
 			req.LifeCycleConfiguration = transitionToIA
-		case "NONE":
-			req.LifeCycleConfiguration = "NONE"
-		case "AFTER_7_DAYS",
-			"AFTER_14_DAYS",
-			"AFTER_30_DAYS",
-			"AFTER_60_DAYS",
-			"AFTER_90_DAYS":
-			log.Debugf("setting Transition to Infrequent access to %s", req.LifeCycleConfiguration)
-		default:
-			return nil, apierror.New(apierror.ErrBadRequest, "invalid lifecycle configuration, valid values are NONE | AFTER_7_DAYS | AFTER_14_DAYS | AFTER_30_DAYS | AFTER_60_DAYS | AFTER_90_DAYS", nil)
 		}
 
-		// validate intelligent tiering configuration setting
-		switch req.TransitionToPrimaryStorageClass {
-		case "":
-			log.Debugf("not updating intelligent tiering rule")
+		if req.TransitionToPrimaryStorageClass == "" {
+			logger(ctx).Debugf("not updating intelligent tiering rule")
 			req.TransitionToPrimaryStorageClass = transitionToPrimary
-		case "NONE":
-			req.TransitionToPrimaryStorageClass = "NONE"
-		case "AFTER_1_ACCESS":
-			log.Debugf("setting Tansition to primary access to %s", req.TransitionToPrimaryStorageClass)
-		default:
-			return nil, apierror.New(apierror.ErrBadRequest, "invalid transition to primary storage class rule, valid values are NONE | AFTER_1_ACCESS", nil)
 		}
+	}
+
+	if req.BackupPolicy != "" {
+		logger(ctx).Debugf("setting backup policy to %s", req.BackupPolicy)
 
+		if backupPolicy, err = service.GetFilesystemBackup(ctx, fs); err != nil {
+			return nil, err
+		}
 	}
 
-	switch req.BackupPolicy {
-	case "":
-		log.Debugf("not updatingbackup policy")
-	case "DISABLED", "ENABLED":
-		log.Debugf("setting backup policy to %s", req.BackupPolicy)
-	default:
-		return nil, apierror.New(apierror.ErrBadRequest, "invalid backup policy, valid values are ENABLED | DISABLED", nil)
+	if req.AccessPolicy != nil {
+		// a filesystem without a policy has the default policy
+		if accessPolicy, err = service.GetFileSystemPolicy(ctx, fs); err != nil {
+			if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+				return nil, err
+			}
+		}
 	}
 
 	if req.Tags != nil {
@@ -419,100 +503,177 @@ func (s *server) filesystemUpdate(ctx context.Context, account, group, fs string
 	task := flywheel.NewTask()
 
 	// start the orchestration
+	fsCtx, cancel := s.orchestrationContext(ctx, task)
 	go func() {
-		fsid := aws.StringValue(filesystem.FileSystemId)
-
-		fsCtx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		msgChan, errChan := s.startTask(fsCtx, task)
+		fsid := aws.StringValue(filesystem.FileSystemId)
+
+		msgChan, errChan := s.startTask(fsCtx, task, taskInfo{
+			Operation:    kindFilesystemUpdate,
+			Account:      account,
+			Group:        group,
+			FileSystemID: fsid,
+			CallbackURL:  req.CallbackURL,
+		})
 
 		msgChan <- fmt.Sprintf("requested update of filesystem %s", fsid)
 
-		if req.BackupPolicy != "" {
-			msgChan <- fmt.Sprintf("setting filesystem %s backup policy to %s", fsid, req.BackupPolicy)
+		steps := []saga.Step{}
 
-			if err := service.SetFileSystemBackup(fsCtx, fsid, req.BackupPolicy); err != nil {
-				errChan <- fmt.Errorf("failed to set backup policy for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+		if req.BackupPolicy != "" {
+			steps = append(steps, saga.Step{
+				Name: "set-backup-policy",
+				Do: func(ctx context.Context) error {
+					msgChan <- fmt.Sprintf("setting filesystem %s backup policy to %s", fsid, req.BackupPolicy)
+
+					if err := service.SetFileSystemBackup(ctx, fsid, req.BackupPolicy); err != nil {
+						return fmt.Errorf("failed to set backup policy for filesystem %s: %s", fsid, err.Error())
+					}
+					return nil
+				},
+				Undo: func(ctx context.Context) error {
+					logger(ctx).Errorf("rollback: resetting filesystem %s backup policy to %s", fsid, backupPolicy)
+					return service.SetFileSystemBackup(ctx, fsid, backupPolicy)
+				},
+			})
 		}
 
 		if req.LifeCycleConfiguration != "" || req.TransitionToPrimaryStorageClass != "" {
-			msgChan <- fmt.Sprintf("setting filesystem %s lifecycle configuration to %s", fsid, req.LifeCycleConfiguration)
-
-			if err := service.SetFileSystemLifecycle(fsCtx, fsid, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass); err != nil {
-				errChan <- fmt.Errorf("failed to set lifecycle for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+			steps = append(steps, saga.Step{
+				Name: "set-lifecycle",
+				Do: func(ctx context.Context) error {
+					msgChan <- fmt.Sprintf("setting filesystem %s lifecycle configuration to %s", fsid, req.LifeCycleConfiguration)
+
+					if err := service.SetFileSystemLifecycle(ctx, fsid, req.LifeCycleConfiguration, req.TransitionToPrimaryStorageClass); err != nil {
+						return fmt.Errorf("failed to set lifecycle for filesystem %s: %s", fsid, err.Error())
+					}
+					return nil
+				},
+				Undo: func(ctx context.Context) error {
+					logger(ctx).Errorf("rollback: resetting filesystem %s lifecycle configuration to %s", fsid, transitionToIA)
+					return service.SetFileSystemLifecycle(ctx, fsid, transitionToIA, transitionToPrimary)
+				},
+			})
 		}
 
 		if req.AccessPolicy != nil {
-			msgChan <- fmt.Sprintf("setting filesystem %s access policy to %+v", fsid, req.AccessPolicy)
+			steps = append(steps, saga.Step{
+				Name: "set-access-policy",
+				Do: func(ctx context.Context) error {
+					msgChan <- fmt.Sprintf("setting filesystem %s access policy to %+v", fsid, req.AccessPolicy)
+
+					policy := efsPolicyFromFileSystemAccessPolicy(account, group, aws.StringValue(filesystem.FileSystemArn), req.AccessPolicy)
+					policyDoc, err := json.Marshal(policy)
+					if err != nil {
+						return fmt.Errorf("failed to marshall access policy for filesystem %s: %s", fsid, err.Error())
+					}
+
+					if err := service.SetFileSystemPolicy(ctx, fsid, string(policyDoc)); err != nil {
+						return fmt.Errorf("failed to set access policy for filesystem %s: %s", fsid, err.Error())
+					}
+					return nil
+				},
+				Undo: func(ctx context.Context) error {
+					logger(ctx).Errorf("rollback: resetting filesystem %s access policy", fsid)
+
+					if accessPolicy == "" {
+						return service.DeleteFileSystemPolicy(ctx, fsid)
+					}
+					return service.SetFileSystemPolicy(ctx, fsid, accessPolicy)
+				},
+			})
+		}
 
-			policy := efsPolicyFromFileSystemAccessPolicy(account, group, aws.StringValue(filesystem.FileSystemArn), req.AccessPolicy)
-			var policyDoc []byte
-			policyDoc, err = json.Marshal(policy)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to marshall access policy for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+		if req.Tags != nil {
+			// tags added by the update aren't removed when it's undone, the previous values are restored
+			steps = append(steps,
+				saga.Step{
+					Name: "update-tags",
+					Do: func(ctx context.Context) error {
+						msgChan <- fmt.Sprintf("updating tags for filesystem %s ", fsid)
+
+						if err := service.TagFilesystem(ctx, fsid, toEFSTags(req.Tags)); err != nil {
+							return fmt.Errorf("failed to set tags for filesystem %s: %s", fsid, err.Error())
+						}
+						return nil
+					},
+					Undo: func(ctx context.Context) error {
+						if len(filesystem.Tags) == 0 {
+							return nil
+						}
+
+						logger(ctx).Errorf("rollback: resetting tags for filesystem %s", fsid)
+						return service.TagFilesystem(ctx, fsid, filesystem.Tags)
+					},
+				},
+				saga.Step{
+					Name: "update-user-tags",
+					Do: func(ctx context.Context) error {
+						return s.updateTagsForUsers(ctx, account, group, fsid, req.Tags)
+					},
+				},
+			)
+		}
 
-			err = service.SetFileSystemPolicy(fsCtx, fsid, string(policyDoc))
-			if err != nil {
-				errChan <- fmt.Errorf("failed to set access policy for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+		err := saga.New(task.ID, steps, saga.WithProgress(taskProgress(fsCtx, msgChan))).Run(fsCtx)
+		if err != nil {
+			errChan <- err
+			return
 		}
 
-		if req.Tags != nil {
-			msgChan <- fmt.Sprintf("updating tags for filesystem %s ", fsid)
+		s.saveFileSystemConfig(fsCtx, account, group, aws.StringValue(filesystem.Name), fsid, &FileSystemSpec{
+			AccessPolicy:                    req.AccessPolicy,
+			BackupPolicy:                    req.BackupPolicy,
+			LifeCycleConfiguration:          req.LifeCycleConfiguration,
+			TransitionToPrimaryStorageClass: req.TransitionToPrimaryStorageClass,
+		})
+	}()
 
-			if err := service.TagFilesystem(fsCtx, fsid, toEFSTags(req.Tags)); err != nil {
-				errChan <- fmt.Errorf("failed to set tags for filesystem %s: %s", fsid, err.Error())
-				return
-			}
+	return task, nil
+}
 
-			role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+// updateTagsForUsers updates the tags of all of the users of the filesystem
+func (s *server) updateTagsForUsers(ctx context.Context, account, group, fsid string, tags []*Tag) error {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
-			// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
-			session, err := s.assumeRole(
-				fsCtx,
-				s.session.ExternalID,
-				role,
-				"",
-				"arn:aws:iam::aws:policy/IAMReadOnlyAccess",
-				"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
-			)
-			if err != nil {
-				return
-			}
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		"",
+		"arn:aws:iam::aws:policy/IAMReadOnlyAccess",
+		"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to assume role to list users of filesystem %s: %s", fsid, err.Error())
+	}
 
-			efsService := yefs.New(yefs.WithSession(session.Session))
-			iamService := yiam.New(yiam.WithSession(session.Session))
+	efsService := yefs.New(yefs.WithSession(session.Session))
+	iamService := yiam.New(yiam.WithSession(session.Session))
 
-			orch := newUserOrchestrator(iamService, efsService, s.org)
+	orch := newUserOrchestrator(iamService, efsService, s.org)
 
-			users, err := orch.listFilesystemUsers(fsCtx, group, fsid)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to list users filesystem %s: %s", fsid, err.Error())
-				return
-			}
+	users, err := orch.listFilesystemUsers(ctx, group, fsid)
+	if err != nil {
+		return fmt.Errorf("failed to list users filesystem %s: %s", fsid, err.Error())
+	}
 
-			for _, u := range users {
-				if err := s.updateTagsForUser(fsCtx, account, group, fsid, u, req.Tags); err != nil {
-					errChan <- fmt.Errorf("failed to update tags for users of filesystem %s: %s", fsid, err.Error())
-					return
-				}
-			}
+	for _, u := range users {
+		if err := s.updateTagsForUser(ctx, account, group, fsid, u, tags); err != nil {
+			return fmt.Errorf("failed to update tags for users of filesystem %s: %s", fsid, err.Error())
 		}
+	}
 
-	}()
-
-	return task, nil
+	return nil
 }
 
-func (s *server) filesystemDelete(ctx context.Context, account, group, fs string) (*flywheel.Task, error) {
+func (s *server) filesystemDelete(ctx context.Context, account, group, fs, callbackURL string) (*flywheel.Task, error) {
+	if err := s.validateCallbackURL(ctx, callbackURL); err != nil {
+		return nil, err
+	}
+
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
 	if err != nil {
@@ -573,107 +734,146 @@ func (s *server) filesystemDelete(ctx context.Context, account, group, fs string
 
 	// generate a new task to track and start it
 	task := flywheel.NewTask()
-	go func() {
-		fsid := aws.StringValue(filesystem.FileSystemId)
-
-		fsCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	s.runOrchestration(ctx, task, &orchestrationState{
+		TaskID:        task.ID,
+		Kind:          kindFilesystemDelete,
+		Account:       account,
+		Group:         group,
+		Region:        regionFromContext(ctx),
+		FileSystemID:  aws.StringValue(filesystem.FileSystemId),
+		FileSystemArn: aws.StringValue(filesystem.FileSystemArn),
+		CallbackURL:   callbackURL,
+		RequestID:     requestIDFromContext(ctx),
+	})
 
-		msgChan, errChan := s.startTask(fsCtx, task)
+	return task, nil
+}
 
-		role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
-		policy, err := s.filesystemUserDeletePolicy()
-		if err != nil {
-			errChan <- err
-			return
-		}
+// filesystemDeleteSteps returns the steps of the filesystem delete orchestration: delete the filesystem
+// users, delete the mount targets and wait for them to be gone, then delete the filesystem
+func (s *server) filesystemDeleteSteps(ctx context.Context, state *orchestrationState, msgChan chan<- string) ([]saga.Step, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", state.Account, s.session.RoleName)
+	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
+	if err != nil {
+		return nil, err
+	}
 
-		// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
-		session, err := s.assumeRole(
-			fsCtx,
-			s.session.ExternalID,
-			role,
-			policy,
-			"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
-		)
-		if err != nil {
-			errChan <- err
-			return
-		}
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		efsService := yefs.New(yefs.WithSession(session.Session))
-		iamService := yiam.New(yiam.WithSession(session.Session))
+	service := yefs.New(yefs.WithSession(session.Session))
 
-		orch := newUserOrchestrator(iamService, efsService, s.org)
+	group, fsid := state.Group, state.FileSystemID
 
-		users, err := orch.deleteAllFilesystemUsers(fsCtx, group, fsid)
-		if err != nil {
-			errChan <- err
-			return
-		}
+	steps := []saga.Step{
+		{
+			Name: "delete-users",
+			Do: func(ctx context.Context) error {
+				policy, err := s.filesystemUserDeletePolicy()
+				if err != nil {
+					return err
+				}
 
-		msgChan <- fmt.Sprintf("deleted filesystem %s users %+v", fsid, users)
+				// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+				session, err := s.assumeRole(
+					ctx,
+					s.session.ExternalID,
+					role,
+					policy,
+					"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
+				)
+				if err != nil {
+					return err
+				}
 
-		mounttargets, err := service.ListMountTargetsForFileSystem(fsCtx, fsid)
-		if err != nil {
-			errChan <- err
-			return
-		}
+				efsService := yefs.New(yefs.WithSession(session.Session))
+				iamService := yiam.New(yiam.WithSession(session.Session))
 
-		msgChan <- fmt.Sprintf("listed mount targets for filesystem %s", fsid)
+				orch := newUserOrchestrator(iamService, efsService, s.org)
 
-		for _, mt := range mounttargets {
-			if status := aws.StringValue(mt.LifeCycleState); status != "available" {
-				errChan <- fmt.Errorf("filesystem %s mount target %s has status %s, cannot delete", fsid, aws.StringValue(mt.MountTargetId), status)
-				return
-			}
+				users, err := orch.deleteAllFilesystemUsers(ctx, group, fsid)
+				if err != nil {
+					return err
+				}
 
-			msgChan <- fmt.Sprintf("mount target %s for filesystem %s is available", mt, fsid)
+				msgChan <- fmt.Sprintf("deleted filesystem %s users %+v", fsid, users)
+				return nil
+			},
+		},
+		{
+			Name: "delete-mount-targets",
+			Do: func(ctx context.Context) error {
+				mounttargets, err := service.ListMountTargetsForFileSystem(ctx, fsid)
+				if err != nil {
+					return err
+				}
 
-			if err := service.DeleteMountTarget(fsCtx, aws.StringValue(mt.MountTargetId)); err != nil {
-				errChan <- err
-				return
-			}
+				msgChan <- fmt.Sprintf("listed mount targets for filesystem %s", fsid)
 
-			msgChan <- fmt.Sprintf("requested delete for mount target %s for filesystem %s", mt, fsid)
-		}
+				for _, mt := range mounttargets {
+					status := aws.StringValue(mt.LifeCycleState)
 
-		if err = retry(10, 2*time.Second, func() error {
-			msgChan <- fmt.Sprintf("waiting for number of mount targets for filesystem %s to be 0", fsid)
+					// mount targets may already be deleting when the step is resumed
+					if status == "deleting" || status == "deleted" {
+						continue
+					}
 
-			out, err := service.GetFileSystem(fsCtx, fsid)
-			if err != nil {
-				log.Warnf("error getting filesystem %s during delete: %s", fsid, err)
-				return err
-			}
+					if status != "available" {
+						return fmt.Errorf("filesystem %s mount target %s has status %s, cannot delete", fsid, aws.StringValue(mt.MountTargetId), status)
+					}
 
-			if num := aws.Int64Value(out.NumberOfMountTargets); num > 0 {
-				log.Warnf("number of mount targets for filesystem %s > 0 (current: %d)", fsid, num)
-				return fmt.Errorf("waiting for number of mount targets for filesystem %s to be 0 (current: %d)", fsid, num)
-			}
+					msgChan <- fmt.Sprintf("mount target %s for filesystem %s is available", mt, fsid)
 
-			return nil
-		}); err != nil {
-			errChan <- err
-			return
-		}
+					if err := service.DeleteMountTarget(ctx, aws.StringValue(mt.MountTargetId)); err != nil {
+						return err
+					}
 
-		if err = retry(3, 2*time.Second, func() error {
-			msgChan <- fmt.Sprintf("deleting filesystem %s", fsid)
+					msgChan <- fmt.Sprintf("requested delete for mount target %s for filesystem %s", mt, fsid)
+				}
 
-			if err := service.DeleteFileSystem(fsCtx, fsid); err != nil {
-				log.Warnf("error deleting filesystem %s: %s", fsid, err)
-				return err
-			}
+				return nil
+			},
+		},
+		{
+			Name: "wait-mount-targets-deleted",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("waiting for number of mount targets for filesystem %s to be 0", fsid)
 
-			return nil
-		}); err != nil {
-			errChan <- err
-			return
-		}
-	}()
+				w := s.waiters.get(waitMountTarget).WithProgress(taskProgress(ctx, msgChan))
+				return service.WaitForNoMountTargets(ctx, w, fsid)
+			},
+		},
+		{
+			Name: "delete-filesystem",
+			Do: func(ctx context.Context) error {
+				msgChan <- fmt.Sprintf("deleting filesystem %s", fsid)
+
+				// the filesystem can't be deleted while it's still in use by the deleted mount targets
+				w := s.waiters.get(waitFileSystem).WithProgress(taskProgress(ctx, msgChan))
+				return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+					if err := service.DeleteFileSystem(ctx, fsid); err != nil {
+						logger(ctx).Warnf("error deleting filesystem %s: %s", fsid, err)
+
+						if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrConflict {
+							return false, err
+						}
+						return false, waiter.Terminal(err)
+					}
+
+					return true, nil
+				})
+			},
+		},
+	}
 
-	return task, nil
+	return steps, nil
 }
 
 // filesystemList returns a list of elastic filesystems with the given org tag and the group/spaceid tag
@@ -722,7 +922,7 @@ func (s *server) filesystemList(ctx context.Context, account, group string) ([]s
 	for _, fs := range out {
 		a, err := arn.Parse(aws.StringValue(fs.ResourceARN))
 		if err != nil {
-			log.Errorf("failed to parse ARN %s: %s", fs, err)
+			logger(ctx).Errorf("failed to parse ARN %s: %s", fs, err)
 			fsList = append(fsList, aws.StringValue(fs.ResourceARN))
 		}
 
@@ -743,7 +943,7 @@ func (s *server) filesystemList(ctx context.Context, account, group string) ([]s
 		fsList = append(fsList, fsid)
 	}
 
-	log.Debugf("returning list of filesystems in group %s: %+v", group, fsList)
+	logger(ctx).Debugf("returning list of filesystems in group %s: %+v", group, fsList)
 
 	return fsList, nil
 }
@@ -753,7 +953,7 @@ func (s *server) filesystemList(ctx context.Context, account, group string) ([]s
 // the API and check if it has the right tag, but that seems more dangerous and less repeatable.  in other
 // words, this process might be slower but is hopefully safer.
 func (s *server) fileSystemExists(ctx context.Context, account, group, fs string) (bool, error) {
-	log.Debugf("checking if filesystem %s is in the group %s", fs, group)
+	logger(ctx).Debugf("checking if filesystem %s is in the group %s", fs, group)
 
 	list, err := s.filesystemList(ctx, account, group)
 	if err != nil {
@@ -764,7 +964,7 @@ func (s *server) fileSystemExists(ctx context.Context, account, group, fs string
 		id := f
 		if arn.IsARN(f) {
 			if a, err := arn.Parse(f); err != nil {
-				log.Errorf("failed to parse ARN %s: %s", f, err)
+				logger(ctx).Errorf("failed to parse ARN %s: %s", f, err)
 			} else {
 				id = strings.TrimPrefix(a.Resource, "file-system/")
 			}
@@ -780,45 +980,109 @@ func (s *server) fileSystemExists(ctx context.Context, account, group, fs string
 
 // startTask starts the flywheel task and receives messages on the channels.  in the future, this
 // functionality might be part of the flywheel library
-func (s *server) startTask(ctx context.Context, task *flywheel.Task) (chan<- string, chan<- error) {
+func (s *server) startTask(ctx context.Context, task *flywheel.Task, info taskInfo) (chan<- string, chan<- error) {
 	msgChan := make(chan string)
 	errChan := make(chan error)
 
 	// track the task
 	go func() {
+		defer s.orchestrationDone(task)
+
 		taskCtx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		info.TaskID = task.ID
+		info.StartedAt = time.Now().UTC()
+		info.RequestID = requestIDFromContext(ctx)
+
+		// tasks that aren't in flywheel aren't indexed, they couldn't be listed
 		if err := s.flywheel.Start(taskCtx, task); err != nil {
-			log.Errorf("failed to start flywheel task, won't be tracked: %s", err)
+			logger(ctx).Errorf("failed to start flywheel task, won't be tracked: %s", err)
+		} else {
+			s.indexTask(taskCtx, &info)
+		}
+
+		// flywheel tasks don't have metadata, the request id is recorded in the task log
+		if info.RequestID != "" {
+			if ferr := s.flywheel.Log(taskCtx, task.ID, fmt.Sprintf("started by request %s", info.RequestID)); ferr != nil {
+				logger(ctx).Errorf("failed to log flywheel message for %s: %s", task.ID, ferr)
+			}
 		}
 
 		for {
 			select {
 			case msg := <-msgChan:
-				log.Info(msg)
+				logger(ctx).Info(msg)
 
 				if ferr := s.flywheel.CheckIn(taskCtx, task.ID); ferr != nil {
-					log.Errorf("failed to checkin task %s: %s", task.ID, ferr)
+					logger(ctx).Errorf("failed to checkin task %s: %s", task.ID, ferr)
 				}
 
 				if ferr := s.flywheel.Log(taskCtx, task.ID, msg); ferr != nil {
-					log.Errorf("failed to log flywheel message for %s: %s", task.ID, ferr)
+					logger(ctx).Errorf("failed to log flywheel message for %s: %s", task.ID, ferr)
 				}
+				s.publishTaskEvent(taskCtx, task.ID, &taskEvent{Type: taskEventLog, Message: msg})
 			case err := <-errChan:
-				log.Error(err)
+				if errors.Is(err, errTaskCancelled) {
+					logger(ctx).Warnf("marking task %s cancelled", task.ID)
+
+					s.markTaskCancelled(taskCtx, task.ID)
+					s.auditTaskOutcome(ctx, task.ID, audit.OutcomeCancelled, err)
+					s.notifyTask(taskCtx, &info, taskStatusCancelled, err.Error())
+					s.publishTaskEvent(taskCtx, task.ID, &taskEvent{Type: taskEventStatus, Status: taskStatusCancelled, Failure: err.Error()})
+
+					return
+				}
+
+				logger(ctx).Error(err)
 
 				if ferr := s.flywheel.Fail(taskCtx, task.ID, err.Error()); ferr != nil {
-					log.Errorf("failed to fail flywheel task %s: %s", task.ID, ferr)
+					logger(ctx).Errorf("failed to fail flywheel task %s: %s", task.ID, ferr)
 				}
+				s.setIndexedTaskStatus(taskCtx, task.ID, flywheel.STATUS_FAILED)
+				s.auditTaskOutcome(ctx, task.ID, audit.OutcomeFailed, err)
+				s.notifyTask(taskCtx, &info, flywheel.STATUS_FAILED, err.Error())
+				s.publishTaskEvent(taskCtx, task.ID, &taskEvent{Type: taskEventStatus, Status: flywheel.STATUS_FAILED, Failure: err.Error()})
 
 				return
 			case <-ctx.Done():
-				log.Infof("marking task %s complete", task.ID)
+				if s.orchestrationLeaseLost(task.ID) {
+					logger(ctx).Warnf("leaving task %s to the replica holding its lease", task.ID)
+					return
+				}
+
+				if s.orchestrationsInterrupted() {
+					if s.orchestrationResumable(taskCtx, task.ID) {
+						logger(ctx).Warnf("leaving task %s to be resumed by another replica", task.ID)
+						return
+					}
+
+					logger(ctx).Warnf("marking task %s interrupted", task.ID)
+
+					if ferr := s.flywheel.Log(taskCtx, task.ID, interruptedMessage); ferr != nil {
+						logger(ctx).Errorf("failed to log flywheel message for %s: %s", task.ID, ferr)
+					}
+
+					if ferr := s.flywheel.Fail(taskCtx, task.ID, interruptedMessage); ferr != nil {
+						logger(ctx).Errorf("failed to mark flywheel task %s interrupted: %s", task.ID, ferr)
+					}
+					s.setIndexedTaskStatus(taskCtx, task.ID, flywheel.STATUS_FAILED)
+					s.auditTaskOutcome(ctx, task.ID, audit.OutcomeFailed, errors.New(interruptedMessage))
+					s.notifyTask(taskCtx, &info, flywheel.STATUS_FAILED, interruptedMessage)
+					s.publishTaskEvent(taskCtx, task.ID, &taskEvent{Type: taskEventStatus, Status: flywheel.STATUS_FAILED, Failure: interruptedMessage})
+
+					return
+				}
+
+				logger(ctx).Infof("marking task %s complete", task.ID)
 
 				if ferr := s.flywheel.Complete(taskCtx, task.ID); ferr != nil {
-					log.Errorf("failed to complete flywheel task %s: %s", task.ID, ferr)
+					logger(ctx).Errorf("failed to complete flywheel task %s: %s", task.ID, ferr)
 				}
+				s.setIndexedTaskStatus(taskCtx, task.ID, flywheel.STATUS_COMPLETED)
+				s.auditTaskOutcome(ctx, task.ID, audit.OutcomeCompleted, nil)
+				s.notifyTask(taskCtx, &info, flywheel.STATUS_COMPLETED, "")
+				s.publishTaskEvent(taskCtx, task.ID, &taskEvent{Type: taskEventStatus, Status: flywheel.STATUS_COMPLETED})
 
 				return
 			}
@@ -832,7 +1096,7 @@ func (s *server) startTask(ctx context.Context, task *flywheel.Task) (chan<- str
 // this may change to support getting the list of subnets as well, currently it uses
 // the defaults from the EFS service
 func (s *server) subnetAzs(ctx context.Context, account string, defSubnets []string) (map[string]string, error) {
-	log.Infof("determining availability zone for account %s and subnets %+v", account, defSubnets)
+	logger(ctx).Infof("determining availability zone for account %s and subnets %+v", account, defSubnets)
 
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 	policy, err := generatePolicy("ec2:*")
@@ -859,7 +1123,7 @@ func (s *server) subnetAzs(ctx context.Context, account string, defSubnets []str
 			return nil, err
 		}
 
-		log.Debugf("got details about subnet %s: %+v", s, subnet)
+		logger(ctx).Debugf("got details about subnet %s: %+v", s, subnet)
 
 		subnets[s] = aws.StringValue(subnet.AvailabilityZone)
 	}
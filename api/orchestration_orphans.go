@@ -0,0 +1,457 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	yec2 "github.com/YaleSpinup/efs-api/ec2"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	yiam "github.com/YaleSpinup/aws-go/services/iam"
+)
+
+// the types of orphaned resources, in the order they are cleaned up
+const (
+	orphanUser        = "user"
+	orphanAccessPoint = "accessPoint"
+	orphanFileSystem  = "filesystem"
+	orphanGroup       = "group"
+)
+
+// orphanOrder is the order of the cleanup of the orphan types.  Users and access points are deleted before the
+// filesystems, and the admin group is deleted last.
+var orphanOrder = map[string]int{
+	orphanUser:        0,
+	orphanAccessPoint: 1,
+	orphanFileSystem:  2,
+	orphanGroup:       3,
+}
+
+// orphanMinAge is the age a user, group or filesystem must reach before it's an orphan, so the resources of a
+// filesystem create that is still running aren't reported
+const orphanMinAge = time.Hour
+
+// orphanInventory is the state of the org's resources in an account searched for orphans.  IAM users and groups
+// are global, so the filesystems are inventoried in every region of the account before users are matched to them.
+type orphanInventory struct {
+	// regions are the regions searched for filesystems
+	regions     []string
+	fileSystems []*inventoryFileSystem
+	// users are the IAM users under the /spinup/<org>/ path
+	users []*iam.User
+	// group is the admin group of the org, or nil if it doesn't exist
+	group *iam.Group
+}
+
+// inventoryFileSystem is a filesystem of the org with its access points
+type inventoryFileSystem struct {
+	region       string
+	group        string
+	fileSystem   *efs.FileSystemDescription
+	accessPoints []*efs.AccessPointDescription
+}
+
+// orphanScan lists the orphaned resources of the org in the account
+func (s *server) orphanScan(ctx context.Context, account string) ([]*Orphan, error) {
+	inventory, err := s.orphanInventory(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return findOrphans(s.org, time.Now(), inventory), nil
+}
+
+// orphanRegions returns the regions searched for the filesystems of the account: the region of the request, the
+// region configured for the account and the default region, followed by the other regions enabled in the account
+func (s *server) orphanRegions(ctx context.Context, account string, enabled []string) []string {
+	regions := []string{s.sessionRegion(ctx)}
+
+	if a, ok := s.accountDefaults(account); ok && a.Region != "" {
+		regions = append(regions, a.Region)
+	}
+
+	if s.defaultRegion != "" {
+		regions = append(regions, s.defaultRegion)
+	} else {
+		regions = append(regions, defaultRegion)
+	}
+
+	enabled = append([]string{}, enabled...)
+	sort.Strings(enabled)
+	regions = append(regions, enabled...)
+
+	out := []string{}
+	seen := map[string]bool{}
+	for _, r := range regions {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// enabledRegions lists the regions enabled in the account
+func (s *server) enabledRegions(ctx context.Context, account string) ([]string, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := generatePolicy("ec2:DescribeRegions")
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ec2Service := yec2.New(yec2.WithSession(session.Session))
+	return ec2Service.ListRegions(ctx)
+}
+
+// orphanInventory gets the filesystems and access points of the org in the regions of the account, and the IAM
+// users and admin group of the org in the account
+func (s *server) orphanInventory(ctx context.Context, account string) (*orphanInventory, error) {
+	policy, err := generatePolicy("elasticfilesystem:Describe*", "iam:ListUsers", "iam:GetGroup")
+	if err != nil {
+		return nil, err
+	}
+
+	// users and the admin group are only orphans if there are no filesystems in any region, so the scan fails
+	// if the regions of the account can't be listed
+	enabled, err := s.enabledRegions(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &orphanInventory{regions: s.orphanRegions(ctx, account, enabled)}
+
+	var orch *userOrchestrator
+	for _, region := range inventory.regions {
+		rctx := withRegion(ctx, region)
+
+		fsids, err := s.filesystemList(rctx, account, "")
+		if err != nil {
+			return nil, err
+		}
+
+		orch, err = s.newAccountUserOrchestrator(rctx, account, policy)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fsids {
+			group, fsid := "", f
+			if i := strings.LastIndex(f, "/"); i >= 0 {
+				group, fsid = f[:i], f[i+1:]
+			}
+
+			filesystem, err := orch.efsClient.GetFileSystem(rctx, fsid)
+			if err != nil {
+				// the filesystem was deleted since it was listed
+				if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+					continue
+				}
+				return nil, err
+			}
+
+			aps, err := orch.efsClient.ListAccessPoints(rctx, fsid)
+			if err != nil {
+				return nil, err
+			}
+
+			inventory.fileSystems = append(inventory.fileSystems, &inventoryFileSystem{
+				region:       region,
+				group:        group,
+				fileSystem:   filesystem,
+				accessPoints: aps,
+			})
+		}
+	}
+
+	path := fmt.Sprintf("/spinup/%s/", s.org)
+	if err := orch.iamClient.Service.ListUsersPagesWithContext(ctx, &iam.ListUsersInput{PathPrefix: aws.String(path)}, func(out *iam.ListUsersOutput, last bool) bool {
+		inventory.users = append(inventory.users, out.Users...)
+		return true
+	}); err != nil {
+		return nil, yiam.ErrCode("failed to list users", err)
+	}
+
+	group, err := orch.iamClient.GetGroupWithPath(ctx, fmt.Sprintf("SpinupEFSAdminGroup-%s", s.org), path)
+	if err != nil {
+		if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+			return nil, err
+		}
+	} else {
+		inventory.group = group
+	}
+
+	return inventory, nil
+}
+
+// findOrphans returns the orphaned resources in the inventory, in cleanup order:
+//   - IAM users in the path of a filesystem (/spinup/<org>/<group>/<name>/) that doesn't exist in any region
+//   - access points whose Name doesn't start with the name of their filesystem
+//   - available filesystems without mount targets
+//   - the admin group of the org in an account without filesystems in any region
+func findOrphans(org string, now time.Time, inventory *orphanInventory) []*Orphan {
+	orphans := []*Orphan{}
+	add := func(orphanType, resource, region, group, fsid, reason string) {
+		orphans = append(orphans, &Orphan{
+			ID:           orphanType + ":" + resource,
+			Type:         orphanType,
+			Resource:     resource,
+			Region:       region,
+			Group:        group,
+			FileSystemId: fsid,
+			Reason:       reason,
+		})
+	}
+
+	old := func(created *time.Time) bool {
+		return created != nil && now.Sub(*created) >= orphanMinAge
+	}
+
+	names := map[string]bool{}
+	for _, f := range inventory.fileSystems {
+		fsid := aws.StringValue(f.fileSystem.FileSystemId)
+		name := aws.StringValue(f.fileSystem.Name)
+		names[f.group+"/"+name] = true
+
+		// access points are named <fsname>-<apname>, there's nothing to match without a filesystem name
+		if name != "" {
+			for _, ap := range f.accessPoints {
+				if apName := aws.StringValue(ap.Name); !strings.HasPrefix(apName, name+"-") || apName == name+"-" {
+					add(orphanAccessPoint, aws.StringValue(ap.AccessPointId), f.region, f.group, fsid, fmt.Sprintf("access point name %q doesn't match filesystem %s", apName, name))
+				}
+			}
+		}
+
+		if aws.StringValue(f.fileSystem.LifeCycleState) == "available" && aws.Int64Value(f.fileSystem.NumberOfMountTargets) == 0 && old(f.fileSystem.CreationTime) {
+			add(orphanFileSystem, fsid, f.region, f.group, fsid, "filesystem has no mount targets")
+		}
+	}
+
+	for _, u := range inventory.users {
+		group, name, ok := userPathSpace(org, aws.StringValue(u.Path))
+		if !ok || names[group+"/"+name] || !old(u.CreateDate) {
+			continue
+		}
+
+		add(orphanUser, aws.StringValue(u.UserName), "", group, "", fmt.Sprintf("filesystem %s doesn't exist in space %s in regions %s", name, group, strings.Join(inventory.regions, ", ")))
+	}
+
+	if inventory.group != nil && len(inventory.fileSystems) == 0 && old(inventory.group.CreateDate) {
+		add(orphanGroup, aws.StringValue(inventory.group.GroupName), "", "", "", fmt.Sprintf("there are no filesystems in the account in regions %s", strings.Join(inventory.regions, ", ")))
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphanOrder[orphans[i].Type] != orphanOrder[orphans[j].Type] {
+			return orphanOrder[orphans[i].Type] < orphanOrder[orphans[j].Type]
+		}
+		return orphans[i].ID < orphans[j].ID
+	})
+
+	return orphans
+}
+
+// userPathSpace returns the space (group) and filesystem name of an IAM user path /spinup/<org>/<group>/<name>/
+func userPathSpace(org, path string) (string, string, bool) {
+	rest := strings.TrimPrefix(path, fmt.Sprintf("/spinup/%s/", org))
+	if rest == path || !strings.HasSuffix(rest, "/") {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// selectOrphans returns the orphans selected by their ids, in cleanup order.  Ids that aren't orphans (anymore)
+// or are repeated are invalid.
+func selectOrphans(orphans []*Orphan, ids []string) ([]*Orphan, error) {
+	if len(ids) == 0 {
+		return nil, newValidationError(&FieldError{Field: "Orphans", Message: "at least one orphan is required"})
+	}
+
+	byID := map[string]*Orphan{}
+	for _, o := range orphans {
+		byID[o.ID] = o
+	}
+
+	fields := []*FieldError{}
+	selected := map[string]bool{}
+	for i, id := range ids {
+		field := fmt.Sprintf("Orphans[%d]", i)
+
+		switch {
+		case selected[id]:
+			fields = append(fields, &FieldError{Field: field, Message: fmt.Sprintf("duplicate orphan %s", id)})
+		case byID[id] == nil:
+			fields = append(fields, &FieldError{Field: field, Message: fmt.Sprintf("%s is not an orphan", id)})
+		}
+
+		selected[id] = true
+	}
+
+	if len(fields) > 0 {
+		return nil, newValidationError(fields...)
+	}
+
+	out := []*Orphan{}
+	for _, o := range orphans {
+		if selected[o.ID] {
+			out = append(out, o)
+		}
+	}
+
+	return out, nil
+}
+
+// orphanCleanup deletes the selected orphans of the account under one task.  The account is scanned again, so
+// only resources that are still orphans are deleted.  The task continues past failed deletes and fails if any
+// orphan isn't deleted.
+func (s *server) orphanCleanup(ctx context.Context, account string, req *OrphanCleanupRequest) (*OrphanCleanupResponse, *flywheel.Task, error) {
+	if err := s.validateCallbackURL(ctx, req.CallbackURL); err != nil {
+		return nil, nil, err
+	}
+
+	orphans, err := s.orphanScan(ctx, account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected, err := selectOrphans(orphans, req.Orphans)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	task := flywheel.NewTask()
+
+	ocCtx, cancel := s.orchestrationContext(ctx, task)
+	go func() {
+		defer cancel()
+
+		msgChan, errChan := s.startTask(ocCtx, task, taskInfo{
+			Operation:   kindOrphanCleanup,
+			Account:     account,
+			CallbackURL: req.CallbackURL,
+		})
+
+		progress := taskProgress(ocCtx, msgChan)
+		progress(fmt.Sprintf("deleting %d orphans", len(selected)))
+
+		failed := []string{}
+		for _, o := range selected {
+			progress(fmt.Sprintf("deleting orphaned %s %s: %s", o.Type, o.Resource, o.Reason))
+
+			if err := s.deleteOrphan(ocCtx, account, o, progress); err != nil {
+				progress(fmt.Sprintf("failed to delete orphaned %s %s: %s", o.Type, o.Resource, err))
+				failed = append(failed, fmt.Sprintf("%s (%s)", o.ID, err))
+				continue
+			}
+
+			progress(fmt.Sprintf("deleted orphaned %s %s", o.Type, o.Resource))
+		}
+
+		if len(failed) > 0 {
+			errChan <- fmt.Errorf("failed to delete %d of %d orphans: %s", len(failed), len(selected), strings.Join(failed, ", "))
+		}
+	}()
+
+	return &OrphanCleanupResponse{TaskID: task.ID, Orphans: selected}, task, nil
+}
+
+// deleteOrphan deletes an orphaned resource in its region.  Filesystems are deleted with their own delete task.
+func (s *server) deleteOrphan(ctx context.Context, account string, orphan *Orphan, progress func(string)) error {
+	if orphan.Region != "" {
+		ctx = withRegion(ctx, orphan.Region)
+	}
+
+	if orphan.Type == orphanFileSystem {
+		fsTask, err := s.filesystemDelete(ctx, account, orphan.Group, orphan.Resource, "")
+		if err != nil {
+			return err
+		}
+
+		progress(fmt.Sprintf("deleting filesystem %s with task %s", orphan.Resource, fsTask.ID))
+
+		return s.waitForTask(ctx, s.waiters.get(waitTask), fsTask.ID)
+	}
+
+	policy, err := s.orphanCleanupPolicy()
+	if err != nil {
+		return err
+	}
+
+	orch, err := s.newAccountUserOrchestrator(ctx, account, policy)
+	if err != nil {
+		return err
+	}
+
+	switch orphan.Type {
+	case orphanUser:
+		return orch.deleteUser(ctx, orphan.Resource)
+	case orphanAccessPoint:
+		return orch.efsClient.DeleteAccessPoint(ctx, orphan.Resource)
+	case orphanGroup:
+		return orch.deleteGroup(ctx, orphan.Resource, fmt.Sprintf("/spinup/%s/", s.org))
+	}
+
+	return fmt.Errorf("unknown orphan type %s", orphan.Type)
+}
+
+// deleteGroup removes the members of the IAM group, detaches its policies and deletes the group.  The policies
+// aren't deleted, prepareAccount attaches them again when the group is created again.
+func (o *userOrchestrator) deleteGroup(ctx context.Context, name, path string) error {
+	members := []string{}
+	if err := o.iamClient.Service.GetGroupPagesWithContext(ctx, &iam.GetGroupInput{GroupName: aws.String(name)}, func(out *iam.GetGroupOutput, last bool) bool {
+		for _, u := range out.Users {
+			members = append(members, aws.StringValue(u.UserName))
+		}
+		return true
+	}); err != nil {
+		return yiam.ErrCode("failed to get group", err)
+	}
+
+	for _, m := range members {
+		if err := o.iamClient.RemoveUserFromGroup(ctx, m, name); err != nil {
+			return err
+		}
+	}
+
+	policies, err := o.iamClient.ListAttachedGroupPolicies(ctx, name, path)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		if _, err := o.iamClient.Service.DetachGroupPolicyWithContext(ctx, &iam.DetachGroupPolicyInput{
+			GroupName: aws.String(name),
+			PolicyArn: aws.String(p),
+		}); err != nil {
+			return yiam.ErrCode("failed to detach group policy", err)
+		}
+	}
+
+	if _, err := o.iamClient.Service.DeleteGroupWithContext(ctx, &iam.DeleteGroupInput{GroupName: aws.String(name)}); err != nil {
+		return yiam.ErrCode("failed to delete group", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-2 * time.Hour)
+	young := now.Add(-10 * time.Minute)
+
+	filesystem := func(fsid, name string, mountTargets int64, created time.Time, aps ...string) *inventoryFileSystem {
+		f := &inventoryFileSystem{
+			region: "us-east-1",
+			group:  "space1",
+			fileSystem: &efs.FileSystemDescription{
+				FileSystemId:         aws.String(fsid),
+				Name:                 aws.String(name),
+				LifeCycleState:       aws.String("available"),
+				NumberOfMountTargets: aws.Int64(mountTargets),
+				CreationTime:         aws.Time(created),
+			},
+		}
+		for i, ap := range aps {
+			f.accessPoints = append(f.accessPoints, &efs.AccessPointDescription{
+				AccessPointId: aws.String(fsid + "-ap-" + string(rune('a'+i))),
+				Name:          aws.String(ap),
+			})
+		}
+		return f
+	}
+
+	user := func(name, path string, created time.Time) *iam.User {
+		return &iam.User{UserName: aws.String(name), Path: aws.String(path), CreateDate: aws.Time(created)}
+	}
+
+	adminGroup := &iam.Group{GroupName: aws.String("SpinupEFSAdminGroup-test"), CreateDate: aws.Time(old)}
+
+	ids := func(orphans []*Orphan) []string {
+		out := []string{}
+		for _, o := range orphans {
+			out = append(out, o.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		inventory *orphanInventory
+		expected  []string
+	}{
+		{
+			name: "no orphans",
+			inventory: &orphanInventory{
+				fileSystems: []*inventoryFileSystem{filesystem("fs-1", "myfs", 2, old, "myfs-data")},
+				users:       []*iam.User{user("myfs-alice", "/spinup/test/space1/myfs/", old)},
+				group:       adminGroup,
+			},
+			expected: []string{},
+		},
+		{
+			name: "user without filesystem",
+			inventory: &orphanInventory{
+				fileSystems: []*inventoryFileSystem{filesystem("fs-1", "myfs", 2, old)},
+				users: []*iam.User{
+					user("myfs-alice", "/spinup/test/space1/myfs/", old),
+					user("gone-bob", "/spinup/test/space1/gone/", old),
+					user("other-carol", "/spinup/test/space2/myfs/", old),
+					user("new-dave", "/spinup/test/space1/new/", young),
+					user("SpinupEFSAdmin", "/spinup/test/", old),
+				},
+			},
+			expected: []string{"user:gone-bob", "user:other-carol"},
+		},
+		{
+			name: "user of a filesystem in another region",
+			inventory: &orphanInventory{
+				regions: []string{"us-east-1", "us-west-2"},
+				fileSystems: []*inventoryFileSystem{
+					filesystem("fs-1", "myfs", 2, old),
+					{
+						region: "us-west-2",
+						group:  "space1",
+						fileSystem: &efs.FileSystemDescription{
+							FileSystemId:         aws.String("fs-2"),
+							Name:                 aws.String("westfs"),
+							LifeCycleState:       aws.String("available"),
+							NumberOfMountTargets: aws.Int64(2),
+							CreationTime:         aws.Time(old),
+						},
+					},
+				},
+				users: []*iam.User{
+					user("myfs-alice", "/spinup/test/space1/myfs/", old),
+					user("westfs-bob", "/spinup/test/space1/westfs/", old),
+				},
+				group: adminGroup,
+			},
+			expected: []string{},
+		},
+		{
+			name: "admin group with filesystems only in another region",
+			inventory: &orphanInventory{
+				regions: []string{"us-east-1", "us-west-2"},
+				fileSystems: []*inventoryFileSystem{
+					{
+						region: "us-west-2",
+						group:  "space1",
+						fileSystem: &efs.FileSystemDescription{
+							FileSystemId:         aws.String("fs-2"),
+							Name:                 aws.String("westfs"),
+							LifeCycleState:       aws.String("available"),
+							NumberOfMountTargets: aws.Int64(2),
+							CreationTime:         aws.Time(old),
+						},
+					},
+				},
+				group: adminGroup,
+			},
+			expected: []string{},
+		},
+		{
+			name: "admin group without filesystems",
+			inventory: &orphanInventory{
+				group: adminGroup,
+			},
+			expected: []string{"group:SpinupEFSAdminGroup-test"},
+		},
+		{
+			name: "new admin group",
+			inventory: &orphanInventory{
+				group: &iam.Group{GroupName: aws.String("SpinupEFSAdminGroup-test"), CreateDate: aws.Time(young)},
+			},
+			expected: []string{},
+		},
+		{
+			name: "filesystems without mount targets",
+			inventory: &orphanInventory{
+				fileSystems: []*inventoryFileSystem{
+					filesystem("fs-1", "myfs", 0, old),
+					filesystem("fs-2", "newfs", 0, young),
+				},
+				group: adminGroup,
+			},
+			expected: []string{"filesystem:fs-1"},
+		},
+		{
+			name: "access points not matching their filesystem",
+			inventory: &orphanInventory{
+				fileSystems: []*inventoryFileSystem{
+					filesystem("fs-1", "myfs", 1, old, "myfs-data", "otherfs-data", "", "myfs-"),
+					filesystem("fs-2", "", 1, old, "anything"),
+				},
+			},
+			expected: []string{"accessPoint:fs-1-ap-b", "accessPoint:fs-1-ap-c", "accessPoint:fs-1-ap-d"},
+		},
+		{
+			name: "cleanup order",
+			inventory: &orphanInventory{
+				fileSystems: []*inventoryFileSystem{filesystem("fs-1", "myfs", 0, old, "data")},
+				users:       []*iam.User{user("gone-bob", "/spinup/test/space1/gone/", old)},
+			},
+			expected: []string{"user:gone-bob", "accessPoint:fs-1-ap-a", "filesystem:fs-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := ids(findOrphans("test", now, tt.inventory)); !reflect.DeepEqual(tt.expected, out) {
+				t.Errorf("expected orphans %v, got %v", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestFindOrphansRegion(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-2 * time.Hour)
+
+	inventory := &orphanInventory{
+		regions: []string{"us-east-1", "us-west-2"},
+		fileSystems: []*inventoryFileSystem{
+			{
+				region: "us-west-2",
+				group:  "space1",
+				fileSystem: &efs.FileSystemDescription{
+					FileSystemId:         aws.String("fs-2"),
+					Name:                 aws.String("westfs"),
+					LifeCycleState:       aws.String("available"),
+					NumberOfMountTargets: aws.Int64(0),
+					CreationTime:         aws.Time(old),
+				},
+				accessPoints: []*efs.AccessPointDescription{
+					{AccessPointId: aws.String("fsap-1"), Name: aws.String("otherfs-data")},
+				},
+			},
+		},
+		users: []*iam.User{
+			{UserName: aws.String("gone-bob"), Path: aws.String("/spinup/test/space1/gone/"), CreateDate: aws.Time(old)},
+		},
+	}
+
+	expected := map[string]string{
+		"user:gone-bob":      "",
+		"accessPoint:fsap-1": "us-west-2",
+		"filesystem:fs-2":    "us-west-2",
+	}
+
+	out := findOrphans("test", now, inventory)
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d orphans, got %+v", len(expected), out)
+	}
+
+	for _, o := range out {
+		if region, ok := expected[o.ID]; !ok || o.Region != region {
+			t.Errorf("expected orphan %s in region %q, got %q", o.ID, expected[o.ID], o.Region)
+		}
+	}
+}
+
+func TestOrphanRegions(t *testing.T) {
+	s := server{
+		defaultRegion: "us-east-1",
+	}
+	s.config.Store(&dynamicConfig{
+		accounts: map[string]common.Account{
+			"1234567890": {Region: "us-west-2"},
+		},
+	})
+
+	tests := []struct {
+		account string
+		region  string
+		enabled []string
+		expect  []string
+	}{
+		{account: "1234567890", expect: []string{"us-east-1", "us-west-2"}},
+		{account: "1234567890", region: "us-west-2", expect: []string{"us-west-2", "us-east-1"}},
+		{account: "1234567890", region: "eu-west-1", expect: []string{"eu-west-1", "us-west-2", "us-east-1"}},
+		{account: "0987654321", expect: []string{"us-east-1"}},
+		{
+			account: "1234567890",
+			enabled: []string{"us-west-2", "us-east-2", "ca-central-1", "us-east-1"},
+			expect:  []string{"us-east-1", "us-west-2", "ca-central-1", "us-east-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.region != "" {
+			ctx = withRegion(ctx, tt.region)
+		}
+
+		if out := s.orphanRegions(ctx, tt.account, tt.enabled); !reflect.DeepEqual(tt.expect, out) {
+			t.Errorf("expected regions %v for account %s in region %q, got %v", tt.expect, tt.account, tt.region, out)
+		}
+	}
+}
+
+func TestUserPathSpace(t *testing.T) {
+	tests := []struct {
+		path  string
+		group string
+		name  string
+		ok    bool
+	}{
+		{path: "/spinup/test/space1/myfs/", group: "space1", name: "myfs", ok: true},
+		{path: "/spinup/test/"},
+		{path: "/spinup/test/space1/"},
+		{path: "/spinup/test/space1/myfs/extra/"},
+		{path: "/spinup/other/space1/myfs/"},
+		{path: "/spinup/test/space1/myfs"},
+		{path: "/"},
+	}
+
+	for _, tt := range tests {
+		group, name, ok := userPathSpace("test", tt.path)
+		if group != tt.group || name != tt.name || ok != tt.ok {
+			t.Errorf("expected %s to be %q, %q, %t, got %q, %q, %t", tt.path, tt.group, tt.name, tt.ok, group, name, ok)
+		}
+	}
+}
+
+func TestSelectOrphans(t *testing.T) {
+	orphans := []*Orphan{
+		{ID: "user:gone-bob", Type: orphanUser},
+		{ID: "accessPoint:fsap-1", Type: orphanAccessPoint},
+		{ID: "filesystem:fs-1", Type: orphanFileSystem},
+	}
+
+	out, err := selectOrphans(orphans, []string{"filesystem:fs-1", "user:gone-bob"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(out) != 2 || out[0].ID != "user:gone-bob" || out[1].ID != "filesystem:fs-1" {
+		t.Errorf("expected the selected orphans in cleanup order, got %+v", out)
+	}
+
+	fieldErrorsOf := func(err error) fieldErrors {
+		aerr, ok := err.(apierror.Error)
+		if !ok || aerr.Code != apierror.ErrBadRequest {
+			t.Fatalf("expected bad request error, got %v", err)
+		}
+
+		fe, ok := aerr.OrigErr.(fieldErrors)
+		if !ok {
+			t.Fatalf("expected field errors, got %v", aerr.OrigErr)
+		}
+		return fe
+	}
+
+	_, err = selectOrphans(orphans, []string{"user:gone-bob", "group:SpinupEFSAdminGroup-test", "user:gone-bob"})
+	if fe := fieldErrorsOf(err); len(fe) != 2 || fe[0].Field != "Orphans[1]" || fe[1].Field != "Orphans[2]" {
+		t.Errorf("expected errors for Orphans[1] and Orphans[2], got %s", fe)
+	}
+
+	_, err = selectOrphans(orphans, nil)
+	if fe := fieldErrorsOf(err); len(fe) != 1 || fe[0].Field != "Orphans" {
+		t.Errorf("expected error for Orphans, got %s", fe)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/aws-go/services/iam"
+	"github.com/YaleSpinup/efs-api/efs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// quotaUsage returns the quota limits for a group along with the current usage of filesystems, access points and users
+func (s *server) quotaUsage(ctx context.Context, account, group string) (*QuotaResponse, error) {
+	quota := s.quotaForGroup(group)
+
+	fsList, err := s.filesystemList(ctx, account, group)
+	if err != nil {
+		return nil, err
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		"",
+		"arn:aws:iam::aws:policy/IAMReadOnlyAccess",
+		"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	efsService := efs.New(efs.WithSession(session.Session))
+	iamService := iam.New(iam.WithSession(session.Session))
+
+	orch := newUserOrchestrator(iamService, efsService, s.org)
+
+	usage := &QuotaUsage{
+		FileSystems:     len(fsList),
+		FileSystemUsage: make(map[string]*FileSystemQuotaUsage, len(fsList)),
+	}
+
+	for _, fs := range fsList {
+		accessPoints, err := efsService.ListAccessPoints(ctx, fs)
+		if err != nil {
+			return nil, err
+		}
+
+		users, err := orch.listFilesystemUsers(ctx, group, fs)
+		if err != nil {
+			return nil, err
+		}
+
+		filesystem, err := efsService.GetFileSystem(ctx, fs)
+		if err != nil {
+			return nil, err
+		}
+
+		var storage int64
+		if filesystem.SizeInBytes != nil {
+			storage = aws.Int64Value(filesystem.SizeInBytes.Value)
+		}
+		usage.StorageBytes += storage
+
+		usage.FileSystemUsage[fs] = &FileSystemQuotaUsage{
+			AccessPoints: len(accessPoints),
+			Users:        len(users),
+			StorageBytes: storage,
+		}
+	}
+
+	return &QuotaResponse{
+		Group: group,
+		Limits: &QuotaLimits{
+			FileSystems:               quota.FileSystems,
+			AccessPointsPerFileSystem: quota.AccessPointsPerFileSystem,
+			UsersPerFileSystem:        quota.UsersPerFileSystem,
+			StorageGB:                 quota.StorageGB,
+		},
+		Usage: usage,
+	}, nil
+}
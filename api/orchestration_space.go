@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/YaleSpinup/flywheel"
+)
+
+// spaceTeardownConcurrency is the maximum number of filesystems deleted at the same time by a space teardown
+const spaceTeardownConcurrency = 3
+
+// the statuses of the filesystems of a space teardown
+const (
+	teardownPlanned = "planned"
+	teardownPending = "pending"
+	teardownDeleted = "deleted"
+	teardownFailed  = "failed"
+)
+
+// teardownResultsPrefix prefixes the last event of a space teardown task, the JSON list of the final results of
+// the filesystem deletes
+const teardownResultsPrefix = "teardown results: "
+
+// spaceTeardown deletes all of the filesystems in the space (group) under one parent task, which deletes each
+// filesystem with its own delete task and waits for it to finish.  The final result of each delete is logged as
+// the last event of the parent task, which fails if any filesystem isn't deleted.  A dry run only lists the filesystems that would be deleted.
+func (s *server) spaceTeardown(ctx context.Context, account, group string, dryRun bool) (*SpaceTeardownResponse, *flywheel.Task, error) {
+	fsids, err := s.filesystemList(ctx, account, group)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := teardownPending
+	if dryRun {
+		status = teardownPlanned
+	}
+
+	resp := &SpaceTeardownResponse{
+		Group:       group,
+		DryRun:      dryRun,
+		FileSystems: make([]*SpaceTeardownResult, 0, len(fsids)),
+	}
+
+	for _, fsid := range fsids {
+		resp.FileSystems = append(resp.FileSystems, &SpaceTeardownResult{FileSystemId: fsid, Status: status})
+	}
+
+	if dryRun || len(fsids) == 0 {
+		return resp, nil, nil
+	}
+
+	task := flywheel.NewTask()
+	resp.TaskID = task.ID
+
+	tdCtx, cancel := s.orchestrationContext(ctx, task)
+	go func() {
+		defer cancel()
+
+		msgChan, errChan := s.startTask(tdCtx, task, taskInfo{
+			Operation: kindSpaceTeardown,
+			Account:   account,
+			Group:     group,
+		})
+
+		progress := taskProgress(tdCtx, msgChan)
+		progress(fmt.Sprintf("deleting %d filesystems in space %s", len(fsids), group))
+
+		results := teardownFileSystems(tdCtx, fsids, spaceTeardownConcurrency, func(ctx context.Context, fsid string) (string, error) {
+			fsTask, err := s.filesystemDelete(ctx, account, group, fsid, "")
+			if err != nil {
+				return "", err
+			}
+
+			progress(fmt.Sprintf("deleting filesystem %s with task %s", fsid, fsTask.ID))
+
+			return fsTask.ID, s.waitForTask(ctx, s.waiters.get(waitTask), fsTask.ID)
+		}, progress)
+
+		progress(teardownResultsEvent(results))
+
+		if err := teardownError(group, results); err != nil {
+			errChan <- err
+		}
+	}()
+
+	return resp, task, nil
+}
+
+// teardownFileSystems deletes the filesystems with the delete function, running at most concurrency deletes at
+// the same time, and returns the result of each delete
+func teardownFileSystems(ctx context.Context, fsids []string, concurrency int, del func(ctx context.Context, fsid string) (string, error), progress func(string)) []*SpaceTeardownResult {
+	results := make([]*SpaceTeardownResult, len(fsids))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, fsid := range fsids {
+		result := &SpaceTeardownResult{FileSystemId: fsid, Status: teardownPending}
+		results[i] = result
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				result.Status = teardownFailed
+				result.Error = ctx.Err().Error()
+				return
+			}
+
+			taskID, err := del(ctx, result.FileSystemId)
+			result.TaskID = taskID
+			if err != nil {
+				result.Status = teardownFailed
+				result.Error = err.Error()
+				progress(fmt.Sprintf("failed to delete filesystem %s: %s", result.FileSystemId, err))
+				return
+			}
+
+			result.Status = teardownDeleted
+			progress(fmt.Sprintf("deleted filesystem %s", result.FileSystemId))
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// teardownResultsEvent returns the task event with the final results of the filesystem deletes
+func teardownResultsEvent(results []*SpaceTeardownResult) string {
+	out, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Sprintf("failed to marshal teardown results: %s", err)
+	}
+
+	return teardownResultsPrefix + string(out)
+}
+
+// teardownError returns the error of the failed filesystem deletes of the space teardown, or nil if all of the
+// filesystems were deleted
+func teardownError(group string, results []*SpaceTeardownResult) error {
+	failed := []string{}
+	for _, r := range results {
+		if r.Status == teardownFailed {
+			failed = append(failed, fmt.Sprintf("%s (%s)", r.FileSystemId, r.Error))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("failed to delete %d of %d filesystems in space %s: %s", len(failed), len(results), group, strings.Join(failed, ", "))
+}
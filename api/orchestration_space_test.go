@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTeardownFileSystems(t *testing.T) {
+	fsids := []string{"fs-1", "fs-2", "fs-3", "fs-4", "fs-5", "fs-6", "fs-7"}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	del := func(ctx context.Context, fsid string) (string, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		if fsid == "fs-3" {
+			return "task-3", errors.New("boom")
+		}
+
+		if fsid == "fs-5" {
+			return "", errors.New("filesystem fs-5 has status creating")
+		}
+		return "task-" + strings.TrimPrefix(fsid, "fs-"), nil
+	}
+
+	msgs := make(chan string, 100)
+	results := teardownFileSystems(context.TODO(), fsids, 2, del, func(msg string) { msgs <- msg })
+
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent deletes, got %d", maxRunning)
+	}
+
+	if len(results) != len(fsids) {
+		t.Fatalf("expected %d results, got %d", len(fsids), len(results))
+	}
+
+	for i, r := range results {
+		if r.FileSystemId != fsids[i] {
+			t.Errorf("expected result %d for %s, got %s", i, fsids[i], r.FileSystemId)
+		}
+
+		expected := teardownDeleted
+		if r.FileSystemId == "fs-3" || r.FileSystemId == "fs-5" {
+			expected = teardownFailed
+		}
+
+		if r.Status != expected {
+			t.Errorf("expected %s to be %s, got %s", r.FileSystemId, expected, r.Status)
+		}
+	}
+
+	if results[2].TaskID != "task-3" || results[2].Error != "boom" {
+		t.Errorf("expected failed delete task and error, got %+v", results[2])
+	}
+
+	if len(msgs) != len(fsids) {
+		t.Errorf("expected a progress message per filesystem, got %d", len(msgs))
+	}
+
+	event := teardownResultsEvent(results)
+	if !strings.HasPrefix(event, teardownResultsPrefix) {
+		t.Fatalf("expected the results event to start with %q, got %q", teardownResultsPrefix, event)
+	}
+
+	logged := []*SpaceTeardownResult{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(event, teardownResultsPrefix)), &logged); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logged) != len(fsids) || *logged[2] != *results[2] || *logged[0] != *results[0] {
+		t.Errorf("expected the logged results to match the results, got %s", event)
+	}
+
+	err := teardownError("space1", results)
+	if err == nil {
+		t.Fatal("expected teardown error, got nil")
+	}
+
+	if expected := "failed to delete 2 of 7 filesystems in space space1: fs-3 (boom), fs-5 (filesystem fs-5 has status creating)"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+}
+
+func TestTeardownFileSystemsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	block := make(chan struct{})
+	del := func(ctx context.Context, fsid string) (string, error) {
+		cancel()
+		<-block
+		return "", ctx.Err()
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+
+	results := teardownFileSystems(ctx, []string{"fs-1", "fs-2", "fs-3"}, 1, del, func(string) {})
+	for _, r := range results {
+		if r.Status != teardownFailed {
+			t.Errorf("expected %s to fail, got %s", r.FileSystemId, r.Status)
+		}
+	}
+
+	if err := teardownError("space1", results); err == nil {
+		t.Error("expected teardown error, got nil")
+	}
+}
+
+func TestTeardownErrorAllDeleted(t *testing.T) {
+	results := []*SpaceTeardownResult{}
+	for i := 0; i < 3; i++ {
+		results = append(results, &SpaceTeardownResult{FileSystemId: fmt.Sprintf("fs-%d", i), Status: teardownDeleted})
+	}
+
+	if err := teardownError("space1", results); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+}
@@ -0,0 +1,1121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/YaleSpinup/efs-api/saga"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+
+	yiam "github.com/YaleSpinup/aws-go/services/iam"
+	yefs "github.com/YaleSpinup/efs-api/efs"
+)
+
+// the actions of the changes of a filesystem spec plan
+const (
+	specCreate  = "create"
+	specUpdate  = "update"
+	specDelete  = "delete"
+	specReplace = "replace"
+)
+
+// the resources changed by a filesystem spec plan
+const (
+	specFileSystem   = "filesystem"
+	specBackupPolicy = "backupPolicy"
+	specLifeCycle    = "lifeCycleConfiguration"
+	specTransition   = "transitionToPrimaryStorageClass"
+	specAccessPolicy = "accessPolicy"
+	specTag          = "tag"
+	specMountTarget  = "mountTarget"
+	specAccessPoint  = "accessPoint"
+	specUser         = "user"
+)
+
+// fileSystemState is the current state of a filesystem that a spec is compared against
+type fileSystemState struct {
+	fileSystem                      *efs.FileSystemDescription
+	backupPolicy                    string
+	lifeCycleConfiguration          string
+	transitionToPrimaryStorageClass string
+	accessPolicy                    *FileSystemAccessPolicy
+	mountTargets                    []*efs.MountTargetDescription
+	// mountTargetSgs are the security groups of the mount targets, keyed by mount target id
+	mountTargetSgs map[string][]string
+	accessPoints   []*efs.AccessPointDescription
+	users          []string
+}
+
+// specPlan is the plan of a filesystem spec with the changes to apply to an existing filesystem
+type specPlan struct {
+	changes []*SpecChange
+
+	// the settings to set, empty if they aren't changed
+	backupPolicy                    string
+	lifeCycleConfiguration          string
+	transitionToPrimaryStorageClass string
+	accessPolicy                    *FileSystemAccessPolicy
+
+	// tags are all of the tags of the filesystem if any of them are changed, untag are the removed tag keys
+	tags  []*Tag
+	untag []string
+
+	// the subnets of the mount targets to create, the ids of the mount targets to delete and the security
+	// groups of the mount targets to update, keyed by mount target id
+	sgs                []string
+	createMountTargets []string
+	deleteMountTargets []string
+	updateMountTargets map[string][]string
+
+	// the access points to create and the ids of the access points to delete
+	createAccessPoints []*AccessPointSpec
+	deleteAccessPoints []string
+
+	createUsers []string
+	deleteUsers []string
+}
+
+// fileSystemSpecApply computes the changes to make the filesystem with the name in the space match the spec and,
+// unless it's a dry run, applies them with one task.  The filesystem is created if it doesn't exist.
+func (s *server) fileSystemSpecApply(ctx context.Context, account, group, name string, spec *FileSystemSpec, dryRun bool) (*FileSystemSpecPlan, *flywheel.Task, error) {
+	if err := validateRequest(spec); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateSpec(name, spec); err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkSpecQuota(s.quotaForGroup(group), spec); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.validateCallbackURL(ctx, spec.CallbackURL); err != nil {
+		return nil, nil, err
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	service := yefs.New(yefs.WithSession(session.Session))
+
+	filesystem, err := s.fileSystemByName(ctx, service, account, group, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := &FileSystemSpecPlan{
+		Group:  group,
+		Name:   name,
+		DryRun: dryRun,
+	}
+
+	defaults, _ := s.accountDefaults(account)
+
+	if filesystem == nil {
+		out.Changes = planFileSystemSpecCreate(spec, defaults.DefaultSubnets)
+		if dryRun {
+			return out, nil, nil
+		}
+
+		if err := s.checkFileSystemQuota(ctx, account, group, len(spec.AccessPoints)); err != nil {
+			return nil, nil, err
+		}
+
+		task := s.fileSystemSpecCreate(ctx, account, group, name, spec)
+		out.TaskID = task.ID
+
+		return out, task, nil
+	}
+
+	fsid := aws.StringValue(filesystem.FileSystemId)
+	out.FileSystemId = fsid
+
+	if status := aws.StringValue(filesystem.LifeCycleState); status != "available" {
+		msg := fmt.Sprintf("filesystem %s has status %s, cannot apply spec to filesystems that are not 'available'", fsid, status)
+		return nil, nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	current, err := s.fileSystemSpecState(ctx, service, account, group, filesystem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := planFileSystemSpec(s.org, group, name, spec, current, defaults.DefaultSgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out.Changes = plan.changes
+	if dryRun || len(plan.changes) == 0 {
+		return out, nil, nil
+	}
+
+	task := s.fileSystemSpecUpdate(ctx, service, kindSpecApply, account, group, filesystem, spec, plan)
+	out.TaskID = task.ID
+
+	return out, task, nil
+}
+
+// fileSystemSpecCreate starts the task creating the filesystem of the spec with its own create task, and then
+// creating its users
+func (s *server) fileSystemSpecCreate(ctx context.Context, account, group, name string, spec *FileSystemSpec) *flywheel.Task {
+	req := &FileSystemCreateRequest{
+		Name:                            name,
+		AccessPolicy:                    spec.AccessPolicy,
+		BackupPolicy:                    spec.BackupPolicy,
+		LifeCycleConfiguration:          spec.LifeCycleConfiguration,
+		TransitionToPrimaryStorageClass: spec.TransitionToPrimaryStorageClass,
+		OneZone:                         aws.BoolValue(spec.OneZone),
+		Sgs:                             spec.Sgs,
+		Subnets:                         spec.Subnets,
+		Tags:                            spec.Tags,
+	}
+
+	for _, ap := range spec.AccessPoints {
+		req.AccessPoints = append(req.AccessPoints, &AccessPointCreateRequest{
+			Name:          ap.Name,
+			PosixUser:     ap.PosixUser,
+			RootDirectory: ap.RootDirectory,
+		})
+	}
+
+	task := flywheel.NewTask()
+
+	specCtx, cancel := s.orchestrationContext(ctx, task)
+	go func() {
+		defer cancel()
+
+		msgChan, errChan := s.startTask(specCtx, task, taskInfo{
+			Operation:   kindSpecApply,
+			Account:     account,
+			Group:       group,
+			CallbackURL: spec.CallbackURL,
+		})
+
+		progress := taskProgress(specCtx, msgChan)
+		progress(fmt.Sprintf("applying spec of new filesystem %s", name))
+
+		steps := []saga.Step{
+			{
+				Name: "create-filesystem",
+				Do: func(ctx context.Context) error {
+					fs, fsTask, err := s.filesystemCreate(ctx, account, group, req)
+					if err != nil {
+						return fmt.Errorf("failed to create filesystem %s: %s", name, err)
+					}
+
+					progress(fmt.Sprintf("creating filesystem %s with task %s", fs.FileSystemId, fsTask.ID))
+
+					w := s.waiters.get(waitTask).WithProgress(progress)
+					if err := s.waitForTask(ctx, w, fsTask.ID); err != nil {
+						return fmt.Errorf("failed to create filesystem %s: %s", name, err)
+					}
+
+					progress(fmt.Sprintf("created filesystem %s", fs.FileSystemId))
+					return s.createSpecUsers(ctx, account, group, fs.FileSystemId, spec.Users, progress)
+				},
+			},
+		}
+
+		if err := saga.New(task.ID, steps, saga.WithProgress(progress)).Run(specCtx); err != nil {
+			errChan <- err
+		}
+	}()
+
+	return task
+}
+
+// fileSystemSpecUpdate starts the task of the operation applying the plan to the filesystem.  Resources are deleted
+// before they're created, so that access points and mount targets can be replaced.  A failed apply isn't undone,
+// applying the spec again continues from the current state.  The settings of the spec are recorded as the last
+// applied configuration of the filesystem when the plan is applied.
+func (s *server) fileSystemSpecUpdate(ctx context.Context, service yefs.EFS, operation, account, group string, filesystem *efs.FileSystemDescription, spec *FileSystemSpec, plan *specPlan) *flywheel.Task {
+	fsid := aws.StringValue(filesystem.FileSystemId)
+	task := flywheel.NewTask()
+
+	specCtx, cancel := s.orchestrationContext(ctx, task)
+	go func() {
+		defer cancel()
+
+		msgChan, errChan := s.startTask(specCtx, task, taskInfo{
+			Operation:    operation,
+			Account:      account,
+			Group:        group,
+			FileSystemID: fsid,
+			CallbackURL:  spec.CallbackURL,
+		})
+
+		progress := taskProgress(specCtx, msgChan)
+		progress(fmt.Sprintf("applying %d changes to filesystem %s", len(plan.changes), fsid))
+
+		steps := []saga.Step{}
+
+		if plan.backupPolicy != "" {
+			steps = append(steps, saga.Step{
+				Name: "set-backup-policy",
+				Do: func(ctx context.Context) error {
+					progress(fmt.Sprintf("setting filesystem %s backup policy to %s", fsid, plan.backupPolicy))
+
+					if err := service.SetFileSystemBackup(ctx, fsid, plan.backupPolicy); err != nil {
+						return fmt.Errorf("failed to set backup policy for filesystem %s: %s", fsid, err)
+					}
+					return nil
+				},
+			})
+		}
+
+		if plan.lifeCycleConfiguration != "" {
+			steps = append(steps, saga.Step{
+				Name: "set-lifecycle",
+				Do: func(ctx context.Context) error {
+					progress(fmt.Sprintf("setting filesystem %s lifecycle configuration to %s", fsid, plan.lifeCycleConfiguration))
+
+					if err := service.SetFileSystemLifecycle(ctx, fsid, plan.lifeCycleConfiguration, plan.transitionToPrimaryStorageClass); err != nil {
+						return fmt.Errorf("failed to set lifecycle for filesystem %s: %s", fsid, err)
+					}
+					return nil
+				},
+			})
+		}
+
+		if plan.accessPolicy != nil {
+			steps = append(steps, saga.Step{
+				Name: "set-access-policy",
+				Do: func(ctx context.Context) error {
+					progress(fmt.Sprintf("setting filesystem %s access policy to %+v", fsid, plan.accessPolicy))
+
+					policy, err := json.Marshal(efsPolicyFromFileSystemAccessPolicy(account, group, aws.StringValue(filesystem.FileSystemArn), plan.accessPolicy))
+					if err != nil {
+						return fmt.Errorf("failed to marshall access policy for filesystem %s: %s", fsid, err)
+					}
+
+					if err := service.SetFileSystemPolicy(ctx, fsid, string(policy)); err != nil {
+						return fmt.Errorf("failed to set access policy for filesystem %s: %s", fsid, err)
+					}
+					return nil
+				},
+			})
+		}
+
+		if plan.tags != nil {
+			steps = append(steps, saga.Step{
+				Name: "update-tags",
+				Do: func(ctx context.Context) error {
+					progress(fmt.Sprintf("updating tags for filesystem %s", fsid))
+
+					if len(plan.untag) > 0 {
+						if err := service.UntagFilesystem(ctx, fsid, plan.untag); err != nil {
+							return fmt.Errorf("failed to remove tags from filesystem %s: %s", fsid, err)
+						}
+					}
+
+					if err := service.TagFilesystem(ctx, fsid, toEFSTags(plan.tags)); err != nil {
+						return fmt.Errorf("failed to set tags for filesystem %s: %s", fsid, err)
+					}
+
+					return s.updateTagsForUsers(ctx, account, group, fsid, plan.tags)
+				},
+			})
+		}
+
+		if len(plan.deleteAccessPoints) > 0 {
+			steps = append(steps, saga.Step{
+				Name: "delete-access-points",
+				Do: func(ctx context.Context) error {
+					for _, apid := range plan.deleteAccessPoints {
+						progress(fmt.Sprintf("deleting access point %s of filesystem %s", apid, fsid))
+
+						if err := service.DeleteAccessPoint(ctx, apid); err != nil {
+							return fmt.Errorf("failed to delete access point %s of filesystem %s: %s", apid, fsid, err)
+						}
+					}
+					return nil
+				},
+			})
+		}
+
+		if len(plan.deleteUsers) > 0 {
+			steps = append(steps, saga.Step{
+				Name: "delete-users",
+				Do: func(ctx context.Context) error {
+					policy, err := s.filesystemUserDeletePolicy()
+					if err != nil {
+						return err
+					}
+
+					orch, err := s.newAccountUserOrchestrator(ctx, account, policy, "arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess")
+					if err != nil {
+						return err
+					}
+
+					for _, u := range plan.deleteUsers {
+						progress(fmt.Sprintf("deleting filesystem %s user %s", fsid, u))
+
+						if err := orch.deleteFilesystemUser(ctx, group, fsid, u); err != nil {
+							return fmt.Errorf("failed to delete filesystem %s user %s: %s", fsid, u, err)
+						}
+					}
+					return nil
+				},
+			})
+		}
+
+		if len(plan.updateMountTargets) > 0 {
+			steps = append(steps, saga.Step{
+				Name: "update-mount-targets",
+				Do: func(ctx context.Context) error {
+					for _, mt := range sortedMountTargets(plan.updateMountTargets) {
+						sgs := plan.updateMountTargets[mt]
+						progress(fmt.Sprintf("setting security groups of mount target %s for filesystem %s to %s", mt, fsid, strings.Join(sgs, ", ")))
+
+						if err := service.SetMountTargetSecurityGroups(ctx, mt, sgs); err != nil {
+							return fmt.Errorf("failed to set security groups of mount target %s for filesystem %s: %s", mt, fsid, err)
+						}
+					}
+					return nil
+				},
+			})
+		}
+
+		if len(plan.deleteMountTargets) > 0 {
+			steps = append(steps,
+				saga.Step{
+					Name: "delete-mount-targets",
+					Do: func(ctx context.Context) error {
+						for _, mt := range plan.deleteMountTargets {
+							progress(fmt.Sprintf("deleting mount target %s for filesystem %s", mt, fsid))
+
+							if err := service.DeleteMountTarget(ctx, mt); err != nil {
+								return fmt.Errorf("failed to delete mount target %s for filesystem %s: %s", mt, fsid, err)
+							}
+						}
+						return nil
+					},
+				},
+				saga.Step{
+					Name: "wait-mount-targets-deleted",
+					Do: func(ctx context.Context) error {
+						progress(fmt.Sprintf("waiting for the deleted mount targets for filesystem %s to be gone", fsid))
+
+						deleted := map[string]bool{}
+						for _, mt := range plan.deleteMountTargets {
+							deleted[mt] = true
+						}
+
+						w := s.waiters.get(waitMountTarget).WithProgress(progress)
+						return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+							mts, err := service.ListMountTargetsForFileSystem(ctx, fsid)
+							if err != nil {
+								return false, err
+							}
+
+							for _, mt := range mts {
+								if id := aws.StringValue(mt.MountTargetId); deleted[id] && aws.StringValue(mt.LifeCycleState) != "deleted" {
+									return false, fmt.Errorf("mount target %s for filesystem %s is %s", id, fsid, aws.StringValue(mt.LifeCycleState))
+								}
+							}
+							return true, nil
+						})
+					},
+				},
+			)
+		}
+
+		if len(plan.createMountTargets) > 0 {
+			steps = append(steps,
+				saga.Step{
+					Name: "create-mount-targets",
+					Do: func(ctx context.Context) error {
+						for _, subnet := range plan.createMountTargets {
+							progress(fmt.Sprintf("creating mount target in subnet %s for filesystem %s", subnet, fsid))
+
+							if _, err := service.CreateMountTarget(ctx, &efs.CreateMountTargetInput{
+								FileSystemId:   aws.String(fsid),
+								SecurityGroups: aws.StringSlice(plan.sgs),
+								SubnetId:       aws.String(subnet),
+							}); err != nil {
+								return fmt.Errorf("failed to create mount target for filesystem %s: %s", fsid, err)
+							}
+						}
+						return nil
+					},
+				},
+				saga.Step{
+					Name: "wait-mount-targets-available",
+					Do: func(ctx context.Context) error {
+						progress(fmt.Sprintf("waiting for mount targets for filesystem %s to be available", fsid))
+
+						w := s.waiters.get(waitMountTarget).WithProgress(progress)
+						if err := service.WaitForMountTargetsState(ctx, w, fsid, "available"); err != nil {
+							return fmt.Errorf("failed waiting for mount targets for filesystem %s to be available: %s", fsid, err)
+						}
+						return nil
+					},
+				},
+			)
+		}
+
+		if len(plan.createAccessPoints) > 0 {
+			steps = append(steps, saga.Step{
+				Name: "create-access-points",
+				Do: func(ctx context.Context) error {
+					for _, apSpec := range plan.createAccessPoints {
+						progress(fmt.Sprintf("creating access point '%s' for fs %s", apSpec.Name, fsid))
+
+						ap, apTask, err := s.accessPointCreate(ctx, account, group, fsid, &AccessPointCreateRequest{
+							Name:          apSpec.Name,
+							PosixUser:     apSpec.PosixUser,
+							RootDirectory: apSpec.RootDirectory,
+						})
+						if err != nil {
+							return fmt.Errorf("failed to create access point %s for fs %s: %s", apSpec.Name, fsid, err)
+						}
+
+						w := s.waiters.get(waitTask).WithProgress(progress)
+						if err := s.waitForTask(ctx, w, apTask.ID); err != nil {
+							return fmt.Errorf("failed to create access point %s for fs %s: %s", ap.AccessPointId, fsid, err)
+						}
+					}
+					return nil
+				},
+			})
+		}
+
+		if len(plan.createUsers) > 0 {
+			steps = append(steps, saga.Step{
+				Name: "create-users",
+				Do: func(ctx context.Context) error {
+					return s.createSpecUsers(ctx, account, group, fsid, plan.createUsers, progress)
+				},
+			})
+		}
+
+		if err := saga.New(task.ID, steps, saga.WithProgress(progress)).Run(specCtx); err != nil {
+			errChan <- err
+			return
+		}
+
+		s.saveFileSystemConfig(specCtx, account, group, aws.StringValue(filesystem.Name), fsid, spec)
+	}()
+
+	return task
+}
+
+// createSpecUsers creates the users of the filesystem
+func (s *server) createSpecUsers(ctx context.Context, account, group, fsid string, users []string, progress func(string)) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	policy, err := s.filesystemUserCreatePolicy()
+	if err != nil {
+		return err
+	}
+
+	orch, err := s.newAccountUserOrchestrator(ctx, account, policy, "arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess")
+	if err != nil {
+		return err
+	}
+
+	if err := orch.prepareAccount(ctx); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		progress(fmt.Sprintf("creating filesystem %s user %s", fsid, u))
+
+		if _, err := orch.createFilesystemUser(ctx, group, fsid, s.quotaForGroup(group), &FileSystemUserCreateRequest{UserName: u}); err != nil {
+			return fmt.Errorf("failed to create filesystem %s user %s: %s", fsid, u, err)
+		}
+	}
+
+	return nil
+}
+
+// newAccountUserOrchestrator returns a user orchestrator with a session in the account limited to the policies
+func (s *server) newAccountUserOrchestrator(ctx context.Context, account, policy string, policyArns ...string) (*userOrchestrator, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+
+	// IAM doesn't support resource tags, so we can't pass the s.orgPolicy here
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+		policyArns...,
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return nil, apierror.New(apierror.ErrForbidden, msg, err)
+	}
+
+	return newUserOrchestrator(yiam.New(yiam.WithSession(session.Session)), yefs.New(yefs.WithSession(session.Session)), s.org), nil
+}
+
+// fileSystemByName returns the filesystem with the name in the space, or nil if there isn't one
+func (s *server) fileSystemByName(ctx context.Context, service yefs.EFS, account, group, name string) (*efs.FileSystemDescription, error) {
+	fsids, err := s.filesystemList(ctx, account, group)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *efs.FileSystemDescription
+	for _, fsid := range fsids {
+		filesystem, err := service.GetFileSystem(ctx, fsid)
+		if err != nil {
+			return nil, err
+		}
+
+		if aws.StringValue(filesystem.Name) != name {
+			continue
+		}
+
+		if found != nil {
+			msg := fmt.Sprintf("more than one filesystem named %s in space %s", name, group)
+			return nil, apierror.New(apierror.ErrConflict, msg, nil)
+		}
+		found = filesystem
+	}
+
+	return found, nil
+}
+
+// fileSystemSpecState gets the current state of the filesystem, including its access points and users
+func (s *server) fileSystemSpecState(ctx context.Context, service yefs.EFS, account, group string, filesystem *efs.FileSystemDescription) (*fileSystemState, error) {
+	state, err := fileSystemSettingsState(ctx, service, filesystem)
+	if err != nil {
+		return nil, err
+	}
+
+	fsid := aws.StringValue(filesystem.FileSystemId)
+	if state.accessPoints, err = service.ListAccessPoints(ctx, fsid); err != nil {
+		return nil, err
+	}
+
+	orch, err := s.newAccountUserOrchestrator(ctx, account, "",
+		"arn:aws:iam::aws:policy/IAMReadOnlyAccess",
+		"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.users, err = orch.listFilesystemUsers(ctx, group, fsid); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// fileSystemSettingsState gets the current settings and mount targets of the filesystem
+func fileSystemSettingsState(ctx context.Context, service yefs.EFS, filesystem *efs.FileSystemDescription) (*fileSystemState, error) {
+	fsid := aws.StringValue(filesystem.FileSystemId)
+	state := &fileSystemState{
+		fileSystem:     filesystem,
+		mountTargetSgs: map[string][]string{},
+	}
+
+	var err error
+	if state.backupPolicy, err = service.GetFilesystemBackup(ctx, fsid); err != nil {
+		return nil, err
+	}
+
+	if state.lifeCycleConfiguration, state.transitionToPrimaryStorageClass, err = service.GetFilesystemLifecycle(ctx, fsid); err != nil {
+		return nil, err
+	}
+
+	// a filesystem without a policy has the default policy
+	policy, err := service.GetFileSystemPolicy(ctx, fsid)
+	if err != nil {
+		if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	if state.accessPolicy, err = filSystemAccessPolicyFromEfsPolicy(policy); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to parse filesystem access policy", err)
+	}
+
+	if state.mountTargets, err = service.ListMountTargetsForFileSystem(ctx, fsid); err != nil {
+		return nil, err
+	}
+
+	for _, mt := range state.mountTargets {
+		id := aws.StringValue(mt.MountTargetId)
+		if state.mountTargetSgs[id], err = service.GetMountTargetSecurityGroups(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// validateSpec validates the spec beyond its schema, access point names and users must be unique and the IAM
+// user names, prefixed with the filesystem name, must not be too long
+func validateSpec(name string, spec *FileSystemSpec) error {
+	fields := []*FieldError{}
+
+	apNames := map[string]bool{}
+	for i, ap := range spec.AccessPoints {
+		if apNames[ap.Name] {
+			fields = append(fields, &FieldError{Field: fmt.Sprintf("AccessPoints[%d].Name", i), Message: fmt.Sprintf("duplicate access point name %s", ap.Name)})
+		}
+		apNames[ap.Name] = true
+	}
+
+	users := map[string]bool{}
+	for i, u := range spec.Users {
+		field := fmt.Sprintf("Users[%d]", i)
+		if users[u] {
+			fields = append(fields, &FieldError{Field: field, Message: fmt.Sprintf("duplicate user %s", u)})
+		}
+		users[u] = true
+
+		if len(name)+1+len(u) > maxUserNameLength {
+			msg := fmt.Sprintf("%s must be at most %d characters for filesystem %s", field, maxUserNameLength-len(name)-1, name)
+			fields = append(fields, &FieldError{Field: field, Message: msg})
+		}
+	}
+
+	if len(fields) > 0 {
+		return newValidationError(fields...)
+	}
+
+	return nil
+}
+
+// checkSpecQuota returns a conflict error if the spec has more access points or users than the quota
+func checkSpecQuota(quota common.Quota, spec *FileSystemSpec) error {
+	if n := len(spec.AccessPoints); quota.AccessPointsPerFileSystem > 0 && n > quota.AccessPointsPerFileSystem {
+		msg := fmt.Sprintf("access point quota exceeded, requested %d of %d access points per filesystem", n, quota.AccessPointsPerFileSystem)
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	if n := len(spec.Users); quota.UsersPerFileSystem > 0 && n > quota.UsersPerFileSystem {
+		msg := fmt.Sprintf("user quota exceeded, requested %d of %d users per filesystem", n, quota.UsersPerFileSystem)
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	return nil
+}
+
+// planFileSystemSpecCreate returns the changes creating the filesystem of the spec, the mount targets are created
+// in the default subnets when the spec doesn't have any
+func planFileSystemSpecCreate(spec *FileSystemSpec, defaultSubnets []string) []*SpecChange {
+	changes := []*SpecChange{{Action: specCreate, Resource: specFileSystem}}
+
+	subnets := spec.Subnets
+	if subnets == nil {
+		subnets = defaultSubnets
+	}
+
+	// a one zone filesystem has a single mount target in one of the subnets
+	if aws.BoolValue(spec.OneZone) && len(subnets) > 0 {
+		changes = append(changes, &SpecChange{Action: specCreate, Resource: specMountTarget})
+	} else {
+		for _, subnet := range subnets {
+			changes = append(changes, &SpecChange{Action: specCreate, Resource: specMountTarget, ID: subnet})
+		}
+	}
+
+	for _, ap := range spec.AccessPoints {
+		changes = append(changes, &SpecChange{Action: specCreate, Resource: specAccessPoint, ID: ap.Name})
+	}
+
+	for _, u := range spec.Users {
+		changes = append(changes, &SpecChange{Action: specCreate, Resource: specUser, ID: u})
+	}
+
+	return changes
+}
+
+// planFileSystemSpec compares the spec with the current state of the filesystem and returns the plan of the
+// changes to apply.  New mount targets get the security groups of the spec, or of the existing mount targets,
+// or the default security groups.
+func planFileSystemSpec(org, group, name string, spec *FileSystemSpec, current *fileSystemState, defaultSgs []string) (*specPlan, error) {
+	if spec.OneZone != nil && *spec.OneZone != (current.fileSystem.AvailabilityZoneName != nil) {
+		msg := fmt.Sprintf("OneZone of filesystem %s can't be changed", aws.StringValue(current.fileSystem.FileSystemId))
+		return nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	plan := &specPlan{changes: []*SpecChange{}}
+
+	update := func(resource, from, to string) {
+		plan.changes = append(plan.changes, &SpecChange{Action: specUpdate, Resource: resource, From: from, To: to})
+	}
+
+	if spec.BackupPolicy != "" {
+		if backup := settledBackupPolicy(current.backupPolicy); backup != spec.BackupPolicy {
+			plan.backupPolicy = spec.BackupPolicy
+			update(specBackupPolicy, backup, spec.BackupPolicy)
+		}
+	}
+
+	// the lifecycle configuration and the transition to primary storage class are set together
+	ia, primary := noneIfEmpty(current.lifeCycleConfiguration), noneIfEmpty(current.transitionToPrimaryStorageClass)
+	wantIA, wantPrimary := ia, primary
+	if spec.LifeCycleConfiguration != "" {
+		wantIA = spec.LifeCycleConfiguration
+	}
+
+	if spec.TransitionToPrimaryStorageClass != "" {
+		wantPrimary = spec.TransitionToPrimaryStorageClass
+	}
+
+	if wantIA != ia || wantPrimary != primary {
+		plan.lifeCycleConfiguration, plan.transitionToPrimaryStorageClass = wantIA, wantPrimary
+
+		if wantIA != ia {
+			update(specLifeCycle, ia, wantIA)
+		}
+
+		if wantPrimary != primary {
+			update(specTransition, primary, wantPrimary)
+		}
+	}
+
+	if spec.AccessPolicy != nil {
+		// a filesystem without a policy allows anonymous access
+		policy := current.accessPolicy
+		if policy == nil {
+			policy = &FileSystemAccessPolicy{AllowAnonymousAccess: true}
+		}
+
+		if *policy != *spec.AccessPolicy {
+			plan.accessPolicy = spec.AccessPolicy
+			update(specAccessPolicy, fmt.Sprintf("%+v", *policy), fmt.Sprintf("%+v", *spec.AccessPolicy))
+		}
+	}
+
+	if spec.Tags != nil {
+		planTags(plan, normalizeTags(org, name, group, spec.Tags), fromEFSTags(current.fileSystem.Tags))
+	}
+
+	planMountTargets(plan, spec, current, defaultSgs)
+
+	if spec.AccessPoints != nil {
+		planAccessPoints(plan, name, spec.AccessPoints, current.accessPoints)
+	}
+
+	if spec.Users != nil {
+		planUsers(plan, spec.Users, current.users)
+	}
+
+	return plan, nil
+}
+
+// planTags adds the changes of the tags of the filesystem to the plan, tags managed by AWS are kept
+func planTags(plan *specPlan, desired, current []*Tag) {
+	currentTags := map[string]string{}
+	for _, t := range current {
+		currentTags[t.Key] = t.Value
+	}
+
+	desiredTags := map[string]bool{}
+	changed := false
+	for _, t := range desired {
+		desiredTags[t.Key] = true
+
+		v, ok := currentTags[t.Key]
+		switch {
+		case !ok:
+			plan.changes = append(plan.changes, &SpecChange{Action: specCreate, Resource: specTag, ID: t.Key, To: t.Value})
+		case v != t.Value:
+			plan.changes = append(plan.changes, &SpecChange{Action: specUpdate, Resource: specTag, ID: t.Key, From: v, To: t.Value})
+		default:
+			continue
+		}
+		changed = true
+	}
+
+	for _, t := range current {
+		if desiredTags[t.Key] || strings.HasPrefix(t.Key, "aws:") {
+			continue
+		}
+
+		plan.untag = append(plan.untag, t.Key)
+		plan.changes = append(plan.changes, &SpecChange{Action: specDelete, Resource: specTag, ID: t.Key, From: t.Value})
+		changed = true
+	}
+
+	if changed {
+		plan.tags = desired
+	}
+}
+
+// planMountTargets adds the changes of the mount targets to the plan.  Mount targets are matched by subnet and
+// are only created or deleted when the spec has subnets, their security groups are updated when the spec has
+// security groups.
+func planMountTargets(plan *specPlan, spec *FileSystemSpec, current *fileSystemState, defaultSgs []string) {
+	existing := map[string]*efs.MountTargetDescription{}
+	for _, mt := range current.mountTargets {
+		if status := aws.StringValue(mt.LifeCycleState); status == "deleting" || status == "deleted" {
+			continue
+		}
+		existing[aws.StringValue(mt.SubnetId)] = mt
+	}
+
+	plan.sgs = spec.Sgs
+	if plan.sgs == nil && len(current.mountTargets) > 0 {
+		plan.sgs = current.mountTargetSgs[aws.StringValue(current.mountTargets[0].MountTargetId)]
+	}
+
+	if plan.sgs == nil {
+		plan.sgs = defaultSgs
+	}
+
+	desired := map[string]bool{}
+	for _, subnet := range spec.Subnets {
+		desired[subnet] = true
+	}
+
+	for _, subnet := range sortedSubnets(existing) {
+		mt := existing[subnet]
+		id := aws.StringValue(mt.MountTargetId)
+
+		if spec.Subnets != nil && !desired[subnet] {
+			plan.deleteMountTargets = append(plan.deleteMountTargets, id)
+			plan.changes = append(plan.changes, &SpecChange{Action: specDelete, Resource: specMountTarget, ID: subnet})
+			continue
+		}
+
+		if spec.Sgs == nil {
+			continue
+		}
+
+		if sgs := current.mountTargetSgs[id]; !sameStrings(sgs, spec.Sgs) {
+			if plan.updateMountTargets == nil {
+				plan.updateMountTargets = map[string][]string{}
+			}
+
+			plan.updateMountTargets[id] = spec.Sgs
+			plan.changes = append(plan.changes, &SpecChange{
+				Action:   specUpdate,
+				Resource: specMountTarget,
+				ID:       subnet,
+				From:     strings.Join(sgs, ", "),
+				To:       strings.Join(spec.Sgs, ", "),
+			})
+		}
+	}
+
+	for _, subnet := range spec.Subnets {
+		if _, ok := existing[subnet]; ok {
+			continue
+		}
+
+		plan.createMountTargets = append(plan.createMountTargets, subnet)
+		plan.changes = append(plan.changes, &SpecChange{Action: specCreate, Resource: specMountTarget, ID: subnet})
+	}
+}
+
+// planAccessPoints adds the changes of the access points to the plan.  Access points are matched by their name
+// without the filesystem name prefix, an access point that doesn't match its spec is replaced.
+func planAccessPoints(plan *specPlan, name string, desired []*AccessPointSpec, current []*efs.AccessPointDescription) {
+	existing := map[string]*efs.AccessPointDescription{}
+	for _, ap := range current {
+		apName := strings.TrimPrefix(aws.StringValue(ap.Name), name+"-")
+
+		// only one access point is kept for each name
+		if _, ok := existing[apName]; ok {
+			plan.deleteAccessPoints = append(plan.deleteAccessPoints, aws.StringValue(ap.AccessPointId))
+			plan.changes = append(plan.changes, &SpecChange{Action: specDelete, Resource: specAccessPoint, ID: apName})
+			continue
+		}
+		existing[apName] = ap
+	}
+
+	wanted := map[string]bool{}
+	for _, apSpec := range desired {
+		wanted[apSpec.Name] = true
+
+		ap, ok := existing[apSpec.Name]
+		switch {
+		case !ok:
+			plan.changes = append(plan.changes, &SpecChange{Action: specCreate, Resource: specAccessPoint, ID: apSpec.Name})
+		case !accessPointMatches(apSpec, ap):
+			plan.deleteAccessPoints = append(plan.deleteAccessPoints, aws.StringValue(ap.AccessPointId))
+			plan.changes = append(plan.changes, &SpecChange{Action: specReplace, Resource: specAccessPoint, ID: apSpec.Name})
+		default:
+			continue
+		}
+
+		plan.createAccessPoints = append(plan.createAccessPoints, apSpec)
+	}
+
+	for _, ap := range current {
+		apName := strings.TrimPrefix(aws.StringValue(ap.Name), name+"-")
+		if wanted[apName] || existing[apName] != ap {
+			continue
+		}
+
+		plan.deleteAccessPoints = append(plan.deleteAccessPoints, aws.StringValue(ap.AccessPointId))
+		plan.changes = append(plan.changes, &SpecChange{Action: specDelete, Resource: specAccessPoint, ID: apName})
+	}
+}
+
+// planUsers adds the users to create and delete to the plan
+func planUsers(plan *specPlan, desired, current []string) {
+	for _, u := range desired {
+		if !containsString(current, u) {
+			plan.createUsers = append(plan.createUsers, u)
+			plan.changes = append(plan.changes, &SpecChange{Action: specCreate, Resource: specUser, ID: u})
+		}
+	}
+
+	for _, u := range current {
+		if !containsString(desired, u) {
+			plan.deleteUsers = append(plan.deleteUsers, u)
+			plan.changes = append(plan.changes, &SpecChange{Action: specDelete, Resource: specUser, ID: u})
+		}
+	}
+}
+
+// accessPointMatches returns true if the access point has the POSIX user and root directory of the spec.  An
+// access point created without a root directory has the root directory /.
+func accessPointMatches(spec *AccessPointSpec, ap *efs.AccessPointDescription) bool {
+	if !posixUserMatches(spec.PosixUser, ap.PosixUser) {
+		return false
+	}
+
+	want, got := spec.RootDirectory, ap.RootDirectory
+	if want == nil {
+		want = &efs.RootDirectory{}
+	}
+
+	if got == nil {
+		got = &efs.RootDirectory{}
+	}
+
+	if rootPath(aws.StringValue(want.Path)) != rootPath(aws.StringValue(got.Path)) {
+		return false
+	}
+
+	// the creation info is only used when the root directory is created, it's compared when the spec has it
+	if want.CreationInfo == nil {
+		return true
+	}
+
+	if got.CreationInfo == nil {
+		return false
+	}
+
+	return aws.Int64Value(want.CreationInfo.OwnerUid) == aws.Int64Value(got.CreationInfo.OwnerUid) &&
+		aws.Int64Value(want.CreationInfo.OwnerGid) == aws.Int64Value(got.CreationInfo.OwnerGid) &&
+		octalValue(aws.StringValue(want.CreationInfo.Permissions)) == octalValue(aws.StringValue(got.CreationInfo.Permissions))
+}
+
+func posixUserMatches(want, got *efs.PosixUser) bool {
+	if want == nil || got == nil {
+		return want == nil && got == nil
+	}
+
+	if aws.Int64Value(want.Uid) != aws.Int64Value(got.Uid) || aws.Int64Value(want.Gid) != aws.Int64Value(got.Gid) {
+		return false
+	}
+
+	wantGids, gotGids := aws.Int64ValueSlice(want.SecondaryGids), aws.Int64ValueSlice(got.SecondaryGids)
+	if len(wantGids) != len(gotGids) {
+		return false
+	}
+
+	sort.Slice(wantGids, func(i, j int) bool { return wantGids[i] < wantGids[j] })
+	sort.Slice(gotGids, func(i, j int) bool { return gotGids[i] < gotGids[j] })
+
+	for i := range wantGids {
+		if wantGids[i] != gotGids[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rootPath returns the root directory path, / if it's empty
+func rootPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// octalValue returns the value of the octal permissions, so that 755 and 0755 are the same
+func octalValue(permissions string) uint64 {
+	v, _ := strconv.ParseUint(permissions, 8, 32)
+	return v
+}
+
+// settledBackupPolicy returns the backup policy a changing backup policy will have
+func settledBackupPolicy(status string) string {
+	switch status {
+	case "ENABLING":
+		return "ENABLED"
+	case "DISABLING":
+		return "DISABLED"
+	}
+	return status
+}
+
+func noneIfEmpty(s string) string {
+	if s == "" {
+		return "NONE"
+	}
+	return s
+}
+
+// sameStrings returns true if the lists have the same strings in any order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedSubnets(mts map[string]*efs.MountTargetDescription) []string {
+	subnets := make([]string, 0, len(mts))
+	for s := range mts {
+		subnets = append(subnets, s)
+	}
+	sort.Strings(subnets)
+	return subnets
+}
+
+func sortedMountTargets(mts map[string][]string) []string {
+	ids := make([]string, 0, len(mts))
+	for id := range mts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+)
+
+func testFileSystemState() *fileSystemState {
+	return &fileSystemState{
+		fileSystem: &efs.FileSystemDescription{
+			FileSystemId: aws.String("fs-0123abcd"),
+			Name:         aws.String("myfs"),
+			Tags: []*efs.Tag{
+				{Key: aws.String("Name"), Value: aws.String("myfs")},
+				{Key: aws.String("spinup:org"), Value: aws.String("test")},
+				{Key: aws.String("spinup:spaceid"), Value: aws.String("space-1")},
+				{Key: aws.String("aws:elasticfilesystem:default-backup"), Value: aws.String("enabled")},
+				{Key: aws.String("team"), Value: aws.String("a")},
+				{Key: aws.String("old"), Value: aws.String("x")},
+			},
+		},
+		backupPolicy:                    "ENABLED",
+		lifeCycleConfiguration:          "AFTER_30_DAYS",
+		transitionToPrimaryStorageClass: "",
+		mountTargets: []*efs.MountTargetDescription{
+			{MountTargetId: aws.String("fsmt-1"), SubnetId: aws.String("subnet-1"), LifeCycleState: aws.String("available")},
+			{MountTargetId: aws.String("fsmt-2"), SubnetId: aws.String("subnet-2"), LifeCycleState: aws.String("available")},
+		},
+		mountTargetSgs: map[string][]string{
+			"fsmt-1": {"sg-1"},
+			"fsmt-2": {"sg-1"},
+		},
+		accessPoints: []*efs.AccessPointDescription{
+			{
+				AccessPointId: aws.String("fsap-1"),
+				Name:          aws.String("myfs-data"),
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/")},
+			},
+			{
+				AccessPointId: aws.String("fsap-2"),
+				Name:          aws.String("myfs-logs"),
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/logs")},
+			},
+			{
+				AccessPointId: aws.String("fsap-3"),
+				Name:          aws.String("myfs-old"),
+			},
+		},
+		users: []string{"alice", "bob"},
+	}
+}
+
+func TestPlanFileSystemSpecUnchanged(t *testing.T) {
+	spec := &FileSystemSpec{
+		AccessPoints: []*AccessPointSpec{
+			{Name: "data", PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)}},
+			{Name: "logs", PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)}, RootDirectory: &efs.RootDirectory{Path: aws.String("/logs")}},
+			{Name: "old"},
+		},
+		AccessPolicy:                    &FileSystemAccessPolicy{AllowAnonymousAccess: true},
+		BackupPolicy:                    "ENABLED",
+		LifeCycleConfiguration:          "AFTER_30_DAYS",
+		TransitionToPrimaryStorageClass: "NONE",
+		OneZone:                         aws.Bool(false),
+		Sgs:                             []string{"sg-1"},
+		Subnets:                         []string{"subnet-2", "subnet-1"},
+		Tags:                            []*Tag{{Key: "team", Value: "a"}, {Key: "old", Value: "x"}},
+		Users:                           []string{"bob", "alice"},
+	}
+
+	plan, err := planFileSystemSpec("test", "space-1", "myfs", spec, testFileSystemState(), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(plan.changes) != 0 {
+		for _, c := range plan.changes {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+
+	// an empty spec doesn't manage anything
+	plan, err = planFileSystemSpec("test", "space-1", "myfs", &FileSystemSpec{}, testFileSystemState(), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(plan.changes) != 0 {
+		t.Errorf("expected no changes for an empty spec, got %d", len(plan.changes))
+	}
+}
+
+func TestPlanFileSystemSpec(t *testing.T) {
+	spec := &FileSystemSpec{
+		AccessPoints: []*AccessPointSpec{
+			{Name: "data", PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)}},
+			{Name: "logs", PosixUser: &efs.PosixUser{Uid: aws.Int64(2000), Gid: aws.Int64(2000)}, RootDirectory: &efs.RootDirectory{Path: aws.String("/logs")}},
+			{Name: "scratch"},
+		},
+		AccessPolicy:                    &FileSystemAccessPolicy{EnforceEncryptedTransport: true},
+		BackupPolicy:                    "DISABLED",
+		TransitionToPrimaryStorageClass: "AFTER_1_ACCESS",
+		Sgs:                             []string{"sg-2"},
+		Subnets:                         []string{"subnet-2", "subnet-3"},
+		Tags:                            []*Tag{{Key: "team", Value: "b"}, {Key: "new", Value: "y"}},
+		Users:                           []string{"alice", "carol"},
+	}
+
+	plan, err := planFileSystemSpec("test", "space-1", "myfs", spec, testFileSystemState(), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	expected := []*SpecChange{
+		{Action: specUpdate, Resource: specBackupPolicy, From: "ENABLED", To: "DISABLED"},
+		{Action: specUpdate, Resource: specTransition, From: "NONE", To: "AFTER_1_ACCESS"},
+		{Action: specUpdate, Resource: specAccessPolicy, From: "{AllowAnonymousAccess:true EnforceEncryptedTransport:false AllowEcsTaskExecutionRole:false}", To: "{AllowAnonymousAccess:false EnforceEncryptedTransport:true AllowEcsTaskExecutionRole:false}"},
+		{Action: specUpdate, Resource: specTag, ID: "team", From: "a", To: "b"},
+		{Action: specCreate, Resource: specTag, ID: "new", To: "y"},
+		{Action: specDelete, Resource: specTag, ID: "old", From: "x"},
+		{Action: specDelete, Resource: specMountTarget, ID: "subnet-1"},
+		{Action: specUpdate, Resource: specMountTarget, ID: "subnet-2", From: "sg-1", To: "sg-2"},
+		{Action: specCreate, Resource: specMountTarget, ID: "subnet-3"},
+		{Action: specReplace, Resource: specAccessPoint, ID: "logs"},
+		{Action: specCreate, Resource: specAccessPoint, ID: "scratch"},
+		{Action: specDelete, Resource: specAccessPoint, ID: "old"},
+		{Action: specCreate, Resource: specUser, ID: "carol"},
+		{Action: specDelete, Resource: specUser, ID: "bob"},
+	}
+
+	if !reflect.DeepEqual(expected, plan.changes) {
+		for _, c := range plan.changes {
+			t.Logf("got change %+v", c)
+		}
+		t.Fatalf("expected %d changes, got %d", len(expected), len(plan.changes))
+	}
+
+	if plan.backupPolicy != "DISABLED" {
+		t.Errorf("expected backup policy DISABLED, got %s", plan.backupPolicy)
+	}
+
+	// the lifecycle configuration that isn't in the spec keeps its current value
+	if plan.lifeCycleConfiguration != "AFTER_30_DAYS" || plan.transitionToPrimaryStorageClass != "AFTER_1_ACCESS" {
+		t.Errorf("expected lifecycle AFTER_30_DAYS/AFTER_1_ACCESS, got %s/%s", plan.lifeCycleConfiguration, plan.transitionToPrimaryStorageClass)
+	}
+
+	if !reflect.DeepEqual(plan.untag, []string{"old"}) {
+		t.Errorf("expected to untag old, got %v", plan.untag)
+	}
+
+	if !reflect.DeepEqual(plan.deleteMountTargets, []string{"fsmt-1"}) {
+		t.Errorf("expected to delete mount target fsmt-1, got %v", plan.deleteMountTargets)
+	}
+
+	if !reflect.DeepEqual(plan.createMountTargets, []string{"subnet-3"}) || !reflect.DeepEqual(plan.sgs, []string{"sg-2"}) {
+		t.Errorf("expected to create mount target in subnet-3 with sg-2, got %v with %v", plan.createMountTargets, plan.sgs)
+	}
+
+	if !reflect.DeepEqual(plan.updateMountTargets, map[string][]string{"fsmt-2": {"sg-2"}}) {
+		t.Errorf("expected to update mount target fsmt-2, got %v", plan.updateMountTargets)
+	}
+
+	if !reflect.DeepEqual(plan.deleteAccessPoints, []string{"fsap-2", "fsap-3"}) {
+		t.Errorf("expected to delete access points fsap-2 and fsap-3, got %v", plan.deleteAccessPoints)
+	}
+
+	names := []string{}
+	for _, ap := range plan.createAccessPoints {
+		names = append(names, ap.Name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"logs", "scratch"}) {
+		t.Errorf("expected to create access points logs and scratch, got %v", names)
+	}
+
+	if !reflect.DeepEqual(plan.createUsers, []string{"carol"}) || !reflect.DeepEqual(plan.deleteUsers, []string{"bob"}) {
+		t.Errorf("expected to create carol and delete bob, got %v and %v", plan.createUsers, plan.deleteUsers)
+	}
+}
+
+func TestPlanFileSystemSpecMountTargetSgs(t *testing.T) {
+	// new mount targets get the security groups of the existing mount targets
+	plan, err := planFileSystemSpec("test", "space-1", "myfs", &FileSystemSpec{Subnets: []string{"subnet-1", "subnet-2", "subnet-3"}}, testFileSystemState(), []string{"sg-default"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(plan.sgs, []string{"sg-1"}) {
+		t.Errorf("expected security groups of the existing mount targets, got %v", plan.sgs)
+	}
+
+	// or the default security groups when there aren't any
+	current := testFileSystemState()
+	current.mountTargets = nil
+
+	plan, err = planFileSystemSpec("test", "space-1", "myfs", &FileSystemSpec{Subnets: []string{"subnet-1"}}, current, []string{"sg-default"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(plan.sgs, []string{"sg-default"}) {
+		t.Errorf("expected default security groups, got %v", plan.sgs)
+	}
+
+	// an empty list of access points deletes all of them
+	plan, err = planFileSystemSpec("test", "space-1", "myfs", &FileSystemSpec{AccessPoints: []*AccessPointSpec{}}, testFileSystemState(), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(plan.deleteAccessPoints, []string{"fsap-1", "fsap-2", "fsap-3"}) {
+		t.Errorf("expected to delete all access points, got %v", plan.deleteAccessPoints)
+	}
+}
+
+func TestPlanFileSystemSpecOneZone(t *testing.T) {
+	_, err := planFileSystemSpec("test", "space-1", "myfs", &FileSystemSpec{OneZone: aws.Bool(true)}, testFileSystemState(), nil)
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
+
+func TestPlanFileSystemSpecCreate(t *testing.T) {
+	spec := &FileSystemSpec{
+		AccessPoints: []*AccessPointSpec{{Name: "data"}},
+		Users:        []string{"alice"},
+	}
+
+	expected := []*SpecChange{
+		{Action: specCreate, Resource: specFileSystem},
+		{Action: specCreate, Resource: specMountTarget, ID: "subnet-1"},
+		{Action: specCreate, Resource: specMountTarget, ID: "subnet-2"},
+		{Action: specCreate, Resource: specAccessPoint, ID: "data"},
+		{Action: specCreate, Resource: specUser, ID: "alice"},
+	}
+
+	if changes := planFileSystemSpecCreate(spec, []string{"subnet-1", "subnet-2"}); !reflect.DeepEqual(expected, changes) {
+		t.Errorf("expected %d changes, got %d", len(expected), len(changes))
+	}
+
+	spec.OneZone = aws.Bool(true)
+	changes := planFileSystemSpecCreate(spec, []string{"subnet-1", "subnet-2"})
+	if len(changes) != 4 || changes[1].Resource != specMountTarget || changes[1].ID != "" {
+		t.Errorf("expected one mount target for a one zone filesystem, got %+v", changes)
+	}
+}
+
+func TestAccessPointMatches(t *testing.T) {
+	ap := &efs.AccessPointDescription{
+		PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{3, 2})},
+		RootDirectory: &efs.RootDirectory{
+			Path:         aws.String("/data"),
+			CreationInfo: &efs.CreationInfo{OwnerUid: aws.Int64(1000), OwnerGid: aws.Int64(1000), Permissions: aws.String("0755")},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		spec  *AccessPointSpec
+		match bool
+	}{
+		{
+			name: "same",
+			spec: &AccessPointSpec{
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{2, 3})},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/data"), CreationInfo: &efs.CreationInfo{OwnerUid: aws.Int64(1000), OwnerGid: aws.Int64(1000), Permissions: aws.String("755")}},
+			},
+			match: true,
+		},
+		{
+			name: "without creation info",
+			spec: &AccessPointSpec{
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{2, 3})},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/data")},
+			},
+			match: true,
+		},
+		{
+			name: "different uid",
+			spec: &AccessPointSpec{
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1001), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{2, 3})},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/data")},
+			},
+		},
+		{
+			name: "different secondary gids",
+			spec: &AccessPointSpec{
+				PosixUser:     &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)},
+				RootDirectory: &efs.RootDirectory{Path: aws.String("/data")},
+			},
+		},
+		{
+			name: "different path",
+			spec: &AccessPointSpec{
+				PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{2, 3})},
+			},
+		},
+		{
+			name: "no posix user",
+			spec: &AccessPointSpec{RootDirectory: &efs.RootDirectory{Path: aws.String("/data")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if match := accessPointMatches(tt.spec, ap); match != tt.match {
+				t.Errorf("expected match %t, got %t", tt.match, match)
+			}
+		})
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	spec := &FileSystemSpec{
+		AccessPoints: []*AccessPointSpec{{Name: "data"}, {Name: "logs"}, {Name: "data"}},
+		Users:        []string{"alice", "alice", "a-very-long-user-name-that-is-too-long-with-the-prefix"},
+	}
+
+	err := validateSpec("a-long-filesystem-name", spec)
+
+	aerr, ok := err.(apierror.Error)
+	if !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Fatalf("expected bad request error, got %v", err)
+	}
+
+	fe, ok := aerr.OrigErr.(fieldErrors)
+	if !ok {
+		t.Fatalf("expected field errors, got %v", aerr.OrigErr)
+	}
+
+	fields := []string{}
+	for _, f := range fe {
+		fields = append(fields, f.Field)
+	}
+
+	if expected := []string{"AccessPoints[2].Name", "Users[1]", "Users[2]"}; !reflect.DeepEqual(expected, fields) {
+		t.Errorf("expected field errors %v, got %v", expected, fields)
+	}
+
+	if err := validateSpec("myfs", &FileSystemSpec{Users: []string{"alice"}}); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+}
+
+func TestCheckSpecQuota(t *testing.T) {
+	quota := common.Quota{AccessPointsPerFileSystem: 2, UsersPerFileSystem: 1}
+
+	if err := checkSpecQuota(quota, &FileSystemSpec{AccessPoints: []*AccessPointSpec{{}, {}}, Users: []string{"alice"}}); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	if err := checkSpecQuota(quota, &FileSystemSpec{AccessPoints: []*AccessPointSpec{{}, {}, {}}}); err == nil {
+		t.Error("expected access point quota error, got nil")
+	}
+
+	if err := checkSpecQuota(quota, &FileSystemSpec{Users: []string{"alice", "bob"}}); err == nil {
+		t.Error("expected user quota error, got nil")
+	}
+
+	if err := checkSpecQuota(common.Quota{}, &FileSystemSpec{Users: []string{"alice", "bob"}}); err != nil {
+		t.Errorf("expected nil error without quota, got %s", err)
+	}
+}
@@ -7,21 +7,39 @@ import (
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/YaleSpinup/aws-go/services/iam"
+	"github.com/YaleSpinup/efs-api/common"
 	"github.com/YaleSpinup/efs-api/efs"
+	"github.com/YaleSpinup/efs-api/saga"
 	"github.com/aws/aws-sdk-go/aws"
-	log "github.com/sirupsen/logrus"
 )
 
-func (o *userOrchestrator) createFilesystemUser(ctx context.Context, group, fsid string, req *FileSystemUserCreateRequest) (*FileSystemUserResponse, error) {
+func (o *userOrchestrator) createFilesystemUser(ctx context.Context, group, fsid string, quota common.Quota, req *FileSystemUserCreateRequest) (*FileSystemUserResponse, error) {
 	filesystem, err := o.efsClient.GetFileSystem(ctx, fsid)
 	if err != nil {
 		return nil, err
 	}
 
+	if quota.UsersPerFileSystem > 0 {
+		users, err := o.listFilesystemUsers(ctx, group, fsid)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkUserQuota(quota, len(users)); err != nil {
+			return nil, err
+		}
+	}
+
 	name := aws.StringValue(filesystem.Name)
 	path := fmt.Sprintf("/spinup/%s/%s/%s/", o.org, group, name)
 	userName := fmt.Sprintf("%s-%s", name, req.UserName)
 
+	// the IAM user name is prefixed with the filesystem name
+	if len(userName) > maxUserNameLength {
+		msg := fmt.Sprintf("UserName must be at most %d characters for filesystem %s", maxUserNameLength-len(name)-1, name)
+		return nil, newValidationError(&FieldError{Field: "UserName", Message: msg})
+	}
+
 	// set the user tags from the filesystems
 	tags := normalizeTags(o.org, userName, group, fromEFSTags(filesystem.Tags))
 	tags = append(tags, &Tag{
@@ -29,22 +47,46 @@ func (o *userOrchestrator) createFilesystemUser(ctx context.Context, group, fsid
 		Value: aws.StringValue(filesystem.Name),
 	})
 
-	user, err := o.iamClient.CreateUser(ctx, userName, path, toIAMTags(tags))
-	if err != nil {
-		return nil, err
-	}
+	grp := fmt.Sprintf("%s-%s", "SpinupEFSAdminGroup", o.org)
 
-	if err := o.iamClient.WaitForUser(ctx, userName); err != nil {
-		return nil, err
+	// the user is deleted if it can't be added to the group
+	var response *FileSystemUserResponse
+	steps := []saga.Step{
+		{
+			Name: "create-user",
+			Do: func(ctx context.Context) error {
+				out, err := o.iamClient.CreateUser(ctx, userName, path, toIAMTags(tags))
+				if err != nil {
+					return err
+				}
+
+				response = filesystemUserResponseFromIAM(out, nil)
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				logger(ctx).Errorf("rollback: deleting user %s", userName)
+				return o.iamClient.DeleteUser(ctx, userName)
+			},
+		},
+		{
+			Name: "wait-user",
+			Do: func(ctx context.Context) error {
+				return o.iamClient.WaitForUser(ctx, userName)
+			},
+		},
+		{
+			Name: "add-user-to-group",
+			Do: func(ctx context.Context) error {
+				return o.iamClient.AddUserToGroup(ctx, userName, grp)
+			},
+		},
 	}
 
-	grp := fmt.Sprintf("%s-%s", "SpinupEFSAdminGroup", o.org)
-
-	if err := o.iamClient.AddUserToGroup(ctx, userName, grp); err != nil {
+	if err := saga.New(userName, steps).Run(ctx); err != nil {
 		return nil, err
 	}
 
-	return filesystemUserResponseFromIAM(user, nil), nil
+	return response, nil
 }
 
 // deleteFilesystemUser deletes a filesystem user and all associated access keys
@@ -62,6 +104,11 @@ func (o *userOrchestrator) deleteFilesystemUser(ctx context.Context, group, fsid
 		return err
 	}
 
+	return o.deleteUser(ctx, userName)
+}
+
+// deleteUser removes the IAM user from its groups, deletes its access keys and deletes the user
+func (o *userOrchestrator) deleteUser(ctx context.Context, userName string) error {
 	groups, err := o.iamClient.ListGroupsForUser(ctx, userName)
 	if err != nil {
 		return err
@@ -101,7 +148,7 @@ func (o *userOrchestrator) deleteAllFilesystemUsers(ctx context.Context, group,
 
 	for _, u := range users {
 		if err := o.deleteFilesystemUser(ctx, group, fsid, u); err != nil {
-			log.Errorf("failed to delete filesystem %s user %s: %s", fsid, u, err)
+			logger(ctx).Errorf("failed to delete filesystem %s user %s: %s", fsid, u, err)
 		}
 	}
 
@@ -127,7 +174,7 @@ func (o *userOrchestrator) listFilesystemUsers(ctx context.Context, group, fsid
 
 	trimmed := make([]string, 0, len(users))
 	for _, u := range users {
-		log.Debugf("trimming prefix '%s' from username %s", prefix, u)
+		logger(ctx).Debugf("trimming prefix '%s' from username %s", prefix, u)
 		u = strings.TrimPrefix(u, prefix)
 		trimmed = append(trimmed, u)
 	}
@@ -207,7 +254,7 @@ func (o *userOrchestrator) updateFilesystemUser(ctx context.Context, group, fsid
 }
 
 func (s *server) updateTagsForUser(ctx context.Context, account, group, fsid, user string, tags []*Tag) error {
-	log.Infof("updating tags for filesystem %s user %s", fsid, user)
+	logger(ctx).Infof("updating tags for filesystem %s user %s", fsid, user)
 
 	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
 
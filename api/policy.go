@@ -58,6 +58,7 @@ func (s *server) filesystemUserCreatePolicy() (string, error) {
 					"iam:GetGroup",
 					"iam:CreateGroup",
 					"iam:TagUser",
+					"iam:ListUsers",
 				},
 				Resource: []string{
 					"arn:aws:iam::*:group/*",
@@ -116,6 +117,53 @@ func (s *server) filesystemUserDeletePolicy() (string, error) {
 	return string(j), nil
 }
 
+// orphanCleanupPolicy allows deleting the orphaned IAM users and admin group of the org and the orphaned access points
+func (s *server) orphanCleanupPolicy() (string, error) {
+	policy := &iam.PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []iam.StatementEntry{
+			{
+				Sid:    "DeleteOrphanedUsersAndGroups",
+				Effect: "Allow",
+				Action: []string{
+					"iam:DeleteAccessKey",
+					"iam:RemoveUserFromGroup",
+					"iam:ListAccessKeys",
+					"iam:ListGroupsForUser",
+					"iam:ListUsers",
+					"iam:DeleteUser",
+					"iam:GetUser",
+					"iam:GetGroup",
+					"iam:ListAttachedGroupPolicies",
+					"iam:DetachGroupPolicy",
+					"iam:DeleteGroup",
+				},
+				Resource: []string{
+					fmt.Sprintf("arn:aws:iam::*:user/spinup/%s/*", s.org),
+					fmt.Sprintf("arn:aws:iam::*:group/spinup/%s/*", s.org),
+				},
+			},
+			{
+				Sid:    "DeleteOrphanedAccessPoints",
+				Effect: "Allow",
+				Action: []string{
+					"elasticfilesystem:DescribeAccessPoints",
+					"elasticfilesystem:DescribeFileSystems",
+					"elasticfilesystem:DeleteAccessPoint",
+				},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	j, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
 func (s *server) filesystemUserUpdatePolicy() (string, error) {
 	policy := &iam.PolicyDocument{
 		Version: "2012-10-17",
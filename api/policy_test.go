@@ -54,7 +54,7 @@ func Test_server_filesystemUserCreatePolicy(t *testing.T) {
 			fields: fields{
 				org: "testOrg",
 			},
-			want: `{"Version":"2012-10-17","Statement":[{"Sid":"CreateRepositoryUser","Effect":"Allow","Action":["iam:CreatePolicy","iam:UntagUser","iam:GetPolicyVersion","iam:AddUserToGroup","iam:GetPolicy","iam:ListAttachedGroupPolicies","iam:ListGroupPolicies","iam:AttachGroupPolicy","iam:GetUser","iam:CreatePolicyVersion","iam:CreateUser","iam:GetGroup","iam:CreateGroup","iam:TagUser"],"Resource":["arn:aws:iam::*:group/*","arn:aws:iam::*:policy/spinup/testOrg/*","arn:aws:iam::*:user/spinup/testOrg/*"]},{"Sid":"ListRepositoryUserPolicies","Effect":"Allow","Action":["iam:ListPolicies"],"Resource":["*"]}]}`,
+			want: `{"Version":"2012-10-17","Statement":[{"Sid":"CreateRepositoryUser","Effect":"Allow","Action":["iam:CreatePolicy","iam:UntagUser","iam:GetPolicyVersion","iam:AddUserToGroup","iam:GetPolicy","iam:ListAttachedGroupPolicies","iam:ListGroupPolicies","iam:AttachGroupPolicy","iam:GetUser","iam:CreatePolicyVersion","iam:CreateUser","iam:GetGroup","iam:CreateGroup","iam:TagUser","iam:ListUsers"],"Resource":["arn:aws:iam::*:group/*","arn:aws:iam::*:policy/spinup/testOrg/*","arn:aws:iam::*:user/spinup/testOrg/*"]},{"Sid":"ListRepositoryUserPolicies","Effect":"Allow","Action":["iam:ListPolicies"],"Resource":["*"]}]}`,
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/YaleSpinup/efs-api/efs"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// quotaForGroup returns the quota for a group/space, starting with the org default and
+// replacing any limits that are set in the override for the spaceid.  Unlimited limits are
+// returned as zero.
+func (s *server) quotaForGroup(group string) common.Quota {
+	quotas := s.conf().quotas
+	quota := quotas.Default
+
+	if override, ok := quotas.Overrides[group]; ok {
+		quota.FileSystems = overrideLimit(quota.FileSystems, override.FileSystems)
+		quota.AccessPointsPerFileSystem = overrideLimit(quota.AccessPointsPerFileSystem, override.AccessPointsPerFileSystem)
+		quota.UsersPerFileSystem = overrideLimit(quota.UsersPerFileSystem, override.UsersPerFileSystem)
+		quota.StorageGB = overrideLimit(quota.StorageGB, override.StorageGB)
+
+		log.Debugf("using quota override for group %s: %+v", group, quota)
+	}
+
+	quota.FileSystems = unlimitedAsZero(quota.FileSystems)
+	quota.AccessPointsPerFileSystem = unlimitedAsZero(quota.AccessPointsPerFileSystem)
+	quota.UsersPerFileSystem = unlimitedAsZero(quota.UsersPerFileSystem)
+	quota.StorageGB = unlimitedAsZero(quota.StorageGB)
+
+	return quota
+}
+
+// overrideLimit returns the override of a limit, or the limit if the override isn't set
+func overrideLimit(limit, override int) int {
+	if override == 0 {
+		return limit
+	}
+	return override
+}
+
+// unlimitedAsZero returns zero for an unlimited limit
+func unlimitedAsZero(limit int) int {
+	if limit == common.Unlimited {
+		return 0
+	}
+	return limit
+}
+
+// checkFileSystemQuota returns a limit exceeded error if creating a filesystem in the group would exceed the
+// number of filesystems in the quota or the storage quota is used up, or a conflict if the number of requested access points exceeds the quota
+func (s *server) checkFileSystemQuota(ctx context.Context, account, group string, accessPoints int) error {
+	quota := s.quotaForGroup(group)
+
+	if quota.AccessPointsPerFileSystem > 0 && accessPoints > quota.AccessPointsPerFileSystem {
+		msg := fmt.Sprintf("access point quota exceeded, requested %d of %d access points per filesystem", accessPoints, quota.AccessPointsPerFileSystem)
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	if quota.FileSystems <= 0 && quota.StorageGB <= 0 {
+		return nil
+	}
+
+	fsList, err := s.filesystemList(ctx, account, group)
+	if err != nil {
+		return err
+	}
+
+	if current := len(fsList); quota.FileSystems > 0 && current >= quota.FileSystems {
+		msg := fmt.Sprintf("filesystem quota exceeded for %s, current usage %d of %d filesystems", group, current, quota.FileSystems)
+		return apierror.New(apierror.ErrLimitExceeded, msg, nil)
+	}
+
+	if quota.StorageGB <= 0 {
+		return nil
+	}
+
+	storage, err := s.groupStorageBytes(ctx, account, fsList)
+	if err != nil {
+		return err
+	}
+
+	return checkStorageQuota(group, quota, storage)
+}
+
+// checkStorageQuota returns a limit exceeded error if the filesystems in the group use all of the storage in the quota
+func checkStorageQuota(group string, quota common.Quota, storage int64) error {
+	if quota.StorageGB <= 0 || storage < int64(quota.StorageGB)*bytesPerGB {
+		return nil
+	}
+
+	msg := fmt.Sprintf("storage quota exceeded for %s, current usage %.1f of %d GB", group, float64(storage)/bytesPerGB, quota.StorageGB)
+	return apierror.New(apierror.ErrLimitExceeded, msg, nil)
+}
+
+// groupStorageBytes returns the total metered size of the filesystems
+func (s *server) groupStorageBytes(ctx context.Context, account string, fsids []string) (int64, error) {
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		"",
+		"arn:aws:iam::aws:policy/AmazonElasticFileSystemReadOnlyAccess",
+	)
+	if err != nil {
+		msg := fmt.Sprintf("failed to assume role in account: %s", account)
+		return 0, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	service := efs.New(efs.WithSession(session.Session))
+
+	var total int64
+	for _, fsid := range fsids {
+		filesystem, err := service.GetFileSystem(ctx, fsid)
+		if err != nil {
+			return 0, err
+		}
+
+		if filesystem.SizeInBytes != nil {
+			total += aws.Int64Value(filesystem.SizeInBytes.Value)
+		}
+	}
+
+	return total, nil
+}
+
+// checkAccessPointQuota returns a conflict error if creating another access point would exceed the quota
+func checkAccessPointQuota(quota common.Quota, current int) error {
+	if quota.AccessPointsPerFileSystem <= 0 || current < quota.AccessPointsPerFileSystem {
+		return nil
+	}
+
+	msg := fmt.Sprintf("access point quota exceeded, current usage %d of %d access points per filesystem", current, quota.AccessPointsPerFileSystem)
+	return apierror.New(apierror.ErrConflict, msg, nil)
+}
+
+// checkUserQuota returns a conflict error if creating another user would exceed the quota
+func checkUserQuota(quota common.Quota, current int) error {
+	if quota.UsersPerFileSystem <= 0 || current < quota.UsersPerFileSystem {
+		return nil
+	}
+
+	msg := fmt.Sprintf("user quota exceeded, current usage %d of %d users per filesystem", current, quota.UsersPerFileSystem)
+	return apierror.New(apierror.ErrConflict, msg, nil)
+}
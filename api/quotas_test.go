@@ -0,0 +1,92 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+)
+
+func TestQuotaForGroup(t *testing.T) {
+	s := server{}
+	s.config.Store(&dynamicConfig{
+		quotas: common.Quotas{
+			Default: common.Quota{
+				FileSystems:               10,
+				AccessPointsPerFileSystem: 20,
+				UsersPerFileSystem:        5,
+				StorageGB:                 100,
+			},
+			Overrides: map[string]common.Quota{
+				"bigspace": {
+					FileSystems: 50,
+				},
+				"freespace": {
+					FileSystems: common.Unlimited,
+					StorageGB:   common.Unlimited,
+				},
+			},
+		},
+	})
+
+	tests := map[string]common.Quota{
+		"somespace": {FileSystems: 10, AccessPointsPerFileSystem: 20, UsersPerFileSystem: 5, StorageGB: 100},
+		"bigspace":  {FileSystems: 50, AccessPointsPerFileSystem: 20, UsersPerFileSystem: 5, StorageGB: 100},
+		"freespace": {AccessPointsPerFileSystem: 20, UsersPerFileSystem: 5},
+	}
+
+	for group, expected := range tests {
+		if out := s.quotaForGroup(group); !reflect.DeepEqual(expected, out) {
+			t.Errorf("expected quota for %s to be %+v, got %+v", group, expected, out)
+		}
+	}
+}
+
+func TestCheckAccessPointQuota(t *testing.T) {
+	if err := checkAccessPointQuota(common.Quota{}, 1000); err != nil {
+		t.Errorf("expected nil error for unlimited quota, got %s", err)
+	}
+
+	quota := common.Quota{AccessPointsPerFileSystem: 2}
+	if err := checkAccessPointQuota(quota, 1); err != nil {
+		t.Errorf("expected nil error under quota, got %s", err)
+	}
+
+	err := checkAccessPointQuota(quota, 2)
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected conflict error at quota, got %v", err)
+	}
+}
+
+func TestCheckUserQuota(t *testing.T) {
+	if err := checkUserQuota(common.Quota{}, 1000); err != nil {
+		t.Errorf("expected nil error for unlimited quota, got %s", err)
+	}
+
+	quota := common.Quota{UsersPerFileSystem: 3}
+	if err := checkUserQuota(quota, 2); err != nil {
+		t.Errorf("expected nil error under quota, got %s", err)
+	}
+
+	err := checkUserQuota(quota, 3)
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected conflict error at quota, got %v", err)
+	}
+}
+
+func TestCheckStorageQuota(t *testing.T) {
+	if err := checkStorageQuota("space", common.Quota{}, 1000*bytesPerGB); err != nil {
+		t.Errorf("expected nil error for unlimited quota, got %s", err)
+	}
+
+	quota := common.Quota{StorageGB: 10}
+	if err := checkStorageQuota("space", quota, 9*bytesPerGB); err != nil {
+		t.Errorf("expected nil error under quota, got %s", err)
+	}
+
+	err := checkStorageQuota("space", quota, 10*bytesPerGB)
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrLimitExceeded {
+		t.Errorf("expected limit exceeded error at quota, got %v", err)
+	}
+}
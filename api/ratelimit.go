@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// rateLimiter takes a request from the bucket with the key, returning whether the request is allowed
+// and how long to wait before retrying if it isn't
+type rateLimiter interface {
+	allow(ctx context.Context, key string, rule common.RateLimitRule) (bool, time.Duration, error)
+}
+
+// rateLimitBucket is the key of a token bucket and its limit
+type rateLimitBucket struct {
+	key  string
+	rule common.RateLimitRule
+}
+
+// tokenBucketScript atomically refills the bucket in KEYS[1] at ARGV[1] tokens per second up to ARGV[2]
+// tokens as of ARGV[3] milliseconds and takes a token from it.  It returns whether a token was taken
+// and the number of milliseconds until one is available.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {allowed, wait}
+`)
+
+// redisRateLimiter is a token bucket rate limiter stored in redis so limits are shared between replicas
+type redisRateLimiter struct {
+	client redis.Scripter
+	now    func() time.Time
+	prefix string
+}
+
+// newRateLimiter creates a redis rate limiter using the rate limit redis configuration, or the flywheel
+// redis if it's not configured
+func newRateLimiter(config common.RateLimit, fw common.Flywheel) (*redisRateLimiter, error) {
+	opts := &redis.Options{
+		Addr:     config.RedisAddress,
+		Password: config.RedisPassword,
+	}
+
+	database := config.RedisDatabase
+	if config.RedisAddress == "" {
+		opts.Addr = fw.RedisAddress
+		opts.Password = fw.RedisPassword
+		database = fw.RedisDatabase
+	}
+
+	if database != "" {
+		db, err := strconv.Atoi(database)
+		if err != nil {
+			return nil, err
+		}
+		opts.DB = db
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "efsapi:ratelimit"
+	}
+
+	log.Infof("rate limiting requests with redis %s", opts.Addr)
+
+	return &redisRateLimiter{
+		client: redis.NewClient(opts),
+		now:    time.Now,
+		prefix: prefix,
+	}, nil
+}
+
+func (l *redisRateLimiter) allow(ctx context.Context, key string, rule common.RateLimitRule) (bool, time.Duration, error) {
+	burst := rule.Burst
+	if burst < 1 {
+		burst = int(math.Ceil(rule.RequestsPerSecond))
+	}
+
+	// keep the bucket until it would be full again
+	ttl := int64(math.Ceil(float64(burst)/rule.RequestsPerSecond*1000)) + 1000
+
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + ":" + key}, rule.RequestsPerSecond, burst, l.now().UnixMilli(), ttl).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit response %v", res)
+	}
+
+	allowed, _ := res[0].(int64)
+	wait, _ := res[1].(int64)
+
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// RateLimitMiddleware limits the rate of requests for the authenticated token and for the account
+// in the request, returning 429 with a Retry-After header when a limit is exceeded
+func (s *server) RateLimitMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.rateLimiter == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		limits := s.conf().rateLimit
+		buckets := []rateLimitBucket{}
+
+		if name := tokenName(r.Context()); name != "" && limits.PerToken.RequestsPerSecond > 0 {
+			buckets = append(buckets, rateLimitBucket{key: "token:" + name, rule: limits.PerToken})
+		}
+
+		if account, ok := mux.Vars(r)["account"]; ok && limits.PerAccount.RequestsPerSecond > 0 {
+			buckets = append(buckets, rateLimitBucket{key: "account:" + s.mapAccountNumber(account), rule: limits.PerAccount})
+		}
+
+		for _, b := range buckets {
+			allowed, wait, err := s.rateLimiter.allow(r.Context(), b.key, b.rule)
+			if err != nil {
+				// fail open so a redis outage doesn't take down the api
+				log.Errorf("failed to check rate limit for %s: %s", b.key, err)
+				continue
+			}
+
+			if !allowed {
+				retry := int(math.Ceil(wait.Seconds()))
+				if retry < 1 {
+					retry = 1
+				}
+
+				log.Warnf("rate limit exceeded for %s on '%s', retry after %ds", b.key, r.URL, retry)
+
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				handleError(w, apierror.New(apierror.ErrLimitExceeded, "rate limit exceeded", nil))
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+type testScripter struct {
+	redis.Scripter
+	keys   []string
+	args   []interface{}
+	result []interface{}
+}
+
+func (t *testScripter) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	t.keys = keys
+	t.args = args
+	return redis.NewCmdResult(t.result, nil)
+}
+
+func TestRedisRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	client := &testScripter{result: []interface{}{int64(0), int64(1500)}}
+	l := &redisRateLimiter{client: client, now: func() time.Time { return now }, prefix: "efsapi:ratelimit"}
+
+	allowed, wait, err := l.allow(context.TODO(), "token:dashboard", common.RateLimitRule{RequestsPerSecond: 2, Burst: 10})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if allowed || wait != 1500*time.Millisecond {
+		t.Errorf("expected request to be limited for 1.5s, got allowed %t and wait %s", allowed, wait)
+	}
+
+	if !reflect.DeepEqual(client.keys, []string{"efsapi:ratelimit:token:dashboard"}) {
+		t.Errorf("unexpected keys %v", client.keys)
+	}
+
+	expectedArgs := []interface{}{float64(2), 10, now.UnixMilli(), int64(6000)}
+	if !reflect.DeepEqual(client.args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, client.args)
+	}
+
+	client.result = []interface{}{int64(1), int64(0)}
+	if allowed, _, err := l.allow(context.TODO(), "account:1234567890", common.RateLimitRule{RequestsPerSecond: 0.5}); err != nil || !allowed {
+		t.Errorf("expected request to be allowed, got %t, %v", allowed, err)
+	}
+
+	// without a burst the bucket holds a second of requests
+	if client.args[1] != 1 {
+		t.Errorf("expected default burst of 1, got %v", client.args[1])
+	}
+}
+
+type testRateLimiter struct {
+	counts map[string]int
+	err    error
+}
+
+func (t *testRateLimiter) allow(ctx context.Context, key string, rule common.RateLimitRule) (bool, time.Duration, error) {
+	t.counts[key]++
+	if t.err != nil {
+		return false, 0, t.err
+	}
+	return t.counts[key] <= rule.Burst, 1500 * time.Millisecond, nil
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := &testRateLimiter{counts: map[string]int{}}
+
+	s := server{rateLimiter: limiter}
+	s.config.Store(&dynamicConfig{
+		accountsMap: map[string]string{"spinup": "1234567890"},
+		rateLimit: common.RateLimit{
+			PerToken:   common.RateLimitRule{RequestsPerSecond: 1, Burst: 3},
+			PerAccount: common.RateLimitRule{RequestsPerSecond: 1, Burst: 2},
+		},
+	})
+
+	router := mux.NewRouter()
+	router.Use(s.RateLimitMiddleware)
+	router.HandleFunc("/v1/efs/{account}/filesystems", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.HandleFunc("/v1/efs/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req = req.WithContext(withToken(req.Context(), &apiToken{name: token}))
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the account bucket is shared between the account name and number
+	for _, path := range []string{"/v1/efs/spinup/filesystems", "/v1/efs/1234567890/filesystems"} {
+		if rr := request(path, "dashboard"); rr.Code != http.StatusOK {
+			t.Errorf("expected %s to be allowed, got %d", path, rr.Code)
+		}
+	}
+
+	rr := request("/v1/efs/spinup/filesystems", "dashboard")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected account limit to be exceeded, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected Retry-After 2, got %s", rr.Header().Get("Retry-After"))
+	}
+
+	// the token bucket has one more request in another account, then it's limited everywhere
+	if rr := request("/v1/efs/other/filesystems", "dashboard"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected token limit to be exceeded, got %d", rr.Code)
+	}
+
+	if rr := request("/v1/efs/other/filesystems", "pipeline"); rr.Code != http.StatusOK {
+		t.Errorf("expected other token to be allowed, got %d", rr.Code)
+	}
+
+	// requests without a token or account aren't limited
+	for i := 0; i < 5; i++ {
+		if rr := request("/v1/efs/ping", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected public request to be allowed, got %d", rr.Code)
+		}
+	}
+
+	// redis errors fail open
+	limiter.err = errors.New("connection refused")
+	if rr := request("/v1/efs/spinup/filesystems", "dashboard"); rr.Code != http.StatusOK {
+		t.Errorf("expected request to be allowed when the limiter fails, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,503 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	yefs "github.com/YaleSpinup/efs-api/efs"
+)
+
+// reconcileOptOutTag opts a filesystem out of reconciliation when it's set to false
+const reconcileOptOutTag = "spinup:reconcile"
+
+// the statuses of the filesystems compared by the reconciler
+const (
+	driftInSync    = "inSync"
+	driftDrifted   = "drifted"
+	driftRepairing = "repairing"
+	driftSkipped   = "skipped"
+	driftFailed    = "failed"
+)
+
+var (
+	driftChanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "efsapi",
+		Subsystem: "reconciler",
+		Name:      "drift_changes",
+		Help:      "Number of changes between a filesystem and its last applied configuration.",
+	}, []string{"account", "group", "filesystem"})
+
+	reconcileChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "efsapi",
+		Subsystem: "reconciler",
+		Name:      "checks_total",
+		Help:      "Number of filesystems compared with their last applied configuration, by status.",
+	}, []string{"status"})
+)
+
+func init() {
+	prometheus.MustRegister(driftChanges, reconcileChecks)
+}
+
+// fileSystemConfig is the last applied configuration of a filesystem.  The spec only has the settings that the
+// reconciler manages: the backup policy, the lifecycle configuration, the access policy and the subnets and
+// security groups of the mount targets.
+type fileSystemConfig struct {
+	Account      string
+	Region       string
+	Group        string
+	Name         string
+	FileSystemID string
+	Spec         *FileSystemSpec
+	UpdatedAt    time.Time
+}
+
+// fileSystemConfigStore persists the last applied configuration of the filesystems and the latest drift found by
+// the reconciler
+type fileSystemConfigStore interface {
+	save(ctx context.Context, config *fileSystemConfig) error
+	load(ctx context.Context, account, fsid string) (*fileSystemConfig, error)
+	remove(ctx context.Context, account, fsid string) error
+	list(ctx context.Context) ([]*fileSystemConfig, error)
+	saveDrift(ctx context.Context, account string, drift *FileSystemDrift) error
+	listDrift(ctx context.Context, account string) ([]*FileSystemDrift, error)
+	claim(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+}
+
+// redisFileSystemConfigStore stores the configurations as JSON in the hash <prefix>:configs, keyed by
+// <account>:<filesystem id>, the drift of the filesystems in an account in the hash <prefix>:drift:<account>,
+// keyed by filesystem id, and the lease of the replica running the reconciler in <prefix>:lease
+type redisFileSystemConfigStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// newFileSystemConfigStore creates a redis filesystem configuration store under the flywheel namespace
+func newFileSystemConfigStore(client redis.Cmdable, namespace string) *redisFileSystemConfigStore {
+	return &redisFileSystemConfigStore{
+		client: client,
+		prefix: namespace + ":reconciler",
+	}
+}
+
+func (r *redisFileSystemConfigStore) configsKey() string { return r.prefix + ":configs" }
+func (r *redisFileSystemConfigStore) leaseKey() string   { return r.prefix + ":lease" }
+
+func (r *redisFileSystemConfigStore) driftKey(account string) string {
+	return r.prefix + ":drift:" + account
+}
+
+func (r *redisFileSystemConfigStore) save(ctx context.Context, config *fileSystemConfig) error {
+	out, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return r.client.HSet(ctx, r.configsKey(), config.Account+":"+config.FileSystemID, out).Err()
+}
+
+func (r *redisFileSystemConfigStore) load(ctx context.Context, account, fsid string) (*fileSystemConfig, error) {
+	out, err := r.client.HGet(ctx, r.configsKey(), account+":"+fsid).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	config := &fileSystemConfig{}
+	if err := json.Unmarshal(out, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (r *redisFileSystemConfigStore) remove(ctx context.Context, account, fsid string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, r.configsKey(), account+":"+fsid)
+		pipe.HDel(ctx, r.driftKey(account), fsid)
+		return nil
+	})
+	return err
+}
+
+func (r *redisFileSystemConfigStore) list(ctx context.Context) ([]*fileSystemConfig, error) {
+	out, err := r.client.HGetAll(ctx, r.configsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*fileSystemConfig, 0, len(out))
+	for key, j := range out {
+		config := &fileSystemConfig{}
+		if err := json.Unmarshal([]byte(j), config); err != nil {
+			return nil, fmt.Errorf("failed to decode configuration %s: %s", key, err)
+		}
+		configs = append(configs, config)
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Account != configs[j].Account {
+			return configs[i].Account < configs[j].Account
+		}
+		return configs[i].FileSystemID < configs[j].FileSystemID
+	})
+
+	return configs, nil
+}
+
+func (r *redisFileSystemConfigStore) saveDrift(ctx context.Context, account string, drift *FileSystemDrift) error {
+	out, err := json.Marshal(drift)
+	if err != nil {
+		return err
+	}
+
+	return r.client.HSet(ctx, r.driftKey(account), drift.FileSystemId, out).Err()
+}
+
+func (r *redisFileSystemConfigStore) listDrift(ctx context.Context, account string) ([]*FileSystemDrift, error) {
+	out, err := r.client.HGetAll(ctx, r.driftKey(account)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]*FileSystemDrift, 0, len(out))
+	for fsid, j := range out {
+		drift := &FileSystemDrift{}
+		if err := json.Unmarshal([]byte(j), drift); err != nil {
+			return nil, fmt.Errorf("failed to decode drift of filesystem %s: %s", fsid, err)
+		}
+		drifts = append(drifts, drift)
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].FileSystemId < drifts[j].FileSystemId })
+
+	return drifts, nil
+}
+
+func (r *redisFileSystemConfigStore) claim(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.leaseKey(), owner, ttl).Result()
+}
+
+// mergeFileSystemSpec returns a copy of the configuration spec updated with the reconciled settings of the spec.
+// Settings that aren't in the spec keep their configured value.  Empty lists of subnets and security groups aren't
+// merged, so the reconciler never deletes all of the mount targets.
+func mergeFileSystemSpec(config, spec *FileSystemSpec) *FileSystemSpec {
+	merged := &FileSystemSpec{}
+	if config != nil {
+		*merged = FileSystemSpec{
+			AccessPolicy:                    config.AccessPolicy,
+			BackupPolicy:                    config.BackupPolicy,
+			LifeCycleConfiguration:          config.LifeCycleConfiguration,
+			TransitionToPrimaryStorageClass: config.TransitionToPrimaryStorageClass,
+			Sgs:                             config.Sgs,
+			Subnets:                         config.Subnets,
+		}
+	}
+
+	if spec.AccessPolicy != nil {
+		policy := *spec.AccessPolicy
+		merged.AccessPolicy = &policy
+	}
+
+	if spec.BackupPolicy != "" {
+		merged.BackupPolicy = spec.BackupPolicy
+	}
+
+	if spec.LifeCycleConfiguration != "" {
+		merged.LifeCycleConfiguration = spec.LifeCycleConfiguration
+	}
+
+	if spec.TransitionToPrimaryStorageClass != "" {
+		merged.TransitionToPrimaryStorageClass = spec.TransitionToPrimaryStorageClass
+	}
+
+	if len(spec.Sgs) > 0 {
+		merged.Sgs = append([]string{}, spec.Sgs...)
+	}
+
+	if len(spec.Subnets) > 0 {
+		merged.Subnets = append([]string{}, spec.Subnets...)
+	}
+
+	return merged
+}
+
+// saveFileSystemConfig merges the settings of the spec into the last applied configuration of the filesystem.
+// Failing to save the configuration doesn't fail the task that applied it, the filesystem is compared with the
+// previous configuration.
+func (s *server) saveFileSystemConfig(ctx context.Context, account, group, name, fsid string, spec *FileSystemSpec) {
+	if s.fileSystemConfigs == nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	config, err := s.fileSystemConfigs.load(ctx, account, fsid)
+	if err != nil {
+		logger(ctx).Errorf("failed to load configuration of filesystem %s: %s", fsid, err)
+		return
+	}
+
+	if config == nil {
+		config = &fileSystemConfig{Account: account, FileSystemID: fsid}
+	}
+
+	config.Region = s.sessionRegion(ctx)
+	config.Group = group
+	config.Name = name
+	config.Spec = mergeFileSystemSpec(config.Spec, spec)
+	config.UpdatedAt = time.Now().UTC()
+
+	if err := s.fileSystemConfigs.save(ctx, config); err != nil {
+		logger(ctx).Errorf("failed to save configuration of filesystem %s: %s", fsid, err)
+	}
+}
+
+// removeFileSystemConfig forgets the last applied configuration and the drift of the deleted filesystem
+func (s *server) removeFileSystemConfig(ctx context.Context, account, group, fsid string) {
+	if s.fileSystemConfigs == nil {
+		return
+	}
+
+	if err := s.fileSystemConfigs.remove(context.WithoutCancel(ctx), account, fsid); err != nil {
+		logger(ctx).Errorf("failed to remove configuration of filesystem %s: %s", fsid, err)
+	}
+
+	driftChanges.DeleteLabelValues(account, group, fsid)
+}
+
+// fileSystemSpecFromCreate returns the spec of the settings of the filesystem create request.  A filesystem
+// created without an access policy has the default policy, which allows anonymous access.
+func fileSystemSpecFromCreate(req *FileSystemCreateRequest) *FileSystemSpec {
+	accessPolicy := req.AccessPolicy
+	if accessPolicy == nil {
+		accessPolicy = &FileSystemAccessPolicy{AllowAnonymousAccess: true}
+	}
+
+	return &FileSystemSpec{
+		AccessPolicy:                    accessPolicy,
+		BackupPolicy:                    req.BackupPolicy,
+		LifeCycleConfiguration:          req.LifeCycleConfiguration,
+		TransitionToPrimaryStorageClass: req.TransitionToPrimaryStorageClass,
+		Sgs:                             req.Sgs,
+		Subnets:                         req.Subnets,
+	}
+}
+
+// reconcile compares the filesystems with their last applied configuration every interval, and repairs the drift
+// if repair is true, until the context is done.  The replicas take turns, only the replica holding the lease
+// reconciles in an interval.
+func (s *server) reconcile(ctx context.Context, interval time.Duration, repair bool) {
+	if s.fileSystemConfigs == nil {
+		return
+	}
+
+	log.Infof("reconciling filesystems every %s, repair %t", interval, repair)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		claimed, err := s.fileSystemConfigs.claim(ctx, s.replicaID, interval*9/10)
+		if err != nil {
+			log.Errorf("failed to claim reconciler lease: %s", err)
+			continue
+		}
+
+		if claimed {
+			s.reconcileFileSystems(withRequestID(ctx, "reconcile-"+uuid.NewString()), repair)
+		}
+	}
+}
+
+// reconcileFileSystems compares each filesystem with its last applied configuration, saving and reporting the drift
+func (s *server) reconcileFileSystems(ctx context.Context, repair bool) {
+	configs, err := s.fileSystemConfigs.list(ctx)
+	if err != nil {
+		logger(ctx).Errorf("failed to list filesystem configurations: %s", err)
+		return
+	}
+
+	logger(ctx).Infof("reconciling %d filesystems", len(configs))
+
+	for _, config := range configs {
+		if ctx.Err() != nil || s.orchestrationsInterrupted() {
+			return
+		}
+
+		drift := s.reconcileFileSystem(ctx, config, repair)
+		if drift == nil {
+			continue
+		}
+
+		if drift.Status == driftFailed {
+			logger(ctx).Warnf("failed to reconcile filesystem %s: %s", config.FileSystemID, drift.Reason)
+		}
+
+		reconcileChecks.WithLabelValues(drift.Status).Inc()
+		driftChanges.WithLabelValues(config.Account, config.Group, config.FileSystemID).Set(float64(len(drift.Changes)))
+
+		if err := s.fileSystemConfigs.saveDrift(ctx, config.Account, drift); err != nil {
+			logger(ctx).Errorf("failed to save drift of filesystem %s: %s", config.FileSystemID, err)
+		}
+	}
+}
+
+// reconcileFileSystem compares the filesystem with its last applied configuration and, if repair is true, starts a
+// task applying the changes.  It returns nil if the filesystem doesn't exist anymore.
+func (s *server) reconcileFileSystem(ctx context.Context, config *fileSystemConfig, repair bool) *FileSystemDrift {
+	ctx = withRegion(ctx, config.Region)
+	account, group, fsid := config.Account, config.Group, config.FileSystemID
+
+	drift := &FileSystemDrift{
+		Group:        group,
+		Name:         config.Name,
+		FileSystemId: fsid,
+		Changes:      []*SpecChange{},
+		CheckedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	failed := func(err error) *FileSystemDrift {
+		drift.Status = driftFailed
+		drift.Reason = err.Error()
+		return drift
+	}
+
+	role := fmt.Sprintf("arn:aws:iam::%s:role/%s", account, s.session.RoleName)
+	policy, err := generatePolicy("elasticfilesystem:*", "kms:*")
+	if err != nil {
+		return failed(err)
+	}
+
+	session, err := s.assumeRole(
+		ctx,
+		s.session.ExternalID,
+		role,
+		policy,
+	)
+	if err != nil {
+		return failed(err)
+	}
+
+	service := yefs.New(yefs.WithSession(session.Session))
+
+	filesystem, err := service.GetFileSystem(ctx, fsid)
+	if err != nil {
+		if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+			logger(ctx).Infof("filesystem %s doesn't exist, forgetting its configuration", fsid)
+			s.removeFileSystemConfig(ctx, account, group, fsid)
+			return nil
+		}
+		return failed(err)
+	}
+
+	if reason := reconcileSkipReason(s.org, filesystem); reason != "" {
+		drift.Status = driftSkipped
+		drift.Reason = reason
+		return drift
+	}
+
+	// the filesystem is changing while its tasks run
+	tasks, err := s.listTasks(ctx, account, taskFilter{Group: group, FileSystemID: fsid, Status: flywheel.STATUS_RUNNING}, 1)
+	if err != nil {
+		return failed(err)
+	}
+
+	for _, t := range tasks {
+		if !taskFinished(t.Status) {
+			drift.Status = driftSkipped
+			drift.Reason = fmt.Sprintf("%s task %s is %s", t.Operation, t.TaskID, t.Status)
+			return drift
+		}
+	}
+
+	current, err := fileSystemSettingsState(ctx, service, filesystem)
+	if err != nil {
+		return failed(err)
+	}
+
+	defaults, _ := s.accountDefaults(account)
+
+	plan, err := planFileSystemSpec(s.org, group, config.Name, config.Spec, current, defaults.DefaultSgs)
+	if err != nil {
+		return failed(err)
+	}
+
+	drift.Changes = plan.changes
+	switch {
+	case len(plan.changes) == 0:
+		drift.Status = driftInSync
+	case !repair:
+		drift.Status = driftDrifted
+	default:
+		logger(ctx).Infof("repairing %d changes of filesystem %s", len(plan.changes), fsid)
+
+		task := s.fileSystemSpecUpdate(ctx, service, kindReconcile, account, group, filesystem, config.Spec, plan)
+		drift.Status = driftRepairing
+		drift.TaskID = task.ID
+	}
+
+	return drift
+}
+
+// reconcileSkipReason returns why the filesystem isn't reconciled, or the empty string if it is.  Filesystems that
+// belong to another org, are opted out with the spinup:reconcile tag or are not available are skipped.
+func reconcileSkipReason(org string, filesystem *efs.FileSystemDescription) string {
+	tags := map[string]string{}
+	for _, t := range filesystem.Tags {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	if tags["spinup:org"] != org {
+		return fmt.Sprintf("filesystem belongs to org %s", tags["spinup:org"])
+	}
+
+	if tags[reconcileOptOutTag] == "false" {
+		return fmt.Sprintf("reconciliation is disabled with the %s tag", reconcileOptOutTag)
+	}
+
+	if status := aws.StringValue(filesystem.LifeCycleState); status != "available" {
+		return fmt.Sprintf("filesystem has status %s", status)
+	}
+
+	return ""
+}
+
+// listDrift returns the latest drift of the filesystems in the account, optionally only in the group
+func (s *server) listDrift(ctx context.Context, account, group string) ([]*FileSystemDrift, error) {
+	drifts := []*FileSystemDrift{}
+	if s.fileSystemConfigs == nil {
+		return drifts, nil
+	}
+
+	out, err := s.fileSystemConfigs.listDrift(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range out {
+		if group == "" || d.Group == group {
+			drifts = append(drifts, d)
+		}
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/gorilla/mux"
+)
+
+func TestRedisFileSystemConfigStore(t *testing.T) {
+	store := newFileSystemConfigStore(newTestRedis(t), "efsapi")
+	ctx := context.TODO()
+
+	configs := []*fileSystemConfig{
+		{Account: "1234567890", FileSystemID: "fs-2", Group: "space1", Spec: &FileSystemSpec{BackupPolicy: "ENABLED"}},
+		{Account: "1234567890", FileSystemID: "fs-1", Group: "space1", Spec: &FileSystemSpec{Subnets: []string{"subnet-1"}}},
+		{Account: "0987654321", FileSystemID: "fs-3", Group: "space2", Spec: &FileSystemSpec{}},
+	}
+
+	for _, c := range configs {
+		if err := store.save(ctx, c); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	out, err := store.load(ctx, "1234567890", "fs-1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if out == nil || out.Group != "space1" || !reflect.DeepEqual(out.Spec.Subnets, []string{"subnet-1"}) {
+		t.Errorf("unexpected loaded configuration %+v", out)
+	}
+
+	if out, err := store.load(ctx, "0987654321", "fs-1"); out != nil || err != nil {
+		t.Errorf("expected no configuration, got %+v, %v", out, err)
+	}
+
+	list, err := store.list(ctx)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	ids := []string{}
+	for _, c := range list {
+		ids = append(ids, c.FileSystemID)
+	}
+
+	if expected := []string{"fs-3", "fs-1", "fs-2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected configurations %v, got %v", expected, ids)
+	}
+
+	for _, fsid := range []string{"fs-2", "fs-1"} {
+		if err := store.saveDrift(ctx, "1234567890", &FileSystemDrift{FileSystemId: fsid, Status: driftInSync}); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	drifts, err := store.listDrift(ctx, "1234567890")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(drifts) != 2 || drifts[0].FileSystemId != "fs-1" || drifts[1].FileSystemId != "fs-2" {
+		t.Errorf("expected drift of fs-1 and fs-2, got %+v", drifts)
+	}
+
+	if err := store.remove(ctx, "1234567890", "fs-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, _ := store.load(ctx, "1234567890", "fs-1"); out != nil {
+		t.Errorf("expected removed configuration, got %+v", out)
+	}
+
+	if drifts, _ := store.listDrift(ctx, "1234567890"); len(drifts) != 1 || drifts[0].FileSystemId != "fs-2" {
+		t.Errorf("expected removed drift, got %+v", drifts)
+	}
+
+	// only one replica reconciles in an interval
+	if ok, _ := store.claim(ctx, "replica-1", time.Minute); !ok {
+		t.Error("expected replica-1 to claim the lease")
+	}
+
+	if ok, _ := store.claim(ctx, "replica-2", time.Minute); ok {
+		t.Error("expected replica-2 not to claim the lease")
+	}
+}
+
+func TestMergeFileSystemSpec(t *testing.T) {
+	created := mergeFileSystemSpec(nil, fileSystemSpecFromCreate(&FileSystemCreateRequest{
+		Name:                            "myfs",
+		BackupPolicy:                    "DISABLED",
+		LifeCycleConfiguration:          "NONE",
+		TransitionToPrimaryStorageClass: "NONE",
+		Sgs:                             []string{},
+		Subnets:                         []string{"subnet-1", "subnet-2"},
+		Tags:                            []*Tag{{Key: "team", Value: "a"}},
+	}))
+
+	expected := &FileSystemSpec{
+		AccessPolicy:                    &FileSystemAccessPolicy{AllowAnonymousAccess: true},
+		BackupPolicy:                    "DISABLED",
+		LifeCycleConfiguration:          "NONE",
+		TransitionToPrimaryStorageClass: "NONE",
+		Subnets:                         []string{"subnet-1", "subnet-2"},
+	}
+
+	if !reflect.DeepEqual(expected, created) {
+		t.Errorf("expected created configuration %+v, got %+v", expected, created)
+	}
+
+	// only the settings in the spec are changed, the empty subnets aren't merged
+	updated := mergeFileSystemSpec(created, &FileSystemSpec{
+		AccessPolicy:           &FileSystemAccessPolicy{EnforceEncryptedTransport: true},
+		LifeCycleConfiguration: "AFTER_30_DAYS",
+		Sgs:                    []string{"sg-1"},
+		Subnets:                []string{},
+		Users:                  []string{"alice"},
+	})
+
+	expected = &FileSystemSpec{
+		AccessPolicy:                    &FileSystemAccessPolicy{EnforceEncryptedTransport: true},
+		BackupPolicy:                    "DISABLED",
+		LifeCycleConfiguration:          "AFTER_30_DAYS",
+		TransitionToPrimaryStorageClass: "NONE",
+		Sgs:                             []string{"sg-1"},
+		Subnets:                         []string{"subnet-1", "subnet-2"},
+	}
+
+	if !reflect.DeepEqual(expected, updated) {
+		t.Errorf("expected updated configuration %+v, got %+v", expected, updated)
+	}
+
+	if !created.AccessPolicy.AllowAnonymousAccess {
+		t.Error("expected the merged configuration not to be modified")
+	}
+}
+
+func TestSaveFileSystemConfig(t *testing.T) {
+	store := newFileSystemConfigStore(newTestRedis(t), "efsapi")
+	s := server{fileSystemConfigs: store}
+	ctx := withRegion(context.TODO(), "us-west-2")
+
+	s.saveFileSystemConfig(ctx, "1234567890", "space1", "myfs", "fs-1", &FileSystemSpec{BackupPolicy: "ENABLED", Subnets: []string{"subnet-1"}})
+	s.saveFileSystemConfig(ctx, "1234567890", "space1", "myfs", "fs-1", &FileSystemSpec{BackupPolicy: "DISABLED"})
+
+	config, err := store.load(ctx, "1234567890", "fs-1")
+	if err != nil || config == nil {
+		t.Fatalf("expected configuration, got %+v, %v", config, err)
+	}
+
+	if config.Region != "us-west-2" || config.Group != "space1" || config.Name != "myfs" || config.UpdatedAt.IsZero() {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+
+	if config.Spec.BackupPolicy != "DISABLED" || !reflect.DeepEqual(config.Spec.Subnets, []string{"subnet-1"}) {
+		t.Errorf("unexpected configuration spec %+v", config.Spec)
+	}
+
+	s.removeFileSystemConfig(ctx, "1234567890", "space1", "fs-1")
+	if config, _ := store.load(ctx, "1234567890", "fs-1"); config != nil {
+		t.Errorf("expected removed configuration, got %+v", config)
+	}
+}
+
+func TestReconcileSkipReason(t *testing.T) {
+	filesystem := func(status string, tags map[string]string) *efs.FileSystemDescription {
+		fs := &efs.FileSystemDescription{LifeCycleState: aws.String(status)}
+		for k, v := range tags {
+			fs.Tags = append(fs.Tags, &efs.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		return fs
+	}
+
+	tests := []struct {
+		name       string
+		filesystem *efs.FileSystemDescription
+		skipped    bool
+	}{
+		{name: "reconciled", filesystem: filesystem("available", map[string]string{"spinup:org": "test"})},
+		{name: "opted in", filesystem: filesystem("available", map[string]string{"spinup:org": "test", "spinup:reconcile": "true"})},
+		{name: "opted out", filesystem: filesystem("available", map[string]string{"spinup:org": "test", "spinup:reconcile": "false"}), skipped: true},
+		{name: "other org", filesystem: filesystem("available", map[string]string{"spinup:org": "other"}), skipped: true},
+		{name: "not available", filesystem: filesystem("updating", map[string]string{"spinup:org": "test"}), skipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := reconcileSkipReason("test", tt.filesystem); (reason != "") != tt.skipped {
+				t.Errorf("expected skipped %t, got reason %q", tt.skipped, reason)
+			}
+		})
+	}
+}
+
+func TestDriftListHandler(t *testing.T) {
+	store := newFileSystemConfigStore(newTestRedis(t), "efsapi")
+	s := server{fileSystemConfigs: store}
+	s.config.Store(&dynamicConfig{accountsMap: map[string]string{"spinup": "1234567890"}})
+
+	ctx := context.TODO()
+	drifts := []*FileSystemDrift{
+		{Group: "space1", FileSystemId: "fs-1", Status: driftInSync, Changes: []*SpecChange{}},
+		{Group: "space2", FileSystemId: "fs-2", Status: driftDrifted, Changes: []*SpecChange{{Action: specUpdate, Resource: specBackupPolicy, From: "DISABLED", To: "ENABLED"}}},
+	}
+
+	for _, d := range drifts {
+		if err := store.saveDrift(ctx, "1234567890", d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/efs/{account}/drift", s.DriftListHandler).Methods(http.MethodGet)
+
+	list := func(query string, token *apiToken) ([]*FileSystemDrift, int) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/efs/spinup/drift"+query, nil)
+		req = req.WithContext(withToken(req.Context(), token))
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		out := []*FileSystemDrift{}
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return out, rr.Code
+	}
+
+	reader := &apiToken{name: "dashboard", scope: scopeRead}
+
+	out, code := list("", reader)
+	if code != http.StatusOK || !reflect.DeepEqual(out, drifts) {
+		t.Errorf("expected drift of all filesystems, got %+v (%d)", out, code)
+	}
+
+	// tokens restricted to groups must pass one of their groups
+	grouped := &apiToken{name: "space", scope: scopeRead, groups: []string{"space2"}}
+	if _, code := list("", grouped); code != http.StatusForbidden {
+		t.Errorf("expected forbidden without a group, got %d", code)
+	}
+
+	if out, code := list("?group=space2", grouped); code != http.StatusOK || len(out) != 1 || out[0].Status != driftDrifted {
+		t.Errorf("expected drift of the filesystem in the group, got %+v (%d)", out, code)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const regionContextKey contextKey = "region"
+
+// defaultRegion is used when a region isn't passed with the request or configured for the account
+const defaultRegion = "us-east-1"
+
+// withRegion returns a copy of the context carrying the region
+func withRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionContextKey, region)
+}
+
+// regionFromContext returns the region carried in the context, or the empty string
+func regionFromContext(ctx context.Context) string {
+	if region, ok := ctx.Value(regionContextKey).(string); ok {
+		return region
+	}
+	return ""
+}
+
+// RegionMiddleware determines the region for the request and stores it in the request context.  The region
+// is taken from the `region` query parameter, then the region in the accounts configuration, then the default.
+func (s *server) RegionMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		region, err := s.requestRegion(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		log.Debugf("using region %s for request %s with token %s", region, r.URL, tokenName(r.Context()))
+
+		h.ServeHTTP(w, r.WithContext(withRegion(r.Context(), region)))
+	})
+}
+
+// requestRegion returns the validated region for a request
+func (s *server) requestRegion(r *http.Request) (string, error) {
+	if region := r.URL.Query().Get("region"); region != "" {
+		if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); !ok {
+			msg := fmt.Sprintf("invalid region %s", region)
+			return "", apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+		return region, nil
+	}
+
+	if account, ok := mux.Vars(r)["account"]; ok {
+		if a, ok := s.accountDefaults(account); ok && a.Region != "" {
+			return a.Region, nil
+		}
+
+		if a, ok := s.accountDefaults(s.mapAccountNumber(account)); ok && a.Region != "" {
+			return a.Region, nil
+		}
+	}
+
+	if s.defaultRegion != "" {
+		return s.defaultRegion, nil
+	}
+
+	return defaultRegion, nil
+}
+
+// sessionRegion returns the region carried in the context or the default region for the server
+func (s *server) sessionRegion(ctx context.Context) string {
+	if region := regionFromContext(ctx); region != "" {
+		return region
+	}
+
+	if s.defaultRegion != "" {
+		return s.defaultRegion
+	}
+
+	return defaultRegion
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestRequestRegion(t *testing.T) {
+	s := server{
+		defaultRegion: "us-east-1",
+	}
+	s.config.Store(&dynamicConfig{
+		accounts: map[string]common.Account{
+			"1234567890": {Region: "us-west-2"},
+			"spinupdev":  {Region: "us-west-1"},
+			"spinupsec":  {Region: "us-east-2"},
+		},
+		accountsMap: map[string]string{
+			"spinup":    "1234567890",
+			"spinupdev": "5555555555",
+		},
+	})
+
+	tests := []struct {
+		url     string
+		account string
+		expect  string
+		wantErr bool
+	}{
+		{url: "/v1/efs/foo/filesystems", account: "foo", expect: "us-east-1"},
+		{url: "/v1/efs/spinup/filesystems", account: "spinup", expect: "us-west-2"},
+		{url: "/v1/efs/spinupsec/filesystems", account: "spinupsec", expect: "us-east-2"},
+		{url: "/v1/efs/spinupdev/filesystems", account: "spinupdev", expect: "us-west-1"},
+		{url: "/v1/efs/spinup/filesystems?region=eu-west-1", account: "spinup", expect: "eu-west-1"},
+		{url: "/v1/efs/spinup/filesystems?region=narnia", account: "spinup", wantErr: true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.url, nil)
+		req = mux.SetURLVars(req, map[string]string{"account": test.account})
+
+		out, err := s.requestRegion(req)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("expected error for %s, got nil", test.url)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected nil error for %s, got %s", test.url, err)
+		}
+
+		if out != test.expect {
+			t.Errorf("expected region %s for %s, got %s", test.expect, test.url, out)
+		}
+	}
+}
+
+func TestSessionRegion(t *testing.T) {
+	s := server{}
+	if out := s.sessionRegion(context.TODO()); out != defaultRegion {
+		t.Errorf("expected default region %s, got %s", defaultRegion, out)
+	}
+
+	s.defaultRegion = "us-east-2"
+	if out := s.sessionRegion(context.TODO()); out != "us-east-2" {
+		t.Errorf("expected server default region us-east-2, got %s", out)
+	}
+
+	if out := s.sessionRegion(withRegion(context.TODO(), "us-west-1")); out != "us-west-1" {
+		t.Errorf("expected context region us-west-1, got %s", out)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerOption is an option for creating a new server
+type ServerOption func(*server)
+
+// ConfigLoader loads the configuration when the server is reloaded
+type ConfigLoader func() (common.Config, error)
+
+// dynamicConfig is the part of the configuration that can be reloaded without restarting the server
+type dynamicConfig struct {
+	accounts    map[string]common.Account
+	accountsMap map[string]string
+	kmsKeyTags  []string
+	pricing     map[string]common.Pricing
+	quotas      common.Quotas
+	rateLimit   common.RateLimit
+	tokens      []*apiToken
+}
+
+func newDynamicConfig(config common.Config) *dynamicConfig {
+	return &dynamicConfig{
+		accounts:    config.Accounts,
+		accountsMap: config.AccountsMap,
+		kmsKeyTags:  config.KmsKeyTags,
+		pricing:     config.Pricing,
+		quotas:      config.Quotas,
+		rateLimit:   config.RateLimit,
+		tokens:      newAPITokens(config),
+	}
+}
+
+// WithConfigLoader sets the loader used to reload the configuration on SIGHUP
+func WithConfigLoader(loader ConfigLoader) ServerOption {
+	return func(s *server) {
+		log.Debug("enabling configuration reload on SIGHUP")
+		s.configLoader = loader
+	}
+}
+
+// WithConfigWatch reloads the configuration when the modification time of the file at path changes,
+// checking at the given interval.  It has no effect without a config loader.
+func WithConfigWatch(path string, interval time.Duration) ServerOption {
+	return func(s *server) {
+		log.Debugf("watching configuration file %s every %s", path, interval.String())
+		s.configWatchPath = path
+		s.configWatchInterval = interval
+	}
+}
+
+// conf returns the current reloadable configuration
+func (s *server) conf() *dynamicConfig {
+	if c := s.config.Load(); c != nil {
+		return c
+	}
+	return &dynamicConfig{}
+}
+
+// watchConfig reloads the configuration when the process receives a SIGHUP or the watched configuration
+// file changes, until the context is done
+func (s *server) watchConfig(ctx context.Context) {
+	if s.configLoader == nil {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	var modTime time.Time
+	if s.configWatchPath != "" && s.configWatchInterval > 0 {
+		if fi, err := os.Stat(s.configWatchPath); err == nil {
+			modTime = fi.ModTime()
+		}
+
+		ticker := time.NewTicker(s.configWatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info("received SIGHUP, reloading configuration")
+		case <-tick:
+			fi, err := os.Stat(s.configWatchPath)
+			if err != nil {
+				log.Warnf("failed to stat configuration file %s: %s", s.configWatchPath, err)
+				continue
+			}
+
+			if fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+
+			log.Infof("configuration file %s changed, reloading configuration", s.configWatchPath)
+		}
+
+		if err := s.reloadConfig(); err != nil {
+			log.Errorf("failed to reload configuration, keeping current configuration: %s", err)
+		}
+	}
+}
+
+// reloadConfig loads and validates the configuration and swaps the reloadable configuration.  The current
+// configuration is kept if the new configuration cannot be loaded or is invalid.
+func (s *server) reloadConfig() error {
+	if s.configLoader == nil {
+		return errors.New("configuration loader is not set")
+	}
+
+	config, err := s.configLoader()
+	if err != nil {
+		return err
+	}
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	if config.Org != s.org {
+		return fmt.Errorf("'org' cannot be changed from %s to %s without a restart", s.org, config.Org)
+	}
+
+	s.config.Store(newDynamicConfig(config))
+	common.SetLogLevel(config.LogLevel)
+
+	log.Info("reloaded configuration, changes to settings other than accounts, accountsMap, kmsKeyTags, logLevel, pricing, quotas, rateLimit limits, token and tokens require a restart")
+
+	return nil
+}
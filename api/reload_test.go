@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+)
+
+func TestReloadConfig(t *testing.T) {
+	s := server{org: "testorg"}
+	s.config.Store(newDynamicConfig(common.Config{
+		Org:   "testorg",
+		Token: "oldtoken",
+	}))
+
+	if err := s.reloadConfig(); err == nil {
+		t.Error("expected error reloading without a config loader, got nil")
+	}
+
+	var next common.Config
+	var loadErr error
+	s.configLoader = func() (common.Config, error) { return next, loadErr }
+
+	// successful reload swaps the dynamic configuration
+	next = common.Config{
+		Org:         "testorg",
+		Token:       "newtoken",
+		AccountsMap: map[string]string{"spinup": "1234567890"},
+		KmsKeyTags:  []string{"foo"},
+	}
+	if err := s.reloadConfig(); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if string(s.conf().tokens[0].secret) != "newtoken" {
+		t.Errorf("expected token to be reloaded, got %s", string(s.conf().tokens[0].secret))
+	}
+
+	if s.mapAccountNumber("spinup") != "1234567890" {
+		t.Errorf("expected accounts map to be reloaded, got %s", s.mapAccountNumber("spinup"))
+	}
+
+	// loader errors, invalid configurations and org changes keep the current configuration
+	failures := map[string]func(){
+		"loader error":   func() { next, loadErr = common.Config{Org: "testorg", Token: "bad"}, errors.New("boom") },
+		"invalid config": func() { next, loadErr = common.Config{Org: "testorg", Token: "bad", LogLevel: "loud"}, nil },
+		"org change":     func() { next, loadErr = common.Config{Org: "otherorg", Token: "bad"}, nil },
+	}
+
+	for name, setup := range failures {
+		setup()
+		if err := s.reloadConfig(); err == nil {
+			t.Errorf("expected error for %s, got nil", name)
+		}
+
+		if string(s.conf().tokens[0].secret) != "newtoken" {
+			t.Errorf("expected configuration to be kept for %s, got token %s", name, string(s.conf().tokens[0].secret))
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan struct{}, 1)
+
+	s := server{org: "testorg"}
+	WithConfigLoader(func() (common.Config, error) {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+		return common.Config{Org: "testorg", Token: "watched"}, nil
+	})(&s)
+	WithConfigWatch(path, 10*time.Millisecond)(&s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.watchConfig(ctx)
+
+	// give the watcher a chance to record the initial modification time
+	time.Sleep(50 * time.Millisecond)
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for configuration reload")
+	}
+}
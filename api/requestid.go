@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestIDContextKey contextKey = "requestid"
+
+// requestIDField is the logrus field with the request id
+const requestIDField = "request_id"
+
+// maxRequestIDLength is the longest request id accepted from the client
+const maxRequestIDLength = 128
+
+// validRequestID matches request ids that are safe to log and to use in STS session names and tags
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9_.:/=+@-]+$`)
+
+// withRequestID returns a copy of the context carrying the request id
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// requestIDFromContext returns the request id carried in the context, or the empty string
+func requestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// RequestIDMiddleware takes the request id from the X-Request-Id header, or generates one if it's missing or
+// invalid, stores it in the request context and echoes it in the response
+func RequestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if len(id) > maxRequestIDLength || !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
+
+// logger returns a log entry for the context.  Entries are logged with the request id in the context by the
+// requestIDHook.
+func logger(ctx context.Context) *log.Entry {
+	return log.WithContext(ctx)
+}
+
+// requestIDHook adds the request id of the context of log entries to their fields
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (requestIDHook) Fire(entry *log.Entry) error {
+	if id := requestIDFromContext(entry.Context); id != "" {
+		entry.Data[requestIDField] = id
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		generate bool
+	}{
+		{
+			name:     "missing",
+			generate: true,
+		},
+		{
+			name:   "accepted",
+			header: "abc-123_req:1",
+		},
+		{
+			name:     "invalid characters",
+			header:   "abc 123\n",
+			generate: true,
+		},
+		{
+			name:     "too long",
+			header:   strings.Repeat("a", maxRequestIDLength+1),
+			generate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/efs/ping", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if echoed := rr.Header().Get(requestIDHeader); echoed != got {
+				t.Errorf("expected response header %q, got %q", got, echoed)
+			}
+
+			if tt.generate {
+				if _, err := uuid.Parse(got); err != nil {
+					t.Errorf("expected generated uuid request id, got %q", got)
+				}
+			} else if got != tt.header {
+				t.Errorf("expected request id %q, got %q", tt.header, got)
+			}
+		})
+	}
+}
+
+func TestRequestIDHook(t *testing.T) {
+	l := log.New()
+	l.SetOutput(io.Discard)
+	l.AddHook(requestIDHook{})
+
+	var entries []*log.Entry
+	l.AddHook(captureHook(func(e *log.Entry) { entries = append(entries, e) }))
+
+	l.WithContext(withRequestID(context.TODO(), "req-123")).Info("with request id")
+	l.WithContext(context.TODO()).Info("without request id")
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	if id := entries[0].Data[requestIDField]; id != "req-123" {
+		t.Errorf("expected request id field req-123, got %v", id)
+	}
+
+	if _, ok := entries[1].Data[requestIDField]; ok {
+		t.Errorf("expected no request id field, got %v", entries[1].Data)
+	}
+}
+
+// captureHook calls the function with each log entry
+type captureHook func(*log.Entry)
+
+func (captureHook) Levels() []log.Level { return log.AllLevels }
+
+func (c captureHook) Fire(e *log.Entry) error {
+	c(e)
+	return nil
+}
+
+func TestRoleSessionName(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		expected  string
+	}{
+		{
+			name:      "request id",
+			requestID: "abc-123",
+			expected:  "spinup-ss-efs-api-abc-123",
+		},
+		{
+			name:      "invalid characters replaced",
+			requestID: "trace:1/2",
+			expected:  "spinup-ss-efs-api-trace-1-2",
+		},
+		{
+			name:      "truncated",
+			requestID: strings.Repeat("a", 100),
+			expected:  "spinup-ss-efs-api-" + strings.Repeat("a", maxRoleSessionNameLength-18),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleSessionName("ss", tt.requestID); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if got := roleSessionName("ss", ""); !strings.HasPrefix(got, "spinup-ss-efs-api-") || len(got) > maxRoleSessionNameLength {
+		t.Errorf("expected random session name, got %s", got)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -17,10 +18,14 @@ import (
 
 // assumeRole assumes the passed role arn.  if an externalId is set in the account to be accessed, it can be passed with the request.  inline
 // policy can be passed to limit the access for the session.  policy Arns can also be passed to limit access for the session.
-// Note: sessions live for 900s and will be cached for 600 seconds, giving a 300s buffer to avoid terminated sessions inside of orchestration
+// Note: sessions live for 900s and will be cached for 600 seconds, giving a 300s buffer to avoid terminated sessions inside of orchestration.
+// The session is created in the region carried in the context and cached per region.
 func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePolicy string, policyArns ...string) (*session.Session, error) {
-	contextLogger := log.WithFields(log.Fields{
-		"role": roleArn,
+	region := s.sessionRegion(ctx)
+
+	contextLogger := logger(ctx).WithFields(log.Fields{
+		"role":   roleArn,
+		"region": region,
 	})
 
 	start := time.Now()
@@ -31,9 +36,11 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 
 	stsService := stsSvc.New(stsSvc.WithSession(s.session.Session))
 
-	name := fmt.Sprintf("spinup-%s-efs-api-%s", s.org, uuid.New())
-
-	contextLogger = contextLogger.WithField("session", name)
+	// sessions are named with the id of the request assuming the role.  They're cached and shared with the later
+	// requests, whose CloudTrail entries carry the name of the first request's session, so the name is logged by
+	// each request using the session and it's the only way to correlate CloudTrail entries with requests.  The
+	// request id isn't sent as a session tag since it would differ from the id of the requests sharing the session.
+	name := roleSessionName(s.org, requestIDFromContext(ctx))
 
 	input := sts.AssumeRoleInput{
 		DurationSeconds: aws.Int64(900),
@@ -47,7 +54,7 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 		},
 	}
 
-	cacheKey := fmt.Sprintf("spinup_%s_%s", s.org, roleArn)
+	cacheKey := fmt.Sprintf("spinup_%s_%s_%s", s.org, region, roleArn)
 
 	if externalId != "" {
 		input.SetExternalId(externalId)
@@ -75,17 +82,19 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 
 	item, expire, found := s.sessionCache.GetWithExpiration(cacheKey)
 	if found {
-		if sess, ok := item.(*session.Session); ok {
-			contextLogger.Infof("using cached session (expire: %s)", expire.String())
-			return sess, nil
+		if rs, ok := item.(*roleSession); ok {
+			contextLogger.WithField("session", rs.name).Infof("using cached session (expire: %s)", expire.String())
+			return rs.session, nil
 		}
 	}
 
+	contextLogger = contextLogger.WithField("session", name)
+
 	contextLogger.Debugf("assuming role %s with input %+v", roleArn, input)
 
 	out, err := stsService.AssumeRole(ctx, &input)
 	if err != nil {
-		log.Errorf("got: %s", err)
+		logger(ctx).Errorf("got: %s", err)
 		return nil, err
 	}
 
@@ -99,12 +108,38 @@ func (s *server) assumeRole(ctx context.Context, externalId, roleArn, inlinePoli
 			aws.StringValue(out.Credentials.SecretAccessKey),
 			aws.StringValue(out.Credentials.SessionToken),
 		),
-		session.WithRegion("us-east-1"),
+		session.WithRegion(region),
 	)
 
 	contextLogger.Debugf("caching session with cache key: '%s'", cacheKey)
 
-	s.sessionCache.Set(cacheKey, &sess, cache.DefaultExpiration)
+	s.sessionCache.Set(cacheKey, &roleSession{session: &sess, name: name}, cache.DefaultExpiration)
 
 	return &sess, nil
 }
+
+// roleSession is a cached session of an assumed role
+type roleSession struct {
+	session *session.Session
+	name    string
+}
+
+// maxRoleSessionNameLength is the longest STS role session name
+const maxRoleSessionNameLength = 64
+
+// invalidRoleSessionNameChars matches the characters not allowed in STS role session names
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^a-zA-Z0-9_+=,.@-]`)
+
+// roleSessionName returns the STS role session name for the request id, or a random one if there's no request id
+func roleSessionName(org, requestID string) string {
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+
+	// role session names don't allow some of the characters allowed in request ids
+	name := invalidRoleSessionNameChars.ReplaceAllString(fmt.Sprintf("spinup-%s-efs-api-%s", org, requestID), "-")
+	if len(name) > maxRoleSessionNameLength {
+		name = name[:maxRoleSessionNameLength]
+	}
+	return name
+}
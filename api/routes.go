@@ -24,28 +24,52 @@ import (
 
 func (s *server) routes() {
 	api := s.router.PathPrefix("/v1/efs").Subrouter()
+	api.Use(s.RegionMiddleware)
+	api.Use(s.RateLimitMiddleware)
+	api.Use(s.AuditMiddleware)
+
+	// the OpenAPI document describes every route below, requests are validated against it
+	s.openAPI = newOpenAPIDocument(s.version.Version, apiOperations)
+	api.Use(s.ValidationMiddleware)
 
 	api.HandleFunc("/ping", s.PingHandler).Methods(http.MethodGet)
 	api.HandleFunc("/version", s.VersionHandler).Methods(http.MethodGet)
 	api.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	api.HandleFunc("/openapi.json", s.OpenAPIHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/flywheel", s.FlywheelTasksHandler).Methods(http.MethodGet)
+	api.HandleFunc("/tasks/{id}", s.TaskCancelHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/tasks/{id}/events", s.TaskEventsHandler).Methods(http.MethodGet)
+
+	api.Handle("/{account}/filesystems", s.scoped(scopeRead, s.FileSystemListHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}", s.scoped(scopeRead, s.FileSystemListHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}", s.scoped(scopeWrite, s.FileSystemCreateHandler)).Methods(http.MethodPost)
+	api.Handle("/{account}/filesystems/{group}", s.scoped(scopeWrite, s.SpaceTeardownHandler)).Methods(http.MethodDelete)
+	api.Handle("/{account}/filesystems/{group}/{id}", s.scoped(scopeRead, s.FileSystemShowHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}/{id}", s.scoped(scopeWrite, s.FileSystemDeleteHandler)).Methods(http.MethodDelete)
+	api.Handle("/{account}/filesystems/{group}/{id}", s.scoped(scopeWrite, s.FileSystemUpdateHandler)).Methods(http.MethodPut)
+
+	api.Handle("/{account}/filesystems/{group}/{name}/spec", s.scoped(scopeWrite, s.FileSystemSpecHandler)).Methods(http.MethodPut)
+
+	api.Handle("/{account}/filesystems/{group}/{id}/cost", s.scoped(scopeRead, s.FileSystemCostHandler)).Methods(http.MethodGet)
+
+	api.Handle("/{account}/filesystems/{group}/{id}/users", s.scoped(scopeWrite, s.UsersCreateHandler)).Methods(http.MethodPost)
+	api.Handle("/{account}/filesystems/{group}/{id}/users", s.scoped(scopeRead, s.UsersListHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}/{id}/users/{user}", s.scoped(scopeRead, s.UsersShowHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}/{id}/users/{user}", s.scoped(scopeWrite, s.UsersUpdateHandler)).Methods(http.MethodPut)
+	api.Handle("/{account}/filesystems/{group}/{id}/users/{user}", s.scoped(scopeWrite, s.UsersDeleteHandler)).Methods(http.MethodDelete)
+
+	api.Handle("/{account}/filesystems/{group}/{id}/aps", s.scoped(scopeRead, s.FileSystemAPListHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}/{id}/aps", s.scoped(scopeWrite, s.FileSystemAPCreateHandler)).Methods(http.MethodPost)
+	api.Handle("/{account}/filesystems/{group}/{id}/aps/{apid}", s.scoped(scopeRead, s.FileSystemAPShowHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/filesystems/{group}/{id}/aps/{apid}", s.scoped(scopeWrite, s.FileSystemAPDeleteHandler)).Methods(http.MethodDelete)
+
+	api.Handle("/{account}/costs/{group}", s.scoped(scopeRead, s.GroupCostHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/quotas/{group}", s.scoped(scopeRead, s.QuotaShowHandler)).Methods(http.MethodGet)
+
+	api.HandleFunc("/{account}/tasks", s.TaskListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/drift", s.DriftListHandler).Methods(http.MethodGet)
 
-	api.Handle("/flywheel", s.flywheel.Handler())
-
-	api.HandleFunc("/{account}/filesystems", s.FileSystemListHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}", s.FileSystemListHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}", s.FileSystemCreateHandler).Methods(http.MethodPost)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}", s.FileSystemShowHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}", s.FileSystemDeleteHandler).Methods(http.MethodDelete)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}", s.FileSystemUpdateHandler).Methods(http.MethodPut)
-
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/users", s.UsersCreateHandler).Methods(http.MethodPost)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/users", s.UsersListHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/users/{user}", s.UsersShowHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/users/{user}", s.UsersUpdateHandler).Methods(http.MethodPut)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/users/{user}", s.UsersDeleteHandler).Methods(http.MethodDelete)
-
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/aps", s.FileSystemAPListHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/aps", s.FileSystemAPCreateHandler).Methods(http.MethodPost)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/aps/{apid}", s.FileSystemAPShowHandler).Methods(http.MethodGet)
-	api.HandleFunc("/{account}/filesystems/{group}/{id}/aps/{apid}", s.FileSystemAPDeleteHandler).Methods(http.MethodDelete)
+	api.Handle("/{account}/orphans", s.scoped(scopeAdmin, s.OrphanListHandler)).Methods(http.MethodGet)
+	api.Handle("/{account}/orphans/cleanup", s.scoped(scopeAdmin, s.OrphanCleanupHandler)).Methods(http.MethodPost)
 }
@@ -19,20 +19,25 @@ package api
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/YaleSpinup/aws-go/services/session"
+	"github.com/YaleSpinup/efs-api/audit"
 	"github.com/YaleSpinup/efs-api/common"
 	"github.com/YaleSpinup/efs-api/ec2"
 	"github.com/YaleSpinup/efs-api/efs"
 	"github.com/YaleSpinup/efs-api/resourcegroupstaggingapi"
+	"github.com/YaleSpinup/efs-api/webhook"
 	"github.com/YaleSpinup/flywheel"
+	"github.com/go-redis/redis/v8"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -46,43 +51,74 @@ func init() {
 }
 
 type server struct {
-	accountsMap          map[string]string
+	auditor              *audit.Auditor
+	config               atomic.Pointer[dynamicConfig]
+	configLoader         ConfigLoader
+	configWatchInterval  time.Duration
+	configWatchPath      string
 	context              context.Context
+	defaultRegion        string
 	ec2Services          ec2.EC2
 	efsServices          efs.EFS
-	kmsKeyTags           []string
+	fileSystemConfigs    fileSystemConfigStore
 	flywheel             *flywheel.Manager
+	oidc                 *oidcAuthenticator
+	openAPI              *openAPIDocument
+	orchestrations       *orchestrations
+	orchestrationStore   orchestrationStore
+	taskEvents           taskEvents
+	taskIndex            taskIndex
+	rateLimiter          rateLimiter
+	replicaID            string
 	org                  string
 	orgPolicy            string
 	rgTaggingAPIServices resourcegroupstaggingapi.ResourceGroupsTaggingAPI
 	router               *mux.Router
 	session              session.Session
 	sessionCache         *cache.Cache
+	shuttingDown         chan struct{}
 	version              common.Version
+	waiters              waiters
+	webhookConfig        common.Webhooks
+	webhooks             *webhook.Notifier
 }
 
 // NewServer creates a new server and starts it
-func NewServer(config common.Config) error {
+func NewServer(config common.Config, opts ...ServerOption) error {
 	// setup server context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if config.Org == "" {
-		return errors.New("'org' cannot be empty in the configuration")
+	if err := config.Validate(); err != nil {
+		return err
 	}
 
 	s := server{
-		accountsMap:          config.AccountsMap,
+		defaultRegion:        config.Account.Region,
 		ec2Services:          ec2.EC2{},
 		efsServices:          efs.EFS{},
-		kmsKeyTags:           config.KmsKeyTags,
 		rgTaggingAPIServices: resourcegroupstaggingapi.ResourceGroupsTaggingAPI{},
 		router:               mux.NewRouter(),
+		shuttingDown:         make(chan struct{}),
 		version:              config.Version,
 		context:              ctx,
 		org:                  config.Org,
+		orchestrations:       newOrchestrations(),
+		replicaID:            newReplicaID(),
 		sessionCache:         cache.New(600*time.Second, 900*time.Second),
+		webhookConfig:        config.Webhooks,
+	}
+	s.config.Store(newDynamicConfig(config))
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	oidc, err := newOIDCAuthenticator(config.OIDC)
+	if err != nil {
+		return err
 	}
+	s.oidc = oidc
 
 	orgPolicy, err := orgTagAccessPolicy(config.Org)
 	if err != nil {
@@ -105,10 +141,50 @@ func NewServer(config common.Config) error {
 	}
 	s.flywheel = manager
 
+	rdb, err := newFlywheelRedis(config.Flywheel)
+	if err != nil {
+		return fmt.Errorf("failed to create flywheel redis client: %s", err)
+	}
+	s.orchestrationStore = newOrchestrationStore(rdb, config.Flywheel.Namespace)
+	s.taskIndex = newTaskIndex(rdb, config.Flywheel.Namespace)
+	s.taskEvents = newTaskEvents(rdb, config.Flywheel.Namespace)
+	s.fileSystemConfigs = newFileSystemConfigStore(rdb, config.Flywheel.Namespace)
+
+	auditor, err := newAuditor(config.Audit)
+	if err != nil {
+		return fmt.Errorf("failed to create auditor: %s", err)
+	}
+	s.auditor = auditor
+	defer s.auditor.Close()
+
+	w, err := newWaiters(config.Waiters)
+	if err != nil {
+		return fmt.Errorf("failed to create waiters: %s", err)
+	}
+	s.waiters = w
+
+	notifier, err := newWebhookNotifier(config.Webhooks)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook notifier: %s", err)
+	}
+	s.webhooks = notifier
+	defer s.webhooks.Close()
+
+	// the limits are checked per request, so limits added by a reload take effect without a restart
+	if config.RateLimit.RedisAddress != "" || config.Flywheel.RedisAddress != "" {
+		limiter, err := newRateLimiter(config.RateLimit, config.Flywheel)
+		if err != nil {
+			return fmt.Errorf("failed to create rate limiter: %s", err)
+		}
+		s.rateLimiter = limiter
+	}
+
 	publicURLs := map[string]string{
 		"/v1/efs/ping":    "public",
 		"/v1/efs/version": "public",
 		"/v1/efs/metrics": "public",
+
+		"/v1/efs/openapi.json": "public",
 	}
 
 	// load routes
@@ -118,7 +194,26 @@ func NewServer(config common.Config) error {
 		config.ListenAddress = ":8080"
 	}
 
-	handler := handlers.RecoveryHandler()(handlers.LoggingHandler(os.Stdout, TokenMiddleware([]byte(config.Token), publicURLs, s.router)))
+	// watch for configuration changes
+	go s.watchConfig(ctx)
+
+	// resume orchestrations orphaned by other replicas
+	go s.recoverOrchestrations(ctx)
+
+	// compare the filesystems with their last applied configuration
+	if config.Reconciler.Interval != "" {
+		interval, err := time.ParseDuration(config.Reconciler.Interval)
+		if err != nil {
+			return fmt.Errorf("failed to parse reconciler interval: %s", err)
+		}
+
+		go s.reconcile(ctx, interval, config.Reconciler.Mode == "repair")
+	}
+
+	// log entries with a context carry its request id
+	log.AddHook(requestIDHook{})
+
+	handler := handlers.RecoveryHandler()(handlers.LoggingHandler(os.Stdout, RequestIDMiddleware(tokenMiddleware(s.authenticate, publicURLs, s.router))))
 	srv := &http.Server{
 		Handler:      handler,
 		Addr:         config.ListenAddress,
@@ -126,12 +221,34 @@ func NewServer(config common.Config) error {
 		ReadTimeout:  15 * time.Second,
 	}
 
-	log.Infof("starting listener on %s", config.ListenAddress)
-	if err := srv.ListenAndServe(); err != nil {
+	// long-lived responses like task event streams aren't idle, so they have to end for the shutdown to finish
+	srv.RegisterOnShutdown(func() { close(s.shuttingDown) })
+
+	shutdownTimeout := defaultShutdownTimeout
+	if config.ShutdownTimeout != "" {
+		if shutdownTimeout, err = time.ParseDuration(config.ShutdownTimeout); err != nil {
+			return fmt.Errorf("failed to parse shutdown timeout: %s", err)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Infof("starting listener on %s", config.ListenAddress)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
 		return err
+	case sig := <-stop:
+		log.Infof("received %s", sig)
 	}
 
-	return nil
+	return s.shutdown(srv, shutdownTimeout)
 }
 
 func newFlywheelManager(config common.Flywheel) (*flywheel.Manager, error) {
@@ -173,11 +290,35 @@ func newFlywheelManager(config common.Flywheel) (*flywheel.Manager, error) {
 	return manager, nil
 }
 
+// newFlywheelRedis creates a client for the flywheel redis, used to store orchestration state and index tasks
+func newFlywheelRedis(config common.Flywheel) (*redis.Client, error) {
+	opts := &redis.Options{
+		Addr:     config.RedisAddress,
+		Username: config.RedisUsername,
+		Password: config.RedisPassword,
+	}
+
+	if config.RedisDatabase != "" {
+		db, err := strconv.Atoi(config.RedisDatabase)
+		if err != nil {
+			return nil, err
+		}
+		opts.DB = db
+	}
+
+	return redis.NewClient(opts), nil
+}
+
 // LogWriter is an http.ResponseWriter
 type LogWriter struct {
 	http.ResponseWriter
 }
 
+// Unwrap returns the wrapped http.ResponseWriter so an http.ResponseController can flush it
+func (w LogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Write log message if http response writer returns an error
 func (w LogWriter) Write(p []byte) (n int, err error) {
 	n, err = w.ResponseWriter.Write(p)
@@ -187,70 +328,9 @@ func (w LogWriter) Write(p []byte) (n int, err error) {
 	return
 }
 
-type rollbackFunc func(ctx context.Context) error
-
-// rollBack executes functions from a stack of rollback functions
-func rollBack(t *[]rollbackFunc) {
-	if t == nil {
-		return
-	}
-
-	timeout, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-
-	done := make(chan string, 1)
-	go func() {
-		tasks := *t
-		log.Errorf("executing rollback of %d tasks", len(tasks))
-		for i := len(tasks) - 1; i >= 0; i-- {
-			f := tasks[i]
-			if funcerr := f(timeout); funcerr != nil {
-				log.Errorf("rollback task error: %s, continuing rollback", funcerr)
-			}
-			log.Infof("executed rollback task %d of %d", len(tasks)-i, len(tasks))
-		}
-		done <- "success"
-	}()
-
-	// wait for a done context
-	select {
-	case <-timeout.Done():
-		log.Error("timeout waiting for successful rollback")
-	case <-done:
-		log.Info("successfully rolled back")
-	}
-}
-
-type stop struct {
-	error
-}
-
-// retry is stolen from https://upgear.io/blog/simple-golang-retry-function/
-func retry(attempts int, sleep time.Duration, f func() error) error {
-	if err := f(); err != nil {
-		if s, ok := err.(stop); ok {
-			// Return the original error for later checking
-			return s.error
-		}
-
-		if attempts--; attempts > 0 {
-			// Add some randomness to prevent creating a Thundering Herd
-			jitter := time.Duration(rand.Int63n(int64(sleep)))
-			sleep = sleep + jitter/2
-
-			log.Debugf("sleeping for %s", sleep.String())
-			time.Sleep(sleep)
-			return retry(attempts, 2*sleep, f)
-		}
-		return err
-	}
-
-	return nil
-}
-
 // if we have an entry for the account name, return the associated account number
 func (s *server) mapAccountNumber(name string) string {
-	if a, ok := s.accountsMap[name]; ok {
+	if a, ok := s.conf().accountsMap[name]; ok {
 		return a
 	}
 	return name
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/flywheel"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultShutdownTimeout is how long to wait for running orchestrations when shutting down
+const defaultShutdownTimeout = 2 * time.Minute
+
+// interruptGracePeriod is how long to wait for interrupted orchestrations to mark their tasks and roll back
+const interruptGracePeriod = 10 * time.Second
+
+// interruptedMessage is the failure message of tasks still running when the server shuts down
+const interruptedMessage = "interrupted: the server shut down before the task finished"
+
+// orchestrations tracks the running asynchronous orchestrations so they can be drained on shutdown.  Each
+// orchestration is tracked until both the orchestration goroutine (including any rollback) and the task
+// tracking goroutine have finished.
+type orchestrations struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	refs      map[string]int
+	cancels   map[string]context.CancelFunc
+	cancelled map[string]bool
+	// leaseLost are the orchestrations stopped because another replica took over their lease
+	leaseLost map[string]bool
+	wg        sync.WaitGroup
+}
+
+func newOrchestrations() *orchestrations {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &orchestrations{
+		ctx:       ctx,
+		cancel:    cancel,
+		refs:      map[string]int{},
+		cancels:   map[string]context.CancelFunc{},
+		cancelled: map[string]bool{},
+		leaseLost: map[string]bool{},
+	}
+}
+
+// add tracks a running orchestration for the task
+func (o *orchestrations) add(task *flywheel.Task) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.wg.Add(2)
+	o.refs[task.ID] += 2
+}
+
+// done is called when the orchestration or the task tracking for the task finishes
+func (o *orchestrations) done(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.refs[id] == 0 {
+		return
+	}
+
+	o.refs[id]--
+	if o.refs[id] == 0 {
+		delete(o.refs, id)
+		delete(o.leaseLost, id)
+	}
+	o.wg.Done()
+}
+
+// running returns the ids of the running orchestration tasks
+func (o *orchestrations) running() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ids := make([]string, 0, len(o.refs))
+	for id := range o.refs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// cancellable registers the function that cancels the steps of the task's orchestration
+func (o *orchestrations) cancellable(id string, cancel context.CancelFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.cancels[id] = cancel
+}
+
+// finished forgets the cancellation of the task's orchestration
+func (o *orchestrations) finished(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.cancels, id)
+	delete(o.cancelled, id)
+}
+
+// cancelTask cancels the steps of the task's orchestration, returning false if it's not running here
+func (o *orchestrations) cancelTask(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cancel, ok := o.cancels[id]
+	if !ok {
+		return false
+	}
+
+	o.cancelled[id] = true
+	cancel()
+
+	return true
+}
+
+// loseLease stops the steps of the task's orchestration after its lease was lost, returning false if it's not
+// running here.  Unlike a cancellation, the steps aren't rolled back and the task isn't finished.
+func (o *orchestrations) loseLease(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cancel, ok := o.cancels[id]
+	if !ok {
+		return false
+	}
+
+	o.leaseLost[id] = true
+	cancel()
+
+	return true
+}
+
+// lostLease returns true if the task's orchestration was stopped because its lease was lost
+func (o *orchestrations) lostLease(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.leaseLost[id]
+}
+
+// wasCancelled returns true if the task's orchestration was cancelled
+func (o *orchestrations) wasCancelled(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.cancelled[id]
+}
+
+// wait waits for the running orchestrations to finish, returning false if the context is done first
+func (o *orchestrations) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// orchestrationContext returns the context for an asynchronous orchestration of the task and tracks it
+// until the task finishes.  The orchestration outlives the request, so it's detached from the request
+// cancellation but keeps the request values (ie. the region).  It's cancelled if the server is shut
+// down before it finishes.
+func (s *server) orchestrationContext(ctx context.Context, task *flywheel.Task) (context.Context, context.CancelFunc) {
+	oCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	if s.orchestrations == nil {
+		return oCtx, cancel
+	}
+
+	s.orchestrations.add(task)
+	stop := context.AfterFunc(s.orchestrations.ctx, cancel)
+
+	return oCtx, func() {
+		stop()
+		cancel()
+		s.orchestrationDone(task)
+	}
+}
+
+// orchestrationDone is called when the orchestration or the task tracking for the task finishes
+func (s *server) orchestrationDone(task *flywheel.Task) {
+	if s.orchestrations != nil {
+		s.orchestrations.done(task.ID)
+	}
+}
+
+// orchestrationsInterrupted returns true if the running orchestrations were interrupted by a shutdown
+func (s *server) orchestrationsInterrupted() bool {
+	return s.orchestrations != nil && s.orchestrations.ctx.Err() != nil
+}
+
+// shutdown stops accepting requests, waits for in-flight requests and running orchestrations to finish
+// until the timeout, then cancels the remaining orchestrations and waits up to the grace period for them
+// to mark their tasks as interrupted
+func (s *server) shutdown(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Infof("shutting down, waiting up to %s for requests and orchestrations to finish", timeout.String())
+
+	var err error
+	if srv != nil {
+		if err = srv.Shutdown(ctx); err != nil {
+			log.Errorf("failed to gracefully stop the http server: %s", err)
+		}
+	}
+
+	if s.orchestrations == nil {
+		return err
+	}
+
+	if s.orchestrations.wait(ctx) {
+		log.Info("all orchestrations finished")
+		return err
+	}
+
+	log.Warnf("timed out waiting for %d orchestrations, interrupting them", len(s.orchestrations.running()))
+
+	// the task tracking of each orchestration marks its task interrupted, or leaves it to be resumed
+	s.orchestrations.cancel()
+
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), interruptGracePeriod)
+	defer graceCancel()
+
+	if !s.orchestrations.wait(graceCtx) {
+		log.Warnf("timed out waiting for interrupted orchestrations %v to stop", s.orchestrations.running())
+	}
+
+	return err
+}
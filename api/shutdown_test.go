@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/flywheel"
+)
+
+func TestOrchestrationContext(t *testing.T) {
+	s := server{orchestrations: newOrchestrations()}
+	task := flywheel.NewTask()
+
+	reqCtx, reqCancel := context.WithCancel(withRegion(context.Background(), "us-west-2"))
+	ctx, cancel := s.orchestrationContext(reqCtx, task)
+
+	// the orchestration outlives the request but keeps its values
+	reqCancel()
+	if ctx.Err() != nil {
+		t.Error("expected orchestration context not to be cancelled with the request")
+	}
+
+	if region := regionFromContext(ctx); region != "us-west-2" {
+		t.Errorf("expected region from the request context, got %s", region)
+	}
+
+	if running := s.orchestrations.running(); !reflect.DeepEqual(running, []string{task.ID}) {
+		t.Errorf("expected task %s to be running, got %v", task.ID, running)
+	}
+
+	// the orchestration is tracked until both the orchestration and the task tracking finish
+	cancel()
+	if running := s.orchestrations.running(); len(running) != 1 {
+		t.Errorf("expected task to be tracked until the task tracking finishes, got %v", running)
+	}
+
+	s.orchestrationDone(task)
+	if running := s.orchestrations.running(); len(running) != 0 {
+		t.Errorf("expected no running tasks, got %v", running)
+	}
+
+	// extra calls are ignored
+	s.orchestrationDone(task)
+
+	// without tracking the context is still detached from the request
+	untracked := server{}
+	uctx, ucancel := untracked.orchestrationContext(reqCtx, task)
+	if uctx.Err() != nil {
+		t.Error("expected untracked orchestration context not to be cancelled with the request")
+	}
+	ucancel()
+}
+
+func TestShutdownDrainsOrchestrations(t *testing.T) {
+	s := server{orchestrations: newOrchestrations()}
+	task := flywheel.NewTask()
+
+	ctx, cancel := s.orchestrationContext(context.Background(), task)
+	go func() {
+		defer s.orchestrationDone(task)
+		defer cancel()
+
+		select {
+		case <-ctx.Done():
+			t.Error("expected orchestration to finish without being interrupted")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}()
+
+	if err := s.shutdown(nil, 5*time.Second); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if s.orchestrationsInterrupted() {
+		t.Error("expected orchestrations not to be interrupted")
+	}
+
+	if running := s.orchestrations.running(); len(running) != 0 {
+		t.Errorf("expected no running orchestrations, got %v", running)
+	}
+}
+
+func TestShutdownInterruptsOrchestrations(t *testing.T) {
+	s := server{orchestrations: newOrchestrations()}
+	task := flywheel.NewTask()
+
+	interrupted := make(chan struct{})
+
+	ctx, cancel := s.orchestrationContext(context.Background(), task)
+	go func() {
+		defer s.orchestrationDone(task)
+		defer cancel()
+
+		<-ctx.Done()
+		close(interrupted)
+	}()
+
+	if err := s.shutdown(nil, 50*time.Millisecond); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !s.orchestrationsInterrupted() {
+		t.Error("expected orchestrations to be interrupted")
+	}
+
+	// shutdown waits for the interrupted orchestrations to stop
+	select {
+	case <-interrupted:
+	default:
+		t.Fatal("expected the orchestration to be cancelled before shutdown returned")
+	}
+
+	if running := s.orchestrations.running(); len(running) != 0 {
+		t.Errorf("expected no running orchestrations, got %v", running)
+	}
+}
@@ -0,0 +1,496 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/saga"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// the kinds of asynchronous orchestrations, only filesystem create and delete are resumable
+const (
+	kindAccessPointCreate = "accessPointCreate"
+	kindFilesystemCreate  = "filesystemCreate"
+	kindFilesystemDelete  = "filesystemDelete"
+	kindFilesystemUpdate  = "filesystemUpdate"
+	kindOrphanCleanup     = "orphanCleanup"
+	kindReconcile         = "reconcile"
+	kindSpaceTeardown     = "spaceTeardown"
+	kindSpecApply         = "specApply"
+)
+
+const (
+	// orchestrationLeaseTTL is how long a replica owns an orchestration without renewing its lease.  When a
+	// lease expires, the orchestration is resumed (or rolled back) by the next replica that claims it.
+	orchestrationLeaseTTL = 30 * time.Second
+
+	// orchestrationStateTTL is how long the state of an orchestration is kept in redis
+	orchestrationStateTTL = 24 * time.Hour
+)
+
+// orchestrationState is the persisted state of an asynchronous orchestration.  It's saved after every
+// completed step so the orchestration can be resumed from the next step, or its completed steps rolled
+// back, by another replica.
+type orchestrationState struct {
+	TaskID        string
+	Kind          string
+	Account       string
+	Group         string
+	Region        string
+	FileSystemID  string
+	FileSystemArn string
+	Request       *FileSystemCreateRequest `json:",omitempty"`
+	MountTargets  []string                 `json:",omitempty"`
+	CallbackURL   string                   `json:",omitempty"`
+	RequestID     string                   `json:",omitempty"`
+	Completed     []string
+	RollingBack   bool
+	UpdatedAt     time.Time
+}
+
+// orchestrationStore persists the state of orchestrations and the leases of the replicas running them
+type orchestrationStore interface {
+	save(ctx context.Context, state *orchestrationState) error
+	load(ctx context.Context, id string) (*orchestrationState, error)
+	remove(ctx context.Context, id string) error
+	list(ctx context.Context) ([]string, error)
+	claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error)
+	renew(ctx context.Context, id, owner string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, id, owner string) error
+	requestCancel(ctx context.Context, id string) error
+	cancelRequested(ctx context.Context, id string) (bool, error)
+}
+
+// renewLeaseScript extends the lease in KEYS[1] by ARGV[2] milliseconds if it's held by ARGV[1]
+var renewLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease in KEYS[1] if it's held by ARGV[1]
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// redisOrchestrationStore stores the state of each orchestration as JSON in <prefix>:state:<task id>, the
+// lease in <prefix>:lease:<task id>, cancellation requests in <prefix>:cancel:<task id> and the ids of the
+// stored orchestrations in the set <prefix>:index
+type redisOrchestrationStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// newOrchestrationStore creates a redis orchestration store under the flywheel namespace
+func newOrchestrationStore(client redis.Cmdable, namespace string) *redisOrchestrationStore {
+	return &redisOrchestrationStore{
+		client: client,
+		prefix: namespace + ":orchestrations",
+	}
+}
+
+func (r *redisOrchestrationStore) stateKey(id string) string  { return r.prefix + ":state:" + id }
+func (r *redisOrchestrationStore) leaseKey(id string) string  { return r.prefix + ":lease:" + id }
+func (r *redisOrchestrationStore) cancelKey(id string) string { return r.prefix + ":cancel:" + id }
+func (r *redisOrchestrationStore) indexKey() string           { return r.prefix + ":index" }
+
+func (r *redisOrchestrationStore) save(ctx context.Context, state *orchestrationState) error {
+	out, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.stateKey(state.TaskID), out, orchestrationStateTTL)
+		pipe.SAdd(ctx, r.indexKey(), state.TaskID)
+		return nil
+	})
+	return err
+}
+
+func (r *redisOrchestrationStore) load(ctx context.Context, id string) (*orchestrationState, error) {
+	out, err := r.client.Get(ctx, r.stateKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &orchestrationState{}
+	if err := json.Unmarshal(out, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (r *redisOrchestrationStore) remove(ctx context.Context, id string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.stateKey(id), r.leaseKey(id), r.cancelKey(id))
+		pipe.SRem(ctx, r.indexKey(), id)
+		return nil
+	})
+	return err
+}
+
+func (r *redisOrchestrationStore) list(ctx context.Context) ([]string, error) {
+	return r.client.SMembers(ctx, r.indexKey()).Result()
+}
+
+func (r *redisOrchestrationStore) claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.leaseKey(id), owner, ttl).Result()
+}
+
+func (r *redisOrchestrationStore) renew(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLeaseScript.Run(ctx, r.client, []string{r.leaseKey(id)}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *redisOrchestrationStore) release(ctx context.Context, id, owner string) error {
+	return releaseLeaseScript.Run(ctx, r.client, []string{r.leaseKey(id)}, owner).Err()
+}
+
+func (r *redisOrchestrationStore) requestCancel(ctx context.Context, id string) error {
+	return r.client.Set(ctx, r.cancelKey(id), time.Now().UTC().Format(time.RFC3339Nano), orchestrationStateTTL).Err()
+}
+
+func (r *redisOrchestrationStore) cancelRequested(ctx context.Context, id string) (bool, error) {
+	n, err := r.client.Exists(ctx, r.cancelKey(id)).Result()
+	return n > 0, err
+}
+
+// newReplicaID returns a unique id for this replica, used as the owner of orchestration leases
+func newReplicaID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "efs-api"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// saveOrchestration persists the state of the orchestration, even if it was cancelled.  Failing to save the
+// state doesn't fail the orchestration, it just can't be resumed by another replica.
+func (s *server) saveOrchestration(ctx context.Context, state *orchestrationState) {
+	if s.orchestrationStore == nil {
+		return
+	}
+
+	state.UpdatedAt = time.Now().UTC()
+	if err := s.orchestrationStore.save(context.WithoutCancel(ctx), state); err != nil {
+		logger(ctx).Errorf("failed to save state of orchestration %s: %s", state.TaskID, err)
+	}
+}
+
+// forgetOrchestration removes the persisted state of the finished orchestration
+func (s *server) forgetOrchestration(ctx context.Context, id string) {
+	if s.orchestrationStore == nil {
+		return
+	}
+
+	if err := s.orchestrationStore.remove(context.WithoutCancel(ctx), id); err != nil {
+		logger(ctx).Errorf("failed to remove state of orchestration %s: %s", id, err)
+	}
+}
+
+// orchestrationResumable returns true if the orchestration of the task has persisted state, so it will be
+// resumed by another replica instead of failing its task when it's interrupted
+func (s *server) orchestrationResumable(ctx context.Context, id string) bool {
+	if s.orchestrationStore == nil {
+		return false
+	}
+
+	state, err := s.orchestrationStore.load(ctx, id)
+	if err != nil {
+		logger(ctx).Errorf("failed to load state of orchestration %s: %s", id, err)
+		return false
+	}
+
+	return state != nil
+}
+
+// errLeaseLost is returned by orchestrations stopped because another replica took over their lease
+var errLeaseLost = errors.New("the lease on the orchestration was lost to another replica")
+
+// keepLease renews the lease on the orchestration and checks if it was cancelled on another replica until
+// the context is done.  If the lease was lost, another replica may have resumed the orchestration, so it's
+// stopped here without rolling back or saving its state.
+func (s *server) keepLease(ctx context.Context, id string) {
+	ticker := time.NewTicker(orchestrationLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ok, err := s.orchestrationStore.renew(ctx, id, s.replicaID, orchestrationLeaseTTL); err != nil {
+				logger(ctx).Errorf("failed to renew lease on orchestration %s: %s", id, err)
+			} else if !ok {
+				logger(ctx).Errorf("lost lease on orchestration %s, stopping it", id)
+
+				if s.orchestrations != nil {
+					s.orchestrations.loseLease(id)
+				}
+				return
+			}
+
+			s.checkCancelRequested(ctx, id)
+		}
+	}
+}
+
+// runOrchestration persists the state of a new orchestration and runs its steps asynchronously, tracking
+// them with the task
+func (s *server) runOrchestration(ctx context.Context, task *flywheel.Task, state *orchestrationState) {
+	if s.orchestrationStore != nil {
+		if _, err := s.orchestrationStore.claim(ctx, state.TaskID, s.replicaID, orchestrationLeaseTTL); err != nil {
+			logger(ctx).Errorf("failed to claim lease on orchestration %s: %s", state.TaskID, err)
+		}
+	}
+	s.saveOrchestration(ctx, state)
+
+	s.startOrchestration(ctx, task, state)
+}
+
+// startOrchestration runs the remaining steps of the orchestration asynchronously, holding the lease on it
+// while it runs.  If it's interrupted by a shutdown, the lease is released and the state is kept so that
+// another replica resumes it.
+func (s *server) startOrchestration(ctx context.Context, task *flywheel.Task, state *orchestrationState) {
+	fsCtx, cancel := s.orchestrationContext(ctx, task)
+	go func() {
+		defer cancel()
+
+		// the steps are cancelled separately from the orchestration so the task is tracked until the
+		// rollback of a cancelled orchestration finishes
+		stepCtx, finished := s.cancellableOrchestration(fsCtx, task)
+		defer finished()
+
+		if s.orchestrationStore != nil {
+			s.checkCancelRequested(fsCtx, state.TaskID)
+			go s.keepLease(fsCtx, state.TaskID)
+		}
+
+		msgChan, errChan := s.startTask(fsCtx, task, taskInfo{
+			Operation:    state.Kind,
+			Account:      state.Account,
+			Group:        state.Group,
+			FileSystemID: state.FileSystemID,
+			CallbackURL:  state.CallbackURL,
+		})
+
+		steps, err := s.orchestrationSteps(stepCtx, state, msgChan)
+		if err == nil {
+			err = s.runSteps(stepCtx, state, steps, taskProgress(fsCtx, msgChan))
+		} else if !s.orchestrationsInterrupted() {
+			s.forgetOrchestration(fsCtx, state.TaskID)
+		}
+
+		if err == nil {
+			s.orchestrationSucceeded(fsCtx, state)
+			return
+		}
+
+		if s.orchestrationLeaseLost(state.TaskID) {
+			logger(ctx).Warnf("leaving orchestration %s to the replica holding its lease", state.TaskID)
+			return
+		}
+
+		if s.orchestrationsInterrupted() {
+			if s.orchestrationStore != nil {
+				releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer releaseCancel()
+
+				if rerr := s.orchestrationStore.release(releaseCtx, state.TaskID, s.replicaID); rerr != nil {
+					logger(ctx).Errorf("failed to release lease on orchestration %s: %s", state.TaskID, rerr)
+				}
+			}
+			return
+		}
+
+		if s.orchestrationCancelled(task.ID) {
+			err = errTaskCancelled
+		}
+
+		errChan <- err
+	}()
+}
+
+// orchestrationSteps returns the steps of the orchestration
+func (s *server) orchestrationSteps(ctx context.Context, state *orchestrationState, msgChan chan<- string) ([]saga.Step, error) {
+	switch state.Kind {
+	case kindFilesystemCreate:
+		return s.filesystemCreateSteps(ctx, state, msgChan)
+	case kindFilesystemDelete:
+		return s.filesystemDeleteSteps(ctx, state, msgChan)
+	default:
+		return nil, fmt.Errorf("unknown orchestration %s for task %s", state.Kind, state.TaskID)
+	}
+}
+
+// orchestrationSucceeded records the configuration of a created filesystem and forgets the configuration of a
+// deleted filesystem
+func (s *server) orchestrationSucceeded(ctx context.Context, state *orchestrationState) {
+	switch state.Kind {
+	case kindFilesystemCreate:
+		s.saveFileSystemConfig(ctx, state.Account, state.Group, state.Request.Name, state.FileSystemID, fileSystemSpecFromCreate(state.Request))
+	case kindFilesystemDelete:
+		s.removeFileSystemConfig(ctx, state.Account, state.Group, state.FileSystemID)
+	}
+}
+
+// runSteps runs the steps of the orchestration that haven't completed as a saga, saving the state after each
+// step.  If a step fails, the completed steps are rolled back in reverse order and the state is removed.  If the
+// orchestration is interrupted by a shutdown, the state is kept so it can be resumed.
+func (s *server) runSteps(ctx context.Context, state *orchestrationState, steps []saga.Step, progress func(string)) error {
+	sg := saga.New(state.TaskID, steps,
+		saga.WithCompleted(state.Completed...),
+		saga.WithCompensating(state.RollingBack),
+		saga.WithCompensationTimeout(120*time.Second),
+		saga.WithInterrupted(func() bool {
+			return s.orchestrationsInterrupted() || s.orchestrationLeaseLost(state.TaskID)
+		}),
+		saga.WithProgress(progress),
+		saga.WithCheckpoint(func(c saga.Checkpoint) {
+			state.Completed = c.Completed
+			state.RollingBack = c.Compensating
+
+			// the replica holding the lease owns the state
+			if !s.orchestrationLeaseLost(state.TaskID) {
+				s.saveOrchestration(ctx, state)
+			}
+		}),
+	)
+
+	err := sg.Run(ctx)
+
+	var serr *saga.Error
+	if errors.As(err, &serr) && serr.Interrupted {
+		return err
+	}
+
+	// the replica holding the lease owns the state, even if the last step finished here
+	if s.orchestrationLeaseLost(state.TaskID) {
+		return errLeaseLost
+	}
+
+	s.forgetOrchestration(ctx, state.TaskID)
+
+	return err
+}
+
+// recoverOrchestrations resumes orphaned orchestrations, whose replica stopped renewing their lease, when
+// the server starts and then periodically until the context is done
+func (s *server) recoverOrchestrations(ctx context.Context) {
+	if s.orchestrationStore == nil {
+		return
+	}
+
+	ticker := time.NewTicker(orchestrationLeaseTTL)
+	defer ticker.Stop()
+
+	for {
+		for _, state := range s.claimOrphanedOrchestrations(ctx) {
+			s.resumeOrchestration(ctx, state)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimOrphanedOrchestrations claims the leases on the stored orchestrations that aren't owned by a replica
+// and returns their state
+func (s *server) claimOrphanedOrchestrations(ctx context.Context) []*orchestrationState {
+	if s.orchestrationsInterrupted() {
+		return nil
+	}
+
+	ids, err := s.orchestrationStore.list(ctx)
+	if err != nil {
+		logger(ctx).Errorf("failed to list orchestrations: %s", err)
+		return nil
+	}
+
+	running := map[string]bool{}
+	if s.orchestrations != nil {
+		for _, id := range s.orchestrations.running() {
+			running[id] = true
+		}
+	}
+
+	orphans := []*orchestrationState{}
+	for _, id := range ids {
+		// don't claim orchestrations running here if the lease lapsed
+		if running[id] {
+			continue
+		}
+
+		claimed, err := s.orchestrationStore.claim(ctx, id, s.replicaID, orchestrationLeaseTTL)
+		if err != nil {
+			logger(ctx).Errorf("failed to claim lease on orchestration %s: %s", id, err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		state, err := s.orchestrationStore.load(ctx, id)
+		if err != nil {
+			logger(ctx).Errorf("failed to load state of orchestration %s: %s", id, err)
+			if rerr := s.orchestrationStore.release(ctx, id, s.replicaID); rerr != nil {
+				logger(ctx).Errorf("failed to release lease on orchestration %s: %s", id, rerr)
+			}
+			continue
+		}
+
+		// the state expired, forget about it
+		if state == nil {
+			s.forgetOrchestration(ctx, id)
+			continue
+		}
+
+		logger(ctx).Infof("claimed orphaned %s orchestration %s", state.Kind, id)
+
+		orphans = append(orphans, state)
+	}
+
+	return orphans
+}
+
+// resumeOrchestration restarts the task of the orphaned orchestration and resumes its steps
+func (s *server) resumeOrchestration(ctx context.Context, state *orchestrationState) {
+	// the resumed orchestration logs and assumes roles with the id of the request that started it
+	if state.RequestID != "" {
+		ctx = withRequestID(ctx, state.RequestID)
+	}
+
+	task, err := s.flywheel.GetTask(ctx, state.TaskID)
+	if err != nil || task == nil {
+		logger(ctx).Warnf("failed to get task for orphaned orchestration %s, creating a new one: %v", state.TaskID, err)
+
+		task = flywheel.NewTask()
+		task.ID = state.TaskID
+	}
+
+	if state.RollingBack {
+		logger(ctx).Infof("resuming rollback of %s orchestration %s", state.Kind, state.TaskID)
+	} else {
+		logger(ctx).Infof("resuming %s orchestration %s after %d completed steps", state.Kind, state.TaskID, len(state.Completed))
+	}
+
+	s.startOrchestration(withRegion(ctx, state.Region), task, state)
+}
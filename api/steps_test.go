@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/saga"
+	"github.com/YaleSpinup/flywheel"
+)
+
+type testOrchestrationStore struct {
+	mu      sync.Mutex
+	states  map[string]orchestrationState
+	leases  map[string]string
+	cancels map[string]bool
+	saves   [][]string
+}
+
+func newTestOrchestrationStore() *testOrchestrationStore {
+	return &testOrchestrationStore{
+		states:  map[string]orchestrationState{},
+		leases:  map[string]string{},
+		cancels: map[string]bool{},
+	}
+}
+
+func (t *testOrchestrationStore) save(ctx context.Context, state *orchestrationState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := *state
+	s.Completed = append([]string{}, state.Completed...)
+	t.states[state.TaskID] = s
+	t.saves = append(t.saves, s.Completed)
+	return nil
+}
+
+func (t *testOrchestrationStore) load(ctx context.Context, id string) (*orchestrationState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.states[id]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (t *testOrchestrationStore) remove(ctx context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.states, id)
+	delete(t.leases, id)
+	return nil
+}
+
+func (t *testOrchestrationStore) list(ctx context.Context) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := []string{}
+	for id := range t.states {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (t *testOrchestrationStore) claim(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.leases[id]; ok {
+		return false, nil
+	}
+	t.leases[id] = owner
+	return true, nil
+}
+
+func (t *testOrchestrationStore) renew(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.leases[id] == owner, nil
+}
+
+func (t *testOrchestrationStore) release(ctx context.Context, id, owner string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.leases[id] == owner {
+		delete(t.leases, id)
+	}
+	return nil
+}
+
+func (t *testOrchestrationStore) requestCancel(ctx context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancels[id] = true
+	return nil
+}
+
+func (t *testOrchestrationStore) cancelRequested(ctx context.Context, id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cancels[id], nil
+}
+
+// testSteps returns steps named a, b and c that record their runs and rollbacks, failing the named step
+func testSteps(fail string, calls *[]string) []saga.Step {
+	steps := []saga.Step{}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		steps = append(steps, saga.Step{
+			Name: name,
+			Do: func(ctx context.Context) error {
+				*calls = append(*calls, "run "+name)
+				if name == fail {
+					return errors.New("boom")
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				*calls = append(*calls, "rollback "+name)
+				return nil
+			},
+		})
+	}
+	return steps
+}
+
+func TestRunSteps(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store}
+
+	calls := []string{}
+	state := &orchestrationState{TaskID: "task-1"}
+	if err := s.runSteps(context.TODO(), state, testSteps("", &calls), nil); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if expected := []string{"run a", "run b", "run c"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	// the state is saved after each step and removed when the orchestration finishes
+	expectedSaves := [][]string{{"a"}, {"a", "b"}, {"a", "b", "c"}}
+	if !reflect.DeepEqual(store.saves, expectedSaves) {
+		t.Errorf("expected saves %v, got %v", expectedSaves, store.saves)
+	}
+
+	if _, ok := store.states["task-1"]; ok {
+		t.Error("expected state to be removed")
+	}
+}
+
+func TestRunStepsResume(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store}
+
+	calls := []string{}
+	state := &orchestrationState{TaskID: "task-1", Completed: []string{"a", "b"}}
+	if err := s.runSteps(context.TODO(), state, testSteps("", &calls), nil); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if expected := []string{"run c"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected only the remaining step to run, got %v", calls)
+	}
+}
+
+func TestRunStepsRollback(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store}
+
+	calls := []string{}
+	state := &orchestrationState{TaskID: "task-1"}
+	if err := s.runSteps(context.TODO(), state, testSteps("c", &calls), nil); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	expected := []string{"run a", "run b", "run c", "rollback b", "rollback a"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	// the rolled back steps are removed from the state as the rollback progresses
+	expectedSaves := [][]string{{"a"}, {"a", "b"}, {"a", "b"}, {"a"}, {}}
+	if !reflect.DeepEqual(store.saves, expectedSaves) {
+		t.Errorf("expected saves %v, got %v", expectedSaves, store.saves)
+	}
+
+	if _, ok := store.states["task-1"]; ok {
+		t.Error("expected state to be removed")
+	}
+
+	// a resumed orchestration that was rolling back finishes the rollback without running any steps
+	calls = []string{}
+	state = &orchestrationState{TaskID: "task-2", Completed: []string{"a"}, RollingBack: true}
+	if err := s.runSteps(context.TODO(), state, testSteps("", &calls), nil); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if expected := []string{"rollback a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestRunStepsInterrupted(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store, orchestrations: newOrchestrations()}
+
+	calls := []string{}
+	steps := testSteps("", &calls)
+	steps[1].Do = func(ctx context.Context) error {
+		s.orchestrations.cancel()
+		return context.Canceled
+	}
+
+	state := &orchestrationState{TaskID: "task-1"}
+	if err := s.runSteps(context.TODO(), state, steps, nil); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// the completed steps aren't rolled back so another replica can resume the orchestration
+	if expected := []string{"run a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	saved, ok := store.states["task-1"]
+	if !ok {
+		t.Fatal("expected state to be kept")
+	}
+
+	if saved.RollingBack || !reflect.DeepEqual(saved.Completed, []string{"a"}) {
+		t.Errorf("unexpected saved state %+v", saved)
+	}
+
+	if !s.orchestrationResumable(context.TODO(), "task-1") {
+		t.Error("expected orchestration to be resumable")
+	}
+}
+
+func TestRunStepsLeaseLost(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store, orchestrations: newOrchestrations()}
+
+	task := flywheel.NewTask()
+	ctx, finished := s.cancellableOrchestration(context.Background(), task)
+	defer finished()
+
+	calls := []string{}
+	steps := testSteps("", &calls)
+	steps[1].Do = func(ctx context.Context) error {
+		s.orchestrations.loseLease(task.ID)
+		return ctx.Err()
+	}
+
+	state := &orchestrationState{TaskID: task.ID}
+	if err := s.runSteps(ctx, state, steps, nil); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// the steps aren't rolled back and the state isn't saved or removed, the other replica owns it
+	if expected := []string{"run a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	if expected := [][]string{{"a"}}; !reflect.DeepEqual(store.saves, expected) {
+		t.Errorf("expected saves %v, got %v", expected, store.saves)
+	}
+
+	if _, ok := store.states[task.ID]; !ok {
+		t.Error("expected state to be kept")
+	}
+
+	if !s.orchestrationLeaseLost(task.ID) || s.orchestrationCancelled(task.ID) {
+		t.Error("expected orchestration to have lost its lease without being cancelled")
+	}
+}
+
+func TestClaimOrphanedOrchestrations(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store, orchestrations: newOrchestrations(), replicaID: "replica-2"}
+
+	for _, id := range []string{"orphan", "owned", "local"} {
+		store.states[id] = orchestrationState{TaskID: id, Kind: kindFilesystemCreate}
+	}
+	store.leases["owned"] = "replica-1"
+
+	// the lease on an orchestration running here lapsed
+	s.orchestrations.refs["local"] = 2
+
+	orphans := s.claimOrphanedOrchestrations(context.TODO())
+	if len(orphans) != 1 || orphans[0].TaskID != "orphan" {
+		t.Fatalf("expected to claim the orphaned orchestration, got %+v", orphans)
+	}
+
+	if store.leases["orphan"] != "replica-2" || store.leases["owned"] != "replica-1" {
+		t.Errorf("unexpected leases %v", store.leases)
+	}
+
+	if _, ok := store.leases["local"]; ok {
+		t.Error("expected orchestration running here not to be claimed")
+	}
+
+	// claimed orchestrations aren't claimed again
+	if orphans := s.claimOrphanedOrchestrations(context.TODO()); len(orphans) != 0 {
+		t.Errorf("expected no orphans, got %+v", orphans)
+	}
+}
+
+func TestRedisOrchestrationStore(t *testing.T) {
+	client := newTestRedis(t)
+	store := newOrchestrationStore(client, "efsapi")
+	ctx := context.TODO()
+
+	state := &orchestrationState{TaskID: "task-1", Kind: kindFilesystemCreate, Account: "1234567890", Completed: []string{"a"}}
+	if err := store.save(ctx, state); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	out, err := store.load(ctx, "task-1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if out == nil || out.Kind != kindFilesystemCreate || !reflect.DeepEqual(out.Completed, []string{"a"}) {
+		t.Errorf("unexpected loaded state %+v", out)
+	}
+
+	if ids, _ := store.list(ctx); !reflect.DeepEqual(ids, []string{"task-1"}) {
+		t.Errorf("expected stored orchestrations [task-1], got %v", ids)
+	}
+
+	// only one replica holds the lease and only it can renew or release it
+	if ok, _ := store.claim(ctx, "task-1", "replica-1", time.Minute); !ok {
+		t.Error("expected replica-1 to claim the lease")
+	}
+
+	if ok, _ := store.claim(ctx, "task-1", "replica-2", time.Minute); ok {
+		t.Error("expected replica-2 not to claim the lease")
+	}
+
+	if ok, _ := store.renew(ctx, "task-1", "replica-2", time.Minute); ok {
+		t.Error("expected replica-2 not to renew the lease")
+	}
+
+	if ok, err := store.renew(ctx, "task-1", "replica-1", time.Minute); !ok || err != nil {
+		t.Errorf("expected replica-1 to renew the lease, got %t, %v", ok, err)
+	}
+
+	if err := store.release(ctx, "task-1", "replica-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := store.claim(ctx, "task-1", "replica-2", time.Minute); ok {
+		t.Error("expected the lease not to be released by replica-2")
+	}
+
+	if err := store.release(ctx, "task-1", "replica-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := store.claim(ctx, "task-1", "replica-2", time.Minute); !ok {
+		t.Error("expected replica-2 to claim the released lease")
+	}
+
+	if err := store.requestCancel(ctx, "task-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if requested, _ := store.cancelRequested(ctx, "task-1"); !requested {
+		t.Error("expected cancellation to be requested")
+	}
+
+	if err := store.remove(ctx, "task-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := store.load(ctx, "task-1"); out != nil || err != nil {
+		t.Errorf("expected removed state, got %+v, %v", out, err)
+	}
+
+	if requested, _ := store.cancelRequested(ctx, "task-1"); requested {
+		t.Error("expected cancellation request to be removed")
+	}
+
+	if ids, _ := store.list(ctx); len(ids) != 0 {
+		t.Errorf("expected no stored orchestrations, got %v", ids)
+	}
+}
@@ -0,0 +1,476 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/waiter"
+	"github.com/YaleSpinup/flywheel"
+	"github.com/go-redis/redis/v8"
+)
+
+// taskStatusCancelled is the status of a task whose orchestration was cancelled.  It isn't a flywheel status,
+// the flywheel task is failed and the task is cancelled in the task index.
+const taskStatusCancelled = "cancelled"
+
+// taskCancelledPrefix starts the flywheel failure of cancelled tasks, it marks them cancelled for clients of the
+// flywheel task route
+const taskCancelledPrefix = taskStatusCancelled + ":"
+
+// errTaskCancelled is the failure of tasks whose orchestration was cancelled
+var errTaskCancelled = errors.New(taskCancelledPrefix + " the task was cancelled before it finished")
+
+// flywheelTaskStatus returns the status of the flywheel task, cancelled for failed tasks with the cancellation
+// failure
+func flywheelTaskStatus(task *flywheel.Task) string {
+	if task.Status == flywheel.STATUS_FAILED && strings.HasPrefix(task.Failure, taskCancelledPrefix) {
+		return taskStatusCancelled
+	}
+	return task.Status
+}
+
+// cancellableOrchestration returns the context for the steps of the task's orchestration, which is cancelled
+// when the task is cancelled, and a function to call when the orchestration finishes
+func (s *server) cancellableOrchestration(ctx context.Context, task *flywheel.Task) (context.Context, func()) {
+	stepCtx, cancel := context.WithCancel(ctx)
+	if s.orchestrations == nil {
+		return stepCtx, cancel
+	}
+
+	s.orchestrations.cancellable(task.ID, cancel)
+
+	return stepCtx, func() {
+		cancel()
+		s.orchestrations.finished(task.ID)
+	}
+}
+
+// cancelOrchestration cancels the task's orchestration, returning false if it's not running here
+func (s *server) cancelOrchestration(id string) bool {
+	return s.orchestrations != nil && s.orchestrations.cancelTask(id)
+}
+
+// orchestrationCancelled returns true if the task's orchestration was cancelled
+func (s *server) orchestrationCancelled(id string) bool {
+	return s.orchestrations != nil && s.orchestrations.wasCancelled(id)
+}
+
+// orchestrationLeaseLost returns true if the task's orchestration was stopped because another replica took over
+// its lease
+func (s *server) orchestrationLeaseLost(id string) bool {
+	return s.orchestrations != nil && s.orchestrations.lostLease(id)
+}
+
+// checkCancelRequested cancels the task's orchestration if cancellation was requested on another replica
+func (s *server) checkCancelRequested(ctx context.Context, id string) {
+	if s.orchestrationStore == nil || s.orchestrationCancelled(id) {
+		return
+	}
+
+	requested, err := s.orchestrationStore.cancelRequested(ctx, id)
+	if err != nil {
+		logger(ctx).Errorf("failed to check for cancellation of orchestration %s: %s", id, err)
+		return
+	}
+
+	if requested {
+		logger(ctx).Warnf("cancelling orchestration %s as requested", id)
+		s.cancelOrchestration(id)
+	}
+}
+
+// cancelTask cancels the running filesystem create or delete task.  If the orchestration is running on
+// another replica, the cancellation is requested in redis and picked up by that replica.
+func (s *server) cancelTask(ctx context.Context, id string) error {
+	if s.cancelOrchestration(id) {
+		logger(ctx).Warnf("cancelled orchestration %s", id)
+		return nil
+	}
+
+	if s.orchestrationStore == nil {
+		return errors.New("orchestration is not running here")
+	}
+
+	logger(ctx).Warnf("requesting cancellation of orchestration %s", id)
+
+	return s.orchestrationStore.requestCancel(ctx, id)
+}
+
+// markTaskCancelled fails the flywheel task with the cancellation message and sets its status in the task
+// index to cancelled.  Flywheel doesn't have a cancelled status, so the task is listed as cancelled from the index.
+func (s *server) markTaskCancelled(ctx context.Context, id string) {
+	if ferr := s.flywheel.Fail(ctx, id, errTaskCancelled.Error()); ferr != nil {
+		logger(ctx).Errorf("failed to fail flywheel task %s: %s", id, ferr)
+		return
+	}
+
+	s.setIndexedTaskStatus(ctx, id, taskStatusCancelled)
+}
+
+// taskFinished returns true if the task status is final
+func taskFinished(status string) bool {
+	switch status {
+	case flywheel.STATUS_COMPLETED, flywheel.STATUS_FAILED:
+		return true
+	}
+	return false
+}
+
+// waitForTask waits for the flywheel task to finish, returning an error if it failed or was cancelled.  Tasks
+// that aren't found yet haven't been started by their orchestration.
+func (s *server) waitForTask(ctx context.Context, w *waiter.Waiter, id string) error {
+	return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		task, err := s.flywheel.GetTask(ctx, id)
+		if err != nil {
+			return false, err
+		}
+
+		if task == nil {
+			return false, fmt.Errorf("task %s is not started", id)
+		}
+
+		switch task.Status {
+		case flywheel.STATUS_COMPLETED:
+			return true, nil
+		case flywheel.STATUS_FAILED:
+			return false, waiter.Terminal(fmt.Errorf("task %s %s: %s", id, task.Status, task.Failure))
+		}
+
+		return false, fmt.Errorf("task %s is not yet finished (%s)", id, task.Status)
+	})
+}
+
+// taskProgress returns a function sending progress messages to the task, which drops them once the task
+// stops being tracked
+func taskProgress(ctx context.Context, msgChan chan<- string) func(string) {
+	return func(msg string) {
+		select {
+		case msgChan <- msg:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// taskIndexTTL is how long tasks are kept in the task index
+const taskIndexTTL = 24 * time.Hour
+
+// taskIndexPageSize is the number of task ids read from the task index at a time
+const taskIndexPageSize = 100
+
+// taskFetchConcurrency is the number of listed tasks fetched from flywheel at the same time
+const taskFetchConcurrency = 10
+
+// taskInfo describes the operation and the filesystem of an asynchronous task
+type taskInfo struct {
+	TaskID       string
+	Operation    string
+	Account      string
+	Group        string
+	FileSystemID string
+	StartedAt    time.Time
+	RequestID    string `json:",omitempty"`
+	CallbackURL  string `json:"-"`
+	// Status is the final status of the task from the task index when it's listed, empty while it's running
+	Status string `json:"-"`
+}
+
+// taskFilter filters the tasks listed from the task index, empty fields match all tasks
+type taskFilter struct {
+	Group        string
+	FileSystemID string
+	Operation    string
+	Status       string
+}
+
+// matches returns true if the task matches the group, filesystem, operation and status of the filter.  Tasks
+// without a final status in the task index are running.
+func (f taskFilter) matches(info *taskInfo) bool {
+	status := info.Status
+	if status == "" {
+		status = flywheel.STATUS_RUNNING
+	}
+
+	return (f.Group == "" || f.Group == info.Group) &&
+		(f.FileSystemID == "" || f.FileSystemID == info.FileSystemID) &&
+		(f.Operation == "" || f.Operation == info.Operation) &&
+		(f.Status == "" || f.Status == status)
+}
+
+// taskIndex indexes tasks by account, group, filesystem and operation
+type taskIndex interface {
+	add(ctx context.Context, info *taskInfo) error
+	get(ctx context.Context, id string) (*taskInfo, error)
+	list(ctx context.Context, account string, filter taskFilter, limit int) ([]*taskInfo, error)
+	setStatus(ctx context.Context, id, status string) error
+}
+
+// redisTaskIndex stores each task as JSON in <prefix>:task:<task id>, the final status of finished tasks in
+// <prefix>:status:<task id> and indexes the task ids by start time in
+// the sorted sets <prefix>:account:<account>, and <prefix>:account:<account>:group:<group>, :fs:<filesystem id>
+// and :operation:<operation>
+type redisTaskIndex struct {
+	client redis.Cmdable
+	now    func() time.Time
+	prefix string
+}
+
+// newTaskIndex creates a redis task index under the flywheel namespace
+func newTaskIndex(client redis.Cmdable, namespace string) *redisTaskIndex {
+	return &redisTaskIndex{
+		client: client,
+		now:    time.Now,
+		prefix: namespace + ":taskindex",
+	}
+}
+
+func (r *redisTaskIndex) taskKey(id string) string { return r.prefix + ":task:" + id }
+
+func (r *redisTaskIndex) statusKey(id string) string { return r.prefix + ":status:" + id }
+
+func (r *redisTaskIndex) accountKey(account string) string { return r.prefix + ":account:" + account }
+
+func (r *redisTaskIndex) groupKey(account, group string) string {
+	return r.accountKey(account) + ":group:" + group
+}
+
+func (r *redisTaskIndex) fileSystemKey(account, fsid string) string {
+	return r.accountKey(account) + ":fs:" + fsid
+}
+
+func (r *redisTaskIndex) operationKey(account, operation string) string {
+	return r.accountKey(account) + ":operation:" + operation
+}
+
+func (r *redisTaskIndex) add(ctx context.Context, info *taskInfo) error {
+	out, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{r.accountKey(info.Account), r.operationKey(info.Account, info.Operation)}
+	if info.Group != "" {
+		keys = append(keys, r.groupKey(info.Account, info.Group))
+	}
+	if info.FileSystemID != "" {
+		keys = append(keys, r.fileSystemKey(info.Account, info.FileSystemID))
+	}
+
+	score := float64(info.StartedAt.UnixMilli())
+	expired := "(" + strconv.FormatInt(info.StartedAt.Add(-taskIndexTTL).UnixMilli(), 10)
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.taskKey(info.TaskID), out, taskIndexTTL)
+		for _, k := range keys {
+			pipe.ZAdd(ctx, k, &redis.Z{Score: score, Member: info.TaskID})
+			pipe.ZRemRangeByScore(ctx, k, "-inf", expired)
+			pipe.Expire(ctx, k, taskIndexTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// get returns the indexed task, or nil if it isn't indexed
+func (r *redisTaskIndex) get(ctx context.Context, id string) (*taskInfo, error) {
+	out, err := r.client.Get(ctx, r.taskKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := &taskInfo{}
+	if err := json.Unmarshal(out, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// list returns up to limit of the tasks in the account matching the filter, most recently started first.  The
+// index is read a page at a time until enough tasks match.
+func (r *redisTaskIndex) list(ctx context.Context, account string, filter taskFilter, limit int) ([]*taskInfo, error) {
+	key := r.accountKey(account)
+	switch {
+	case filter.FileSystemID != "":
+		key = r.fileSystemKey(account, filter.FileSystemID)
+	case filter.Group != "":
+		key = r.groupKey(account, filter.Group)
+	case filter.Operation != "":
+		key = r.operationKey(account, filter.Operation)
+	}
+
+	min := strconv.FormatInt(r.now().Add(-taskIndexTTL).UnixMilli(), 10)
+
+	tasks := []*taskInfo{}
+	for offset := int64(0); len(tasks) < limit; offset += taskIndexPageSize {
+		ids, err := r.client.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min:    min,
+			Max:    "+inf",
+			Offset: offset,
+			Count:  taskIndexPageSize,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		infos, err := r.read(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if filter.matches(info) && len(tasks) < limit {
+				tasks = append(tasks, info)
+			}
+		}
+
+		if len(ids) < taskIndexPageSize {
+			break
+		}
+	}
+
+	return tasks, nil
+}
+
+// read returns the indexed tasks with their status, skipping the tasks that expired from the index
+func (r *redisTaskIndex) read(ctx context.Context, ids []string) ([]*taskInfo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// the tasks are followed by their statuses
+	keys := make([]string, 2*len(ids))
+	for i, id := range ids {
+		keys[i] = r.taskKey(id)
+		keys[len(ids)+i] = r.statusKey(id)
+	}
+
+	out, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []*taskInfo{}
+	for i, o := range out[:len(ids)] {
+		j, ok := o.(string)
+		if !ok {
+			continue
+		}
+
+		info := &taskInfo{}
+		if err := json.Unmarshal([]byte(j), info); err != nil {
+			logger(ctx).Warnf("failed to unmarshal indexed task %s: %s", ids[i], err)
+			continue
+		}
+		info.Status, _ = out[len(ids)+i].(string)
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// setStatus sets the final status of the task for as long as it's indexed
+func (r *redisTaskIndex) setStatus(ctx context.Context, id, status string) error {
+	return r.client.Set(ctx, r.statusKey(id), status, taskIndexTTL).Err()
+}
+
+// indexTask adds the task to the task index.  Failing to index the task doesn't fail it, it just isn't listed.
+func (s *server) indexTask(ctx context.Context, info *taskInfo) {
+	if s.taskIndex == nil {
+		return
+	}
+
+	if err := s.taskIndex.add(ctx, info); err != nil {
+		logger(ctx).Errorf("failed to index task %s: %s", info.TaskID, err)
+	}
+}
+
+// setIndexedTaskStatus sets the final status of the task in the task index.  Failing to set it doesn't fail
+// the task, it's just listed as running.
+func (s *server) setIndexedTaskStatus(ctx context.Context, id, status string) {
+	if s.taskIndex == nil {
+		return
+	}
+
+	if err := s.taskIndex.setStatus(ctx, id, status); err != nil {
+		logger(ctx).Errorf("failed to set the status of indexed task %s: %s", id, err)
+	}
+}
+
+// listTasks returns up to limit of the most recent tasks in the account matching the filter, with their status.
+// The tasks are filtered by the task index and only the listed tasks are fetched from flywheel.
+func (s *server) listTasks(ctx context.Context, account string, filter taskFilter, limit int) ([]*TaskResponse, error) {
+	tasks := []*TaskResponse{}
+	if s.taskIndex == nil {
+		return tasks, nil
+	}
+
+	infos, err := s.taskIndex.list(ctx, account, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	fwTasks := make([]*flywheel.Task, len(infos))
+	errs := make([]error, len(infos))
+	sem := make(chan struct{}, taskFetchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, info := range infos {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fwTasks[i], errs[i] = s.flywheel.GetTask(ctx, id)
+		}(i, info.TaskID)
+	}
+	wg.Wait()
+
+	for i, info := range infos {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+
+		// the task expired from flywheel
+		task := fwTasks[i]
+		if task == nil {
+			continue
+		}
+
+		status := flywheelTaskStatus(task)
+		if info.Status == taskStatusCancelled && status == flywheel.STATUS_FAILED {
+			status = taskStatusCancelled
+		}
+
+		// the task finished after it was read from the index
+		if filter.Status != "" && filter.Status != status {
+			continue
+		}
+
+		tasks = append(tasks, &TaskResponse{
+			TaskID:       info.TaskID,
+			Operation:    info.Operation,
+			Group:        info.Group,
+			FileSystemID: info.FileSystemID,
+			RequestID:    info.RequestID,
+			Status:       status,
+			CreatedAt:    task.CreatedAt,
+			CheckinAt:    task.CheckinAt,
+			CompletedAt:  task.CompletedAt,
+			FailedAt:     task.FailedAt,
+			Failure:      task.Failure,
+		})
+	}
+
+	return tasks, nil
+}
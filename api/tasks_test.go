@@ -0,0 +1,471 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/flywheel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+func TestRunStepsCancelled(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store, orchestrations: newOrchestrations()}
+	task := flywheel.NewTask()
+
+	ctx, finished := s.cancellableOrchestration(context.Background(), task)
+	defer finished()
+
+	calls := []string{}
+	steps := testSteps("", &calls)
+	steps[0].Undo = func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			t.Error("expected rollback context not to be cancelled")
+		}
+		calls = append(calls, "rollback a")
+		return nil
+	}
+	steps[1].Do = func(ctx context.Context) error {
+		if !s.cancelOrchestration(task.ID) {
+			t.Error("expected orchestration to be cancelled")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	state := &orchestrationState{TaskID: task.ID}
+	if err := s.runSteps(ctx, state, steps, nil); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// the completed steps of a cancelled orchestration are rolled back
+	if expected := []string{"run a", "rollback a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	if !s.orchestrationCancelled(task.ID) {
+		t.Error("expected orchestration to be cancelled")
+	}
+
+	if _, ok := store.states[task.ID]; ok {
+		t.Error("expected state to be removed")
+	}
+
+	finished()
+	if s.orchestrationCancelled(task.ID) || s.cancelOrchestration(task.ID) {
+		t.Error("expected finished orchestration to be forgotten")
+	}
+}
+
+func TestCheckCancelRequested(t *testing.T) {
+	store := newTestOrchestrationStore()
+	s := server{orchestrationStore: store, orchestrations: newOrchestrations()}
+	task := flywheel.NewTask()
+
+	ctx, finished := s.cancellableOrchestration(context.Background(), task)
+	defer finished()
+
+	s.checkCancelRequested(context.TODO(), task.ID)
+	if ctx.Err() != nil {
+		t.Fatal("expected orchestration not to be cancelled")
+	}
+
+	store.cancels[task.ID] = true
+	s.checkCancelRequested(context.TODO(), task.ID)
+	if ctx.Err() == nil || !s.orchestrationCancelled(task.ID) {
+		t.Error("expected orchestration to be cancelled")
+	}
+}
+
+func TestTaskCancelHandler(t *testing.T) {
+	client := newTestRedis(t)
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestOrchestrationStore()
+	s := server{flywheel: manager, orchestrationStore: store, orchestrations: newOrchestrations(), taskIndex: newTaskIndex(client, "efsapi")}
+	s.config.Store(&dynamicConfig{accountsMap: map[string]string{"spinup": "1234567890"}})
+
+	// a finished task isn't running, its status is only returned to tokens allowed access to it
+	done := flywheel.NewTask()
+	if err := manager.Start(context.TODO(), done); err != nil {
+		t.Fatal(err)
+	}
+	s.indexTask(context.TODO(), &taskInfo{TaskID: done.ID, Operation: kindFilesystemUpdate, Account: "1234567890", Group: "space2", StartedAt: time.Now()})
+
+	local := flywheel.NewTask()
+	ctx, finished := s.cancellableOrchestration(context.Background(), local)
+	defer finished()
+
+	store.states[local.ID] = orchestrationState{TaskID: local.ID, Kind: kindFilesystemCreate, Account: "1234567890", Group: "space1"}
+	store.states["remote"] = orchestrationState{TaskID: "remote", Kind: kindFilesystemDelete, Account: "1234567890", Group: "space1"}
+	store.states["rollingback"] = orchestrationState{TaskID: "rollingback", Kind: kindFilesystemCreate, Account: "1234567890", Group: "space1", RollingBack: true}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/efs/tasks/{id}", s.TaskCancelHandler).Methods(http.MethodDelete)
+
+	request := func(id string, token *apiToken) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/v1/efs/tasks/"+id, nil)
+		req = req.WithContext(withToken(req.Context(), token))
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	writer := &apiToken{name: "provisioner", scope: scopeWrite}
+	tests := []struct {
+		id     string
+		token  *apiToken
+		status int
+	}{
+		{id: local.ID, token: &apiToken{name: "dashboard", scope: scopeRead}, status: http.StatusForbidden},
+		{id: local.ID, token: &apiToken{name: "other", scope: scopeWrite, accounts: []string{"0987654321"}}, status: http.StatusForbidden},
+		{id: local.ID, token: &apiToken{name: "other", scope: scopeWrite, groups: []string{"space2"}}, status: http.StatusForbidden},
+		{id: "rollingback", token: writer, status: http.StatusConflict},
+		{id: local.ID, token: &apiToken{name: "space", scope: scopeWrite, accounts: []string{"spinup"}, groups: []string{"space1"}}, status: http.StatusAccepted},
+		{id: "remote", token: writer, status: http.StatusAccepted},
+		{id: done.ID, token: &apiToken{name: "space", scope: scopeWrite, groups: []string{"space1"}}, status: http.StatusForbidden},
+		{id: "unknown", token: &apiToken{name: "space", scope: scopeWrite, groups: []string{"space1"}}, status: http.StatusForbidden},
+		{id: done.ID, token: writer, status: http.StatusConflict},
+		{id: "unknown", token: writer, status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		if rr := request(test.id, test.token); rr.Code != test.status {
+			t.Errorf("expected status %d cancelling %s with token %s, got %d", test.status, test.id, test.token.name, rr.Code)
+		}
+	}
+
+	// the orchestration running here is cancelled, the other one is requested in redis
+	if ctx.Err() == nil {
+		t.Error("expected local orchestration to be cancelled")
+	}
+
+	if !store.cancels["remote"] || store.cancels[local.ID] {
+		t.Errorf("expected cancellation to be requested for the remote orchestration only, got %v", store.cancels)
+	}
+}
+
+func TestFlywheelTasksHandler(t *testing.T) {
+	client := newTestRedis(t)
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server{flywheel: manager, taskIndex: newTaskIndex(client, "efsapi")}
+	s.config.Store(&dynamicConfig{accountsMap: map[string]string{"spinup": "1234567890"}})
+
+	space1 := flywheel.NewTask()
+	space2 := flywheel.NewTask()
+	unindexed := flywheel.NewTask()
+	for _, task := range []*flywheel.Task{space1, space2, unindexed} {
+		if err := manager.Start(context.TODO(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.indexTask(context.TODO(), &taskInfo{TaskID: space1.ID, Operation: kindFilesystemCreate, Account: "1234567890", Group: "space1", StartedAt: time.Now()})
+	s.indexTask(context.TODO(), &taskInfo{TaskID: space2.ID, Operation: kindFilesystemCreate, Account: "1234567890", Group: "space2", StartedAt: time.Now()})
+
+	request := func(token *apiToken, ids ...string) *httptest.ResponseRecorder {
+		url := "/v1/efs/flywheel"
+		if len(ids) > 0 {
+			url += "?task=" + strings.Join(ids, "&task=")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req = req.WithContext(withToken(req.Context(), token))
+
+		rr := httptest.NewRecorder()
+		s.FlywheelTasksHandler(rr, req)
+		return rr
+	}
+
+	reader := &apiToken{name: "dashboard", scope: scopeRead}
+	space := &apiToken{name: "space", scope: scopeRead, accounts: []string{"spinup"}, groups: []string{"space1"}}
+	tests := []struct {
+		name   string
+		token  *apiToken
+		ids    []string
+		status int
+	}{
+		{name: "group token reads its task", token: space, ids: []string{space1.ID}, status: http.StatusOK},
+		{name: "group token reads another group's task", token: space, ids: []string{space1.ID, space2.ID}, status: http.StatusForbidden},
+		{name: "group token reads an unindexed task", token: space, ids: []string{unindexed.ID}, status: http.StatusForbidden},
+		{name: "account token reads another account's task", token: &apiToken{name: "other", scope: scopeRead, accounts: []string{"0987654321"}}, ids: []string{space1.ID}, status: http.StatusForbidden},
+		{name: "unrestricted token reads every task", token: reader, ids: []string{space1.ID, space2.ID, unindexed.ID}, status: http.StatusOK},
+		{name: "no task", token: reader, status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		if rr := request(test.token, test.ids...); rr.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, rr.Code)
+		}
+	}
+
+	rr := request(space, space1.ID, "unknown-task")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected unknown tasks to be forbidden for group tokens, got %d", rr.Code)
+	}
+
+	rr = request(reader, space1.ID, "unknown-task")
+	tasks := map[string]*flywheel.Task{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[space1.ID] == nil {
+		t.Errorf("expected only task %s, got %v", space1.ID, tasks)
+	}
+
+	// cancelled tasks are failed in flywheel and returned as cancelled
+	s.markTaskCancelled(context.TODO(), space1.ID)
+	if err := manager.Fail(context.TODO(), space2.ID, "boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = request(reader, space1.ID, space2.ID)
+	tasks = map[string]*flywheel.Task{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	if task := tasks[space1.ID]; task == nil || task.Status != taskStatusCancelled || !strings.HasPrefix(task.Failure, "cancelled:") {
+		t.Errorf("expected task %s to be cancelled, got %+v", space1.ID, task)
+	}
+
+	if task := tasks[space2.ID]; task == nil || task.Status != flywheel.STATUS_FAILED {
+		t.Errorf("expected task %s to be failed, got %+v", space2.ID, task)
+	}
+}
+
+// newTestRedis returns a client for a miniredis server that's closed when the test finishes
+func newTestRedis(t *testing.T) *redis.Client {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisTaskIndex(t *testing.T) {
+	client := newTestRedis(t)
+
+	now := time.Now()
+	index := newTaskIndex(client, "efsapi")
+	index.now = func() time.Time { return now }
+
+	tasks := []*taskInfo{
+		{TaskID: "old", Operation: kindFilesystemCreate, Account: "1234567890", Group: "space1", FileSystemID: "fs-1", StartedAt: now.Add(-25 * time.Hour)},
+		{TaskID: "create", Operation: kindFilesystemCreate, Account: "1234567890", Group: "space1", FileSystemID: "fs-1", StartedAt: now.Add(-2 * time.Hour)},
+		{TaskID: "ap", Operation: kindAccessPointCreate, Account: "1234567890", Group: "space1", FileSystemID: "fs-1", StartedAt: now.Add(-time.Hour)},
+		{TaskID: "delete", Operation: kindFilesystemDelete, Account: "1234567890", Group: "space2", FileSystemID: "fs-2", StartedAt: now},
+		{TaskID: "other", Operation: kindFilesystemDelete, Account: "0987654321", Group: "space1", FileSystemID: "fs-3", StartedAt: now},
+	}
+
+	for _, task := range tasks {
+		if err := index.add(context.TODO(), task); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	tests := []struct {
+		filter   taskFilter
+		expected []string
+	}{
+		{filter: taskFilter{}, expected: []string{"delete", "ap", "create"}},
+		{filter: taskFilter{Group: "space1"}, expected: []string{"ap", "create"}},
+		{filter: taskFilter{FileSystemID: "fs-1", Operation: kindFilesystemCreate}, expected: []string{"create"}},
+		{filter: taskFilter{Operation: kindFilesystemDelete}, expected: []string{"delete"}},
+		{filter: taskFilter{Group: "space3"}, expected: []string{}},
+		{filter: taskFilter{Status: flywheel.STATUS_RUNNING}, expected: []string{"delete", "create"}},
+		{filter: taskFilter{Status: flywheel.STATUS_COMPLETED}, expected: []string{"ap"}},
+	}
+
+	if err := index.setStatus(context.TODO(), "ap", flywheel.STATUS_COMPLETED); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	for _, test := range tests {
+		out, err := index.list(context.TODO(), "1234567890", test.filter, 10)
+		if err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+
+		ids := []string{}
+		for _, o := range out {
+			ids = append(ids, o.TaskID)
+		}
+
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("expected tasks %v for filter %+v, got %v", test.expected, test.filter, ids)
+		}
+	}
+}
+
+func TestRedisTaskIndexPages(t *testing.T) {
+	client := newTestRedis(t)
+
+	now := time.Now()
+	index := newTaskIndex(client, "efsapi")
+	index.now = func() time.Time { return now }
+
+	// the oldest tasks are on the last page
+	for i := 0; i < 2*taskIndexPageSize+50; i++ {
+		id := fmt.Sprintf("task-%03d", i)
+		info := &taskInfo{TaskID: id, Operation: kindFilesystemCreate, Account: "1234567890", Group: "space1", StartedAt: now.Add(-time.Duration(i) * time.Second)}
+		if err := index.add(context.TODO(), info); err != nil {
+			t.Fatal(err)
+		}
+
+		if i >= 2*taskIndexPageSize+45 {
+			if err := index.setStatus(context.TODO(), id, flywheel.STATUS_FAILED); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	out, err := index.list(context.TODO(), "1234567890", taskFilter{}, 3)
+	if err != nil || len(out) != 3 || out[0].TaskID != "task-000" {
+		t.Errorf("expected the 3 most recent tasks, got %d tasks, %v", len(out), err)
+	}
+
+	out, err = index.list(context.TODO(), "1234567890", taskFilter{Status: flywheel.STATUS_FAILED}, 3)
+	if err != nil || len(out) != 3 || out[0].TaskID != "task-245" || out[2].TaskID != "task-247" {
+		t.Errorf("expected the 3 most recent failed tasks from the last page, got %+v, %v", out, err)
+	}
+
+	if out, _ := index.list(context.TODO(), "1234567890", taskFilter{Status: flywheel.STATUS_FAILED}, 10); len(out) != 5 {
+		t.Errorf("expected 5 failed tasks, got %d", len(out))
+	}
+}
+
+func TestTaskListHandler(t *testing.T) {
+	client := newTestRedis(t)
+
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server{flywheel: manager, taskIndex: newTaskIndex(client, "efsapi")}
+	s.config.Store(&dynamicConfig{accountsMap: map[string]string{"spinup": "1234567890"}})
+
+	ctx := context.TODO()
+	for i, status := range []string{flywheel.STATUS_COMPLETED, flywheel.STATUS_FAILED, flywheel.STATUS_RUNNING} {
+		task := flywheel.NewTask()
+		if err := manager.Start(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+
+		switch status {
+		case flywheel.STATUS_COMPLETED:
+			err = manager.Complete(ctx, task.ID)
+		case flywheel.STATUS_FAILED:
+			err = manager.Fail(ctx, task.ID, "boom")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.indexTask(ctx, &taskInfo{
+			TaskID:       task.ID,
+			Operation:    kindFilesystemCreate,
+			Account:      "1234567890",
+			Group:        "space1",
+			FileSystemID: "fs-1",
+			StartedAt:    time.Now().Add(time.Duration(i) * time.Second),
+		})
+
+		// the task tracking sets the final status in the index
+		if status != flywheel.STATUS_RUNNING {
+			s.setIndexedTaskStatus(ctx, task.ID, status)
+		}
+	}
+
+	// cancelled tasks are failed in flywheel and listed as cancelled
+	cancelled := flywheel.NewTask()
+	if err := manager.Start(ctx, cancelled); err != nil {
+		t.Fatal(err)
+	}
+	s.indexTask(ctx, &taskInfo{TaskID: cancelled.ID, Operation: kindFilesystemDelete, Account: "1234567890", Group: "space2", StartedAt: time.Now().Add(-time.Second)})
+	s.markTaskCancelled(ctx, cancelled.ID)
+
+	if task, _ := manager.GetTask(ctx, cancelled.ID); task.Status != flywheel.STATUS_FAILED {
+		t.Errorf("expected cancelled task to be failed in flywheel, got %s", task.Status)
+	}
+
+	// indexed tasks that expired from flywheel aren't listed
+	s.indexTask(ctx, &taskInfo{TaskID: "expired", Operation: kindFilesystemDelete, Account: "1234567890", Group: "space1", StartedAt: time.Now()})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/efs/{account}/tasks", s.TaskListHandler).Methods(http.MethodGet)
+
+	list := func(query string, token *apiToken) ([]*TaskResponse, int) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/efs/spinup/tasks"+query, nil)
+		req = req.WithContext(withToken(req.Context(), token))
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		out := []*TaskResponse{}
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return out, rr.Code
+	}
+
+	reader := &apiToken{name: "dashboard", scope: scopeRead}
+
+	out, code := list("?group=space1", reader)
+	if code != http.StatusOK || len(out) != 3 {
+		t.Fatalf("expected 3 tasks, got %d (%d)", len(out), code)
+	}
+
+	if out[0].Status != flywheel.STATUS_RUNNING || out[2].Status != flywheel.STATUS_COMPLETED {
+		t.Errorf("expected most recent tasks first, got %s then %s", out[0].Status, out[2].Status)
+	}
+
+	if out[0].Operation != kindFilesystemCreate || out[0].Group != "space1" || out[0].FileSystemID != "fs-1" {
+		t.Errorf("unexpected task %+v", out[0])
+	}
+
+	if out, _ := list("?status=failed", reader); len(out) != 1 || out[0].Failure != "boom" {
+		t.Errorf("expected the failed task, got %+v", out)
+	}
+
+	if out, _ := list("?status=cancelled", reader); len(out) != 1 || out[0].TaskID != cancelled.ID || out[0].Failure != errTaskCancelled.Error() {
+		t.Errorf("expected the cancelled task, got %+v", out)
+	}
+
+	if out, _ := list("?fs=fs-1&limit=2", reader); len(out) != 2 {
+		t.Errorf("expected 2 tasks, got %d", len(out))
+	}
+
+	if _, code := list("?limit=0", reader); code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid limit, got %d", code)
+	}
+
+	// tokens restricted to groups must pass one of their groups
+	grouped := &apiToken{name: "space", scope: scopeRead, groups: []string{"space1"}}
+	if _, code := list("", grouped); code != http.StatusForbidden {
+		t.Errorf("expected forbidden without a group, got %d", code)
+	}
+
+	if out, code := list("?group=space1", grouped); code != http.StatusOK || len(out) != 3 {
+		t.Errorf("expected 3 tasks in the group, got %d (%d)", len(out), code)
+	}
+}
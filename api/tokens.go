@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// scope is the level of access granted to a token, each scope includes the scopes below it
+type scope int
+
+const (
+	scopeRead scope = iota + 1
+	scopeWrite
+	scopeAdmin
+)
+
+const tokenContextKey contextKey = "token"
+
+// defaultTokenName is the name of the token configured with the legacy `token` setting
+const defaultTokenName = "default"
+
+var scopeNames = map[string]scope{
+	"read":  scopeRead,
+	"write": scopeWrite,
+	"admin": scopeAdmin,
+}
+
+func (sc scope) String() string {
+	for name, s := range scopeNames {
+		if s == sc {
+			return name
+		}
+	}
+	return "none"
+}
+
+// apiToken is an authenticated API token
+type apiToken struct {
+	name     string
+	secret   []byte
+	scope    scope
+	accounts []string
+	groups   []string
+}
+
+// newAPITokens returns the API tokens from the configuration.  The legacy `token` setting is an admin
+// token without any account or group restrictions.
+func newAPITokens(config common.Config) []*apiToken {
+	tokens := []*apiToken{}
+
+	if config.Token != "" {
+		tokens = append(tokens, &apiToken{
+			name:   defaultTokenName,
+			secret: []byte(config.Token),
+			scope:  scopeAdmin,
+		})
+	}
+
+	for _, t := range config.Tokens {
+		token := &apiToken{
+			name:     t.Name,
+			secret:   []byte(t.Token),
+			accounts: t.Accounts,
+			groups:   t.Groups,
+		}
+
+		for _, name := range t.Scopes {
+			if sc := scopeNames[name]; sc > token.scope {
+				token.scope = sc
+			}
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// authenticateToken returns the token matching the X-Auth-Token header, or nil if none match.  The header can
+// be prefixed with the name of the token (`<name>:<hash>`) so only that token is compared, otherwise every
+// configured token is compared until one matches.
+func authenticateToken(tokens []*apiToken, htoken string) *apiToken {
+	if htoken == "" {
+		return nil
+	}
+
+	// bcrypt hashes don't contain a colon, so anything before one is the name of the token
+	name, hash, named := strings.Cut(htoken, ":")
+	if !named {
+		hash = htoken
+	}
+
+	for _, t := range tokens {
+		if len(t.secret) == 0 || (named && t.name != name) {
+			continue
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), t.secret); err == nil {
+			return t
+		}
+
+		if named {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// withToken returns a copy of the context carrying the authenticated token
+func withToken(ctx context.Context, token *apiToken) context.Context {
+	return context.WithValue(ctx, tokenContextKey, token)
+}
+
+// tokenFromContext returns the authenticated token carried in the context, or nil
+func tokenFromContext(ctx context.Context) *apiToken {
+	if token, ok := ctx.Value(tokenContextKey).(*apiToken); ok {
+		return token
+	}
+	return nil
+}
+
+// tokenName returns the name of the authenticated token carried in the context, or the empty string
+func tokenName(ctx context.Context) string {
+	if token := tokenFromContext(ctx); token != nil {
+		return token.name
+	}
+	return ""
+}
+
+// authenticate returns the token for a request authenticated with an OIDC bearer token in the
+// Authorization header or a pre-shared key in the X-Auth-Token header, or nil
+func (s *server) authenticate(r *http.Request) *apiToken {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && s.oidc != nil {
+		token, err := s.oidc.authenticate(r.Context(), bearer)
+		if err != nil {
+			log.Warnf("invalid bearer token for '%s': %s", r.URL, err)
+			return nil
+		}
+		return token
+	}
+
+	return authenticateToken(s.conf().tokens, r.Header.Get("X-Auth-Token"))
+}
+
+// scoped wraps a handler and only allows requests authenticated with a token that has at least the
+// required scope and is allowed to access the account and group in the request
+func (s *server) scoped(required scope, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if !s.tokenAllowed(tokenFromContext(r.Context()), required, vars["account"], vars["group"], r.URL.String()) {
+			handleError(w, errTokenNotAllowed)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// tokenAllowed checks that the token has the required scope and is allowed access to the account and group
+func (s *server) tokenAllowed(token *apiToken, required scope, account, group, url string) bool {
+	if token == nil {
+		log.Warnf("no authenticated token for '%s'", url)
+		return false
+	}
+
+	if token.scope < required {
+		log.Warnf("token %s with scope %s is not allowed %s scope for '%s'", token.name, token.scope, required, url)
+		return false
+	}
+
+	if !s.tokenAllowsAccount(token, account) {
+		log.Warnf("token %s is not allowed access to account %s", token.name, account)
+		return false
+	}
+
+	if !tokenAllowsGroup(token, group) {
+		log.Warnf("token %s is not allowed access to group %s", token.name, group)
+		return false
+	}
+
+	return true
+}
+
+// tokenAllowsAccount checks the account allowlist of the token.  Accounts can be allowed by name or number.
+func (s *server) tokenAllowsAccount(token *apiToken, account string) bool {
+	if len(token.accounts) == 0 {
+		return true
+	}
+
+	if account == "" {
+		return false
+	}
+
+	number := s.mapAccountNumber(account)
+	for _, a := range token.accounts {
+		if a == account || a == number || s.mapAccountNumber(a) == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenAllowsGroup checks the group allowlist of the token.  Tokens restricted to groups cannot access
+// routes that aren't scoped to a group.
+func tokenAllowsGroup(token *apiToken, group string) bool {
+	if len(token.groups) == 0 {
+		return true
+	}
+
+	for _, g := range token.groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewAPITokens(t *testing.T) {
+	tokens := newAPITokens(common.Config{
+		Token: "legacy",
+		Tokens: []common.Token{
+			{Name: "dashboard", Token: "readonly", Scopes: []string{"read"}},
+			{Name: "pipeline", Token: "provisioner", Scopes: []string{"read", "write"}, Accounts: []string{"spinup"}},
+		},
+	})
+
+	expected := map[string]scope{
+		defaultTokenName: scopeAdmin,
+		"dashboard":      scopeRead,
+		"pipeline":       scopeWrite,
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+
+	for _, token := range tokens {
+		if token.scope != expected[token.name] {
+			t.Errorf("expected token %s to have scope %s, got %s", token.name, expected[token.name], token.scope)
+		}
+	}
+
+	if tokens := newAPITokens(common.Config{}); len(tokens) != 0 {
+		t.Errorf("expected no tokens without configuration, got %d", len(tokens))
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	tokens := newAPITokens(common.Config{
+		Tokens: []common.Token{
+			{Name: "dashboard", Token: "readonly", Scopes: []string{"read"}},
+			{Name: "pipeline", Token: "provisioner", Scopes: []string{"write"}},
+		},
+	})
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("provisioner"), bcrypt.MinCost)
+	if token := authenticateToken(tokens, string(hash)); token == nil || token.name != "pipeline" {
+		t.Errorf("expected pipeline token, got %+v", token)
+	}
+
+	if token := authenticateToken(tokens, "pipeline:"+string(hash)); token == nil || token.name != "pipeline" {
+		t.Errorf("expected pipeline token by name, got %+v", token)
+	}
+
+	if token := authenticateToken(tokens, "dashboard:"+string(hash)); token != nil {
+		t.Errorf("expected nil token for the secret of another named token, got %+v", token)
+	}
+
+	if token := authenticateToken(tokens, "unknown:"+string(hash)); token != nil {
+		t.Errorf("expected nil token for unknown name, got %+v", token)
+	}
+
+	hash, _ = bcrypt.GenerateFromPassword([]byte("wrong"), bcrypt.MinCost)
+	if token := authenticateToken(tokens, string(hash)); token != nil {
+		t.Errorf("expected nil token for unknown secret, got %+v", token)
+	}
+
+	hash, _ = bcrypt.GenerateFromPassword([]byte(""), bcrypt.MinCost)
+	if token := authenticateToken([]*apiToken{{name: "empty"}}, string(hash)); token != nil {
+		t.Errorf("expected nil token for empty secret, got %+v", token)
+	}
+}
+
+func TestScoped(t *testing.T) {
+	s := server{}
+	s.config.Store(&dynamicConfig{
+		accountsMap: map[string]string{
+			"spinup":    "1234567890",
+			"spinupsec": "0987654321",
+		},
+	})
+
+	dashboard := &apiToken{name: "dashboard", scope: scopeRead}
+	pipeline := &apiToken{name: "pipeline", scope: scopeWrite, accounts: []string{"spinup"}}
+	space := &apiToken{name: "space", scope: scopeWrite, groups: []string{"space1"}}
+	admin := &apiToken{name: "admin", scope: scopeAdmin}
+
+	okHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name     string
+		token    *apiToken
+		required scope
+		vars     map[string]string
+		expect   int
+	}{
+		{name: "no token", required: scopeRead, expect: http.StatusForbidden},
+		{name: "read token reading", token: dashboard, required: scopeRead, vars: map[string]string{"account": "spinup"}, expect: http.StatusOK},
+		{name: "read token writing", token: dashboard, required: scopeWrite, vars: map[string]string{"account": "spinup"}, expect: http.StatusForbidden},
+		{name: "write token in allowed account", token: pipeline, required: scopeWrite, vars: map[string]string{"account": "spinup"}, expect: http.StatusOK},
+		{name: "write token in allowed account number", token: pipeline, required: scopeWrite, vars: map[string]string{"account": "1234567890"}, expect: http.StatusOK},
+		{name: "write token in other account", token: pipeline, required: scopeWrite, vars: map[string]string{"account": "spinupsec"}, expect: http.StatusForbidden},
+		{name: "write token as admin", token: pipeline, required: scopeAdmin, vars: map[string]string{"account": "spinup"}, expect: http.StatusForbidden},
+		{name: "group token in allowed group", token: space, required: scopeRead, vars: map[string]string{"account": "spinup", "group": "space1"}, expect: http.StatusOK},
+		{name: "group token in other group", token: space, required: scopeRead, vars: map[string]string{"account": "spinup", "group": "space2"}, expect: http.StatusForbidden},
+		{name: "group token without group", token: space, required: scopeRead, vars: map[string]string{"account": "spinup"}, expect: http.StatusForbidden},
+		{name: "admin token", token: admin, required: scopeAdmin, vars: map[string]string{"account": "spinupsec", "group": "space2"}, expect: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/efs/test", nil)
+		req = mux.SetURLVars(req, test.vars)
+		if test.token != nil {
+			req = req.WithContext(withToken(req.Context(), test.token))
+		}
+
+		rr := httptest.NewRecorder()
+		s.scoped(test.required, okHandler).ServeHTTP(rr, req)
+
+		if rr.Code != test.expect {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expect, rr.Code)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/service/efs"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -37,6 +38,9 @@ type FileSystemCreateRequest struct {
 	// Valid values are ENABLED | DISABLED
 	BackupPolicy string
 
+	// CallbackURL is an optional URL notified when the asynchronous task finishes
+	CallbackURL string
+
 	// KMSKeyId used to encrypt the filesystem
 	KmsKeyId string
 
@@ -70,6 +74,9 @@ type FileSystemUpdateRequest struct {
 	// Valid values are ENABLED | DISABLED
 	BackupPolicy string
 
+	// CallbackURL is an optional URL notified when the asynchronous task finishes
+	CallbackURL string
+
 	// After how long to transition to Infrequent Access storage
 	// Valid values: NONE | AFTER_7_DAYS | AFTER_14_DAYS | AFTER_30_DAYS | AFTER_60_DAYS | AFTER_90_DAYS
 	LifeCycleConfiguration string
@@ -82,9 +89,6 @@ type FileSystemUpdateRequest struct {
 	Tags []*Tag
 }
 
-// listFileSystemsResponse is the response for a list filesystems request
-type listFileSystemsResponse []string
-
 // FileSystemResponse represents a full filesystem service response
 //
 // A filesystem can have zero or more mount targets and zero or more access points.
@@ -140,6 +144,9 @@ type FileSystemResponse struct {
 	// If true, the filesystem is using the EFS OneZone storage classes
 	OneZone bool
 
+	// The region the filesystem is in.
+	Region string
+
 	// The latest known metered size (in bytes) of data stored in the file system,
 	// in its Value field, and the time at which that size was determined in its
 	// Timestamp field. The Timestamp value is the integer number of seconds since
@@ -255,6 +262,281 @@ type FileSystemUserUpdateRequest struct {
 	ResetKey bool
 }
 
+// FileSystemCostResponse is the estimated monthly cost of a filesystem
+type FileSystemCostResponse struct {
+	// Alternatives is the estimated monthly cost under each lifecycle configuration
+	Alternatives []*CostAlternative
+
+	// Currency of all of the costs in the response
+	Currency string
+
+	// The ID of the file system, assigned by Amazon EFS.
+	FileSystemId string
+
+	// The current lifecycle transition policy.
+	LifeCycleConfiguration string
+
+	// LineItems are the individual charges that make up the monthly cost
+	LineItems []*CostLineItem
+
+	// MonthlyCost is the estimated total monthly cost
+	MonthlyCost float64
+
+	// The name of the filesystem.
+	Name string
+
+	// Region the filesystem was priced in
+	Region string
+
+	// StorageClass is the storage class of the filesystem, Standard | OneZone
+	StorageClass string
+
+	// ThroughputMode of the filesystem, bursting | provisioned | elastic
+	ThroughputMode string
+}
+
+// CostLineItem is an individual charge in a cost estimate
+type CostLineItem struct {
+	Cost        float64
+	Description string
+	Quantity    float64
+	Rate        float64
+	Unit        string
+}
+
+// CostAlternative is the estimated cost of a filesystem under a lifecycle configuration
+type CostAlternative struct {
+	// If true, this is the current lifecycle configuration of the filesystem
+	Current bool
+
+	// LifeCycleConfiguration is the lifecycle transition policy being estimated
+	LifeCycleConfiguration string
+
+	// MonthlyCost is the estimated total monthly cost with the lifecycle configuration
+	MonthlyCost float64
+
+	// Savings compared to the current monthly cost, negative values are increases
+	Savings float64
+}
+
+// GroupCostResponse is the rollup of the estimated monthly cost of all filesystems in a group
+type GroupCostResponse struct {
+	Currency    string
+	FileSystems []*FileSystemCostResponse
+	Group       string
+	MonthlyCost float64
+}
+
+// QuotaResponse is the quota and current usage for a group/space
+type QuotaResponse struct {
+	Group  string
+	Limits *QuotaLimits
+	Usage  *QuotaUsage
+}
+
+// QuotaLimits are the resource limits for a group/space, zero is unlimited
+type QuotaLimits struct {
+	FileSystems               int
+	AccessPointsPerFileSystem int
+	UsersPerFileSystem        int
+	StorageGB                 int
+}
+
+// QuotaUsage is the current resource usage for a group/space
+type QuotaUsage struct {
+	// FileSystems is the number of filesystems in the space
+	FileSystems int
+
+	// StorageBytes is the total metered size of the filesystems in the space
+	StorageBytes int64
+
+	// FileSystemUsage is the usage of each filesystem, keyed by filesystem id
+	FileSystemUsage map[string]*FileSystemQuotaUsage
+}
+
+// FileSystemQuotaUsage is the current resource usage for a filesystem
+type FileSystemQuotaUsage struct {
+	AccessPoints int
+	Users        int
+	StorageBytes int64
+}
+
+// TaskResponse is the status of an asynchronous task and the filesystem it operates on
+type TaskResponse struct {
+	TaskID       string
+	Operation    string
+	Group        string
+	FileSystemID string
+	RequestID    string `json:",omitempty"`
+	Status       string
+	CreatedAt    string
+	CheckinAt    string `json:",omitempty"`
+	CompletedAt  string `json:",omitempty"`
+	FailedAt     string `json:",omitempty"`
+	Failure      string `json:",omitempty"`
+}
+
+// SpaceTeardownResponse lists the filesystems deleted, or planned to be deleted, with a space (group)
+type SpaceTeardownResponse struct {
+	Group string
+	// DryRun is true if the filesystems were only listed and not deleted
+	DryRun bool
+	// TaskID is the id of the parent task deleting the filesystems
+	TaskID      string `json:",omitempty"`
+	FileSystems []*SpaceTeardownResult
+}
+
+// SpaceTeardownResult is the status of the deletion of a filesystem in a space
+type SpaceTeardownResult struct {
+	FileSystemId string
+	// Status is planned | pending | deleted | failed
+	Status string
+	// TaskID is the id of the filesystem delete task
+	TaskID string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// FileSystemSpec is the desired state of a filesystem, applied by name.  Fields left out of the spec aren't
+// managed and keep their current values, or get the defaults of a filesystem create when the filesystem doesn't
+// exist yet.  A list in the spec is the complete list, an empty list removes all of the resources.
+type FileSystemSpec struct {
+	// AccessPoints are the access points of the filesystem, matched by name
+	AccessPoints []*AccessPointSpec
+
+	// AccessPolicy is a set of flags to control access to the filesystem
+	AccessPolicy *FileSystemAccessPolicy
+
+	// BackupPolicy is the backup policy/status for the filesystem
+	// Valid values are ENABLED | DISABLED
+	BackupPolicy string
+
+	// CallbackURL is an optional URL notified when the asynchronous task finishes
+	CallbackURL string
+
+	// After how long to transition to Infrequent Access storage
+	// Valid values: NONE | AFTER_7_DAYS | AFTER_14_DAYS | AFTER_30_DAYS | AFTER_60_DAYS | AFTER_90_DAYS
+	LifeCycleConfiguration string
+
+	// Rule for transitioning back to the primary storage class from IA
+	// Valid values: NONE | AFTER_1_ACCESS
+	TransitionToPrimaryStorageClass string
+
+	// OneZone creates the filesystem using the EFS OneZone storage classes, it can't be changed once the
+	// filesystem is created
+	OneZone *bool
+
+	// Security Group IDs of the mount targets
+	Sgs []string
+
+	// Subnets of the mount targets
+	Subnets []string
+
+	// Tags of the filesystem
+	Tags []*Tag
+
+	// Users are the names of the filesystem users
+	Users []string
+}
+
+// AccessPointSpec is the desired state of an access point.  Access points can't be changed, an access point
+// with a different POSIX user or root directory is replaced.
+type AccessPointSpec struct {
+	Name string
+	// https://docs.aws.amazon.com/sdk-for-go/api/service/efs/#PosixUser
+	PosixUser *efs.PosixUser
+	// https://docs.aws.amazon.com/sdk-for-go/api/service/efs/#CreationInfo
+	RootDirectory *efs.RootDirectory
+}
+
+// FileSystemSpecPlan is the list of changes applying a filesystem spec
+type FileSystemSpecPlan struct {
+	Group string
+	Name  string
+	// FileSystemId is empty when the filesystem is created by the plan
+	FileSystemId string `json:",omitempty"`
+	// DryRun is true if the plan was only computed and not applied
+	DryRun bool
+	// TaskID is the id of the task applying the plan, empty if there are no changes
+	TaskID  string `json:",omitempty"`
+	Changes []*SpecChange
+}
+
+// SpecChange is a change of a filesystem spec plan
+type SpecChange struct {
+	// Action is create | update | delete | replace
+	Action string
+	// Resource is filesystem | backupPolicy | lifeCycleConfiguration | transitionToPrimaryStorageClass |
+	// accessPolicy | tag | mountTarget | accessPoint | user
+	Resource string
+	// ID of the changed resource, the subnet of a mount target or the name of an access point or user
+	ID string `json:",omitempty"`
+	// From and To are the current and the desired values of an update
+	From string `json:",omitempty"`
+	To   string `json:",omitempty"`
+}
+
+// FileSystemDrift is the result of the latest comparison of a filesystem with its last applied configuration by
+// the reconciler
+type FileSystemDrift struct {
+	Group        string
+	Name         string
+	FileSystemId string
+	// Status is inSync | drifted | repairing | skipped | failed
+	Status string
+	// Reason a filesystem was skipped or failed
+	Reason string `json:",omitempty"`
+	// TaskID is the id of the task repairing the drift
+	TaskID string `json:",omitempty"`
+	// Changes are the changes that would make the filesystem match its last applied configuration
+	Changes   []*SpecChange
+	CheckedAt string
+}
+
+// Orphan is a resource left behind by a partially failed filesystem create or delete
+type Orphan struct {
+	// ID identifies the orphan in a cleanup request, <type>:<resource>
+	ID string
+	// Type is user | group | filesystem | accessPoint
+	Type string
+	// Resource is the name of the IAM user or group, or the id of the filesystem or access point
+	Resource string
+	// Region is the region of the filesystem or access point, IAM users and groups are global
+	Region       string `json:",omitempty"`
+	Group        string `json:",omitempty"`
+	FileSystemId string `json:",omitempty"`
+	Reason       string
+}
+
+// OrphanCleanupRequest selects the orphans to delete by their ids
+type OrphanCleanupRequest struct {
+	Orphans []string
+	// CallbackURL is an optional URL notified when the asynchronous task finishes
+	CallbackURL string
+}
+
+// OrphanCleanupResponse lists the orphans deleted by the cleanup task
+type OrphanCleanupResponse struct {
+	TaskID  string
+	Orphans []*Orphan
+}
+
+// ErrorResponse is the body of every error response.  Code is one of the apierror codes (BadRequest, Forbidden,
+// NotFound, Conflict, LimitExceeded, ServiceUnavailable or InternalError).
+type ErrorResponse struct {
+	Code         string
+	Message      string
+	RequestID    string        `json:",omitempty"`
+	AWSErrorCode string        `json:",omitempty"`
+	AWSRequestID string        `json:",omitempty"`
+	FieldErrors  []*FieldError `json:",omitempty"`
+}
+
+// FieldError is a validation error of a field of the request
+type FieldError struct {
+	Field   string
+	Message string
+}
+
 // fileSystemFromEFS maps an EFS filesystem, list of moutn targets, and list of access points to a common struct
 func fileSystemResponseFromEFS(fs *efs.FileSystemDescription, mts []*efs.MountTargetDescription, aps []*efs.AccessPointDescription, policy *FileSystemAccessPolicy, backup, ia, primary string) *FileSystemResponse {
 	log.Debugf("mapping filesystem %s", awsutil.Prettify(fs))
@@ -271,6 +553,10 @@ func fileSystemResponseFromEFS(fs *efs.FileSystemDescription, mts []*efs.MountTa
 		NumberOfMountTargets: aws.Int64Value(fs.NumberOfMountTargets),
 	}
 
+	if a, err := arn.Parse(filesystem.FileSystemArn); err == nil {
+		filesystem.Region = a.Region
+	}
+
 	if fs.AvailabilityZoneName != nil {
 		filesystem.OneZone = true
 		filesystem.AvailabilityZone = aws.StringValue(fs.AvailabilityZoneName)
@@ -339,6 +625,8 @@ func fileSystemResponseFromEFS(fs *efs.FileSystemDescription, mts []*efs.MountTa
 // AccessPointCreateRequest is the input for creating an access point
 type AccessPointCreateRequest struct {
 	Name string
+	// CallbackURL is an optional URL notified when the asynchronous task finishes
+	CallbackURL string
 	// https://docs.aws.amazon.com/sdk-for-go/api/service/efs/#PosixUser
 	PosixUser *efs.PosixUser
 	// https://docs.aws.amazon.com/sdk-for-go/api/service/efs/#CreationInfo
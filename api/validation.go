@@ -0,0 +1,372 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// patterns caches the compiled patterns of the schemas
+var patterns sync.Map
+
+func compilePattern(pattern string) *regexp.Regexp {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	re := regexp.MustCompile(pattern)
+	patterns.Store(pattern, re)
+	return re
+}
+
+// ValidationMiddleware validates the path parameters and the JSON body of requests against the OpenAPI document
+// before they are handled.  Requests for routes that aren't in the document aren't validated.
+func (s *server) ValidationMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || s.openAPI == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		op := s.openAPI.operation(r.Method, path)
+		if op == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		fields := s.openAPI.validatePath(op, mux.Vars(r))
+
+		if op.RequestBody != nil {
+			var body []byte
+			if r.Body != nil {
+				if body, err = io.ReadAll(r.Body); err != nil {
+					handleError(w, apierror.New(apierror.ErrBadRequest, "failed to read request body", err))
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			// YAML bodies are converted to JSON, so they're validated and decoded like JSON bodies
+			if _, ok := op.RequestBody.Content["application/yaml"]; ok && isYAMLContentType(r.Header.Get("Content-Type")) {
+				if body, err = yamlToJSON(body); err != nil {
+					handleError(w, newValidationError(&FieldError{Field: "body", Message: fmt.Sprintf("request body is not valid YAML: %s", err)}))
+					return
+				}
+
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r.ContentLength = int64(len(body))
+				r.Header.Set("Content-Type", "application/json")
+
+				setAuditRequest(r.Context(), body)
+			}
+
+			fields = append(fields, s.openAPI.validateBody(op, body)...)
+		}
+
+		if len(fields) > 0 {
+			handleError(w, newValidationError(fields...))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestDocument is the OpenAPI document with the schemas requests are validated against when they aren't
+// passed through the ValidationMiddleware
+var requestDocument = sync.OnceValue(func() *openAPIDocument {
+	return newOpenAPIDocument("", apiOperations)
+})
+
+// validateRequest validates the request against the schema of its type, returning a validation error with all
+// of the invalid fields
+func validateRequest(req interface{}) error {
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	doc := requestDocument()
+	if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+		return apierror.New(apierror.ErrInternalError, fmt.Sprintf("no schema for request type %s", t.Name()), nil)
+	}
+
+	j, err := json.Marshal(req)
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to marshal request", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to unmarshal request", err)
+	}
+
+	if fields := doc.validateValue("", v, &openAPISchema{Ref: "#/components/schemas/" + t.Name()}); len(fields) > 0 {
+		return newValidationError(fields...)
+	}
+
+	return nil
+}
+
+// newRequestDecoder returns a JSON decoder for the request body that rejects unknown fields
+func newRequestDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec
+}
+
+// isYAMLContentType returns true if the content type is one of the YAML media types
+func isYAMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// yamlToJSON converts the YAML document to JSON, an empty document stays empty
+func yamlToJSON(body []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// validatePath validates the path parameters of the operation
+func (d *openAPIDocument) validatePath(op *openAPIOperation, vars map[string]string) []*FieldError {
+	fields := []*FieldError{}
+	for _, p := range op.Parameters {
+		if p.In != "path" || p.Schema == nil || p.Schema.Pattern == "" {
+			continue
+		}
+
+		if v := vars[p.Name]; !compilePattern(p.Schema.Pattern).MatchString(v) {
+			fields = append(fields, &FieldError{
+				Field:   p.Name,
+				Message: fmt.Sprintf("invalid %s %q, must match %s", p.Name, v, p.Schema.Pattern),
+			})
+		}
+	}
+	return fields
+}
+
+// validateBody validates the JSON request body of the operation
+func (d *openAPIDocument) validateBody(op *openAPIOperation, body []byte) []*FieldError {
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return []*FieldError{{Field: "body", Message: "request body is required"}}
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []*FieldError{{Field: "body", Message: fmt.Sprintf("request body is not valid JSON: %s", err)}}
+	}
+
+	return d.validateValue("", v, media.Schema)
+}
+
+// validateValue validates the value decoded from JSON against the schema, returning the errors of the field
+// and its nested fields.  Null values and empty strings are the zero values of the go types and are only
+// rejected for required fields.
+func (d *openAPIDocument) validateValue(field string, v interface{}, schema *openAPISchema) []*FieldError {
+	schema = d.resolve(schema)
+	if schema == nil || v == nil {
+		return nil
+	}
+
+	name := field
+	if name == "" {
+		name = "body"
+	}
+
+	invalid := func(format string, args ...interface{}) []*FieldError {
+		return []*FieldError{{Field: name, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return invalid("%s must be a string", name)
+		}
+
+		if s == "" {
+			return nil
+		}
+
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, s) {
+			return invalid("invalid %s %q, valid values are %s", name, s, strings.Join(schema.Enum, " | "))
+		}
+
+		if schema.Pattern != "" && !compilePattern(schema.Pattern).MatchString(s) {
+			return invalid("invalid %s %q, must match %s", name, s, schema.Pattern)
+		}
+
+		if schema.MinLength != nil && int64(len(s)) < *schema.MinLength {
+			return invalid("%s must be at least %d characters", name, *schema.MinLength)
+		}
+
+		if schema.MaxLength != nil && int64(len(s)) > *schema.MaxLength {
+			return invalid("%s must be at most %d characters", name, *schema.MaxLength)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return invalid("%s must be an integer", name)
+		}
+
+		i, err := n.Int64()
+		if err != nil {
+			return invalid("%s must be an integer", name)
+		}
+
+		if schema.Minimum != nil && i < *schema.Minimum {
+			return invalid("%s must be at least %d", name, *schema.Minimum)
+		}
+
+		if schema.Maximum != nil && i > *schema.Maximum {
+			return invalid("%s must be at most %d", name, *schema.Maximum)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return invalid("%s must be a number", name)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid("%s must be a boolean", name)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return invalid("%s must be an array", name)
+		}
+
+		fields := []*FieldError{}
+		for i, item := range items {
+			fields = append(fields, d.validateValue(fmt.Sprintf("%s[%d]", field, i), item, schema.Items)...)
+		}
+		return fields
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid("%s must be an object", name)
+		}
+
+		fields := []*FieldError{}
+		for _, r := range schema.Required {
+			if rv := objectField(obj, r); rv == nil || rv == "" {
+				fields = append(fields, &FieldError{Field: joinField(field, r), Message: fmt.Sprintf("%s is a required field", r)})
+			}
+		}
+
+		for _, k := range sortedKeys(obj) {
+			if ps := schemaProperty(schema, k); ps != nil {
+				fields = append(fields, d.validateValue(joinField(field, k), obj[k], ps)...)
+				continue
+			}
+
+			switch ap := schema.AdditionalProperties.(type) {
+			case *openAPISchema:
+				fields = append(fields, d.validateValue(joinField(field, k), obj[k], ap)...)
+			case bool:
+				if !ap {
+					fields = append(fields, &FieldError{Field: joinField(field, k), Message: fmt.Sprintf("unknown field %s", k)})
+				}
+			}
+		}
+		return fields
+	}
+
+	return nil
+}
+
+// joinField returns the path of the nested field
+func joinField(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+// sortedKeys returns the keys of the object in order, so errors are returned in a stable order
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// objectField returns the value of the field of the object, matching the field name case insensitively like
+// encoding/json does when decoding the body
+func objectField(obj map[string]interface{}, name string) interface{} {
+	if v, ok := obj[name]; ok {
+		return v
+	}
+
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// schemaProperty returns the schema of the property of the object schema, matching the property name case
+// insensitively like encoding/json does when decoding the body
+func schemaProperty(schema *openAPISchema, name string) *openAPISchema {
+	if ps, ok := schema.Properties[name]; ok {
+		return ps
+	}
+
+	for k, ps := range schema.Properties {
+		if strings.EqualFold(k, name) {
+			return ps
+		}
+	}
+	return nil
+}
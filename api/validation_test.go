@@ -0,0 +1,426 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/gorilla/mux"
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	s := &server{openAPI: newOpenAPIDocument("", apiOperations)}
+
+	handled := false
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+		w.WriteHeader(http.StatusOK)
+	}
+
+	create := func(w http.ResponseWriter, r *http.Request) {
+		// the body is still readable by the handler
+		req := FileSystemCreateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name != "myfs" {
+			t.Errorf("expected handler to decode body, got %+v (%v)", req, err)
+		}
+		ok(w, r)
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/v1/efs").Subrouter()
+	api.Use(s.ValidationMiddleware)
+	api.HandleFunc("/{account}/filesystems/{group}", create).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/filesystems/{group}/{id}", ok).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/notdocumented", ok).Methods(http.MethodPost)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		handled bool
+		fields  []string
+	}{
+		{
+			name:    "valid create",
+			method:  http.MethodPost,
+			path:    "/v1/efs/spinup/filesystems/space-1",
+			body:    `{"Name": "myfs", "BackupPolicy": "ENABLED", "Tags": [{"Key": "foo", "Value": "bar"}]}`,
+			handled: true,
+		},
+		{
+			name:    "field names are case insensitive",
+			method:  http.MethodPost,
+			path:    "/v1/efs/spinup/filesystems/space-1",
+			body:    `{"name": "myfs"}`,
+			handled: true,
+		},
+		{
+			name:   "missing body",
+			method: http.MethodPost,
+			path:   "/v1/efs/spinup/filesystems/space-1",
+			fields: []string{"body"},
+		},
+		{
+			name:   "invalid json",
+			method: http.MethodPost,
+			path:   "/v1/efs/spinup/filesystems/space-1",
+			body:   `{"Name": `,
+			fields: []string{"body"},
+		},
+		{
+			name:   "invalid fields",
+			method: http.MethodPost,
+			path:   "/v1/efs/spinup/filesystems/space-1",
+			body:   `{"BackupPolicy": "MAYBE", "OneZone": "yes", "AccessPoints": [{"PosixUser": {"Uid": "abc"}}]}`,
+			fields: []string{"Name", "AccessPoints[0].PosixUser.Gid", "AccessPoints[0].PosixUser.Uid", "BackupPolicy", "OneZone"},
+		},
+		{
+			name:   "unknown fields",
+			method: http.MethodPost,
+			path:   "/v1/efs/spinup/filesystems/space-1",
+			body:   `{"Name": "myfs", "LifecycleConfig": "AFTER_7_DAYS", "Tags": [{"Key": "foo", "Val": "bar"}]}`,
+			fields: []string{"LifecycleConfig", "Tags[0].Val"},
+		},
+		{
+			name:    "valid filesystem id",
+			method:  http.MethodGet,
+			path:    "/v1/efs/spinup/filesystems/space-1/fs-0123abcd",
+			handled: true,
+		},
+		{
+			name:   "invalid filesystem id",
+			method: http.MethodGet,
+			path:   "/v1/efs/spinup/filesystems/space-1/myfs",
+			fields: []string{"id"},
+		},
+		{
+			name:    "route not in the document",
+			method:  http.MethodPost,
+			path:    "/v1/efs/spinup/notdocumented",
+			body:    `not json`,
+			handled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = false
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if handled != tt.handled {
+				t.Fatalf("expected handled %t, got %t (%d: %s)", tt.handled, handled, rr.Code, rr.Body.String())
+			}
+
+			if tt.handled {
+				return
+			}
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", rr.Code)
+			}
+
+			resp := ErrorResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			fields := []string{}
+			for _, f := range resp.FieldErrors {
+				fields = append(fields, f.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected field errors %v, got %v", tt.fields, resp.FieldErrors)
+			}
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    interface{}
+		fields []string
+	}{
+		{
+			name: "valid filesystem",
+			req: &FileSystemCreateRequest{
+				Name:                            "my-fs.1",
+				BackupPolicy:                    "ENABLED",
+				LifeCycleConfiguration:          "AFTER_30_DAYS",
+				TransitionToPrimaryStorageClass: "AFTER_1_ACCESS",
+				Sgs:                             []string{"sg-0123abcd"},
+				Tags:                            []*Tag{{Key: "CostCenter", Value: "1234 5678"}},
+			},
+		},
+		{
+			name: "invalid filesystem",
+			req: &FileSystemCreateRequest{
+				Name:                   "my fs!",
+				BackupPolicy:           "enabled",
+				LifeCycleConfiguration: "AFTER_1_DAY",
+				Sgs:                    []string{"default"},
+				Tags: []*Tag{
+					{Key: "", Value: "bar"},
+					{Key: strings.Repeat("k", maxTagKeyLength+1), Value: "bar"},
+					{Key: "foo", Value: "bar;baz"},
+				},
+			},
+			fields: []string{"BackupPolicy", "LifeCycleConfiguration", "Name", "Sgs[0]", "Tags[0].Key", "Tags[1].Key", "Tags[2].Value"},
+		},
+		{
+			name:   "missing filesystem name",
+			req:    &FileSystemCreateRequest{},
+			fields: []string{"Name"},
+		},
+		{
+			name:   "filesystem name too long",
+			req:    &FileSystemCreateRequest{Name: strings.Repeat("a", maxFileSystemNameLength+1)},
+			fields: []string{"Name"},
+		},
+		{
+			name:   "invalid update",
+			req:    &FileSystemUpdateRequest{TransitionToPrimaryStorageClass: "ALWAYS"},
+			fields: []string{"TransitionToPrimaryStorageClass"},
+		},
+		{
+			name: "valid access point",
+			req: &AccessPointCreateRequest{
+				Name:      "data",
+				PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000), SecondaryGids: aws.Int64Slice([]int64{0, maxPosixID})},
+				RootDirectory: &efs.RootDirectory{
+					Path:         aws.String("/data/shared"),
+					CreationInfo: &efs.CreationInfo{OwnerUid: aws.Int64(1000), OwnerGid: aws.Int64(1000), Permissions: aws.String("0755")},
+				},
+			},
+		},
+		{
+			name: "invalid access point",
+			req: &AccessPointCreateRequest{
+				PosixUser: &efs.PosixUser{Uid: aws.Int64(-1), Gid: aws.Int64(maxPosixID + 1), SecondaryGids: aws.Int64Slice([]int64{-5})},
+				RootDirectory: &efs.RootDirectory{
+					Path:         aws.String("data/../etc"),
+					CreationInfo: &efs.CreationInfo{OwnerUid: aws.Int64(1000), Permissions: aws.String("999")},
+				},
+			},
+			fields: []string{"PosixUser.Gid", "PosixUser.SecondaryGids[0]", "PosixUser.Uid", "RootDirectory.CreationInfo.OwnerGid", "RootDirectory.CreationInfo.Permissions", "RootDirectory.Path"},
+		},
+		{
+			name:   "root directory with a dot directory",
+			req:    &AccessPointCreateRequest{RootDirectory: &efs.RootDirectory{Path: aws.String("/data/..")}},
+			fields: []string{"RootDirectory.Path"},
+		},
+		{
+			name:   "root directory too deep",
+			req:    &AccessPointCreateRequest{RootDirectory: &efs.RootDirectory{Path: aws.String("/a/b/c/d/e")}},
+			fields: []string{"RootDirectory.Path"},
+		},
+		{
+			name: "valid user",
+			req:  &FileSystemUserCreateRequest{UserName: "jdoe+admin@yale.edu"},
+		},
+		{
+			name:   "invalid user",
+			req:    &FileSystemUserCreateRequest{UserName: "j doe"},
+			fields: []string{"UserName"},
+		},
+		{
+			name: "valid orphan cleanup",
+			req:  &OrphanCleanupRequest{Orphans: []string{"user:myfs-alice", "accessPoint:fsap-123"}},
+		},
+		{
+			name:   "invalid orphan cleanup",
+			req:    &OrphanCleanupRequest{Orphans: []string{"user:myfs-alice", "bucket:mybucket"}},
+			fields: []string{"Orphans[1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(tt.req)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Errorf("expected nil error, got %s", err)
+				}
+				return
+			}
+
+			aerr, ok := err.(apierror.Error)
+			if !ok || aerr.Code != apierror.ErrBadRequest {
+				t.Fatalf("expected bad request error, got %v", err)
+			}
+
+			fields := []string{}
+			for _, f := range aerr.OrigErr.(fieldErrors) {
+				fields = append(fields, f.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected field errors %v, got %v", tt.fields, aerr.OrigErr)
+			}
+		})
+	}
+}
+
+func TestNewRequestDecoder(t *testing.T) {
+	req := FileSystemCreateRequest{}
+	if err := newRequestDecoder(strings.NewReader(`{"Name": "myfs", "BackupPolcy": "ENABLED"}`)).Decode(&req); err == nil {
+		t.Error("expected error decoding unknown field, got nil")
+	}
+
+	if err := newRequestDecoder(strings.NewReader(`{"Name": "myfs", "BackupPolicy": "ENABLED"}`)).Decode(&req); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+}
+
+func TestValidationMiddlewareYAML(t *testing.T) {
+	s := &server{openAPI: newOpenAPIDocument("", apiOperations)}
+
+	var spec *FileSystemSpec
+	apply := func(w http.ResponseWriter, r *http.Request) {
+		spec = &FileSystemSpec{}
+		if err := newRequestDecoder(r.Body).Decode(spec); err != nil {
+			t.Errorf("expected handler to decode body, got %s", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/v1/efs").Subrouter()
+	api.Use(s.ValidationMiddleware)
+	api.HandleFunc("/{account}/filesystems/{group}/{name}/spec", apply).Methods(http.MethodPut)
+	api.HandleFunc("/{account}/filesystems/{group}", apply).Methods(http.MethodPost)
+
+	specYAML := `
+BackupPolicy: ENABLED
+Subnets:
+  - subnet-0123abcd
+AccessPoints:
+  - Name: data
+    PosixUser:
+      Uid: 1000
+      Gid: 1000
+Users:
+  - alice
+`
+
+	tests := []struct {
+		name        string
+		path        string
+		method      string
+		contentType string
+		body        string
+		fields      []string
+	}{
+		{
+			name:        "yaml spec",
+			path:        "/v1/efs/spinup/filesystems/space-1/myfs/spec",
+			method:      http.MethodPut,
+			contentType: "application/yaml",
+			body:        specYAML,
+		},
+		{
+			name:        "yaml spec with charset",
+			path:        "/v1/efs/spinup/filesystems/space-1/myfs/spec",
+			method:      http.MethodPut,
+			contentType: "text/yaml; charset=utf-8",
+			body:        specYAML,
+		},
+		{
+			name:        "json spec",
+			path:        "/v1/efs/spinup/filesystems/space-1/myfs/spec",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"BackupPolicy": "ENABLED", "Subnets": ["subnet-0123abcd"], "AccessPoints": [{"Name": "data", "PosixUser": {"Uid": 1000, "Gid": 1000}}], "Users": ["alice"]}`,
+		},
+		{
+			name:        "invalid yaml fields",
+			path:        "/v1/efs/spinup/filesystems/space-1/myfs/spec",
+			method:      http.MethodPut,
+			contentType: "application/yaml",
+			body:        "BackupPolicy: MAYBE\nAccessPoints:\n  - PosixUser:\n      Uid: 1000\n      Gid: 1000\n",
+			fields:      []string{"AccessPoints[0].Name", "BackupPolicy"},
+		},
+		{
+			name:        "malformed yaml",
+			path:        "/v1/efs/spinup/filesystems/space-1/myfs/spec",
+			method:      http.MethodPut,
+			contentType: "application/yaml",
+			body:        "BackupPolicy: [ENABLED",
+			fields:      []string{"body"},
+		},
+		{
+			name:        "invalid filesystem name",
+			path:        "/v1/efs/spinup/filesystems/space-1/my%20fs/spec",
+			method:      http.MethodPut,
+			contentType: "application/yaml",
+			body:        specYAML,
+			fields:      []string{"name"},
+		},
+		{
+			name:        "yaml isn't accepted by other routes",
+			path:        "/v1/efs/spinup/filesystems/space-1",
+			method:      http.MethodPost,
+			contentType: "application/yaml",
+			body:        "Name: myfs\n",
+			fields:      []string{"body"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec = nil
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if tt.fields == nil {
+				if rr.Code != http.StatusOK || spec == nil {
+					t.Fatalf("expected spec to be handled, got %d: %s", rr.Code, rr.Body.String())
+				}
+
+				expected := &FileSystemSpec{
+					BackupPolicy: "ENABLED",
+					Subnets:      []string{"subnet-0123abcd"},
+					AccessPoints: []*AccessPointSpec{{Name: "data", PosixUser: &efs.PosixUser{Uid: aws.Int64(1000), Gid: aws.Int64(1000)}}},
+					Users:        []string{"alice"},
+				}
+
+				if !reflect.DeepEqual(expected, spec) {
+					t.Errorf("expected spec %+v, got %+v", expected, spec)
+				}
+				return
+			}
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rr.Code)
+			}
+
+			resp := ErrorResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			fields := []string{}
+			for _, f := range resp.FieldErrors {
+				fields = append(fields, f.Field)
+			}
+
+			if !reflect.DeepEqual(tt.fields, fields) {
+				t.Errorf("expected field errors %v, got %v", tt.fields, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/YaleSpinup/efs-api/waiter"
+)
+
+// the resource types with their own waiter timeout
+const (
+	waitFileSystem  = "fileSystem"
+	waitMountTarget = "mountTarget"
+	waitAccessPoint = "accessPoint"
+	waitTask        = "task"
+)
+
+// taskAccessPoints is the number of access points a nested filesystem create is expected to wait for when
+// the task timeout is derived from the other timeouts
+const taskAccessPoints = 10
+
+// defaultWaiterTimeouts are the maximum durations of the waits for each resource type
+var defaultWaiterTimeouts = withTaskTimeout(map[string]time.Duration{
+	waitFileSystem:  5 * time.Minute,
+	waitMountTarget: 10 * time.Minute,
+	waitAccessPoint: 2 * time.Minute,
+})
+
+// withTaskTimeout sets the task timeout, unless it's set, to the longest a nested filesystem create can take:
+// the waits for the filesystem, its mount targets and taskAccessPoints access points, plus the wait for the
+// mount targets to be deleted if it's rolled back
+func withTaskTimeout(timeouts map[string]time.Duration) map[string]time.Duration {
+	if _, ok := timeouts[waitTask]; !ok {
+		timeouts[waitTask] = timeouts[waitFileSystem] + 2*timeouts[waitMountTarget] + taskAccessPoints*timeouts[waitAccessPoint]
+	}
+	return timeouts
+}
+
+// waiters are the waiters for each resource type
+type waiters map[string]*waiter.Waiter
+
+// newWaiters creates the waiters for each resource type from the configuration
+func newWaiters(config common.Waiters) (waiters, error) {
+	interval := 5 * time.Second
+	if config.Interval != "" {
+		i, err := time.ParseDuration(config.Interval)
+		if err != nil {
+			return nil, err
+		}
+		interval = i
+	}
+
+	configured := map[string]string{
+		waitFileSystem:  config.FileSystem,
+		waitMountTarget: config.MountTarget,
+		waitAccessPoint: config.AccessPoint,
+		waitTask:        config.Task,
+	}
+
+	timeouts := map[string]time.Duration{}
+	for resource, timeout := range defaultWaiterTimeouts {
+		// the default task timeout is derived from the configured timeouts
+		if resource == waitTask {
+			continue
+		}
+		timeouts[resource] = timeout
+	}
+
+	for resource, c := range configured {
+		if c == "" {
+			continue
+		}
+
+		t, err := time.ParseDuration(c)
+		if err != nil {
+			return nil, err
+		}
+		timeouts[resource] = t
+	}
+
+	w := waiters{}
+	for resource, timeout := range withTaskTimeout(timeouts) {
+		w[resource] = waiter.New(waiter.WithInterval(interval), waiter.WithTimeout(timeout))
+	}
+
+	return w, nil
+}
+
+// get returns the waiter for the resource type, with the default timeout if it's not configured
+func (w waiters) get(resource string) *waiter.Waiter {
+	if wt, ok := w[resource]; ok {
+		return wt
+	}
+	return waiter.New(waiter.WithTimeout(defaultWaiterTimeouts[resource]))
+}
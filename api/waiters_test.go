@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+)
+
+func TestNewWaiters(t *testing.T) {
+	w, err := newWaiters(common.Waiters{MountTarget: "20m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Duration{
+		waitFileSystem:  5 * time.Minute,
+		waitMountTarget: 20 * time.Minute,
+		waitAccessPoint: 2 * time.Minute,
+		// 5m for the filesystem, twice 20m for the mount targets and 10 times 2m for the access points
+		waitTask: 65 * time.Minute,
+	}
+
+	for resource, timeout := range expected {
+		if got := w.get(resource).Timeout(); got != timeout {
+			t.Errorf("expected %s timeout %s, got %s", resource, timeout, got)
+		}
+	}
+
+	// servers without configured waiters use the defaults
+	if got := (waiters(nil)).get(waitAccessPoint).Timeout(); got != 2*time.Minute {
+		t.Errorf("expected default access point timeout, got %s", got)
+	}
+
+	if got := (waiters(nil)).get(waitTask).Timeout(); got != 45*time.Minute {
+		t.Errorf("expected default task timeout, got %s", got)
+	}
+
+	// a configured task timeout isn't derived
+	w, err = newWaiters(common.Waiters{MountTarget: "20m", Task: "2h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := w.get(waitTask).Timeout(); got != 2*time.Hour {
+		t.Errorf("expected configured task timeout, got %s", got)
+	}
+
+	if _, err := newWaiters(common.Waiters{Interval: "often"}); err == nil {
+		t.Error("expected error for invalid interval")
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/YaleSpinup/efs-api/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookEvents is the number of the most recent task log lines included in webhook notifications
+const webhookEvents = 10
+
+// newWebhookNotifier creates the notifier for the webhooks configuration, webhooks are disabled without a secret
+func newWebhookNotifier(config common.Webhooks) (*webhook.Notifier, error) {
+	if config.Secret == "" {
+		log.Info("no webhook secret is configured, task notifications are disabled")
+		return nil, nil
+	}
+
+	// callbacks are only delivered to public addresses, checked again when connecting in case the callback
+	// host resolves to another address than when the request was validated
+	opts := []webhook.NotifierOption{webhook.WithAllowedIP(publicIP)}
+	if config.Retries > 0 {
+		opts = append(opts, webhook.WithRetries(config.Retries))
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, webhook.WithTimeout(timeout))
+	}
+
+	return webhook.New(config.Secret, opts...), nil
+}
+
+// lookupCallbackHost resolves the host of callback URLs
+var lookupCallbackHost = net.DefaultResolver.LookupIPAddr
+
+// validateCallbackURL checks that the callback URL passed with a request is an http(s) URL on one of the
+// allowed callback hosts that doesn't resolve to a loopback, private or link-local address.  An empty
+// callback URL is valid.
+func (s *server) validateCallbackURL(ctx context.Context, callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+
+	if s.webhooks == nil {
+		return apierror.New(apierror.ErrBadRequest, "callback urls are not supported, webhooks are not configured", nil)
+	}
+
+	if len(s.webhookConfig.CallbackHosts) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "callback urls are not allowed, no callback hosts are configured", nil)
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		msg := fmt.Sprintf("invalid callback url %s, expected an absolute http or https url", callbackURL)
+		return apierror.New(apierror.ErrBadRequest, msg, err)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	allowed := false
+	for _, h := range s.webhookConfig.CallbackHosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		msg := fmt.Sprintf("callback url host %s is not allowed", u.Hostname())
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	addrs, err := lookupCallbackHost(ctx, host)
+	if err != nil {
+		msg := fmt.Sprintf("failed to resolve callback url host %s", u.Hostname())
+		return apierror.New(apierror.ErrBadRequest, msg, err)
+	}
+
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			msg := fmt.Sprintf("callback url host %s resolves to the non-public address %s", u.Hostname(), addr.IP)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+	}
+
+	return nil
+}
+
+// publicIP returns false for loopback, private, link-local and unspecified addresses
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// notifyTask posts the final status of the task to the configured webhooks and the task's callback URL
+func (s *server) notifyTask(ctx context.Context, info *taskInfo, status, failure string) {
+	if s.webhooks == nil {
+		return
+	}
+
+	var callbacks []string
+	if info.CallbackURL != "" {
+		callbacks = []string{info.CallbackURL}
+	}
+
+	if len(s.webhookConfig.URLs) == 0 && len(callbacks) == 0 {
+		return
+	}
+
+	payload := &webhook.Payload{
+		TaskID:       info.TaskID,
+		Operation:    info.Operation,
+		Account:      info.Account,
+		Group:        info.Group,
+		FileSystemID: info.FileSystemID,
+		RequestID:    info.RequestID,
+		Status:       status,
+		Failure:      failure,
+	}
+
+	if task, err := s.flywheel.GetTask(ctx, info.TaskID); err != nil {
+		logger(ctx).Warnf("failed to get events of task %s for webhook notification: %s", info.TaskID, err)
+	} else if task != nil {
+		events := task.Events
+		if len(events) > webhookEvents {
+			events = events[len(events)-webhookEvents:]
+		}
+		payload.Events = events
+	}
+
+	s.webhooks.Notify(s.webhookConfig.URLs, payload)
+	s.webhooks.NotifyCallbacks(callbacks, payload)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/common"
+	"github.com/YaleSpinup/efs-api/webhook"
+	"github.com/YaleSpinup/flywheel"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	lookup := lookupCallbackHost
+	defer func() { lookupCallbackHost = lookup }()
+
+	lookupCallbackHost = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "internal.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.1")}}, nil
+		case "metadata.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("169.254.169.254")}}, nil
+		case "local.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("::1")}}, nil
+		case "missing.example.com":
+			return nil, errors.New("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+	}
+
+	ctx := context.TODO()
+
+	disabled := server{}
+	if err := disabled.validateCallbackURL(ctx, ""); err != nil {
+		t.Errorf("expected nil error for empty callback url, got %s", err)
+	}
+
+	if err := disabled.validateCallbackURL(ctx, "https://hooks.example.com"); err == nil {
+		t.Error("expected error for callback url without webhooks configured")
+	}
+
+	// callback urls are denied without an allowlist of callback hosts
+	unrestricted := server{webhookConfig: common.Webhooks{Secret: "shh"}, webhooks: webhook.New("shh")}
+	if err := unrestricted.validateCallbackURL(ctx, "https://hooks.example.com"); err == nil {
+		t.Error("expected error for callback url without callback hosts configured")
+	}
+
+	s := server{
+		webhookConfig: common.Webhooks{Secret: "shh", CallbackHosts: []string{"example.com"}},
+		webhooks:      webhook.New("shh"),
+	}
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: ""},
+		{url: "https://example.com/hook"},
+		{url: "http://hooks.Example.com:8080/hook"},
+		{url: "https://example.org/hook", wantErr: true},
+		{url: "https://notexample.com/hook", wantErr: true},
+		{url: "ftp://example.com/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "https://internal.example.com/hook", wantErr: true},
+		{url: "https://metadata.example.com/hook", wantErr: true},
+		{url: "https://local.example.com/hook", wantErr: true},
+		{url: "https://missing.example.com/hook", wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := s.validateCallbackURL(ctx, test.url); (err != nil) != test.wantErr {
+			t.Errorf("%s: expected error %t, got %v", test.url, test.wantErr, err)
+		}
+	}
+}
+
+func TestNotifyTask(t *testing.T) {
+	client := newTestRedis(t)
+	manager, err := flywheel.NewManager("efsapi", flywheel.WithRedis(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	received := map[string]*webhook.Payload{}
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if !webhook.Verify([]byte("shh"), body, r.Header.Get(webhook.SignatureHeader)) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			payload := &webhook.Payload{}
+			if err := json.Unmarshal(body, payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			mu.Lock()
+			received[name] = payload
+			mu.Unlock()
+		}
+	}
+
+	global := httptest.NewServer(handler("global"))
+	defer global.Close()
+
+	callback := httptest.NewServer(handler("callback"))
+	defer callback.Close()
+
+	s := server{
+		flywheel:      manager,
+		webhookConfig: common.Webhooks{URLs: []string{global.URL}, Secret: "shh"},
+		webhooks:      webhook.New("shh", webhook.WithBackoff(time.Millisecond)),
+	}
+
+	ctx := context.TODO()
+	task := flywheel.NewTask()
+	if err := manager.Start(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 12; i++ {
+		if err := manager.Log(ctx, task.ID, fmt.Sprintf("message %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := &taskInfo{TaskID: task.ID, Operation: kindFilesystemDelete, Account: "1234567890", Group: "space1", FileSystemID: "fs-1", CallbackURL: callback.URL}
+	s.notifyTask(ctx, info, flywheel.STATUS_FAILED, "boom")
+	s.webhooks.Close()
+
+	if len(received) != 2 {
+		t.Fatalf("expected the global webhook and the callback to be notified, got %v", received)
+	}
+
+	payload := received["callback"]
+	if payload.TaskID != task.ID || payload.Operation != kindFilesystemDelete || payload.FileSystemID != "fs-1" || payload.Status != flywheel.STATUS_FAILED || payload.Failure != "boom" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	// only the last log lines are sent
+	if len(payload.Events) != webhookEvents {
+		t.Fatalf("expected %d events, got %d", webhookEvents, len(payload.Events))
+	}
+
+	if last := payload.Events[webhookEvents-1]; last[len(last)-len("message 11"):] != "message 11" {
+		t.Errorf("expected the last event to be the most recent log line, got %s", last)
+	}
+}
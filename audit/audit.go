@@ -0,0 +1,223 @@
+// Package audit records mutating API operations to one or more sinks
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event is an audit record of a mutating API operation
+type Event struct {
+	Time       time.Time       `json:"time"`
+	Caller     string          `json:"caller"`
+	RequestID  string          `json:"requestId,omitempty"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Route      string          `json:"route,omitempty"`
+	Account    string          `json:"account,omitempty"`
+	Group      string          `json:"group,omitempty"`
+	ResourceID string          `json:"resourceId,omitempty"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	TaskID     string          `json:"taskId,omitempty"`
+	Status     int             `json:"status,omitempty"`
+	Outcome    string          `json:"outcome"`
+	Error      string          `json:"error,omitempty"`
+}
+
+const (
+	// OutcomeSuccess is the outcome of a synchronous operation that succeeded
+	OutcomeSuccess = "success"
+	// OutcomeFailure is the outcome of an operation that was rejected or failed
+	OutcomeFailure = "failure"
+	// OutcomeAccepted is the outcome of an asynchronous operation that was accepted and started a task
+	OutcomeAccepted = "accepted"
+	// OutcomeCompleted is the final outcome of an asynchronous operation whose task completed
+	OutcomeCompleted = "completed"
+	// OutcomeFailed is the final outcome of an asynchronous operation whose task failed
+	OutcomeFailed = "failed"
+	// OutcomeCancelled is the final outcome of an asynchronous operation whose task was cancelled
+	OutcomeCancelled = "cancelled"
+)
+
+// Sink writes audit events
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+	Close() error
+}
+
+// Auditor records audit events to its sinks in the background
+type Auditor struct {
+	closed  bool
+	events  chan *Event
+	mu      sync.RWMutex
+	sinks   []Sink
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+type AuditorOption func(*Auditor)
+
+// New creates an auditor writing to the sinks and starts it
+func New(sinks []Sink, opts ...AuditorOption) *Auditor {
+	a := &Auditor{
+		events:  make(chan *Event, 1000),
+		sinks:   sinks,
+		timeout: 10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.wg.Add(1)
+	go a.run()
+
+	return a
+}
+
+// WithBufferSize sets the number of events that can be queued before events are dropped
+func WithBufferSize(size int) AuditorOption {
+	return func(a *Auditor) {
+		log.Debugf("setting audit buffer size to %d", size)
+		a.events = make(chan *Event, size)
+	}
+}
+
+// WithTimeout sets the timeout for writing an event to a sink
+func WithTimeout(timeout time.Duration) AuditorOption {
+	return func(a *Auditor) {
+		log.Debugf("setting audit sink timeout to %s", timeout.String())
+		a.timeout = timeout
+	}
+}
+
+// Record queues an event to be written to the sinks.  The event is dropped if the queue is full or the
+// auditor is closed.
+func (a *Auditor) Record(event *Event) {
+	if a == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		log.Warnf("auditor is closed, dropping audit event for %s %s", event.Method, event.Path)
+		return
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		log.Errorf("audit queue is full, dropping audit event for %s %s", event.Method, event.Path)
+	}
+}
+
+// Close stops accepting events, writes the queued events and closes the sinks
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+
+	a.wg.Wait()
+
+	var err error
+	for _, s := range a.sinks {
+		if serr := s.Close(); serr != nil {
+			log.Errorf("failed to close audit sink: %s", serr)
+			err = serr
+		}
+	}
+
+	return err
+}
+
+func (a *Auditor) run() {
+	defer a.wg.Done()
+
+	for event := range a.events {
+		for _, s := range a.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+			if err := s.Write(ctx, event); err != nil {
+				log.Errorf("failed to write audit event for %s %s: %s", event.Method, event.Path, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// sensitiveKeys are substrings of (lowercased) JSON keys whose values are redacted
+var sensitiveKeys = []string{"password", "secret", "token", "credential", "privatekey", "accesskey"}
+
+// Redacted is the value that replaces redacted fields
+const Redacted = "[REDACTED]"
+
+// Redact returns the JSON body with the values of sensitive fields replaced.  Bodies that
+// aren't JSON are omitted.
+func Redact(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		log.Debugf("not recording non-JSON request body in audit event: %s", err)
+		return nil
+	}
+
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil
+	}
+
+	return out
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if isSensitive(k) {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = redact(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func isSensitive(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
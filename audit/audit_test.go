@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type testSink struct {
+	mu     sync.Mutex
+	events []*Event
+	closed bool
+	err    error
+}
+
+func (t *testSink) Write(ctx context.Context, event *Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+	return t.err
+}
+
+func (t *testSink) Close() error {
+	t.closed = true
+	return nil
+}
+
+func TestRedact(t *testing.T) {
+	body := []byte(`{"Name":"myfs","KmsKeyId":"key-123","Password":"hunter2","Users":[{"UserName":"jdoe","SecretAccessKey":"abc"}],"Auth":{"token":"xyz"}}`)
+
+	expected := map[string]interface{}{
+		"Name":     "myfs",
+		"KmsKeyId": "key-123",
+		"Password": Redacted,
+		"Users":    []interface{}{map[string]interface{}{"UserName": "jdoe", "SecretAccessKey": Redacted}},
+		"Auth":     map[string]interface{}{"token": Redacted},
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(Redact(body), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("expected %+v, got %+v", expected, out)
+	}
+
+	if out := Redact([]byte("not json")); out != nil {
+		t.Errorf("expected nil for non-JSON body, got %s", string(out))
+	}
+
+	if out := Redact(nil); out != nil {
+		t.Errorf("expected nil for empty body, got %s", string(out))
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	good := &testSink{}
+	bad := &testSink{err: errors.New("boom")}
+
+	a := New([]Sink{bad, good})
+	a.Record(&Event{Method: http.MethodPost, Path: "/foo", Outcome: OutcomeSuccess})
+	a.Record(&Event{Method: http.MethodDelete, Path: "/bar", Outcome: OutcomeFailure})
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(good.events) != 2 || len(bad.events) != 2 {
+		t.Fatalf("expected 2 events in each sink, got %d and %d", len(good.events), len(bad.events))
+	}
+
+	if good.events[0].Time.IsZero() {
+		t.Error("expected event time to be set")
+	}
+
+	if !good.closed || !bad.closed {
+		t.Error("expected sinks to be closed")
+	}
+
+	// events recorded after closing are dropped
+	a.Record(&Event{Method: http.MethodPut, Path: "/baz", Outcome: OutcomeSuccess})
+	if err := a.Close(); err != nil {
+		t.Errorf("expected nil error closing the auditor again, got %s", err)
+	}
+
+	if len(good.events) != 2 {
+		t.Errorf("expected events recorded after closing to be dropped, got %d events", len(good.events))
+	}
+
+	// a nil auditor is a no-op
+	var nilAuditor *Auditor
+	nilAuditor.Record(&Event{})
+	if err := nilAuditor.Close(); err != nil {
+		t.Errorf("expected nil error closing nil auditor, got %s", err)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*Event{
+		{Method: http.MethodPost, Path: "/v1/efs/spinup/filesystems/space1", Outcome: OutcomeAccepted, TaskID: "task1"},
+		{Method: http.MethodPost, Path: "/v1/efs/spinup/filesystems/space1", Outcome: OutcomeCompleted, TaskID: "task1"},
+	}
+
+	for _, e := range events {
+		if err := sink.Write(context.TODO(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			t.Fatalf("expected JSON line, got %s", scanner.Text())
+		}
+
+		if !reflect.DeepEqual(events[lines], e) {
+			t.Errorf("expected event %+v, got %+v", events[lines], e)
+		}
+		lines++
+	}
+
+	if lines != len(events) {
+		t.Errorf("expected %d lines, got %d", len(events), lines)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received *Event
+	var auth string
+
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		received = &Event{}
+		if err := json.NewDecoder(r.Body).Decode(received); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, map[string]string{"Authorization": "Bearer secret"})
+
+	event := &Event{Method: http.MethodDelete, Path: "/v1/efs/spinup/filesystems/space1/fs-123", ResourceID: "fs-123", Outcome: OutcomeSuccess}
+	if err := sink.Write(context.TODO(), event); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(event, received) {
+		t.Errorf("expected webhook to receive %+v, got %+v", event, received)
+	}
+
+	if auth != "Bearer secret" {
+		t.Errorf("expected configured headers to be sent, got %s", auth)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Write(context.TODO(), event); err == nil {
+		t.Error("expected error for failed webhook, got nil")
+	}
+}
+
+type testStreamAdder struct {
+	args *redis.XAddArgs
+}
+
+func (t *testStreamAdder) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	t.args = a
+	return redis.NewStringResult("1-0", nil)
+}
+
+func (t *testStreamAdder) Close() error {
+	return nil
+}
+
+func TestRedisSink(t *testing.T) {
+	client := &testStreamAdder{}
+	sink := &RedisSink{client: client, stream: "efsapi:audit", maxLen: 1000}
+
+	event := &Event{Method: http.MethodPut, Path: "/v1/efs/spinup/filesystems/space1/fs-123", Outcome: OutcomeSuccess}
+	if err := sink.Write(context.TODO(), event); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if client.args.Stream != "efsapi:audit" || client.args.MaxLen != 1000 || !client.args.Approx {
+		t.Errorf("unexpected xadd args %+v", client.args)
+	}
+
+	values, ok := client.args.Values.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected map values, got %T", client.args.Values)
+	}
+
+	out := &Event{}
+	if err := json.Unmarshal([]byte(values["event"].(string)), out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(event, out) {
+		t.Errorf("expected event %+v, got %+v", event, out)
+	}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileSink writes audit events to a file as JSON lines
+type FileSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileSink opens the file for appending and returns a sink writing to it
+func NewFileSink(path string) (*FileSink, error) {
+	log.Infof("writing audit events to file %s", path)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{file: f}, nil
+}
+
+// Write writes the event as a line of JSON
+func (f *FileSink) Write(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// streamAdder is the part of the redis client used to add events to a stream
+type streamAdder interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	Close() error
+}
+
+// RedisSink adds audit events to a redis stream
+type RedisSink struct {
+	client streamAdder
+	maxLen int64
+	stream string
+}
+
+// NewRedisSink returns a sink adding events to the stream, capped at approximately maxLen entries if
+// maxLen is greater than zero
+func NewRedisSink(client *redis.Client, stream string, maxLen int64) *RedisSink {
+	log.Infof("writing audit events to redis stream %s", stream)
+
+	return &RedisSink{
+		client: client,
+		maxLen: maxLen,
+		stream: stream,
+	}
+}
+
+// Write adds the event to the stream in the `event` field
+func (r *RedisSink) Write(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.stream,
+		MaxLen: r.maxLen,
+		Approx: r.maxLen > 0,
+		Values: map[string]interface{}{"event": string(data)},
+	}).Err()
+}
+
+// Close closes the redis client
+func (r *RedisSink) Close() error {
+	return r.client.Close()
+}
+
+// WebhookSink posts audit events as JSON to a URL
+type WebhookSink struct {
+	client  *http.Client
+	headers map[string]string
+	url     string
+}
+
+// NewWebhookSink returns a sink posting events to the url with the headers
+func NewWebhookSink(url string, headers map[string]string) *WebhookSink {
+	log.Infof("writing audit events to webhook %s", url)
+
+	return &WebhookSink{
+		client:  &http.Client{},
+		headers: headers,
+		url:     url,
+	}
+}
+
+// Write posts the event to the webhook, non-2xx responses are errors
+func (w *WebhookSink) Write(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected webhook response status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Close is a no-op for the webhook sink
+func (w *WebhookSink) Close() error {
+	return nil
+}
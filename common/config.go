@@ -19,6 +19,12 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 import (
 	"encoding/json"
 	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -26,15 +32,26 @@ import (
 
 // Config is representation of the configuration data
 type Config struct {
-	Account       Account
-	AccountsMap   map[string]string
-	KmsKeyTags    []string
-	Flywheel      Flywheel
-	ListenAddress string
-	LogLevel      string
-	Org           string
-	Token         string
-	Version       Version
+	Account         Account
+	Accounts        map[string]Account
+	AccountsMap     map[string]string
+	Audit           Audit
+	KmsKeyTags      []string
+	Flywheel        Flywheel
+	ListenAddress   string
+	LogLevel        string
+	OIDC            OIDC
+	Org             string
+	Pricing         map[string]Pricing
+	Quotas          Quotas
+	RateLimit       RateLimit
+	Reconciler      Reconciler
+	ShutdownTimeout string
+	Token           string
+	Tokens          []Token
+	Version         Version
+	Waiters         Waiters
+	Webhooks        Webhooks
 }
 
 // Account is the configuration for an individual account
@@ -50,6 +67,18 @@ type Account struct {
 	DefaultKmsKeyId string
 }
 
+// Audit is the configuration of the audit log sinks, audit events are written to every configured sink
+type Audit struct {
+	File           string
+	RedisAddress   string
+	RedisDatabase  string
+	RedisPassword  string
+	RedisStream    string
+	RedisMaxLen    int64
+	WebhookURL     string
+	WebhookHeaders map[string]string
+}
+
 // Flywheel is the configuration for task tracking in flywheel
 type Flywheel struct {
 	Namespace     string
@@ -60,6 +89,119 @@ type Flywheel struct {
 	TTL           string
 }
 
+// OIDC is the configuration for authenticating OIDC bearer tokens.  The JWKS is loaded from the JWKSFile or
+// the JWKSURL and cached for the JWKSCacheTTL.  The values of the GroupsClaim are the spaceids the user is
+// allowed to access with the Scope.
+type OIDC struct {
+	Issuer       string
+	Audience     string
+	JWKSFile     string
+	JWKSURL      string
+	JWKSCacheTTL string
+	GroupsClaim  string
+	Scope        string
+}
+
+// Pricing is the per-region EFS price list used to estimate storage costs.  Storage prices are per
+// GB-month, provisioned throughput is per MB/s-month and elastic throughput is per GB read or written.
+type Pricing struct {
+	Currency              string
+	Standard              float64
+	StandardIA            float64
+	OneZone               float64
+	OneZoneIA             float64
+	ProvisionedThroughput float64
+	ElasticRead           float64
+	ElasticWrite          float64
+	// ElasticReadRatio and ElasticWriteRatio are the expected GB read and written in a month for each GB
+	// stored, used to estimate the cost of elastic throughput
+	ElasticReadRatio  *float64
+	ElasticWriteRatio *float64
+	// LifecycleIARatio is the expected fraction of data stored in infrequent access for
+	// each lifecycle configuration, used when estimating alternative lifecycle settings
+	LifecycleIARatio map[string]float64
+}
+
+// RateLimit is the configuration of the request rate limits per token and per account.  The limits are
+// stored in redis, by default the flywheel redis.
+type RateLimit struct {
+	RedisAddress  string
+	RedisDatabase string
+	RedisPassword string
+	Prefix        string
+	PerToken      RateLimitRule
+	PerAccount    RateLimitRule
+}
+
+// RateLimitRule is a token bucket refilled at RequestsPerSecond up to Burst requests.  A zero
+// RequestsPerSecond disables the limit.
+type RateLimitRule struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// Reconciler is the configuration of the background reconciler, which compares the filesystems with their last
+// applied configuration every Interval.  In the report Mode drift is only reported, in the repair Mode it's also
+// repaired.  The reconciler is disabled without an Interval.
+type Reconciler struct {
+	Interval string
+	Mode     string
+}
+
+// Quotas is the configuration of resource quotas.  Default applies to every space in the org and
+// Overrides are keyed by spaceid.  A zero value is unlimited in the default and inherits the default in
+// an override, Unlimited is unlimited in both.
+type Quotas struct {
+	Default   Quota
+	Overrides map[string]Quota
+}
+
+// Quota is the limit of resources a space can create
+type Quota struct {
+	FileSystems               int
+	AccessPointsPerFileSystem int
+	UsersPerFileSystem        int
+	// StorageGB is the total size of the filesystems in the space, new filesystems can't be created
+	// once it's reached
+	StorageGB int
+}
+
+// Unlimited is the quota limit that isn't limited, overriding the default limit
+const Unlimited = -1
+
+// Token is a named API token with its scopes (read, write or admin) and optional allowlists of
+// accounts and groups.  Empty allowlists allow all accounts or groups.
+type Token struct {
+	Name     string
+	Token    string
+	Scopes   []string
+	Accounts []string
+	Groups   []string
+}
+
+// Waiters is the configuration of the waits for filesystems, mount targets and access points to change state,
+// and for tasks started by other tasks to finish.  Resources are checked every Interval for at most the maximum
+// duration for their type.
+type Waiters struct {
+	Interval    string
+	FileSystem  string
+	MountTarget string
+	AccessPoint string
+	Task        string
+}
+
+// Webhooks is the configuration of the notifications posted when asynchronous tasks finish.  Notifications
+// are posted to every URL and to the callback URL passed with the request, signed with the Secret.  Callback
+// URLs must be on one of the CallbackHosts, an empty list denies callback URLs.  Webhooks are disabled without
+// a Secret.
+type Webhooks struct {
+	URLs          []string
+	Secret        string
+	CallbackHosts []string
+	Retries       int
+	Timeout       string
+}
+
 // Version carries around the API version information
 type Version struct {
 	Version           string
@@ -77,3 +219,240 @@ func ReadConfig(r io.Reader) (Config, error) {
 	}
 	return c, nil
 }
+
+// Validate checks the configuration for errors
+func (c Config) Validate() error {
+	if c.Org == "" {
+		return errors.New("'org' cannot be empty in the configuration")
+	}
+
+	switch c.LogLevel {
+	case "", "error", "warn", "info", "debug":
+	default:
+		return errors.Errorf("invalid 'logLevel' %s, valid values are error | warn | info | debug", c.LogLevel)
+	}
+
+	for name, a := range c.Accounts {
+		if err := a.validate(); err != nil {
+			return errors.Wrapf(err, "invalid 'accounts' configuration for %s", name)
+		}
+	}
+
+	names := map[string]struct{}{}
+	for i, t := range c.Tokens {
+		if t.Name == "" {
+			return errors.Errorf("invalid 'tokens' configuration, token %d is missing a name", i)
+		}
+
+		if _, ok := names[t.Name]; ok {
+			return errors.Errorf("invalid 'tokens' configuration, duplicate token name %s", t.Name)
+		}
+		names[t.Name] = struct{}{}
+
+		if t.Token == "" {
+			return errors.Errorf("invalid 'tokens' configuration, token %s cannot be empty", t.Name)
+		}
+
+		if len(t.Scopes) == 0 {
+			return errors.Errorf("invalid 'tokens' configuration, token %s has no scopes", t.Name)
+		}
+
+		for _, scope := range t.Scopes {
+			switch scope {
+			case "read", "write", "admin":
+			default:
+				return errors.Errorf("invalid 'tokens' configuration, token %s has invalid scope %s, valid values are read | write | admin", t.Name, scope)
+			}
+		}
+	}
+
+	if c.ShutdownTimeout != "" {
+		if _, err := time.ParseDuration(c.ShutdownTimeout); err != nil {
+			return errors.Wrapf(err, "invalid 'shutdownTimeout' %s", c.ShutdownTimeout)
+		}
+	}
+
+	if err := c.OIDC.validate(); err != nil {
+		return errors.Wrap(err, "invalid 'oidc' configuration")
+	}
+
+	for name, rule := range map[string]RateLimitRule{"perToken": c.RateLimit.PerToken, "perAccount": c.RateLimit.PerAccount} {
+		if rule.RequestsPerSecond < 0 || rule.Burst < 0 {
+			return errors.Errorf("invalid 'rateLimit' for %s, limits cannot be negative", name)
+		}
+	}
+
+	for region, p := range c.Pricing {
+		if p.Standard < 0 || p.StandardIA < 0 || p.OneZone < 0 || p.OneZoneIA < 0 || p.ProvisionedThroughput < 0 || p.ElasticRead < 0 || p.ElasticWrite < 0 {
+			return errors.Errorf("invalid 'pricing' for %s, prices cannot be negative", region)
+		}
+
+		if (p.ElasticReadRatio != nil && *p.ElasticReadRatio < 0) || (p.ElasticWriteRatio != nil && *p.ElasticWriteRatio < 0) {
+			return errors.Errorf("invalid 'pricing' for %s, elastic throughput ratios cannot be negative", region)
+		}
+	}
+
+	if err := c.Reconciler.validate(); err != nil {
+		return errors.Wrap(err, "invalid 'reconciler' configuration")
+	}
+
+	if err := c.Waiters.validate(); err != nil {
+		return errors.Wrap(err, "invalid 'waiters' configuration")
+	}
+
+	if err := c.Webhooks.validate(); err != nil {
+		return errors.Wrap(err, "invalid 'webhooks' configuration")
+	}
+
+	quotas := map[string]Quota{"default": c.Quotas.Default}
+	for group, q := range c.Quotas.Overrides {
+		quotas[group] = q
+	}
+
+	for name, q := range quotas {
+		if q.FileSystems < Unlimited || q.AccessPointsPerFileSystem < Unlimited || q.UsersPerFileSystem < Unlimited || q.StorageGB < Unlimited {
+			return errors.Errorf("invalid 'quotas' for %s, limits must be %d (unlimited) or more", name, Unlimited)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the per-account defaults for errors
+func (a Account) validate() error {
+	if a.Region != "" {
+		if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), a.Region); !ok {
+			return errors.Errorf("invalid region %s", a.Region)
+		}
+	}
+
+	for _, subnet := range a.DefaultSubnets {
+		if !strings.HasPrefix(subnet, "subnet-") {
+			return errors.Errorf("invalid default subnet %s", subnet)
+		}
+	}
+
+	for _, sg := range a.DefaultSgs {
+		if !strings.HasPrefix(sg, "sg-") {
+			return errors.Errorf("invalid default security group %s", sg)
+		}
+	}
+
+	if a.DefaultKmsKeyId != "" && strings.HasPrefix(a.DefaultKmsKeyId, "arn:") {
+		if k, err := arn.Parse(a.DefaultKmsKeyId); err != nil || k.Service != "kms" {
+			return errors.Errorf("invalid default kms key %s", a.DefaultKmsKeyId)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the reconciler configuration for errors
+func (r Reconciler) validate() error {
+	if r.Interval != "" {
+		interval, err := time.ParseDuration(r.Interval)
+		if err != nil {
+			return errors.Wrapf(err, "invalid interval %s", r.Interval)
+		}
+
+		if interval < time.Minute {
+			return errors.Errorf("invalid interval %s, must be at least 1m", r.Interval)
+		}
+	}
+
+	switch r.Mode {
+	case "", "report", "repair":
+	default:
+		return errors.Errorf("invalid mode %s, valid values are report | repair", r.Mode)
+	}
+
+	return nil
+}
+
+// validate checks the waiter durations for errors
+func (w Waiters) validate() error {
+	for name, d := range map[string]string{"interval": w.Interval, "fileSystem": w.FileSystem, "mountTarget": w.MountTarget, "accessPoint": w.AccessPoint, "task": w.Task} {
+		if d == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s %s", name, d)
+		}
+
+		if duration <= 0 {
+			return errors.Errorf("invalid %s %s, must be positive", name, d)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the OIDC configuration for errors, an empty configuration disables OIDC
+func (o OIDC) validate() error {
+	if o == (OIDC{}) {
+		return nil
+	}
+
+	if o.Issuer == "" || o.Audience == "" {
+		return errors.New("issuer and audience are required")
+	}
+
+	if (o.JWKSFile == "") == (o.JWKSURL == "") {
+		return errors.New("one of jwksFile or jwksUrl is required")
+	}
+
+	if o.JWKSCacheTTL != "" {
+		if _, err := time.ParseDuration(o.JWKSCacheTTL); err != nil {
+			return errors.Wrapf(err, "invalid jwksCacheTTL %s", o.JWKSCacheTTL)
+		}
+	}
+
+	switch o.Scope {
+	case "", "read", "write", "admin":
+	default:
+		return errors.Errorf("invalid scope %s, valid values are read | write | admin", o.Scope)
+	}
+
+	return nil
+}
+
+// validate checks the webhooks configuration for errors
+func (w Webhooks) validate() error {
+	if len(w.URLs) > 0 && w.Secret == "" {
+		return errors.New("secret is required to sign notifications")
+	}
+
+	for _, u := range w.URLs {
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return errors.Errorf("invalid url %s", u)
+		}
+	}
+
+	if w.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+
+	if w.Timeout != "" {
+		if _, err := time.ParseDuration(w.Timeout); err != nil {
+			return errors.Wrapf(err, "invalid timeout %s", w.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// SetLogLevel sets the log level, info if it's unset
+func SetLogLevel(level string) {
+	switch level {
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	case "warn":
+		log.SetLevel(log.WarnLevel)
+	case "debug":
+		log.SetLevel(log.DebugLevel)
+	default:
+		log.SetLevel(log.InfoLevel)
+	}
+}
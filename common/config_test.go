@@ -64,6 +64,21 @@ func TestReadConfig(t *testing.T) {
 			Role:       "uber-role",
 			ExternalID: "foobar",
 		},
+		Accounts: map[string]Account{
+			"provider1": {
+				Region:          "us-east-1",
+				Akid:            "key1",
+				Secret:          "secret1",
+				DefaultKmsKeyId: "arn:aws:kms:us-east-1:11111111111:key/xyxyxyxyxyxyxyxyx",
+				DefaultSgs:      []string{"sg-xxxxxx", "sg-yyyyyy"},
+				DefaultSubnets:  []string{"subnet-xxxxxxx", "subnet-yyyyyy"},
+			},
+			"provider2": {
+				Region: "us-west-1",
+				Akid:   "key2",
+				Secret: "secret2",
+			},
+		},
 		Token:    "SEKRET",
 		LogLevel: "info",
 		Org:      "test",
@@ -83,3 +98,54 @@ func TestReadConfig(t *testing.T) {
 		t.Error("expected error reading config, got nil")
 	}
 }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "valid", config: Config{Org: "test", LogLevel: "info"}},
+		{name: "missing org", config: Config{}, wantErr: true},
+		{name: "bad log level", config: Config{Org: "test", LogLevel: "chatty"}, wantErr: true},
+		{name: "negative price", config: Config{Org: "test", Pricing: map[string]Pricing{"us-east-1": {Standard: -1}}}, wantErr: true},
+		{name: "valid account", config: Config{Org: "test", Accounts: map[string]Account{"spinup": {Region: "us-east-1", DefaultSubnets: []string{"subnet-1234"}, DefaultSgs: []string{"sg-1234"}, DefaultKmsKeyId: "arn:aws:kms:us-east-1:0123456789:key/abcd"}}}},
+		{name: "bad account region", config: Config{Org: "test", Accounts: map[string]Account{"spinup": {Region: "us-middle-earth"}}}, wantErr: true},
+		{name: "bad account subnet", config: Config{Org: "test", Accounts: map[string]Account{"spinup": {DefaultSubnets: []string{"sg-1234"}}}}, wantErr: true},
+		{name: "bad account security group", config: Config{Org: "test", Accounts: map[string]Account{"spinup": {DefaultSgs: []string{"subnet-1234"}}}}, wantErr: true},
+		{name: "bad account kms key", config: Config{Org: "test", Accounts: map[string]Account{"spinup": {DefaultKmsKeyId: "arn:aws:iam::0123456789:role/foo"}}}, wantErr: true},
+		{name: "valid tokens", config: Config{Org: "test", Tokens: []Token{{Name: "dashboard", Token: "secret", Scopes: []string{"read"}, Groups: []string{"space1"}}}}},
+		{name: "token missing name", config: Config{Org: "test", Tokens: []Token{{Token: "secret", Scopes: []string{"read"}}}}, wantErr: true},
+		{name: "duplicate token name", config: Config{Org: "test", Tokens: []Token{{Name: "a", Token: "secret", Scopes: []string{"read"}}, {Name: "a", Token: "other", Scopes: []string{"read"}}}}, wantErr: true},
+		{name: "empty token", config: Config{Org: "test", Tokens: []Token{{Name: "a", Scopes: []string{"read"}}}}, wantErr: true},
+		{name: "token without scopes", config: Config{Org: "test", Tokens: []Token{{Name: "a", Token: "secret"}}}, wantErr: true},
+		{name: "token with bad scope", config: Config{Org: "test", Tokens: []Token{{Name: "a", Token: "secret", Scopes: []string{"superuser"}}}}, wantErr: true},
+		{name: "valid oidc", config: Config{Org: "test", OIDC: OIDC{Issuer: "https://idp.example.com", Audience: "efs-api", JWKSURL: "https://idp.example.com/jwks", JWKSCacheTTL: "1h", Scope: "write"}}},
+		{name: "oidc missing audience", config: Config{Org: "test", OIDC: OIDC{Issuer: "https://idp.example.com", JWKSFile: "jwks.json"}}, wantErr: true},
+		{name: "oidc with file and url", config: Config{Org: "test", OIDC: OIDC{Issuer: "https://idp.example.com", Audience: "efs-api", JWKSFile: "jwks.json", JWKSURL: "https://idp.example.com/jwks"}}, wantErr: true},
+		{name: "oidc bad ttl", config: Config{Org: "test", OIDC: OIDC{Issuer: "https://idp.example.com", Audience: "efs-api", JWKSFile: "jwks.json", JWKSCacheTTL: "forever"}}, wantErr: true},
+		{name: "valid rate limit", config: Config{Org: "test", RateLimit: RateLimit{PerToken: RateLimitRule{RequestsPerSecond: 10, Burst: 20}}}},
+		{name: "negative rate limit", config: Config{Org: "test", RateLimit: RateLimit{PerAccount: RateLimitRule{RequestsPerSecond: -1}}}, wantErr: true},
+		{name: "bad shutdown timeout", config: Config{Org: "test", ShutdownTimeout: "soon"}, wantErr: true},
+		{name: "valid webhooks", config: Config{Org: "test", Webhooks: Webhooks{URLs: []string{"https://hooks.example.com/efs"}, Secret: "shh", CallbackHosts: []string{"example.com"}, Retries: 3, Timeout: "5s"}}},
+		{name: "webhooks without secret", config: Config{Org: "test", Webhooks: Webhooks{URLs: []string{"https://hooks.example.com/efs"}}}, wantErr: true},
+		{name: "bad webhook url", config: Config{Org: "test", Webhooks: Webhooks{URLs: []string{"ftp://hooks.example.com"}, Secret: "shh"}}, wantErr: true},
+		{name: "bad webhook timeout", config: Config{Org: "test", Webhooks: Webhooks{Secret: "shh", Timeout: "later"}}, wantErr: true},
+		{name: "valid waiters", config: Config{Org: "test", Waiters: Waiters{Interval: "2s", FileSystem: "5m", MountTarget: "10m"}}},
+		{name: "bad waiter duration", config: Config{Org: "test", Waiters: Waiters{MountTarget: "soon"}}, wantErr: true},
+		{name: "negative waiter interval", config: Config{Org: "test", Waiters: Waiters{Interval: "-1s"}}, wantErr: true},
+		{name: "bad task waiter duration", config: Config{Org: "test", Waiters: Waiters{Task: "0s"}}, wantErr: true},
+		{name: "valid reconciler", config: Config{Org: "test", Reconciler: Reconciler{Interval: "15m", Mode: "repair"}}},
+		{name: "short reconciler interval", config: Config{Org: "test", Reconciler: Reconciler{Interval: "10s"}}, wantErr: true},
+		{name: "bad reconciler mode", config: Config{Org: "test", Reconciler: Reconciler{Interval: "15m", Mode: "fix"}}, wantErr: true},
+		{name: "unlimited quota override", config: Config{Org: "test", Quotas: Quotas{Overrides: map[string]Quota{"space": {FileSystems: Unlimited, StorageGB: Unlimited}}}}},
+		{name: "negative quota override", config: Config{Org: "test", Quotas: Quotas{Overrides: map[string]Quota{"space": {FileSystems: -2}}}}, wantErr: true},
+		{name: "negative storage quota", config: Config{Org: "test", Quotas: Quotas{Default: Quota{StorageGB: -5}}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := test.config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: expected error %t, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
@@ -61,6 +61,27 @@ func (e *EC2) GetSubnet(ctx context.Context, subnet string) (*ec2.Subnet, error)
 	return out.Subnets[0], nil
 }
 
+// ListRegions lists the names of the regions enabled for the account
+func (e *EC2) ListRegions(ctx context.Context) ([]string, error) {
+	log.Info("listing enabled regions")
+
+	out, err := e.Service.DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{
+		AllRegions: aws.Bool(false),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to describe regions", err)
+	}
+
+	log.Debugf("got output describing regions: %+v", out)
+
+	regions := make([]string, 0, len(out.Regions))
+	for _, r := range out.Regions {
+		regions = append(regions, aws.StringValue(r.RegionName))
+	}
+
+	return regions, nil
+}
+
 func New(opts ...EC2Option) EC2 {
 	e := EC2{}
 
@@ -8,6 +8,7 @@ import (
 
 	"github.com/YaleSpinup/efs-api/common"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
@@ -130,3 +131,37 @@ func TestEC2_GetSubnet(t *testing.T) {
 		})
 	}
 }
+
+func (m *mockEC2Client) DescribeRegionsWithContext(ctx context.Context, input *ec2.DescribeRegionsInput, opts ...request.Option) (*ec2.DescribeRegionsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if aws.BoolValue(input.AllRegions) {
+		m.t.Error("expected only the enabled regions to be described")
+	}
+
+	return &ec2.DescribeRegionsOutput{
+		Regions: []*ec2.Region{
+			{RegionName: aws.String("us-east-1")},
+			{RegionName: aws.String("us-west-2")},
+		},
+	}, nil
+}
+
+func TestEC2_ListRegions(t *testing.T) {
+	e := &EC2{Service: newmockEC2Client(t, nil)}
+	got, err := e.ListRegions(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"us-east-1", "us-west-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EC2.ListRegions() = %v, want %v", got, want)
+	}
+
+	e = &EC2{Service: newmockEC2Client(t, awserr.New("UnauthorizedOperation", "denied", nil))}
+	if _, err := e.ListRegions(context.TODO()); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -14,14 +14,14 @@ func (e *EFS) CreateAccessPoint(ctx context.Context, input *efs.CreateAccessPoin
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("creating access point for %s", aws.StringValue(input.FileSystemId))
+	log.WithContext(ctx).Infof("creating access point for %s", aws.StringValue(input.FileSystemId))
 
 	out, err := e.Service.CreateAccessPointWithContext(ctx, input)
 	if err != nil {
 		return nil, ErrCode("failed to create access point", err)
 	}
 
-	log.Debugf("got output creating access point for %s: %+v", aws.StringValue(input.FileSystemId), out)
+	log.WithContext(ctx).Debugf("got output creating access point for %s: %+v", aws.StringValue(input.FileSystemId), out)
 
 	return out, nil
 }
@@ -35,7 +35,7 @@ func (e EFS) ListAccessPoints(ctx context.Context, fsid string) ([]*efs.AccessPo
 		FileSystemId: aws.String(fsid),
 	}
 
-	log.Infof("getting list of access points %s", fsid)
+	log.WithContext(ctx).Infof("getting list of access points %s", fsid)
 
 	output := []*efs.AccessPointDescription{}
 	for {
@@ -53,7 +53,7 @@ func (e EFS) ListAccessPoints(ctx context.Context, fsid string) ([]*efs.AccessPo
 		input.NextToken = out.NextToken
 	}
 
-	log.Debugf("got output listing access points: %+v", output)
+	log.WithContext(ctx).Debugf("got output listing access points: %+v", output)
 
 	return output, nil
 }
@@ -63,7 +63,7 @@ func (e EFS) GetAccessPoint(ctx context.Context, apid string) (*efs.AccessPointD
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("getting access point %s", apid)
+	log.WithContext(ctx).Infof("getting access point %s", apid)
 
 	out, err := e.Service.DescribeAccessPointsWithContext(ctx, &efs.DescribeAccessPointsInput{
 		AccessPointId: aws.String(apid),
@@ -72,7 +72,7 @@ func (e EFS) GetAccessPoint(ctx context.Context, apid string) (*efs.AccessPointD
 		return nil, ErrCode("failed to get access point", err)
 	}
 
-	log.Debugf("got output getting access point: %+v", out)
+	log.WithContext(ctx).Debugf("got output getting access point: %+v", out)
 
 	if len(out.AccessPoints) > 1 || len(out.AccessPoints) == 0 {
 		return nil, apierror.New(apierror.ErrBadRequest, "unexpected number of access points", nil)
@@ -86,7 +86,7 @@ func (e EFS) DeleteAccessPoint(ctx context.Context, apid string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("deleting access point %s", apid)
+	log.WithContext(ctx).Infof("deleting access point %s", apid)
 
 	if _, err := e.Service.DeleteAccessPointWithContext(ctx, &efs.DeleteAccessPointInput{
 		AccessPointId: aws.String(apid),
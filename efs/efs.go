@@ -2,6 +2,7 @@ package efs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/YaleSpinup/efs-api/common"
 	"github.com/aws/aws-sdk-go/aws"
@@ -74,10 +75,18 @@ func WithCredentials(key, secret, token, region string) EFSOption {
 	}
 }
 
+// WithDefaultKMSKeyId sets the default kms key, a key id is expanded to the ARN of the key in the account and the
+// region of the session
 func WithDefaultKMSKeyId(accountNumber, keyId string) EFSOption {
 	return func(e *EFS) {
 		log.Debugf("using default kms keyid %s", keyId)
-		e.DefaultKmsKeyId = fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", *e.session.Config.Region, accountNumber, keyId)
+
+		if strings.HasPrefix(keyId, "arn:") {
+			e.DefaultKmsKeyId = keyId
+			return
+		}
+
+		e.DefaultKmsKeyId = fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", aws.StringValue(e.session.Config.Region), accountNumber, keyId)
 	}
 }
 
@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/YaleSpinup/efs-api/common"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/efs"
 	"github.com/aws/aws-sdk-go/service/efs/efsiface"
 )
@@ -36,6 +38,30 @@ func TestNewSession(t *testing.T) {
 	}
 }
 
+func TestWithDefaultKMSKeyId(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-west-2")}))
+
+	tests := map[string]string{
+		"abcd": "arn:aws:kms:us-west-2:0123456789:key/abcd",
+		"arn:aws:kms:us-east-1:0987654321:key/efgh": "arn:aws:kms:us-east-1:0987654321:key/efgh",
+	}
+
+	for keyId, expected := range tests {
+		e := New(WithSession(sess), WithDefaultKMSKeyId("0123456789", keyId))
+		if e.DefaultKmsKeyId != expected {
+			t.Errorf("expected default kms key %s for %s, got %s", expected, keyId, e.DefaultKmsKeyId)
+		}
+	}
+}
+
+func (m *mockEFSClient) DeleteFileSystemPolicyWithContext(ctx context.Context, input *efs.DeleteFileSystemPolicyInput, opts ...request.Option) (*efs.DeleteFileSystemPolicyOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &efs.DeleteFileSystemPolicyOutput{}, nil
+}
+
 func (m *mockEFSClient) TagResourceWithContext(ctx context.Context, input *efs.TagResourceInput, opts ...request.Option) (*efs.TagResourceOutput, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -43,3 +69,11 @@ func (m *mockEFSClient) TagResourceWithContext(ctx context.Context, input *efs.T
 
 	return &efs.TagResourceOutput{}, nil
 }
+
+func (m *mockEFSClient) UntagResourceWithContext(ctx context.Context, input *efs.UntagResourceInput, opts ...request.Option) (*efs.UntagResourceOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &efs.UntagResourceOutput{}, nil
+}
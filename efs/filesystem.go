@@ -17,7 +17,7 @@ func (e *EFS) CreateFileSystem(ctx context.Context, input *efs.CreateFileSystemI
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("creating efs filesystem with input %+v", awsutil.Prettify(input))
+	log.WithContext(ctx).Infof("creating efs filesystem with input %+v", awsutil.Prettify(input))
 
 	output, err := e.Service.CreateFileSystemWithContext(ctx, input)
 	if err != nil {
@@ -33,7 +33,7 @@ func (e *EFS) DeleteFileSystem(ctx context.Context, id string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("deleting efs filesystem %s", id)
+	log.WithContext(ctx).Infof("deleting efs filesystem %s", id)
 
 	if _, err := e.Service.DeleteFileSystemWithContext(ctx, &efs.DeleteFileSystemInput{
 		FileSystemId: aws.String(id),
@@ -50,7 +50,7 @@ func (e *EFS) ListFileSystems(ctx context.Context, input *efs.DescribeFileSystem
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("listing efs filesystems with input %s", awsutil.Prettify(input))
+	log.WithContext(ctx).Infof("listing efs filesystems with input %s", awsutil.Prettify(input))
 
 	input.MaxItems = aws.Int64(100)
 	output := []string{}
@@ -70,7 +70,7 @@ func (e *EFS) ListFileSystems(ctx context.Context, input *efs.DescribeFileSystem
 		input.Marker = out.NextMarker
 	}
 
-	log.Debugf("got list of filsystems: %+v", output)
+	log.WithContext(ctx).Debugf("got list of filsystems: %+v", output)
 	return output, nil
 }
 
@@ -80,7 +80,7 @@ func (e *EFS) GetFileSystem(ctx context.Context, id string) (*efs.FileSystemDesc
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("getting details for efs filesystem %s", id)
+	log.WithContext(ctx).Infof("getting details for efs filesystem %s", id)
 
 	output, err := e.Service.DescribeFileSystemsWithContext(ctx, &efs.DescribeFileSystemsInput{
 		FileSystemId: aws.String(id),
@@ -108,11 +108,11 @@ func (e *EFS) SetFileSystemLifecycle(ctx context.Context, id, transitionToIA, tr
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("setting filesystem lifecycle for %s to %s/%s", id, transitionToIA, transitionToPrimary)
+	log.WithContext(ctx).Infof("setting filesystem lifecycle for %s to %s/%s", id, transitionToIA, transitionToPrimary)
 
 	lifecycle := []*efs.LifecyclePolicy{}
 	if transitionToIA != "" && transitionToIA != "NONE" {
-		log.Debugf("setting lifecycle policy to %s", transitionToIA)
+		log.WithContext(ctx).Debugf("setting lifecycle policy to %s", transitionToIA)
 		lifecycle = append(lifecycle, &efs.LifecyclePolicy{TransitionToIA: aws.String(transitionToIA)})
 	}
 
@@ -128,7 +128,7 @@ func (e *EFS) SetFileSystemLifecycle(ctx context.Context, id, transitionToIA, tr
 		return ErrCode("failed to set filesystem lifecycle", err)
 	}
 
-	log.Debugf("got output when setting %s lifecycle to %s/%s: %s", id, transitionToIA, transitionToPrimary, awsutil.Prettify(out))
+	log.WithContext(ctx).Debugf("got output when setting %s lifecycle to %s/%s: %s", id, transitionToIA, transitionToPrimary, awsutil.Prettify(out))
 
 	return nil
 }
@@ -139,7 +139,7 @@ func (e *EFS) GetFilesystemLifecycle(ctx context.Context, id string) (string, st
 		return "", "", apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("getting filesystem lifecycle configuration for efs filesystem %s", id)
+	log.WithContext(ctx).Infof("getting filesystem lifecycle configuration for efs filesystem %s", id)
 
 	output, err := e.Service.DescribeLifecycleConfigurationWithContext(ctx, &efs.DescribeLifecycleConfigurationInput{
 		FileSystemId: aws.String(id),
@@ -148,7 +148,7 @@ func (e *EFS) GetFilesystemLifecycle(ctx context.Context, id string) (string, st
 		return "", "", ErrCode("failed to get filesystem lifecycle configuration", err)
 	}
 
-	log.Debugf("got filesystemy lifecycle configuration for %s: %+v", id, output)
+	log.WithContext(ctx).Debugf("got filesystemy lifecycle configuration for %s: %+v", id, output)
 
 	transitionToIA := "NONE"
 	transitionToPrimary := "NONE"
@@ -173,7 +173,7 @@ func (e *EFS) SetFileSystemBackup(ctx context.Context, id, status string) error
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("setting filesystem filesystem backup policy status for %s to %s", id, status)
+	log.WithContext(ctx).Infof("setting filesystem filesystem backup policy status for %s to %s", id, status)
 
 	out, err := e.Service.PutBackupPolicyWithContext(ctx, &efs.PutBackupPolicyInput{
 		FileSystemId: aws.String(id),
@@ -185,7 +185,7 @@ func (e *EFS) SetFileSystemBackup(ctx context.Context, id, status string) error
 		return ErrCode("failed to set filesystem backup policy status", err)
 	}
 
-	log.Debugf("got output when setting %s backup policy status to to %s: %s", id, status, awsutil.Prettify(out))
+	log.WithContext(ctx).Debugf("got output when setting %s backup policy status to to %s: %s", id, status, awsutil.Prettify(out))
 
 	return nil
 }
@@ -196,7 +196,7 @@ func (e *EFS) GetFilesystemBackup(ctx context.Context, id string) (string, error
 		return "", apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("getting filesystem backup policy status for efs filesystem %s", id)
+	log.WithContext(ctx).Infof("getting filesystem backup policy status for efs filesystem %s", id)
 
 	out, err := e.Service.DescribeBackupPolicyWithContext(ctx, &efs.DescribeBackupPolicyInput{
 		FileSystemId: aws.String(id),
@@ -205,7 +205,7 @@ func (e *EFS) GetFilesystemBackup(ctx context.Context, id string) (string, error
 		return "", ErrCode("failed to get filesystem backup policy status", err)
 	}
 
-	log.Debugf("got filesystem backup policy status for %s: %+v", id, awsutil.Prettify(out))
+	log.WithContext(ctx).Debugf("got filesystem backup policy status for %s: %+v", id, awsutil.Prettify(out))
 
 	if out.BackupPolicy != nil {
 		return aws.StringValue(out.BackupPolicy.Status), nil
@@ -219,7 +219,7 @@ func (e *EFS) SetFileSystemPolicy(ctx context.Context, id, policy string) error
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("setting filesystem policy for efs filesystem %s to %s", id, policy)
+	log.WithContext(ctx).Infof("setting filesystem policy for efs filesystem %s to %s", id, policy)
 
 	out, err := e.Service.PutFileSystemPolicyWithContext(ctx, &efs.PutFileSystemPolicyInput{
 		FileSystemId: aws.String(id),
@@ -229,7 +229,7 @@ func (e *EFS) SetFileSystemPolicy(ctx context.Context, id, policy string) error
 		return ErrCode("failed to set filesystem policy", err)
 	}
 
-	log.Debugf("got output when setting filesystem policy for %s: %+v", id, awsutil.Prettify(out))
+	log.WithContext(ctx).Debugf("got output when setting filesystem policy for %s: %+v", id, awsutil.Prettify(out))
 
 	return nil
 }
@@ -239,7 +239,7 @@ func (e *EFS) GetFileSystemPolicy(ctx context.Context, id string) (string, error
 		return "", apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("getting filesystem policy for efs filesystem %s", id)
+	log.WithContext(ctx).Infof("getting filesystem policy for efs filesystem %s", id)
 
 	out, err := e.Service.DescribeFileSystemPolicyWithContext(ctx, &efs.DescribeFileSystemPolicyInput{
 		FileSystemId: aws.String(id),
@@ -248,17 +248,34 @@ func (e *EFS) GetFileSystemPolicy(ctx context.Context, id string) (string, error
 		return "", ErrCode("failed to get filesystem policy", err)
 	}
 
-	log.Debugf("got output when describing filesystem policy for %s: %+v", id, awsutil.Prettify(out))
+	log.WithContext(ctx).Debugf("got output when describing filesystem policy for %s: %+v", id, awsutil.Prettify(out))
 
 	return aws.StringValue(out.Policy), nil
 }
 
+// DeleteFileSystemPolicy deletes the filesystem policy, restoring the default policy
+func (e *EFS) DeleteFileSystemPolicy(ctx context.Context, id string) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.WithContext(ctx).Infof("deleting filesystem policy for efs filesystem %s", id)
+
+	if _, err := e.Service.DeleteFileSystemPolicyWithContext(ctx, &efs.DeleteFileSystemPolicyInput{
+		FileSystemId: aws.String(id),
+	}); err != nil {
+		return ErrCode("failed to delete filesystem policy", err)
+	}
+
+	return nil
+}
+
 func (e *EFS) TagFilesystem(ctx context.Context, id string, tags []*efs.Tag) error {
 	if id == "" || tags == nil {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("tagging filesystem %s", id)
+	log.WithContext(ctx).Infof("tagging filesystem %s", id)
 
 	if _, err := e.Service.TagResourceWithContext(ctx, &efs.TagResourceInput{
 		ResourceId: aws.String(id),
@@ -267,7 +284,25 @@ func (e *EFS) TagFilesystem(ctx context.Context, id string, tags []*efs.Tag) err
 		return ErrCode("failed to tag filesystem ", err)
 	}
 
-	log.Debugf("successfully applied tags to %s: %s", id, awsutil.Prettify(tags))
+	log.WithContext(ctx).Debugf("successfully applied tags to %s: %s", id, awsutil.Prettify(tags))
+
+	return nil
+}
+
+// UntagFilesystem removes the tags with the given keys from the filesystem
+func (e *EFS) UntagFilesystem(ctx context.Context, id string, keys []string) error {
+	if id == "" || len(keys) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.WithContext(ctx).Infof("removing tags %+v from filesystem %s", keys, id)
+
+	if _, err := e.Service.UntagResourceWithContext(ctx, &efs.UntagResourceInput{
+		ResourceId: aws.String(id),
+		TagKeys:    aws.StringSlice(keys),
+	}); err != nil {
+		return ErrCode("failed to untag filesystem", err)
+	}
 
 	return nil
 }
@@ -915,6 +915,28 @@ func TestEFS_SetFileSystemPolicy(t *testing.T) {
 	}
 }
 
+func TestEFS_DeleteFileSystemPolicy(t *testing.T) {
+	e := EFS{Service: newMockEFSClient(t, nil)}
+
+	if err := e.DeleteFileSystemPolicy(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	if err := e.DeleteFileSystemPolicy(context.TODO(), "fs-12345"); err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
+	e.Service.(*mockEFSClient).err = awserr.New(efs.ErrCodeFileSystemNotFound, "not found", nil)
+	err := e.DeleteFileSystemPolicy(context.TODO(), "fs-12345")
+	if aerr, ok := err.(apierror.Error); ok {
+		if aerr.Code != apierror.ErrNotFound {
+			t.Errorf("expected error code %s, got: %s", apierror.ErrNotFound, aerr.Code)
+		}
+	} else {
+		t.Errorf("expected apierror.Error, got: %s", reflect.TypeOf(err).String())
+	}
+}
+
 func TestEFS_GetFileSystemPolicy(t *testing.T) {
 	type fields struct {
 		session         *session.Session
@@ -959,3 +981,29 @@ func TestEFS_GetFileSystemPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestUntagFileSystem(t *testing.T) {
+	e := EFS{Service: newMockEFSClient(t, nil)}
+
+	if err := e.UntagFilesystem(context.TODO(), "", []string{"foo"}); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	if err := e.UntagFilesystem(context.TODO(), "fs-12345", nil); err == nil {
+		t.Error("expected error for empty keys, got nil")
+	}
+
+	if err := e.UntagFilesystem(context.TODO(), "fs-12345", []string{"foo", "fuu"}); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	e.Service.(*mockEFSClient).err = awserr.New(efs.ErrCodeFileSystemNotFound, "not found", nil)
+	err := e.UntagFilesystem(context.TODO(), "fs-12345", []string{"foo"})
+	if aerr, ok := err.(apierror.Error); ok {
+		if aerr.Code != apierror.ErrNotFound {
+			t.Errorf("expected error code %s, got: %s", apierror.ErrNotFound, aerr.Code)
+		}
+	} else {
+		t.Errorf("expected apierror.Error, got: %s", reflect.TypeOf(err).String())
+	}
+}
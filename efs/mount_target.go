@@ -16,7 +16,7 @@ func (e *EFS) CreateMountTarget(ctx context.Context, input *efs.CreateMountTarge
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("creating efs mount target for fs %s in %s with sgs %+v", aws.StringValue(input.FileSystemId), aws.StringValue(input.SubnetId), aws.StringValueSlice(input.SecurityGroups))
+	log.WithContext(ctx).Infof("creating efs mount target for fs %s in %s with sgs %+v", aws.StringValue(input.FileSystemId), aws.StringValue(input.SubnetId), aws.StringValueSlice(input.SecurityGroups))
 
 	output, err := e.Service.CreateMountTargetWithContext(ctx, input)
 	if err != nil {
@@ -32,7 +32,7 @@ func (e *EFS) ListMountTargetsForFileSystem(ctx context.Context, id string) ([]*
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("listing efs mount targets for fs %s", id)
+	log.WithContext(ctx).Infof("listing efs mount targets for fs %s", id)
 
 	output, err := e.Service.DescribeMountTargetsWithContext(ctx, &efs.DescribeMountTargetsInput{
 		MaxItems:     aws.Int64(100),
@@ -42,7 +42,7 @@ func (e *EFS) ListMountTargetsForFileSystem(ctx context.Context, id string) ([]*
 		return nil, ErrCode("failed to list mount targets for filesystem", err)
 	}
 
-	log.Debugf("got list of mount targets for fs %s: %s", id, awsutil.Prettify(output.MountTargets))
+	log.WithContext(ctx).Debugf("got list of mount targets for fs %s: %s", id, awsutil.Prettify(output.MountTargets))
 
 	return output.MountTargets, nil
 }
@@ -53,7 +53,7 @@ func (e *EFS) DeleteMountTarget(ctx context.Context, id string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Infof("deleting mount target %s", id)
+	log.WithContext(ctx).Infof("deleting mount target %s", id)
 
 	_, err := e.Service.DeleteMountTargetWithContext(ctx, &efs.DeleteMountTargetInput{
 		MountTargetId: aws.String(id),
@@ -64,3 +64,39 @@ func (e *EFS) DeleteMountTarget(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// GetMountTargetSecurityGroups gets the security groups of a mount target
+func (e *EFS) GetMountTargetSecurityGroups(ctx context.Context, id string) ([]string, error) {
+	if id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.WithContext(ctx).Infof("getting security groups for mount target %s", id)
+
+	output, err := e.Service.DescribeMountTargetSecurityGroupsWithContext(ctx, &efs.DescribeMountTargetSecurityGroupsInput{
+		MountTargetId: aws.String(id),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get security groups for mount target", err)
+	}
+
+	return aws.StringValueSlice(output.SecurityGroups), nil
+}
+
+// SetMountTargetSecurityGroups replaces the security groups of a mount target
+func (e *EFS) SetMountTargetSecurityGroups(ctx context.Context, id string, sgs []string) error {
+	if id == "" || len(sgs) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.WithContext(ctx).Infof("setting security groups for mount target %s to %+v", id, sgs)
+
+	if _, err := e.Service.ModifyMountTargetSecurityGroupsWithContext(ctx, &efs.ModifyMountTargetSecurityGroupsInput{
+		MountTargetId:  aws.String(id),
+		SecurityGroups: aws.StringSlice(sgs),
+	}); err != nil {
+		return ErrCode("failed to set security groups for mount target", err)
+	}
+
+	return nil
+}
@@ -418,3 +418,83 @@ func TestDeleteMountTarget(t *testing.T) {
 		t.Errorf("expected apierror.Error, got: %s", reflect.TypeOf(err).String())
 	}
 }
+
+func (m *mockEFSClient) DescribeMountTargetSecurityGroupsWithContext(ctx context.Context, input *efs.DescribeMountTargetSecurityGroupsInput, opts ...request.Option) (*efs.DescribeMountTargetSecurityGroupsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, mt := range testMountTargets {
+		if aws.StringValue(mt.MountTargetId) == aws.StringValue(input.MountTargetId) {
+			return &efs.DescribeMountTargetSecurityGroupsOutput{
+				SecurityGroups: aws.StringSlice([]string{"sg-00000001", "sg-00000002"}),
+			}, nil
+		}
+	}
+
+	return nil, awserr.New(efs.ErrCodeMountTargetNotFound, "mount target not found", nil)
+}
+
+func (m *mockEFSClient) ModifyMountTargetSecurityGroupsWithContext(ctx context.Context, input *efs.ModifyMountTargetSecurityGroupsInput, opts ...request.Option) (*efs.ModifyMountTargetSecurityGroupsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if aws.StringValue(input.MountTargetId) == "fsmt-012345" {
+		return &efs.ModifyMountTargetSecurityGroupsOutput{}, nil
+	}
+
+	return nil, awserr.New(efs.ErrCodeMountTargetNotFound, "mount target not found", nil)
+}
+
+func TestGetMountTargetSecurityGroups(t *testing.T) {
+	e := EFS{Service: newMockEFSClient(t, nil)}
+
+	if _, err := e.GetMountTargetSecurityGroups(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty input, got nil")
+	}
+
+	out, err := e.GetMountTargetSecurityGroups(context.TODO(), "fsmt-00112233445566aa")
+	if err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	if expected := []string{"sg-00000001", "sg-00000002"}; !reflect.DeepEqual(expected, out) {
+		t.Errorf("expected %+v, got %+v", expected, out)
+	}
+
+	_, err = e.GetMountTargetSecurityGroups(context.TODO(), "fsmt-missing")
+	if aerr, ok := err.(apierror.Error); ok {
+		if aerr.Code != apierror.ErrNotFound {
+			t.Errorf("expected error code %s, got: %s", apierror.ErrNotFound, aerr.Code)
+		}
+	} else {
+		t.Errorf("expected apierror.Error, got: %s", reflect.TypeOf(err).String())
+	}
+}
+
+func TestSetMountTargetSecurityGroups(t *testing.T) {
+	e := EFS{Service: newMockEFSClient(t, nil)}
+
+	if err := e.SetMountTargetSecurityGroups(context.TODO(), "fsmt-012345", []string{"sg-12345"}); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	if err := e.SetMountTargetSecurityGroups(context.TODO(), "", []string{"sg-12345"}); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	if err := e.SetMountTargetSecurityGroups(context.TODO(), "fsmt-012345", nil); err == nil {
+		t.Error("expected error for empty security groups, got nil")
+	}
+
+	e.Service.(*mockEFSClient).err = awserr.New(efs.ErrCodeInternalServerError, "internal error", nil)
+	err := e.SetMountTargetSecurityGroups(context.TODO(), "fsmt-012345", []string{"sg-12345"})
+	if aerr, ok := err.(apierror.Error); ok {
+		if aerr.Code != apierror.ErrServiceUnavailable {
+			t.Errorf("expected error code %s, got: %s", apierror.ErrServiceUnavailable, aerr.Code)
+		}
+	} else {
+		t.Errorf("expected apierror.Error, got: %s", reflect.TypeOf(err).String())
+	}
+}
@@ -0,0 +1,129 @@
+package efs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/efs-api/waiter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// WaitForFileSystemState waits for the filesystem to be in the lifecycle state
+func (e *EFS) WaitForFileSystemState(ctx context.Context, w *waiter.Waiter, id, state string) error {
+	log.WithContext(ctx).Infof("waiting for efs filesystem %s to be %s", id, state)
+
+	return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		fs, err := e.GetFileSystem(ctx, id)
+		if err != nil {
+			return false, waitError(err)
+		}
+
+		current := aws.StringValue(fs.LifeCycleState)
+		if current == state {
+			return true, nil
+		}
+
+		err = fmt.Errorf("filesystem %s is not yet %s (%s)", id, state, current)
+		if terminalState(current, state) {
+			return false, waiter.Terminal(err)
+		}
+
+		return false, err
+	})
+}
+
+// WaitForMountTargetsState waits for all of the mount targets of the filesystem to be in the lifecycle state
+func (e *EFS) WaitForMountTargetsState(ctx context.Context, w *waiter.Waiter, fsid, state string) error {
+	log.WithContext(ctx).Infof("waiting for mount targets of efs filesystem %s to be %s", fsid, state)
+
+	return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		mts, err := e.ListMountTargetsForFileSystem(ctx, fsid)
+		if err != nil {
+			return false, waitError(err)
+		}
+
+		for _, mt := range mts {
+			current := aws.StringValue(mt.LifeCycleState)
+			if current == state {
+				continue
+			}
+
+			err := fmt.Errorf("filesystem %s mount target %s is not yet %s (%s)", fsid, aws.StringValue(mt.MountTargetId), state, current)
+			if terminalState(current, state) {
+				return false, waiter.Terminal(err)
+			}
+
+			return false, err
+		}
+
+		return true, nil
+	})
+}
+
+// WaitForNoMountTargets waits for the filesystem to have no mount targets
+func (e *EFS) WaitForNoMountTargets(ctx context.Context, w *waiter.Waiter, fsid string) error {
+	log.WithContext(ctx).Infof("waiting for number of mount targets of efs filesystem %s to be 0", fsid)
+
+	return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		fs, err := e.GetFileSystem(ctx, fsid)
+		if err != nil {
+			return false, waitError(err)
+		}
+
+		if num := aws.Int64Value(fs.NumberOfMountTargets); num > 0 {
+			return false, fmt.Errorf("waiting for number of mount targets for filesystem %s to be 0 (current: %d)", fsid, num)
+		}
+
+		return true, nil
+	})
+}
+
+// WaitForAccessPointState waits for the access point to be in the lifecycle state
+func (e *EFS) WaitForAccessPointState(ctx context.Context, w *waiter.Waiter, apid, state string) error {
+	log.WithContext(ctx).Infof("waiting for access point %s to be %s", apid, state)
+
+	return w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		ap, err := e.GetAccessPoint(ctx, apid)
+		if err != nil {
+			return false, waitError(err)
+		}
+
+		current := aws.StringValue(ap.LifeCycleState)
+		if current == state {
+			return true, nil
+		}
+
+		err = fmt.Errorf("accesspoint %s is not yet %s (%s)", apid, state, current)
+		if terminalState(current, state) {
+			return false, waiter.Terminal(err)
+		}
+
+		return false, err
+	})
+}
+
+// terminalState returns true if a resource in the current lifecycle state won't reach the expected state
+func terminalState(current, expected string) bool {
+	switch current {
+	case "error":
+		return true
+	case "deleting", "deleted":
+		return expected != "deleting" && expected != "deleted"
+	}
+	return false
+}
+
+// waitError stops waiting on errors that won't go away by waiting, missing resources and denied access.  Other
+// errors, like throttling, are retried.
+func waitError(err error) error {
+	if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+		switch aerr.Code {
+		case apierror.ErrNotFound, apierror.ErrForbidden:
+			return waiter.Terminal(err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package efs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/efs-api/waiter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/efs/efsiface"
+)
+
+// testClock advances its time by the duration passed to After instead of sleeping
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// mockWaiterClient returns the next lifecycle state of the filesystem, mount target or access point each time
+// it's described, repeating the last state
+type mockWaiterClient struct {
+	efsiface.EFSAPI
+	states []string
+	calls  int
+	err    error
+}
+
+func (m *mockWaiterClient) next() string {
+	state := m.states[len(m.states)-1]
+	if m.calls < len(m.states) {
+		state = m.states[m.calls]
+	}
+	m.calls++
+	return state
+}
+
+func (m *mockWaiterClient) DescribeFileSystemsWithContext(ctx context.Context, input *efs.DescribeFileSystemsInput, opts ...request.Option) (*efs.DescribeFileSystemsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	state := m.next()
+
+	// the number of mount targets is passed as the state
+	var num int64
+	if state == "1" {
+		num = 1
+	}
+
+	return &efs.DescribeFileSystemsOutput{
+		FileSystems: []*efs.FileSystemDescription{
+			{
+				FileSystemId:         input.FileSystemId,
+				LifeCycleState:       aws.String(state),
+				NumberOfMountTargets: aws.Int64(num),
+			},
+		},
+	}, nil
+}
+
+func (m *mockWaiterClient) DescribeMountTargetsWithContext(ctx context.Context, input *efs.DescribeMountTargetsInput, opts ...request.Option) (*efs.DescribeMountTargetsOutput, error) {
+	state := m.next()
+	return &efs.DescribeMountTargetsOutput{
+		MountTargets: []*efs.MountTargetDescription{
+			{MountTargetId: aws.String("fsmt-1"), LifeCycleState: aws.String("available")},
+			{MountTargetId: aws.String("fsmt-2"), LifeCycleState: aws.String(state)},
+		},
+	}, nil
+}
+
+func (m *mockWaiterClient) DescribeAccessPointsWithContext(ctx context.Context, input *efs.DescribeAccessPointsInput, opts ...request.Option) (*efs.DescribeAccessPointsOutput, error) {
+	return &efs.DescribeAccessPointsOutput{
+		AccessPoints: []*efs.AccessPointDescription{
+			{AccessPointId: input.AccessPointId, LifeCycleState: aws.String(m.next())},
+		},
+	}, nil
+}
+
+func newTestWaiter() *waiter.Waiter {
+	return waiter.New(waiter.WithClock(&testClock{}), waiter.WithInterval(time.Second), waiter.WithTimeout(10*time.Second))
+}
+
+func TestEFS_WaitForFileSystemState(t *testing.T) {
+	tests := []struct {
+		name     string
+		states   []string
+		err      error
+		calls    int
+		terminal bool
+		timeout  bool
+	}{
+		{
+			name:   "available",
+			states: []string{"creating", "creating", "available"},
+			calls:  3,
+		},
+		{
+			name:     "error state",
+			states:   []string{"creating", "error"},
+			calls:    2,
+			terminal: true,
+		},
+		{
+			name:     "deleted",
+			states:   []string{"deleted"},
+			calls:    1,
+			terminal: true,
+		},
+		{
+			name:    "timeout",
+			states:  []string{"creating"},
+			calls:   11,
+			timeout: true,
+		},
+		{
+			name:     "not found",
+			err:      awserr.New(efs.ErrCodeFileSystemNotFound, "not found", nil),
+			terminal: true,
+		},
+		{
+			name:    "throttled",
+			err:     awserr.New("ThrottlingException", "slow down", nil),
+			timeout: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockWaiterClient{states: tt.states, err: tt.err}
+			e := EFS{Service: client}
+
+			err := e.WaitForFileSystemState(context.TODO(), newTestWaiter(), "fs-123", "available")
+			if tt.terminal != waiter.IsTerminal(err) {
+				t.Errorf("expected terminal %t, got error %v", tt.terminal, err)
+			}
+
+			if tt.timeout != errors.Is(err, waiter.ErrTimeout) {
+				t.Errorf("expected timeout %t, got error %v", tt.timeout, err)
+			}
+
+			if !tt.terminal && !tt.timeout && err != nil {
+				t.Errorf("expected nil error, got %s", err)
+			}
+
+			if tt.err == nil && client.calls != tt.calls {
+				t.Errorf("expected %d calls, got %d", tt.calls, client.calls)
+			}
+		})
+	}
+}
+
+func TestEFS_WaitForMountTargetsState(t *testing.T) {
+	e := EFS{Service: &mockWaiterClient{states: []string{"creating", "available"}}}
+	if err := e.WaitForMountTargetsState(context.TODO(), newTestWaiter(), "fs-123", "available"); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	e = EFS{Service: &mockWaiterClient{states: []string{"creating", "error"}}}
+	if err := e.WaitForMountTargetsState(context.TODO(), newTestWaiter(), "fs-123", "available"); !waiter.IsTerminal(err) {
+		t.Errorf("expected terminal error, got %v", err)
+	}
+}
+
+func TestEFS_WaitForNoMountTargets(t *testing.T) {
+	client := &mockWaiterClient{states: []string{"1", "1", "0"}}
+	e := EFS{Service: client}
+	if err := e.WaitForNoMountTargets(context.TODO(), newTestWaiter(), "fs-123"); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	if client.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", client.calls)
+	}
+}
+
+func TestEFS_WaitForAccessPointState(t *testing.T) {
+	e := EFS{Service: &mockWaiterClient{states: []string{"creating", "available"}}}
+	if err := e.WaitForAccessPointState(context.TODO(), newTestWaiter(), "fsap-123", "available"); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := e.WaitForAccessPointState(ctx, newTestWaiter(), "fsap-123", "available"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled error, got %v", err)
+	}
+}
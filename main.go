@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/YaleSpinup/efs-api/api"
 	"github.com/YaleSpinup/efs-api/common"
@@ -58,7 +59,7 @@ func main() {
 	}
 	log.Infof("Starting efs-api version %s (%s)", Version, cwd)
 
-	config, err := common.ReadConfig(configReader())
+	config, err := loadConfig()
 	if err != nil {
 		log.Fatalf("Unable to read configuration from: %+v", err)
 	}
@@ -69,16 +70,7 @@ func main() {
 	}
 
 	// Set the loglevel, info if it's unset
-	switch config.LogLevel {
-	case "error":
-		log.SetLevel(log.ErrorLevel)
-	case "warn":
-		log.SetLevel(log.WarnLevel)
-	case "debug":
-		log.SetLevel(log.DebugLevel)
-	default:
-		log.SetLevel(log.InfoLevel)
-	}
+	common.SetLogLevel(config.LogLevel)
 
 	if config.LogLevel == "debug" {
 		log.Debug("starting profiler on 127.0.0.1:6080")
@@ -86,12 +78,31 @@ func main() {
 	}
 	log.Debugf("read config: %+v", config)
 
-	if err := api.NewServer(config); err != nil {
+	// reload the configuration from the file on SIGHUP and when it changes.  The API_CONFIG environment of
+	// a running process can't change, so there's no file to watch and SIGHUP reads the same configuration again.
+	opts := []api.ServerOption{api.WithConfigLoader(loadConfig)}
+	if os.Getenv("API_CONFIG") != "" {
+		log.Warn("configuration read from API_CONFIG doesn't change until a restart, use -config to reload it")
+	} else {
+		opts = append(opts, api.WithConfigWatch(*configFileName, 30*time.Second))
+	}
+
+	if err := api.NewServer(config, opts...); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func configReader() io.Reader {
+// loadConfig reads the configuration from the API_CONFIG environment or the configuration file
+func loadConfig() (common.Config, error) {
+	r, err := configReader()
+	if err != nil {
+		return common.Config{}, err
+	}
+
+	return common.ReadConfig(r)
+}
+
+func configReader() (io.Reader, error) {
 	if configEnv := os.Getenv("API_CONFIG"); configEnv != "" {
 		log.Infof("reading configuration from API_CONFIG environment")
 
@@ -101,22 +112,23 @@ func configReader() io.Reader {
 			c = []byte(configEnv)
 		}
 
-		return bytes.NewReader(c)
+		return bytes.NewReader(c), nil
 	}
 
 	log.Infof("reading configuration from %s", *configFileName)
 
 	configFile, err := os.Open(*configFileName)
 	if err != nil {
-		log.Fatalln("unable to open config file", err)
+		return nil, fmt.Errorf("unable to open config file: %s", err)
 	}
+	defer configFile.Close()
 
 	c, err := ioutil.ReadAll(configFile)
 	if err != nil {
-		log.Fatalln("unable to read config file", err)
+		return nil, fmt.Errorf("unable to read config file: %s", err)
 	}
 
-	return bytes.NewReader(c)
+	return bytes.NewReader(c), nil
 }
 
 func vers() {
@@ -0,0 +1,237 @@
+// Package saga runs multi-step orchestrations where each step declares how to undo it.  When a step fails,
+// the completed steps are compensated (undone) in reverse order.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrResumedCompensating is the error of a saga resumed while it was compensating a failed step
+var ErrResumedCompensating = errors.New("resumed saga was compensating a failed step")
+
+// Step is a named step of a saga.  Do runs the step and Undo, if it's set, compensates it after a later
+// step fails.  Undo should be idempotent, it may be run again if a compensation is resumed.
+type Step struct {
+	Name string
+	Do   func(ctx context.Context) error
+	Undo func(ctx context.Context) error
+}
+
+// Checkpoint is the progress of a saga, passed to the checkpoint function after every step and compensation
+type Checkpoint struct {
+	// Completed are the names of the completed steps that haven't been compensated, in order
+	Completed []string
+
+	// Compensating is true once a step failed and the completed steps are being compensated
+	Compensating bool
+}
+
+// Error is the error of a failed saga.  It has the message of the error of the failed step.
+type Error struct {
+	// Step is the name of the failed step, empty if the saga was resumed while it was compensating
+	Step string
+
+	// Err is the error of the failed step
+	Err error
+
+	// Interrupted is true if the saga was interrupted before the completed steps were compensated
+	Interrupted bool
+
+	// Compensations are the errors of the undo functions that failed
+	Compensations []error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Cause returns the error of the failed step for github.com/pkg/errors
+func (e *Error) Cause() error { return e.Err }
+
+// Saga is a list of steps run in order
+type Saga struct {
+	name                string
+	steps               []Step
+	completed           []string
+	compensating        bool
+	compensationTimeout time.Duration
+	checkpoint          func(Checkpoint)
+	interrupted         func() bool
+	progress            func(string)
+}
+
+type SagaOption func(*Saga)
+
+// New creates a saga with the steps
+func New(name string, steps []Step, opts ...SagaOption) *Saga {
+	s := &Saga{
+		name:                name,
+		steps:               steps,
+		compensationTimeout: 2 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithCompleted sets the steps that already completed, they're skipped when the saga runs but compensated if
+// a later step fails.  It's used to resume a saga or for steps that ran before the saga started.
+func WithCompleted(completed ...string) SagaOption {
+	return func(s *Saga) {
+		s.completed = append([]string{}, completed...)
+	}
+}
+
+// WithCompensating resumes a saga that was compensating, only its completed steps are compensated
+func WithCompensating(compensating bool) SagaOption {
+	return func(s *Saga) {
+		s.compensating = compensating
+	}
+}
+
+// WithCompensationTimeout sets the timeout for compensating the completed steps, 2 minutes by default
+func WithCompensationTimeout(timeout time.Duration) SagaOption {
+	return func(s *Saga) {
+		s.compensationTimeout = timeout
+	}
+}
+
+// WithCheckpoint sets a function called with the progress of the saga after each step and compensation, for
+// example to persist it so the saga can be resumed
+func WithCheckpoint(checkpoint func(Checkpoint)) SagaOption {
+	return func(s *Saga) {
+		s.checkpoint = checkpoint
+	}
+}
+
+// WithInterrupted sets a function reporting whether the saga was interrupted.  A failed saga that's
+// interrupted stops without compensating its remaining completed steps so it can be resumed.
+func WithInterrupted(interrupted func() bool) SagaOption {
+	return func(s *Saga) {
+		s.interrupted = interrupted
+	}
+}
+
+// WithProgress sets a function called with progress messages as steps fail and are compensated
+func WithProgress(progress func(string)) SagaOption {
+	return func(s *Saga) {
+		s.progress = progress
+	}
+}
+
+// Completed returns the names of the completed steps that haven't been compensated
+func (s *Saga) Completed() []string {
+	return append([]string{}, s.completed...)
+}
+
+// Run runs the steps that haven't completed in order.  If a step fails, the completed steps are compensated
+// in reverse order with a context that isn't cancelled with ctx and an *Error is returned.
+func (s *Saga) Run(ctx context.Context) error {
+	if s.compensating {
+		return s.compensate(ctx, &Error{Err: ErrResumedCompensating})
+	}
+
+	for _, step := range s.steps {
+		if s.isCompleted(step.Name) {
+			continue
+		}
+
+		log.Debugf("running step %s of saga %s", step.Name, s.name)
+
+		if err := step.Do(ctx); err != nil {
+			s.report(fmt.Sprintf("step %s failed: %s", step.Name, err))
+			return s.compensate(ctx, &Error{Step: step.Name, Err: err})
+		}
+
+		s.completed = append(s.completed, step.Name)
+		s.save()
+	}
+
+	return nil
+}
+
+// compensate undoes the completed steps in reverse order, unless the saga is interrupted
+func (s *Saga) compensate(ctx context.Context, serr *Error) error {
+	if s.isInterrupted() {
+		serr.Interrupted = true
+		return serr
+	}
+
+	s.compensating = true
+	s.save()
+
+	log.Errorf("recovering from error: %s, compensating %d steps of saga %s", serr.Err, len(s.completed), s.name)
+
+	// the compensation isn't stopped by the cancellation of the saga
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.compensationTimeout)
+	defer cancel()
+
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if !s.isCompleted(step.Name) {
+			continue
+		}
+
+		if step.Undo != nil {
+			if s.isInterrupted() {
+				serr.Interrupted = true
+				return serr
+			}
+
+			s.report(fmt.Sprintf("compensating step %s", step.Name))
+
+			if err := step.Undo(cctx); err != nil {
+				log.Errorf("compensation of step %s of saga %s error: %s, continuing compensation", step.Name, s.name, err)
+				s.report(fmt.Sprintf("failed to compensate step %s: %s", step.Name, err))
+				serr.Compensations = append(serr.Compensations, fmt.Errorf("%s: %w", step.Name, err))
+			}
+		}
+
+		s.remove(step.Name)
+		s.save()
+	}
+
+	return serr
+}
+
+func (s *Saga) isCompleted(name string) bool {
+	for _, c := range s.completed {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Saga) remove(name string) {
+	for i, c := range s.completed {
+		if c == name {
+			s.completed = append(s.completed[:i:i], s.completed[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Saga) isInterrupted() bool {
+	return s.interrupted != nil && s.interrupted()
+}
+
+func (s *Saga) save() {
+	if s.checkpoint != nil {
+		s.checkpoint(Checkpoint{Completed: s.Completed(), Compensating: s.compensating})
+	}
+}
+
+func (s *Saga) report(msg string) {
+	if s.progress != nil {
+		s.progress(msg)
+	}
+}
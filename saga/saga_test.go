@@ -0,0 +1,190 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testSteps returns steps named a, b and c that record their runs and compensations, failing the named step
+func testSteps(fail string, calls *[]string) []Step {
+	steps := []Step{}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		steps = append(steps, Step{
+			Name: name,
+			Do: func(ctx context.Context) error {
+				*calls = append(*calls, "do "+name)
+				if name == fail {
+					return errors.New("boom")
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				*calls = append(*calls, "undo "+name)
+				return nil
+			},
+		})
+	}
+	return steps
+}
+
+func TestRun(t *testing.T) {
+	calls := []string{}
+	checkpoints := []Checkpoint{}
+
+	s := New("test", testSteps("", &calls), WithCheckpoint(func(c Checkpoint) { checkpoints = append(checkpoints, c) }))
+	if err := s.Run(context.TODO()); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if expected := []string{"do a", "do b", "do c"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	expected := []Checkpoint{{Completed: []string{"a"}}, {Completed: []string{"a", "b"}}, {Completed: []string{"a", "b", "c"}}}
+	if !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %+v, got %+v", expected, checkpoints)
+	}
+}
+
+func TestRunCompleted(t *testing.T) {
+	calls := []string{}
+
+	s := New("test", testSteps("", &calls), WithCompleted("a", "b"))
+	if err := s.Run(context.TODO()); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if expected := []string{"do c"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected only the remaining step to run, got %v", calls)
+	}
+
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(s.Completed(), expected) {
+		t.Errorf("expected completed %v, got %v", expected, s.Completed())
+	}
+}
+
+func TestRunCompensate(t *testing.T) {
+	calls := []string{}
+	messages := []string{}
+	checkpoints := []Checkpoint{}
+
+	steps := testSteps("c", &calls)
+	steps[0].Undo = func(ctx context.Context) error {
+		calls = append(calls, "undo a")
+		return errors.New("bang")
+	}
+
+	s := New("test", steps,
+		WithCompleted("a"),
+		WithCheckpoint(func(c Checkpoint) { checkpoints = append(checkpoints, c) }),
+		WithProgress(func(msg string) { messages = append(messages, msg) }),
+	)
+
+	err := s.Run(context.TODO())
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// the steps completed before the saga ran are compensated too
+	if expected := []string{"do b", "do c", "undo b", "undo a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	var serr *Error
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected saga error, got %T", err)
+	}
+
+	if serr.Step != "c" || err.Error() != "boom" || serr.Interrupted || len(serr.Compensations) != 1 {
+		t.Errorf("unexpected saga error %+v", serr)
+	}
+
+	if serr.Cause() != serr.Err {
+		t.Errorf("expected cause to be the step error, got %v", serr.Cause())
+	}
+
+	expected := []Checkpoint{
+		{Completed: []string{"a", "b"}},
+		{Completed: []string{"a", "b"}, Compensating: true},
+		{Completed: []string{"a"}, Compensating: true},
+		{Completed: []string{}, Compensating: true},
+	}
+	if !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %+v, got %+v", expected, checkpoints)
+	}
+
+	expectedMessages := []string{"step c failed: boom", "compensating step b", "compensating step a", "failed to compensate step a: bang"}
+	if !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("expected messages %v, got %v", expectedMessages, messages)
+	}
+}
+
+func TestRunCompensateCancelled(t *testing.T) {
+	calls := []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	steps := testSteps("", &calls)
+	steps[0].Undo = func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			t.Error("expected compensation context not to be cancelled")
+		}
+		calls = append(calls, "undo a")
+		return nil
+	}
+	steps[1].Do = func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	err := New("test", steps).Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+
+	if expected := []string{"do a", "undo a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestRunResumedCompensating(t *testing.T) {
+	calls := []string{}
+
+	err := New("test", testSteps("", &calls), WithCompleted("a"), WithCompensating(true)).Run(context.TODO())
+	if !errors.Is(err, ErrResumedCompensating) {
+		t.Fatalf("expected resumed compensating error, got %v", err)
+	}
+
+	if expected := []string{"undo a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	calls := []string{}
+	interrupted := false
+
+	steps := testSteps("", &calls)
+	steps[1].Do = func(ctx context.Context) error {
+		interrupted = true
+		return context.Canceled
+	}
+
+	s := New("test", steps, WithInterrupted(func() bool { return interrupted }))
+
+	var serr *Error
+	if err := s.Run(context.TODO()); !errors.As(err, &serr) || !serr.Interrupted {
+		t.Fatalf("expected interrupted saga error, got %v", err)
+	}
+
+	// the completed steps aren't compensated so the saga can be resumed
+	if expected := []string{"do a"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	if expected := []string{"a"}; !reflect.DeepEqual(s.Completed(), expected) {
+		t.Errorf("expected completed %v, got %v", expected, s.Completed())
+	}
+}
@@ -0,0 +1,158 @@
+// Package waiter polls a resource until it reaches the expected state, at a fixed interval and for at most a
+// maximum duration.  Waiting stops when the context is cancelled or the check returns a terminal error.
+package waiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is the error of a wait that didn't finish within its maximum duration
+var ErrTimeout = errors.New("timeout waiting")
+
+// Clock is the time source of a waiter, replaced with a fake clock in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Check checks the state of a resource, returning true when the wait is over.  An error returned with false
+// is transient and the resource is checked again after the interval, unless it's wrapped with Terminal.
+type Check func(ctx context.Context) (bool, error)
+
+// terminalError is an error that stops the wait
+type terminalError struct {
+	error
+}
+
+func (t terminalError) Unwrap() error { return t.error }
+
+// Terminal wraps an error that stops the wait, for example when a resource is in an error state
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return terminalError{err}
+}
+
+// IsTerminal returns true if the error stopped the wait
+func IsTerminal(err error) bool {
+	var t terminalError
+	return errors.As(err, &t)
+}
+
+// Waiter waits for resources by checking them at an interval for at most the timeout
+type Waiter struct {
+	clock    Clock
+	interval time.Duration
+	timeout  time.Duration
+	progress func(string)
+}
+
+type WaiterOption func(*Waiter)
+
+// New creates a waiter checking every 5 seconds for at most 5 minutes by default
+func New(opts ...WaiterOption) *Waiter {
+	w := &Waiter{
+		clock:    realClock{},
+		interval: 5 * time.Second,
+		timeout:  5 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// WithClock sets the clock of the waiter
+func WithClock(clock Clock) WaiterOption {
+	return func(w *Waiter) {
+		w.clock = clock
+	}
+}
+
+// WithInterval sets the time between checks
+func WithInterval(interval time.Duration) WaiterOption {
+	return func(w *Waiter) {
+		w.interval = interval
+	}
+}
+
+// WithTimeout sets the maximum duration of a wait
+func WithTimeout(timeout time.Duration) WaiterOption {
+	return func(w *Waiter) {
+		w.timeout = timeout
+	}
+}
+
+// Timeout returns the maximum duration of a wait
+func (w *Waiter) Timeout() time.Duration {
+	return w.timeout
+}
+
+// WithProgress returns a copy of the waiter that reports the transient errors of each check to progress
+func (w *Waiter) WithProgress(progress func(string)) *Waiter {
+	c := *w
+	c.progress = progress
+	return &c
+}
+
+// Wait checks until the check returns true or a terminal error, the timeout passes or the context is done.  A
+// timeout returns an error wrapping ErrTimeout with the last transient error.
+func (w *Waiter) Wait(ctx context.Context, check Check) error {
+	deadline := w.clock.Now().Add(w.timeout)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done, err := check(ctx)
+		if done {
+			return nil
+		}
+
+		if err != nil {
+			if IsTerminal(err) {
+				return err
+			}
+
+			// the check failed because the context is done
+			if cerr := ctx.Err(); cerr != nil {
+				return cerr
+			}
+
+			if w.progress != nil {
+				w.progress(err.Error())
+			}
+		}
+
+		remaining := deadline.Sub(w.clock.Now())
+		if remaining <= 0 {
+			if err != nil {
+				return fmt.Errorf("%w after %s: %s", ErrTimeout, w.timeout, err)
+			}
+			return fmt.Errorf("%w after %s", ErrTimeout, w.timeout)
+		}
+
+		sleep := w.interval
+		if sleep > remaining {
+			sleep = remaining
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.clock.After(sleep):
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package waiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances its time by the duration passed to After instead of sleeping
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	f.sleeps = append(f.sleeps, d)
+
+	c := make(chan time.Time, 1)
+	c <- f.now
+	return c
+}
+
+func TestWait(t *testing.T) {
+	clock := newFakeClock()
+	w := New(WithClock(clock), WithInterval(2*time.Second), WithTimeout(time.Minute))
+
+	checks := 0
+	messages := []string{}
+	err := w.WithProgress(func(msg string) { messages = append(messages, msg) }).Wait(context.TODO(), func(ctx context.Context) (bool, error) {
+		checks++
+		if checks < 3 {
+			return false, errors.New("creating")
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if checks != 3 {
+		t.Errorf("expected 3 checks, got %d", checks)
+	}
+
+	if len(clock.sleeps) != 2 || clock.sleeps[0] != 2*time.Second || clock.sleeps[1] != 2*time.Second {
+		t.Errorf("expected 2 sleeps of 2s, got %v", clock.sleeps)
+	}
+
+	if len(messages) != 2 || messages[0] != "creating" {
+		t.Errorf("expected the transient errors to be reported, got %v", messages)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	clock := newFakeClock()
+	w := New(WithClock(clock), WithInterval(4*time.Second), WithTimeout(10*time.Second))
+
+	checks := 0
+	err := w.Wait(context.TODO(), func(ctx context.Context) (bool, error) {
+		checks++
+		return false, errors.New("still creating")
+	})
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	if expected := "timeout waiting after 10s: still creating"; err.Error() != expected {
+		t.Errorf("expected error %s, got %s", expected, err)
+	}
+
+	// the last sleep is cut short so the wait takes exactly the timeout
+	if checks != 4 {
+		t.Errorf("expected 4 checks, got %d", checks)
+	}
+
+	if elapsed := clock.Now().Sub(newFakeClock().now); elapsed != 10*time.Second {
+		t.Errorf("expected the wait to take 10s, took %s", elapsed)
+	}
+}
+
+func TestWaitTerminal(t *testing.T) {
+	w := New(WithClock(newFakeClock()))
+
+	boom := errors.New("filesystem is in the error state")
+
+	checks := 0
+	err := w.Wait(context.TODO(), func(ctx context.Context) (bool, error) {
+		checks++
+		return false, Terminal(boom)
+	})
+
+	if !errors.Is(err, boom) || !IsTerminal(err) {
+		t.Fatalf("expected terminal error, got %v", err)
+	}
+
+	if checks != 1 {
+		t.Errorf("expected a single check, got %d", checks)
+	}
+
+	if Terminal(nil) != nil {
+		t.Error("expected terminal nil error to be nil")
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	w := New(WithClock(newFakeClock()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	checks := 0
+	err := w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		checks++
+		cancel()
+		return false, errors.New("request cancelled")
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+
+	if checks != 1 {
+		t.Errorf("expected a single check, got %d", checks)
+	}
+
+	// a cancelled context isn't checked at all
+	if err := w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		t.Error("expected no check with a cancelled context")
+		return true, nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled error, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+// Package webhook posts signed notifications to webhooks when asynchronous tasks finish
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SignatureHeader is the header carrying the signature of the notification body
+const SignatureHeader = "X-Webhook-Signature"
+
+// Payload is the notification posted to webhooks when an asynchronous task finishes
+type Payload struct {
+	TaskID       string    `json:"taskId"`
+	Operation    string    `json:"operation"`
+	Account      string    `json:"account"`
+	Group        string    `json:"group,omitempty"`
+	FileSystemID string    `json:"fileSystemId,omitempty"`
+	RequestID    string    `json:"requestId,omitempty"`
+	Status       string    `json:"status"`
+	Failure      string    `json:"failure,omitempty"`
+	Events       []string  `json:"events,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// Sign returns the signature of the body, the hex encoded HMAC-SHA256 of the body with the secret prefixed
+// with "sha256="
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature is a valid signature of the body with the secret
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Notifier posts signed notifications to webhooks in the background, retrying failed deliveries with
+// exponential backoff
+type Notifier struct {
+	allowedIP      func(net.IP) bool
+	backoff        time.Duration
+	callbackClient *http.Client
+	cancel         context.CancelFunc
+	client         *http.Client
+	closed         bool
+	closeTimeout   time.Duration
+	ctx            context.Context
+	mu             sync.Mutex
+	retries        int
+	secret         []byte
+	wg             sync.WaitGroup
+}
+
+type NotifierOption func(*Notifier)
+
+// New creates a notifier signing notifications with the secret
+func New(secret string, opts ...NotifierOption) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		backoff: 1 * time.Second,
+		cancel:  cancel,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// redirects aren't followed so a notification can't be sent to another host
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		closeTimeout: 30 * time.Second,
+		ctx:          ctx,
+		retries:      5,
+		secret:       []byte(secret),
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.callbackClient = n.client
+	if n.allowedIP != nil {
+		n.callbackClient = &http.Client{
+			Timeout:       n.client.Timeout,
+			CheckRedirect: n.client.CheckRedirect,
+			Transport:     restrictedTransport(n.allowedIP),
+		}
+	}
+
+	return n
+}
+
+// restrictedTransport returns a transport that refuses to connect to addresses that aren't allowed.  The
+// address is checked when the connection is dialed, after the host is resolved, so a callback host can't be
+// rebound to another address between its validation and the delivery.  Proxies are not used since the
+// check would apply to the proxy instead of the callback host.
+func restrictedTransport(allowed func(net.IP) bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("connecting to the address %s is not allowed", host)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// WithRetries sets the number of times a failed delivery is retried
+func WithRetries(retries int) NotifierOption {
+	return func(n *Notifier) {
+		log.Debugf("setting webhook retries to %d", retries)
+		n.retries = retries
+	}
+}
+
+// WithBackoff sets the wait before the first retry, it's doubled for each following retry
+func WithBackoff(backoff time.Duration) NotifierOption {
+	return func(n *Notifier) {
+		log.Debugf("setting webhook backoff to %s", backoff.String())
+		n.backoff = backoff
+	}
+}
+
+// WithCloseTimeout sets how long closing the notifier waits for pending deliveries before cancelling them
+func WithCloseTimeout(timeout time.Duration) NotifierOption {
+	return func(n *Notifier) {
+		log.Debugf("setting webhook close timeout to %s", timeout.String())
+		n.closeTimeout = timeout
+	}
+}
+
+// WithTimeout sets the timeout for each delivery attempt
+func WithTimeout(timeout time.Duration) NotifierOption {
+	return func(n *Notifier) {
+		log.Debugf("setting webhook timeout to %s", timeout.String())
+		n.client.Timeout = timeout
+	}
+}
+
+// WithAllowedIP sets the check for the addresses callbacks may be delivered to, it's applied to each
+// connection when it's dialed
+func WithAllowedIP(allowed func(net.IP) bool) NotifierOption {
+	return func(n *Notifier) {
+		log.Debug("setting webhook callback address check")
+		n.allowedIP = allowed
+	}
+}
+
+// Notify posts the payload to each of the urls in the background.  Notifications are dropped once the
+// notifier is closing.
+func (n *Notifier) Notify(urls []string, payload *Payload) {
+	if n == nil {
+		return
+	}
+
+	n.notify(n.client, urls, payload)
+}
+
+// NotifyCallbacks posts the payload to each of the callback urls in the background, only connecting to
+// addresses allowed by the notifier's address check
+func (n *Notifier) NotifyCallbacks(urls []string, payload *Payload) {
+	if n == nil {
+		return
+	}
+
+	n.notify(n.callbackClient, urls, payload)
+}
+
+// notify posts the payload to each of the urls in the background with the client
+func (n *Notifier) notify(client *http.Client, urls []string, payload *Payload) {
+	if len(urls) == 0 {
+		return
+	}
+
+	if payload.Time.IsZero() {
+		payload.Time = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Errorf("failed to marshal webhook payload for task %s: %s", payload.TaskID, err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		log.Warnf("webhook notifier is closed, dropping notification for task %s", payload.TaskID)
+		return
+	}
+
+	for _, u := range urls {
+		n.wg.Add(1)
+		go func(u string) {
+			defer n.wg.Done()
+
+			if err := n.deliver(n.ctx, client, u, body); err != nil {
+				log.Errorf("failed to notify webhook %s for task %s: %s", u, payload.TaskID, err)
+				return
+			}
+
+			log.Infof("notified webhook %s for task %s", u, payload.TaskID)
+		}(u)
+	}
+}
+
+// Close stops accepting notifications and waits up to the close timeout for the pending deliveries, then
+// cancels the remaining ones
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(n.closeTimeout):
+		log.Warnf("timed out waiting for webhook deliveries, cancelling them")
+		n.cancel()
+		<-done
+	}
+
+	n.cancel()
+}
+
+// deliver posts the body to the url, retrying network errors, timeouts, throttling and server errors
+func (n *Notifier) deliver(ctx context.Context, client *http.Client, url string, body []byte) error {
+	backoff := n.backoff
+
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			// add some randomness so retries from many tasks don't line up
+			wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+			log.Debugf("retrying webhook %s in %s: %s", url, wait.String(), err)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		if retry, err = n.post(ctx, client, url, body); err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// post posts the signed body to the url, returning whether a failed post should be retried
+func (n *Notifier) post(ctx context.Context, client *http.Client, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(n.secret, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected webhook response status %d", res.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected webhook response status %d", res.StatusCode)
+	}
+}
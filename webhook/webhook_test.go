@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '{"taskId":"123"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=4fbb45f03cd0aba842e3665aa33811cbcc671592e56404b15774ff81d4073883"
+	body := []byte(`{"taskId":"123"}`)
+
+	sig := Sign([]byte("secret"), body)
+	if sig != expected {
+		t.Errorf("expected signature %s, got %s", expected, sig)
+	}
+
+	if !Verify([]byte("secret"), body, sig) {
+		t.Error("expected signature to verify")
+	}
+
+	if Verify([]byte("other"), body, sig) || Verify([]byte("secret"), []byte(`{"taskId":"456"}`), sig) {
+		t.Error("expected signature not to verify with another secret or body")
+	}
+}
+
+type testWebhook struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	bodies   [][]byte
+	valid    bool
+}
+
+func (w *testWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	w.bodies = append(w.bodies, body)
+	w.valid = Verify([]byte("secret"), body, r.Header.Get(SignatureHeader))
+
+	status := http.StatusOK
+	if w.requests < len(w.statuses) {
+		status = w.statuses[w.requests]
+	}
+	w.requests++
+
+	rw.WriteHeader(status)
+}
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+	}{
+		{name: "success", statuses: []int{http.StatusNoContent}, requests: 1},
+		{name: "retried", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, requests: 3},
+		{name: "client error", statuses: []int{http.StatusNotFound}, requests: 1},
+		{name: "retries exhausted", statuses: []int{500, 500, 500, 500}, requests: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hook := &testWebhook{statuses: test.statuses}
+			ts := httptest.NewServer(hook)
+			defer ts.Close()
+
+			n := New("secret", WithRetries(2), WithBackoff(time.Millisecond), WithTimeout(time.Second))
+			n.Notify([]string{ts.URL}, &Payload{TaskID: "task-1", Operation: "filesystemCreate", Status: "completed", Events: []string{"done"}})
+			n.Close()
+
+			if hook.requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, hook.requests)
+			}
+
+			if !hook.valid {
+				t.Error("expected a valid signature")
+			}
+
+			payload := Payload{}
+			if err := json.Unmarshal(hook.bodies[0], &payload); err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.TaskID != "task-1" || payload.Status != "completed" || payload.Time.IsZero() || len(payload.Events) != 1 {
+				t.Errorf("unexpected payload %+v", payload)
+			}
+		})
+	}
+
+	// a nil notifier is a no-op
+	var n *Notifier
+	n.Notify([]string{"http://localhost"}, &Payload{})
+	n.Close()
+}
+
+func TestNotifyRedirect(t *testing.T) {
+	target := &testWebhook{}
+	ts := httptest.NewServer(target)
+	defer ts.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(ts.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	n := New("secret", WithRetries(2), WithBackoff(time.Millisecond))
+	n.Notify([]string{redirect.URL}, &Payload{TaskID: "task-1"})
+	n.Close()
+
+	if target.requests != 0 {
+		t.Errorf("expected the redirect not to be followed, got %d requests", target.requests)
+	}
+}
+
+func TestNotifyCallbacks(t *testing.T) {
+	hook := &testWebhook{}
+	ts := httptest.NewServer(hook)
+	defer ts.Close()
+
+	// the test server listens on a loopback address
+	denyLoopback := WithAllowedIP(func(ip net.IP) bool { return !ip.IsLoopback() })
+
+	n := New("secret", WithRetries(1), WithBackoff(time.Millisecond), denyLoopback)
+	n.NotifyCallbacks([]string{ts.URL}, &Payload{TaskID: "task-1"})
+	n.Close()
+
+	if hook.requests != 0 {
+		t.Errorf("expected the callback to a disallowed address not to be delivered, got %d requests", hook.requests)
+	}
+
+	// the configured webhooks aren't restricted
+	n = New("secret", WithRetries(1), WithBackoff(time.Millisecond), denyLoopback)
+	n.Notify([]string{ts.URL}, &Payload{TaskID: "task-1"})
+	n.Close()
+
+	if hook.requests != 1 {
+		t.Errorf("expected the webhook to be notified, got %d requests", hook.requests)
+	}
+
+	// callbacks to allowed addresses are delivered
+	n = New("secret", WithRetries(1), WithBackoff(time.Millisecond), WithAllowedIP(func(net.IP) bool { return true }))
+	n.NotifyCallbacks([]string{ts.URL}, &Payload{TaskID: "task-1"})
+	n.Close()
+
+	if hook.requests != 2 {
+		t.Errorf("expected the callback to be notified, got %d requests", hook.requests)
+	}
+}
+
+func TestNotifierClose(t *testing.T) {
+	hook := &testWebhook{statuses: []int{500, 500, 500}}
+	ts := httptest.NewServer(hook)
+	defer ts.Close()
+
+	// the pending delivery is cancelled while it waits to be retried
+	n := New("secret", WithRetries(3), WithBackoff(time.Hour), WithCloseTimeout(10*time.Millisecond))
+	n.Notify([]string{ts.URL}, &Payload{TaskID: "task-1"})
+
+	closed := make(chan struct{})
+	go func() {
+		n.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out closing the notifier")
+	}
+
+	// notifications are dropped once the notifier is closed
+	n.Notify([]string{ts.URL}, &Payload{TaskID: "task-2"})
+	n.Close()
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+
+	if hook.requests != 1 {
+		t.Errorf("expected 1 request, got %d", hook.requests)
+	}
+}